@@ -0,0 +1,467 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/utils/arch"
+	"github.com/juju/utils/series"
+	"github.com/juju/version"
+	"github.com/kardianos/osext"
+
+	"github.com/juju/1.25-upgrade/juju2/service"
+	"github.com/juju/1.25-upgrade/juju2/service/common"
+)
+
+// The actions agent-service-impl can take on the agent services.
+const (
+	serviceStatusAction  = "status"
+	serviceStartAction   = "start"
+	serviceStopAction    = "stop"
+	serviceRewriteAction = "rewrite"
+)
+
+// The statuses reported for an agent service.
+const (
+	serviceRunning      = "running"
+	serviceStopped      = "stopped"
+	serviceNotInstalled = "not installed"
+	serviceError        = "error"
+)
+
+// The directories the agents on a machine use.
+const (
+	agentDataDir = "/var/lib/juju"
+	agentLogDir  = "/var/log/juju"
+)
+
+var agentServiceImplDoc = `
+
+agent-service-impl must be executed on a machine of a 1.25 environment. It
+is copied to the machines, and run, by the agent-status-impl,
+start-agents-impl, stop-agents-impl and upgrade-agents-impl commands.
+
+The command detects the init system the machine uses, and then checks,
+starts or stops the service for each of the agents on the machine, or
+rewrites the service definitions for the 2.x agents. The results are
+written to stdout as JSON.
+
+`
+
+func newAgentServiceImplCommand() cmd.Command {
+	return &agentServiceImplCommand{}
+}
+
+type agentServiceImplCommand struct {
+	cmd.CommandBase
+
+	action string
+}
+
+func (c *agentServiceImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "agent-service-impl",
+		Args:    "status|start|stop|rewrite",
+		Purpose: "machine aspect of agent-status, start-agents, stop-agents and upgrade-agents",
+		Doc:     agentServiceImplDoc,
+	}
+}
+
+func (c *agentServiceImplCommand) Init(args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing action")
+	}
+	switch args[0] {
+	case serviceStatusAction, serviceStartAction, serviceStopAction, serviceRewriteAction:
+	default:
+		return errors.NotValidf("action %q", args[0])
+	}
+	c.action = args[0]
+	return cmd.CheckEmpty(args[1:])
+}
+
+func (c *agentServiceImplCommand) Run(ctx *cmd.Context) error {
+	hostSeries, err := series.HostSeries()
+	if err != nil {
+		return errors.Annotate(err, "getting host series")
+	}
+	initSystem, err := service.DiscoverInitSystem(hostSeries)
+	if err != nil {
+		return errors.Annotate(err, "discovering init system")
+	}
+	manager := agentServiceManager{
+		dataDir:    agentDataDir,
+		logDir:     agentLogDir,
+		initSystem: initSystem,
+		newService: func(name string) (service.Service, error) {
+			return service.DiscoverService(name, common.Conf{})
+		},
+	}
+	agents, err := manager.act(c.action)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if c.action == serviceRewriteAction && initSystem == service.InitSystemSystemd {
+		if out, err := exec.Command("systemctl", "daemon-reload").CombinedOutput(); err != nil {
+			return errors.Annotatef(err, "reloading systemd: %s", out)
+		}
+	}
+	return json.NewEncoder(ctx.Stdout).Encode(agentServiceResults{
+		InitSystem: initSystem,
+		Agents:     agents,
+	})
+}
+
+// agentServiceResults holds the results from agent-service-impl for one
+// machine.
+type agentServiceResults struct {
+	InitSystem string               `json:"init-system"`
+	Agents     []agentServiceResult `json:"agents"`
+}
+
+// agentServiceResult holds the result of acting on one agent's service.
+type agentServiceResult struct {
+	Agent   string `json:"agent"`
+	Service string `json:"service"`
+	Status  string `json:"status"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// agentServiceManager acts on the services of the agents on a machine.
+type agentServiceManager struct {
+	dataDir    string
+	logDir     string
+	initSystem string
+	newService func(name string) (service.Service, error)
+}
+
+// act takes the action on the service of each agent on the machine,
+// returning the status of each service afterwards. Failures to act on a
+// service are recorded in its result, rather than stopping the other
+// agents from being acted upon.
+func (m agentServiceManager) act(action string) ([]agentServiceResult, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(m.dataDir, "agents"))
+	if err != nil {
+		return nil, errors.Annotate(err, "listing agents")
+	}
+	var results []agentServiceResult
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		agent := entry.Name()
+		result := agentServiceResult{
+			Agent:   agent,
+			Service: "jujud-" + agent,
+			Version: agentToolsVersion(m.dataDir, agent),
+		}
+		status, err := m.actOn(agent, result.Service, action)
+		if err != nil {
+			result.Status = serviceError
+			result.Error = err.Error()
+		} else {
+			result.Status = status
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// actOn takes the action on the named service of the agent, and returns
+// its status.
+func (m agentServiceManager) actOn(agent, name, action string) (string, error) {
+	svc, err := m.newService(name)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	installed, err := svc.Installed()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if !installed {
+		return serviceNotInstalled, nil
+	}
+	switch action {
+	case serviceStartAction:
+		err = svc.Start()
+	case serviceStopAction:
+		err = svc.Stop()
+	case serviceRewriteAction:
+		err = m.rewrite(svc, agent)
+	}
+	if err != nil {
+		return "", errors.Annotatef(err, "%s %s", action, name)
+	}
+	running, err := svc.Running()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if running {
+		return serviceRunning, nil
+	}
+	return serviceStopped, nil
+}
+
+// rewrite replaces the definition of the agent's service with the one
+// used by 2.x. The agent must be stopped first.
+func (m agentServiceManager) rewrite(svc service.Service, agent string) error {
+	running, err := svc.Running()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if running {
+		return errors.New("agent is running, stop it first")
+	}
+	files, err := agentServiceFiles(m.initSystem, agent, m.dataDir, m.logDir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(writeServiceFiles(files))
+}
+
+// agentToolsVersion returns the version of the tools the agent is set to
+// use, from the agent's tools symlink in dataDir.
+func agentToolsVersion(dataDir, agent string) string {
+	target, err := os.Readlink(filepath.Join(dataDir, "tools", agent))
+	if err != nil {
+		logger.Debugf("reading tools link for %s: %v", agent, err)
+		return "unknown"
+	}
+	return filepath.Base(target)
+}
+
+// serviceCall makes sure the plugin is on each of the machines, and then
+// runs agent-service-impl on them to take the action on all the agent
+// services. The plugin copied is the one running on the API server, so
+// machines of a different architecture are refused.
+func serviceCall(ctx *cmd.Context, audit *auditor, machines []FlatMachine, action string) []DistResult {
+	plugin, err := osext.Executable()
+	if err != nil {
+		return serviceCallFailed(machines, errors.Annotate(err, "finding plugin location"))
+	}
+
+	var results []DistResult
+	var matching []FlatMachine
+	for _, machine := range machines {
+		if err := checkMachineArch(machine, arch.HostArch()); err != nil {
+			results = append(results, serviceCallFailed([]FlatMachine{machine}, err)...)
+			continue
+		}
+		matching = append(matching, machine)
+	}
+	copyResults := copyPluginToMachines(ctx, audit, plugin, matching)
+
+	var ready []FlatMachine
+	for _, machine := range matching {
+		if err := copyResults[machine.Model+"/"+machine.ID]; err != nil {
+			results = append(results, serviceCallFailed([]FlatMachine{machine}, err)...)
+			continue
+		}
+		ready = append(ready, machine)
+	}
+
+	script := fmt.Sprintf("%s agent-service-impl %s\n", remotePluginPath(plugin), action)
+	operation := "service " + action
+	progress := newProgressWriter(ctx.Stderr, operation)
+	return append(results, parallelCall(audit, progress, operation, ready, script)...)
+}
+
+// checkMachineArch returns an error unless the machine's agent binaries
+// are of the given architecture.
+func checkMachineArch(machine FlatMachine, hostArch string) error {
+	if machine.Tools == "" {
+		return errors.New("machine architecture not known, its agent has not reported its version")
+	}
+	tools, err := version.ParseBinary(machine.Tools)
+	if err != nil {
+		return errors.Annotate(err, "getting machine architecture")
+	}
+	if tools.Arch != hostArch {
+		return errors.Errorf("machine architecture %s does not match the API server (%s)", tools.Arch, hostArch)
+	}
+	return nil
+}
+
+func serviceCallFailed(machines []FlatMachine, err error) []DistResult {
+	var results []DistResult
+	for _, machine := range machines {
+		results = append(results, DistResult{
+			Model:     machine.Model,
+			Series:    machine.Series,
+			MachineID: machine.ID,
+			Error:     err,
+		})
+	}
+	return results
+}
+
+// copyPluginToMachines installs the plugin on each of the machines where
+// it is missing or out of date. It returns any error for each machine,
+// keyed by model and machine id.
+func copyPluginToMachines(ctx *cmd.Context, audit *auditor, plugin string, machines []FlatMachine) map[string]error {
+	errs := make(map[string]error)
+	local, err := localSHA256Sum(plugin)
+	if err != nil {
+		for _, machine := range machines {
+			errs[machine.Model+"/"+machine.ID] = errors.Annotate(err, "generating local sha256sum")
+		}
+		return errs
+	}
+
+	var outdated []FlatMachine
+	for _, r := range parallelCall(audit, nil, "check plugin", machines, pluginCheckScript(plugin)) {
+		if strings.TrimSpace(r.Stdout) == local {
+			continue
+		}
+		for _, machine := range machines {
+			if machine.Model == r.Model && machine.ID == r.MachineID {
+				outdated = append(outdated, machine)
+			}
+		}
+	}
+
+	if len(outdated) == 0 {
+		return errs
+	}
+
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+	)
+	operation := "copy plugin"
+	progress := newProgressWriter(ctx.Stderr, operation)
+	progress.begin(len(outdated))
+	for _, machine := range outdated {
+		wg.Add(1)
+		go func(machine FlatMachine) {
+			defer wg.Done()
+			progress.started(machine.ID)
+			err := copyPluginToMachine(plugin, local, machine)
+			progress.finished(machine.ID, 0, err)
+			auditData := map[string]interface{}{
+				"machine": machine.ID,
+				"address": machine.Address,
+			}
+			if err != nil {
+				auditData["error"] = err.Error()
+			}
+			audit.recordFor(machine.Model, operation, auditData)
+			lock.Lock()
+			defer lock.Unlock()
+			errs[machine.Model+"/"+machine.ID] = err
+		}(machine)
+	}
+	wg.Wait()
+	progress.end()
+	return errs
+}
+
+// copyPluginToMachine copies the plugin to the machine, and installs it
+// once its sum has been checked. As with runOnMachine, a container that
+// cannot be reached directly is copied to through the machine hosting it.
+func copyPluginToMachine(plugin, sum string, machine FlatMachine) error {
+	staging := pluginStagingPath(plugin)
+	options := newSSHOptions(systemIdentity, "")
+	err := copyViaSSH(plugin, staging, machine.Address, options)
+	if err == nil {
+		return errors.Trace(runInstallScript(machine.Address, pluginInstallScript(plugin, sum, ""), options))
+	}
+	if machine.ParentID == "" {
+		return errors.Annotate(err, "copying plugin to machine")
+	}
+	logger.Debugf("cannot copy to machine %s directly, trying through machine %s", machine.ID, machine.ParentID)
+	switch machine.ContainerType {
+	case "lxc":
+		// Copy the plugin to the host, and install it from there
+		// into the container's root filesystem.
+		if err := copyViaSSH(plugin, staging, machine.ParentAddress, options); err != nil {
+			return errors.Annotate(err, "copying plugin to container host")
+		}
+		root := fmt.Sprintf("/var/lib/lxc/%s/rootfs", machine.InstanceID)
+		err := runInstallScript(machine.ParentAddress, pluginInstallScript(plugin, sum, root), options)
+		return errors.Annotate(err, "installing plugin into container")
+	case "kvm":
+		options := newSSHOptions(systemIdentity, machine.ParentAddress)
+		if err := copyViaSSH(plugin, staging, machine.Address, options); err != nil {
+			return errors.Annotate(err, "copying plugin to machine")
+		}
+		return errors.Trace(runInstallScript(machine.Address, pluginInstallScript(plugin, sum, ""), options))
+	}
+	return errors.Annotate(err, "copying plugin to machine")
+}
+
+// statusResult holds the status of an agent's service.
+type statusResult struct {
+	machine    string
+	agent      string
+	initSystem string
+	status     string
+	version    string
+	err        string
+}
+
+// parseStatus reads the results written by agent-service-impl on each
+// machine.
+func parseStatus(results []DistResult) []statusResult {
+	var statuses []statusResult
+	for _, r := range results {
+		if r.Error != nil || r.Code != 0 {
+			err := fmt.Sprintf("exit code %d", r.Code)
+			if r.Error != nil {
+				err = r.Error.Error()
+			}
+			logger.Warningf("machine: %s rc: %d\nstdout:%s\nstderr:%s", r.MachineID, r.Code, r.Stdout, r.Stderr)
+			statuses = append(statuses, statusResult{
+				machine: r.MachineID,
+				status:  serviceError,
+				err:     err,
+			})
+			continue
+		}
+		var machineResults agentServiceResults
+		if err := json.Unmarshal([]byte(r.Stdout), &machineResults); err != nil {
+			statuses = append(statuses, statusResult{
+				machine: r.MachineID,
+				status:  serviceError,
+				err:     fmt.Sprintf("cannot read results: %v", err),
+			})
+			continue
+		}
+		for _, agent := range machineResults.Agents {
+			statuses = append(statuses, statusResult{
+				machine:    r.MachineID,
+				agent:      agent.Agent,
+				initSystem: machineResults.InitSystem,
+				status:     agent.Status,
+				version:    agent.Version,
+				err:        agent.Error,
+			})
+		}
+	}
+	sort.Sort(statusResults(statuses))
+	return statuses
+}
+
+type statusResults []statusResult
+
+func (r statusResults) Len() int { return len(r) }
+func (r statusResults) Less(i, j int) bool {
+	if r[i].machine != r[j].machine {
+		return r[i].machine < r[j].machine
+	}
+	return r[i].agent < r[j].agent
+}
+func (r statusResults) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
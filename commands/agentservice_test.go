@@ -0,0 +1,158 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/service"
+	"github.com/juju/1.25-upgrade/juju2/service/common"
+)
+
+type agentServiceSuite struct{}
+
+var _ = gc.Suite(&agentServiceSuite{})
+
+func (*agentServiceSuite) TestAgentServices(c *gc.C) {
+	dataDir := c.MkDir()
+	for _, agent := range []string{"machine-1", "unit-mysql-0", "unit-nrpe-0"} {
+		err := os.MkdirAll(filepath.Join(dataDir, "agents", agent), 0755)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	err := os.MkdirAll(filepath.Join(dataDir, "tools"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	err = os.Symlink("1.25.6-trusty-amd64", filepath.Join(dataDir, "tools", "machine-1"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	services := map[string]*fakeService{
+		"jujud-machine-1":    {name: "jujud-machine-1", installed: true, running: true},
+		"jujud-unit-mysql-0": {name: "jujud-unit-mysql-0", installed: true, running: true, stopErr: errors.New("boom")},
+		"jujud-unit-nrpe-0":  {name: "jujud-unit-nrpe-0"},
+	}
+	manager := agentServiceManager{
+		dataDir:    dataDir,
+		logDir:     c.MkDir(),
+		initSystem: service.InitSystemUpstart,
+		newService: func(name string) (service.Service, error) {
+			return services[name], nil
+		},
+	}
+	results, err := manager.act(serviceStopAction)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(results, jc.DeepEquals, []agentServiceResult{{
+		Agent:   "machine-1",
+		Service: "jujud-machine-1",
+		Status:  serviceStopped,
+		Version: "1.25.6-trusty-amd64",
+	}, {
+		Agent:   "unit-mysql-0",
+		Service: "jujud-unit-mysql-0",
+		Status:  serviceError,
+		Version: "unknown",
+		Error:   "stop jujud-unit-mysql-0: boom",
+	}, {
+		Agent:   "unit-nrpe-0",
+		Service: "jujud-unit-nrpe-0",
+		Status:  serviceNotInstalled,
+		Version: "unknown",
+	}})
+}
+
+func (*agentServiceSuite) TestRewriteRunningAgent(c *gc.C) {
+	manager := agentServiceManager{
+		initSystem: service.InitSystemSystemd,
+		newService: func(name string) (service.Service, error) {
+			return &fakeService{name: name, installed: true, running: true}, nil
+		},
+	}
+	_, err := manager.actOn("machine-0", "jujud-machine-0", serviceRewriteAction)
+	c.Assert(err, gc.ErrorMatches, "rewrite jujud-machine-0: agent is running, stop it first")
+}
+
+func (*agentServiceSuite) TestParseStatus(c *gc.C) {
+	results := []DistResult{{
+		MachineID: "1",
+		Stdout:    `{"init-system":"systemd","agents":[{"agent":"unit-mysql-0","service":"jujud-unit-mysql-0","status":"running","version":"2.2.2-xenial-amd64"}]}`,
+	}, {
+		MachineID: "0",
+		Stdout:    `{"init-system":"upstart","agents":[{"agent":"machine-0","service":"jujud-machine-0","status":"stopped","version":"1.25.6-trusty-amd64"}]}`,
+	}, {
+		MachineID: "2",
+		Code:      1,
+	}}
+	c.Assert(parseStatus(results), jc.DeepEquals, []statusResult{{
+		machine:    "0",
+		agent:      "machine-0",
+		initSystem: "upstart",
+		status:     serviceStopped,
+		version:    "1.25.6-trusty-amd64",
+	}, {
+		machine:    "1",
+		agent:      "unit-mysql-0",
+		initSystem: "systemd",
+		status:     serviceRunning,
+		version:    "2.2.2-xenial-amd64",
+	}, {
+		machine: "2",
+		status:  serviceError,
+		err:     "exit code 1",
+	}})
+}
+
+func (*agentServiceSuite) TestCheckMachineArch(c *gc.C) {
+	machine := FlatMachine{ID: "0", Tools: "1.25.10-trusty-amd64"}
+	c.Check(checkMachineArch(machine, "amd64"), jc.ErrorIsNil)
+	c.Check(checkMachineArch(machine, "arm64"), gc.ErrorMatches,
+		`machine architecture amd64 does not match the API server \(arm64\)`)
+
+	machine.Tools = "1.25.10-xenial-ppc64el"
+	c.Check(checkMachineArch(machine, "amd64"), gc.ErrorMatches,
+		`machine architecture ppc64el does not match the API server \(amd64\)`)
+
+	machine.Tools = ""
+	c.Check(checkMachineArch(machine, "amd64"), gc.ErrorMatches,
+		"machine architecture not known, its agent has not reported its version")
+}
+
+func (*agentServiceSuite) TestFailedMachines(c *gc.C) {
+	failed := []statusResult{
+		{machine: "2", agent: "unit-mysql-0", err: "boom"},
+		{machine: "0", err: "exit code 1"},
+		{machine: "2", agent: "machine-2", err: "boom"},
+	}
+	c.Assert(failedMachines(failed), jc.DeepEquals, []string{"0", "2"})
+}
+
+// fakeService is a service.Service that records whether it is running.
+type fakeService struct {
+	service.Service
+
+	name      string
+	installed bool
+	running   bool
+	stopErr   error
+}
+
+func (s *fakeService) Name() string             { return s.name }
+func (s *fakeService) Conf() common.Conf        { return common.Conf{} }
+func (s *fakeService) Installed() (bool, error) { return s.installed, nil }
+func (s *fakeService) Running() (bool, error)   { return s.running, nil }
+
+func (s *fakeService) Start() error {
+	s.running = true
+	return nil
+}
+
+func (s *fakeService) Stop() error {
+	if s.stopErr != nil {
+		return s.stopErr
+	}
+	s.running = false
+	return nil
+}
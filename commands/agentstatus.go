@@ -4,12 +4,6 @@
 package commands
 
 import (
-	"fmt"
-	"path"
-	"regexp"
-	"sort"
-	"strings"
-
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
 
@@ -23,10 +17,18 @@ agents of a 1.25 environment. The agents may be running the 1.25 binary, or a
 2.x binary. The command will return the status of the agent, and what tools
 they are currently set to use.
 
+The init system used by each machine is detected on the machine itself, so
+environments with a mix of upstart and systemd machines are supported.
+
+The --machines, --services and --exclude flags may be used to restrict the
+command to a subset of the machines in the environment. Containers are
+selected or excluded along with their host machine.
+
 `
 
 func newAgentStatusCommand() cmd.Command {
 	command := &agentStatusCommand{}
+	command.selectable = true
 	command.remoteCommand = "agent-status-impl"
 	return wrap(command)
 }
@@ -59,12 +61,14 @@ environment.
 
 The command will get a list of all the machines, and their addresses, and then
 ssh to all the machines to check on the status of the various agents on those
-machines.
+machines, using agent-service-impl.
 
 `
 
 func newAgentStatusImplCommand() cmd.Command {
-	return &agentStatusImplCommand{}
+	command := &agentStatusImplCommand{}
+	command.selectable = true
+	return command
 }
 
 type agentStatusImplCommand struct {
@@ -80,144 +84,83 @@ func (c *agentStatusImplCommand) Info() *cmd.Info {
 }
 
 func (c *agentStatusImplCommand) Run(ctx *cmd.Context) error {
-	st, err := c.getState(ctx)
+	states, err := c.getStates(ctx)
 	if err != nil {
 		return errors.Annotate(err, "getting state")
 	}
-	defer st.Close()
+	defer closeStates(states)
 
 	// Here we always use the 1.25 environment to get all of the machine
 	// addresses. We then use those to ssh into every one of those machine
 	// and run the service status script against all the agents.
-	machines, err := getMachines(st)
+	machines, err := c.selector.selectMachines(states)
 	if err != nil {
 		return errors.Annotate(err, "unable to get addresses for machines")
 	}
 
+	audit := c.startAudit(ctx, states, c.Info().Name)
+
 	// The information is then gathered and parsed and formatted here before
 	// the data is passed back to the caller.
-	serviceStatus(ctx, machines)
+	serviceStatus(ctx, audit, machines)
 
 	return nil
 }
 
-func serviceStatus(ctx *cmd.Context, machines []FlatMachine) {
-	results := serviceCall(machines, "status")
+func serviceStatus(ctx *cmd.Context, audit *auditor, machines []FlatMachine) {
+	results := serviceCall(ctx, audit, machines, serviceStatusAction)
 	values := parseStatus(results)
 	writer := output.TabWriter(ctx.Stdout)
 	wrapper := output.Wrapper{writer}
-	wrapper.Println("AGENT", "STATUS", "VERSION")
+	wrapper.Println("MACHINE", "AGENT", "INIT", "STATUS", "VERSION", "MESSAGE")
 	for _, v := range values {
-		wrapper.Println(v.agent, v.status, v.version)
+		wrapper.Println(v.machine, v.agent, v.initSystem, v.status, v.version, v.err)
 	}
 	writer.Flush()
 }
 
-type statusResult struct {
-	agent   string
-	status  string
-	version string
-}
-
-func parseStatus(status []DistResult) []statusResult {
-	var results []statusResult
-
-	for _, r := range status {
-		agents := strings.Split(r.Stdout, "-- end-of-agent --\n")
-		for _, agent := range agents[:len(agents)-1] {
-			var result statusResult
-			parts := strings.SplitN(agent, "\n", 3)
-			result.agent = parts[0]
-			lsParts := strings.Split(parts[1], " ")
-			toolsPath := lsParts[len(lsParts)-1]
-			result.version = path.Base(toolsPath)
-			switch r.Series {
-			case "trusty":
-				result.status = upstartStatus(parts[2])
-			default:
-				result.status = systemdStatus(parts[2])
-			}
-			logger.Debugf("%#v", result)
-			results = append(results, result)
-		}
-	}
-
-	sort.Sort(statusResults(results))
-	return results
-}
-
-type statusResults []statusResult
-
-func (r statusResults) Len() int           { return len(r) }
-func (r statusResults) Less(i, j int) bool { return r[i].agent < r[j].agent }
-func (r statusResults) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
-
-var upstartRegexp = regexp.MustCompile(`jujud-[\w-]+ ([\w/]+)`)
-
-func upstartStatus(output string) string {
-	matches := upstartRegexp.FindStringSubmatch(output)
-	switch len(matches) {
-	case 2:
-		return matches[1]
-	default:
-		logger.Warningf("unable to determine status from:\n%s", output)
-		return "unknown"
-	}
-}
-
-var systemdRegexp = regexp.MustCompile(`Active: (\w+ \(\w+\))`)
-
-func systemdStatus(output string) string {
-	matches := systemdRegexp.FindStringSubmatch(output)
-	switch len(matches) {
-	case 2:
-		return matches[1]
-	default:
-		logger.Warningf("unable to determine status from:\n%s", output)
-		return "unknown"
-	}
-}
-
-func serviceCall(machines []FlatMachine, command string) []DistResult {
-
-	script := fmt.Sprintf(`
-set -xu
-cd /var/lib/juju/agents
-for agent in *
-do
-	echo $agent
-	ls -al /var/lib/juju/tools/$agent
-	sudo service jujud-$agent %s
-	echo "-- end-of-agent --"
-done
-	`, command)
-
-	return parallelCall(machines, script)
-}
-
 func getMachines(st *state.State) ([]FlatMachine, error) {
 	machines, err := st.AllMachines()
 	if err != nil {
 		return nil, errors.Annotate(err, "getting 1.25 machines")
 	}
 	var result []FlatMachine
-	for i, m := range machines {
+	addresses := make(map[string]string)
+	for _, m := range machines {
 		address, err := getMachineAddress(m)
 		if err != nil {
 			return nil, errors.Annotatef(err, "address for machine %q", m.Id())
 		}
+		addresses[m.Id()] = address
 		fm := FlatMachine{
-			Model:   st.EnvironUUID(),
-			Series:  m.Series(),
-			ID:      m.Id(),
-			Address: address,
+			Model:      st.EnvironUUID(),
+			Series:     m.Series(),
+			ID:         m.Id(),
+			Address:    address,
+			Controller: m.IsManager(),
 		}
 		if tools, err := m.AgentTools(); err == nil {
 			fm.Tools = tools.Version.String()
 		}
-		logger.Debugf("%d: %#v", i, fm)
+		if parentID, ok := m.ParentId(); ok {
+			instanceID, err := m.InstanceId()
+			if err != nil {
+				return nil, errors.Annotatef(err, "instance id for machine %q", m.Id())
+			}
+			fm.ParentID = parentID
+			fm.ContainerType = string(m.ContainerType())
+			fm.InstanceID = string(instanceID)
+		}
 		result = append(result, fm)
 	}
+	// The parent addresses are filled in once all the machines are
+	// known, as a container may be listed before its host.
+	for i, fm := range result {
+		if fm.ParentID != "" {
+			result[i].ParentAddress = addresses[fm.ParentID]
+		}
+		logger.Debugf("%d: %#v", i, result[i])
+	}
 	return result, nil
 }
 
@@ -0,0 +1,214 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/juju/1.25-upgrade/juju1/juju/osenv"
+	"github.com/juju/1.25-upgrade/juju2/audit"
+)
+
+const (
+	// remoteAuditLogDir is where the audit log is kept on the 1.25
+	// API server.
+	remoteAuditLogDir = "/var/log/juju-1.25-upgrade"
+
+	// auditCopyPrefix marks the lines of the remote command's stderr
+	// that hold copies of its audit entries, for the client to record.
+	auditCopyPrefix = "audit-entry: "
+)
+
+// clientAuditLogDir returns where the audit log is kept on the client.
+func clientAuditLogDir() string {
+	return osenv.JujuHomePath("1.25-upgrade")
+}
+
+// newAuditLogSink returns an audit entry sink which appends entries as
+// JSON to an audit.log file in the specified directory. Unlike
+// audit.NewLogFileSink, the file is not handed over to syslog, as the
+// client machine may not have a syslog user.
+func newAuditLogSink(logDir string) (audit.AuditEntrySinkFn, error) {
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		return nil, errors.Trace(err)
+	}
+	logPath := filepath.Join(logDir, "audit.log")
+	// Make sure the file is created with the right mode before
+	// lumberjack gets to it.
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	// The log is an audit trail, so rotated files are compressed but
+	// never removed: with no MaxBackups or MaxAge lumberjack keeps
+	// them all.
+	fileLogger := &lumberjack.Logger{
+		Filename: logPath,
+		MaxSize:  300, // MB
+		Compress: true,
+	}
+	return func(entry audit.AuditEntry) error {
+		bytes, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		_, err = fileLogger.Write(append(bytes, '\n'))
+		return errors.Trace(err)
+	}, nil
+}
+
+// auditor records the actions performed by the tool in the audit log.
+// Failing to record an entry is logged, but does not stop the action.
+// All methods may be called on a nil auditor, which records nothing.
+type auditor struct {
+	mu sync.Mutex
+
+	sink      audit.AuditEntrySinkFn
+	origin    string
+	address   string
+	modelUUID string
+
+	// copyTo, if set, is written a copy of every entry, to be picked
+	// up by the client from the remote command's stderr.
+	copyTo io.Writer
+}
+
+// newClientAuditor returns an auditor that records entries in the audit
+// log on the client.
+func newClientAuditor(modelUUID string) *auditor {
+	sink, err := newAuditLogSink(clientAuditLogDir())
+	if err != nil {
+		logger.Warningf("cannot open audit log: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return &auditor{
+		sink:      sink,
+		origin:    auditOrigin(),
+		address:   hostname,
+		modelUUID: modelUUID,
+	}
+}
+
+// newRemoteAuditor returns an auditor that records entries in the audit
+// log on the API server, and copies them to copyTo for the client.
+func newRemoteAuditor(origin, modelUUID string, copyTo io.Writer) *auditor {
+	sink, err := newAuditLogSink(remoteAuditLogDir)
+	if err != nil {
+		logger.Warningf("cannot open audit log: %v", err)
+	}
+	if origin == "" {
+		origin = "unknown"
+	}
+	// The origin is given by the client as user@host.
+	address := "unknown"
+	if i := strings.LastIndex(origin, "@"); i >= 0 {
+		address = origin[i+1:]
+	}
+	return &auditor{
+		sink:      sink,
+		origin:    origin,
+		address:   address,
+		modelUUID: modelUUID,
+		copyTo:    copyTo,
+	}
+}
+
+// auditOrigin returns the user running the tool, and where.
+func auditOrigin() string {
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return username
+	}
+	return username + "@" + hostname
+}
+
+// record writes an entry for the operation to the audit log.
+func (a *auditor) record(operation string, data map[string]interface{}) {
+	if a == nil {
+		return
+	}
+	a.recordFor(a.modelUUID, operation, data)
+}
+
+// recordFor writes an entry for an operation on the environment with the
+// given UUID to the audit log.
+func (a *auditor) recordFor(modelUUID, operation string, data map[string]interface{}) {
+	if a == nil {
+		return
+	}
+	entry := audit.AuditEntry{
+		JujuServerVersion: upgraderVersion,
+		ModelUUID:         modelUUID,
+		Timestamp:         time.Now().UTC(),
+		RemoteAddress:     a.address,
+		OriginType:        "user",
+		OriginName:        a.origin,
+		Operation:         operation,
+		Data:              data,
+	}
+	a.write(entry)
+}
+
+// write validates the entry and writes it to the sink, and to copyTo if
+// set.
+func (a *auditor) write(entry audit.AuditEntry) {
+	if a == nil {
+		return
+	}
+	if err := entry.Validate(); err != nil {
+		logger.Warningf("not recording invalid audit entry: %v", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sink != nil {
+		if err := a.sink(entry); err != nil {
+			logger.Warningf("cannot record audit entry: %v", err)
+		}
+	}
+	if a.copyTo != nil {
+		bytes, err := json.Marshal(entry)
+		if err != nil {
+			logger.Warningf("cannot copy audit entry: %v", err)
+			return
+		}
+		fmt.Fprintf(a.copyTo, "%s%s\n", auditCopyPrefix, bytes)
+	}
+}
+
+// copyRemoteEntry records the audit entry held in a line of the remote
+// command's stderr, and returns whether the line was an audit entry.
+func (a *auditor) copyRemoteEntry(line string) bool {
+	if !strings.HasPrefix(line, auditCopyPrefix) {
+		return false
+	}
+	var entry audit.AuditEntry
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, auditCopyPrefix)), &entry); err != nil {
+		logger.Warningf("cannot read remote audit entry: %v", err)
+		return true
+	}
+	a.write(entry)
+	return true
+}
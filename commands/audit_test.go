@@ -0,0 +1,100 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/audit"
+)
+
+type auditSuite struct{}
+
+var _ = gc.Suite(&auditSuite{})
+
+const auditModelUUID = "deadbeef-0bad-400d-8000-4b1d0d06f00d"
+
+func (*auditSuite) TestLogSinkAppends(c *gc.C) {
+	dir := c.MkDir()
+	for _, operation := range []string{"stop-agents", "start-agents"} {
+		sink, err := newAuditLogSink(dir)
+		c.Assert(err, jc.ErrorIsNil)
+		a := &auditor{sink: sink, origin: "fred@client", address: "client", modelUUID: auditModelUUID}
+		a.record(operation, map[string]interface{}{"environment": "prod"})
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	c.Assert(err, jc.ErrorIsNil)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	c.Assert(lines, gc.HasLen, 2)
+	var entry audit.AuditEntry
+	err = json.Unmarshal([]byte(lines[1]), &entry)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(entry.Operation, gc.Equals, "start-agents")
+	c.Assert(entry.OriginName, gc.Equals, "fred@client")
+	c.Assert(entry.ModelUUID, gc.Equals, auditModelUUID)
+	c.Assert(entry.Data, jc.DeepEquals, map[string]interface{}{"environment": "prod"})
+}
+
+func (*auditSuite) TestInvalidEntryNotRecorded(c *gc.C) {
+	var entries []audit.AuditEntry
+	a := &auditor{
+		sink: func(entry audit.AuditEntry) error {
+			entries = append(entries, entry)
+			return nil
+		},
+		origin: "fred@client",
+	}
+	a.record("stop-agents", nil)
+	c.Assert(entries, gc.HasLen, 0)
+}
+
+func (*auditSuite) TestNilAuditor(c *gc.C) {
+	var a *auditor
+	a.record("stop-agents", nil)
+	c.Assert(a.copyRemoteEntry("some output"), jc.IsFalse)
+}
+
+func (*auditSuite) TestCopyRemoteEntries(c *gc.C) {
+	var stderr bytes.Buffer
+	remote := newRemoteAuditorForTest(&stderr)
+	stderr.WriteString("first line\n")
+	remote.record("service stop", map[string]interface{}{"machine": "0"})
+	stderr.WriteString("last line\n")
+
+	var entries []audit.AuditEntry
+	client := &auditor{
+		sink: func(entry audit.AuditEntry) error {
+			entries = append(entries, entry)
+			return nil
+		},
+	}
+	var rest []string
+	for _, line := range strings.Split(strings.TrimSuffix(stderr.String(), "\n"), "\n") {
+		if !client.copyRemoteEntry(line) {
+			rest = append(rest, line)
+		}
+	}
+	c.Assert(rest, jc.DeepEquals, []string{"first line", "last line"})
+	c.Assert(entries, gc.HasLen, 1)
+	c.Assert(entries[0].Operation, gc.Equals, "service stop")
+	c.Assert(entries[0].RemoteAddress, gc.Equals, "client")
+	c.Assert(entries[0].Data, jc.DeepEquals, map[string]interface{}{"machine": "0"})
+}
+
+func newRemoteAuditorForTest(copyTo *bytes.Buffer) *auditor {
+	return &auditor{
+		origin:    "fred@client",
+		address:   "client",
+		modelUUID: auditModelUUID,
+		copyTo:    copyTo,
+	}
+}
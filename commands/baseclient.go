@@ -4,16 +4,20 @@
 package commands
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"bytes"
 	"fmt"
-	"path/filepath"
+	"io"
 	"strings"
+	"time"
 
+	"gopkg.in/macaroon-bakery.v1/bakery/checkers"
 	"gopkg.in/macaroon-bakery.v1/httpbakery"
+	"gopkg.in/macaroon.v1"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils"
 	"github.com/kardianos/osext"
 
 	"github.com/juju/1.25-upgrade/juju1/environs/configstore"
@@ -21,15 +25,39 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/cmd/modelcmd"
 )
 
-func wrap(c modelcmd.ControllerCommand) modelcmd.ControllerCommand {
+// clientCommand is implemented by all the commands that run a remote
+// command on the 1.25 API server.
+type clientCommand interface {
+	modelcmd.ControllerCommand
+	setCommandName(name string)
+}
+
+func wrap(c clientCommand) modelcmd.ControllerCommand {
+	c.setCommandName(c.Info().Name)
 	return modelcmd.WrapController(c, modelcmd.WrapControllerSkipControllerFlags)
 }
 
 type baseClientCommand struct {
 	modelcmd.ControllerCommandBase
 
+	// commandName is the name of the command, as recorded in the
+	// audit log.
+	commandName string
+
 	needsController bool
 
+	// selectable is true for commands that accept the machine
+	// selection flags, which are passed on to the remote command.
+	selectable bool
+	selector   machineSelector
+
+	environments environmentSelector
+
+	// overridable is true for commands that export the environment,
+	// and accept the flags that change how it is exported.
+	overridable bool
+	overrides   exportOverrides
+
 	info configstore.EnvironInfo
 
 	name    string
@@ -37,7 +65,28 @@ type baseClientCommand struct {
 	plugin  string
 
 	remoteCommand string
-	remoteArgs    string
+	// controllerInfo holds the encoded controller credentials, which
+	// are passed to the remote command on its stdin.
+	controllerInfo []byte
+	// remoteFlags holds any additional flags to pass on to the
+	// remote command.
+	remoteFlags []string
+}
+
+func (c *baseClientCommand) setCommandName(name string) {
+	c.commandName = name
+}
+
+// SetFlags implements cmd.Command.SetFlags.
+func (c *baseClientCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.ControllerCommandBase.SetFlags(f)
+	c.environments.SetFlags(f)
+	if c.selectable {
+		c.selector.SetFlags(f)
+	}
+	if c.overridable {
+		c.overrides.SetFlags(f)
+	}
 }
 
 // Init will grab the first arg as the environment name.
@@ -65,6 +114,16 @@ func (c *baseClientCommand) init(args []string) ([]string, error) {
 		args = args[1:]
 	}
 
+	if err := c.selector.validate(); err != nil {
+		return args, errors.Trace(err)
+	}
+	if err := c.environments.validate(); err != nil {
+		return args, errors.Trace(err)
+	}
+	if err := c.overrides.validate(); err != nil {
+		return args, errors.Trace(err)
+	}
+
 	if err := c.loadInfo(); err != nil {
 		return args, err
 	}
@@ -72,9 +131,12 @@ func (c *baseClientCommand) init(args []string) ([]string, error) {
 	return args, nil
 }
 
+// controllerMacaroonLifetime is how long the macaroons passed to the
+// remote command may be used to log in to the controller.
+const controllerMacaroonLifetime = time.Hour
+
 func (c *baseClientCommand) setRemoteControllerInfo() error {
-	// Read the controller info and pass it as extra args to the
-	// remote command.
+	// Read the controller info to pass to the remote command.
 	cinfo, err := c.GetControllerAPIInfo()
 	if err != nil {
 		return errors.Trace(err)
@@ -88,17 +150,48 @@ func (c *baseClientCommand) setRemoteControllerInfo() error {
 		Password:    cinfo.Password,
 		Macaroons:   cinfo.Macaroons,
 	}
+	if len(info.Macaroons) > 0 {
+		// The macaroons are enough to log in, so the password is
+		// not sent to the API server at all.
+		info.Password = ""
+		info.Macaroons, err = restrictMacaroons(info.Macaroons, time.Now().Add(controllerMacaroonLifetime))
+		if err != nil {
+			return errors.Annotate(err, "restricting controller macaroons")
+		}
+	}
 
-	// Lets serialize to yaml, then base64 encode it.
-	bytes, err := json.Marshal(info)
+	data, err := encodeControllerInfo(info)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	logger.Debugf("info: %s", bytes)
-	c.remoteArgs = base64.StdEncoding.EncodeToString(bytes)
+	c.controllerInfo = data
 	return nil
 }
 
+// restrictMacaroons returns copies of the macaroons that cannot be used
+// after expiry. The controller checks time-before caveats, so the caveat
+// can be added here without the controller's help.
+//
+// A macaroon that has been discharged is bound to its discharges, and
+// adding a caveat would invalidate them, so those macaroons are passed on
+// unchanged. These are only held by external users; the macaroons of local
+// users are not discharged.
+func restrictMacaroons(slices []macaroon.Slice, expiry time.Time) ([]macaroon.Slice, error) {
+	result := make([]macaroon.Slice, len(slices))
+	for i, ms := range slices {
+		if len(ms) != 1 {
+			result[i] = ms
+			continue
+		}
+		m := ms[0].Clone()
+		if err := m.AddFirstPartyCaveat(checkers.TimeBeforeCaveat(expiry).Condition); err != nil {
+			return nil, errors.Trace(err)
+		}
+		result[i] = macaroon.Slice{m}
+	}
+	return result, nil
+}
+
 func (c *baseClientCommand) GetControllerAPIInfo() (*api.Info, error) {
 	name, err := c.ControllerName()
 	if err != nil {
@@ -121,7 +214,8 @@ func (c *baseClientCommand) GetControllerAPIInfo() (*api.Info, error) {
 	// and return the macaroons in the cookie jar for the controller.
 	//
 	// TODO(axw,mjs) add a controller API that returns a macaroon that
-	// may be used for the sole purpose of migration.
+	// may be used for the sole purpose of migration. Until then, the
+	// macaroons are restricted to a short lifetime by restrictMacaroons.
 	api, err := c.NewAPIRoot()
 	if err != nil {
 		return nil, errors.Annotate(err, "connecting to target controller")
@@ -163,32 +257,117 @@ func (c *baseClientCommand) Run(ctx *cmd.Context) error {
 			return errors.Trace(err)
 		}
 	}
-	if err := checkUpdatePlugin(ctx, c.plugin, c.address); err != nil {
-		return errors.Annotate(err, "checking remote plugin")
+
+	result, err := c.runRemote(ctx)
+	if err != nil {
+		return errors.Trace(err)
 	}
 
-	pluginBase := filepath.Base(c.plugin)
+	fmt.Fprintf(ctx.Stdout, result.Stdout)
+	fmt.Fprintf(ctx.Stderr, result.Stderr)
+
+	if result.Code != 0 {
+		return &cmd.RcPassthroughError{result.Code}
+	}
+
+	return nil
+}
+
+// runRemote makes sure the plugin on the API server is up to date, and
+// then runs the remote command there. The command is recorded in the audit
+// log on the client, along with the entries recorded by the remote command.
+func (c *baseClientCommand) runRemote(ctx *cmd.Context) (RunResult, error) {
+	audit := newClientAuditor(c.info.APIEndpoint().EnvironUUID)
+	auditData := map[string]interface{}{
+		"environment":    c.name,
+		"api-server":     c.address,
+		"remote-command": c.remoteCommand,
+	}
+	if c.needsController {
+		controllerName, _ := c.ControllerName()
+		auditData["controller"] = controllerName
+	}
+	audit.record(c.commandName, auditData)
+
+	// The remote command writes its audit entries and progress events
+	// to stderr, interleaved with its other output. They are handled as
+	// they arrive, and the rest of stderr is returned.
+	display := newProgressDisplay(ctx.Stderr)
+	var stderr []string
+	onStderr := func(line string) {
+		if audit.copyRemoteEntry(line) || display.handleLine(line) {
+			return
+		}
+		stderr = append(stderr, line+"\n")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				display.refresh()
+			}
+		}
+	}()
+	result, err := c.runRemoteCommand(ctx, audit.origin, onStderr)
+	close(done)
+	display.finish()
+	result.Stderr = strings.Join(stderr, "")
+
+	auditData["exit-code"] = result.Code
+	if err != nil {
+		auditData["error"] = err.Error()
+	}
+	audit.record(c.commandName+" finished", auditData)
+	return result, errors.Trace(err)
+}
+
+func (c *baseClientCommand) runRemoteCommand(ctx *cmd.Context, auditOrigin string, onStderr func(string)) (RunResult, error) {
+	if err := checkUpdatePlugin(ctx, c.plugin, c.address); err != nil {
+		return RunResult{}, errors.Annotate(err, "checking remote plugin")
+	}
 
 	debug := ""
 	if logger.IsDebugEnabled() {
 		debug = "--debug"
 	}
 
-	result, err := runViaSSH(
+	remoteArgs := append(c.selector.remoteArgs(), c.environments.remoteArgs()...)
+	remoteArgs = append(remoteArgs, c.overrides.remoteArgs()...)
+	remoteArgs = append(remoteArgs, c.remoteFlags...)
+	remoteArgs = append(remoteArgs, "--audit-origin", auditOrigin)
+	remoteArgs = append(remoteArgs, "--client-version", upgraderVersion.String())
+
+	// The controller credentials are passed on stdin, so that they
+	// are not visible in the process list on the API server.
+	var stdin io.Reader
+	if c.controllerInfo != nil {
+		stdin = bytes.NewReader(c.controllerInfo)
+	}
+	result, err := runViaSSHStreaming(
 		c.address,
-		fmt.Sprintf("./%s %s %s %s\n", pluginBase, c.remoteCommand, c.remoteArgs, debug),
-		"")
+		fmt.Sprintf("%s %s %s %s\n", remotePluginPath(c.plugin), c.remoteCommand, shQuoteArgs(remoteArgs), debug),
+		"",
+		stdin,
+		onStderr)
 
 	if err != nil {
-		return errors.Annotatef(err, "running %s via SSH", c.remoteCommand)
+		return result, errors.Annotatef(err, "running %s via SSH", c.remoteCommand)
 	}
+	return result, nil
+}
 
-	fmt.Fprintf(ctx.Stdout, result.Stdout)
-	fmt.Fprintf(ctx.Stderr, result.Stderr)
-
-	if result.Code != 0 {
-		return &cmd.RcPassthroughError{result.Code}
+// shQuoteArgs quotes each of the arguments so that they are passed on
+// unchanged by the shell the remote command is run with.
+func shQuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = utils.ShQuote(arg)
 	}
-
-	return nil
+	return strings.Join(quoted, " ")
 }
@@ -4,13 +4,19 @@
 package commands
 
 import (
+	"bufio"
 	"encoding/base64"
 	"encoding/json"
+	"io"
+	"os"
+	"strings"
 
+	names2 "gopkg.in/juju/names.v2"
 	"gopkg.in/macaroon.v1"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
 	"github.com/juju/names"
 
 	"github.com/juju/1.25-upgrade/juju1/environs"
@@ -26,6 +32,26 @@ type baseRemoteCommand struct {
 
 	needsController bool
 
+	// selectable is true for commands that accept the machine
+	// selection flags.
+	selectable bool
+	selector   machineSelector
+
+	environments environmentSelector
+
+	// overridable is true for commands that export the environment,
+	// and accept the flags that change how it is exported.
+	overridable bool
+	overrides   exportOverrides
+
+	// auditOrigin is the user running the client command, as
+	// recorded in the audit log.
+	auditOrigin string
+
+	// clientVersion is the version of the client running the
+	// command, which must match this version of the plugin.
+	clientVersion string
+
 	controllerInfo *api.Info
 }
 
@@ -38,43 +64,145 @@ type Info struct {
 	Macaroons   []macaroon.Slice
 }
 
+// SetFlags implements cmd.Command.SetFlags.
+func (c *baseRemoteCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.CommandBase.SetFlags(f)
+	f.StringVar(&c.auditOrigin, "audit-origin", "", "the user running the client command")
+	f.StringVar(&c.clientVersion, "client-version", "", "the version of the client running the command")
+	c.environments.SetFlags(f)
+	if c.selectable {
+		c.selector.SetFlags(f)
+	}
+	if c.overridable {
+		c.overrides.SetFlags(f)
+	}
+}
+
 func (c *baseRemoteCommand) init(args []string) ([]string, error) {
+	if err := checkClientVersion(c.clientVersion); err != nil {
+		return args, errors.Trace(err)
+	}
+	if err := c.overrides.validate(); err != nil {
+		return args, errors.Trace(err)
+	}
 	if c.needsController {
-		if len(args) == 0 {
-			return args, errors.Errorf("missing controller info")
-		}
-
-		bytes, err := base64.StdEncoding.DecodeString(args[0])
+		// The client passes the controller info on stdin, rather than
+		// as an argument, to keep the credentials out of the process
+		// list.
+		info, err := readControllerInfo(os.Stdin)
 		if err != nil {
-			return args, errors.Annotate(err, "decoding controller info")
+			return args, errors.Trace(err)
 		}
-		var info Info
-		err = json.Unmarshal(bytes, &info)
-		if err != nil {
-			return args, errors.Annotate(err, "unmarshalling controller info")
-		}
-		tag, err := names.ParseTag(info.Tag)
-		if err != nil {
-			return args, errors.Annotate(err, "parsing tag")
-		}
-		c.controllerInfo = &api.Info{
-			Addrs:       info.Addrs,
-			SNIHostName: info.SNIHostName,
-			CACert:      info.CACert,
-			Tag:         tag,
-			Password:    info.Password,
-			Macaroons:   info.Macaroons,
-		}
-
-		args = args[1:]
+		c.controllerInfo = info
 	}
 	return args, nil
 }
 
+// checkClientVersion returns an error if the client running the command
+// is a different version from the plugin.
+func checkClientVersion(clientVersion string) error {
+	if clientVersion == "" {
+		return errors.New("client version not specified, remote commands must be run by the client")
+	}
+	if clientVersion != upgraderVersion.String() {
+		return errors.Errorf(
+			"client version %s does not match plugin version %s on the API server",
+			clientVersion, upgraderVersion,
+		)
+	}
+	return nil
+}
+
+// encodeControllerInfo returns the line the client writes to the remote
+// command's stdin to pass it the controller info.
+func encodeControllerInfo(info Info) ([]byte, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	return []byte(encoded + "\n"), nil
+}
+
+// readControllerInfo reads the controller info written by the client
+// with encodeControllerInfo.
+func readControllerInfo(r io.Reader) (*api.Info, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, errors.Annotate(err, "reading controller info")
+	}
+	if line == "" {
+		return nil, errors.New("missing controller info")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return nil, errors.Annotate(err, "decoding controller info")
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, errors.Annotate(err, "unmarshalling controller info")
+	}
+	tag, err := names.ParseTag(info.Tag)
+	if err != nil {
+		return nil, errors.Annotate(err, "parsing tag")
+	}
+	return &api.Info{
+		Addrs:       info.Addrs,
+		SNIHostName: info.SNIHostName,
+		CACert:      info.CACert,
+		Tag:         tag,
+		Password:    info.Password,
+		Macaroons:   info.Macaroons,
+	}, nil
+}
+
 func (c *baseRemoteCommand) getControllerConnection() (api.Connection, error) {
 	return api.Open(c.controllerInfo, api.DefaultDialOpts())
 }
 
+// startAudit returns the auditor for the remote command, having recorded
+// that the command is being run against the environments. Entries are
+// copied to stderr for the client to record as well.
+func (c *baseRemoteCommand) startAudit(ctx *cmd.Context, states []*state.State, command string) *auditor {
+	var uuids []string
+	for _, st := range states {
+		uuids = append(uuids, st.EnvironUUID())
+	}
+	audit := newRemoteAuditor(c.auditOrigin, uuids[0], ctx.Stderr)
+	data := map[string]interface{}{
+		"environments": uuids,
+	}
+	if c.selectable {
+		data["selector"] = c.selector.remoteArgs()
+	}
+	audit.record(command, data)
+	return audit
+}
+
+// getModelConnection returns a connection to the model with the given UUID
+// on the target controller.
+func (c *baseRemoteCommand) getModelConnection(modelUUID string) (api.Connection, error) {
+	info := *c.controllerInfo
+	info.ModelTag = names2.NewModelTag(modelUUID)
+	return api.Open(&info, api.DefaultDialOpts())
+}
+
+// getStates returns a State for each of the environments selected by the
+// environment flags, or just for the state server environment if none were
+// selected. The caller is responsible for closing them, using closeStates.
+func (c *baseRemoteCommand) getStates(ctx *cmd.Context) ([]*state.State, error) {
+	st, err := c.getState(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	states, err := c.environments.openEnvironments(st)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return states, nil
+}
+
+// getState returns a State for the state server environment.
 func (c *baseRemoteCommand) getState(ctx *cmd.Context) (*state.State, error) {
 	tag, err := getCurrentMachineTag(dataDir)
 	if err != nil {
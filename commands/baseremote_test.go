@@ -0,0 +1,73 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/macaroon.v1"
+)
+
+type controllerInfoSuite struct{}
+
+var _ = gc.Suite(&controllerInfoSuite{})
+
+func (*controllerInfoSuite) TestRoundTrip(c *gc.C) {
+	data, err := encodeControllerInfo(Info{
+		Addrs:  []string{"10.0.0.1:17070"},
+		CACert: "cert",
+		Tag:    "user-admin",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(bytes.Count(data, []byte("\n")), gc.Equals, 1)
+
+	info, err := readControllerInfo(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Addrs, jc.DeepEquals, []string{"10.0.0.1:17070"})
+	c.Assert(info.CACert, gc.Equals, "cert")
+	c.Assert(info.Tag.String(), gc.Equals, "user-admin")
+	c.Assert(info.Password, gc.Equals, "")
+}
+
+func (*controllerInfoSuite) TestReadMissing(c *gc.C) {
+	_, err := readControllerInfo(strings.NewReader(""))
+	c.Assert(err, gc.ErrorMatches, "missing controller info")
+}
+
+func (*controllerInfoSuite) TestRestrictMacaroons(c *gc.C) {
+	local, err := macaroon.New([]byte("secret"), "local", "juju")
+	c.Assert(err, jc.ErrorIsNil)
+	external, err := macaroon.New([]byte("secret"), "external", "juju")
+	c.Assert(err, jc.ErrorIsNil)
+	discharge, err := macaroon.New([]byte("other"), "discharge", "idm")
+	c.Assert(err, jc.ErrorIsNil)
+
+	expiry := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	restricted, err := restrictMacaroons([]macaroon.Slice{
+		{local},
+		{external, discharge},
+	}, expiry)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(restricted, gc.HasLen, 2)
+
+	caveats := restricted[0][0].Caveats()
+	c.Assert(caveats, gc.HasLen, 1)
+	c.Assert(caveats[0].Id, gc.Equals, "time-before 2017-08-01T12:00:00Z")
+	// The original is left alone.
+	c.Assert(local.Caveats(), gc.HasLen, 0)
+
+	c.Assert(restricted[1], jc.DeepEquals, macaroon.Slice{external, discharge})
+}
+
+func (*controllerInfoSuite) TestCheckClientVersion(c *gc.C) {
+	c.Assert(checkClientVersion(upgraderVersion.String()), jc.ErrorIsNil)
+	c.Assert(checkClientVersion("0.0.1"), gc.ErrorMatches,
+		"client version 0.0.1 does not match plugin version .* on the API server")
+	c.Assert(checkClientVersion(""), gc.ErrorMatches,
+		"client version not specified, remote commands must be run by the client")
+}
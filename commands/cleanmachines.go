@@ -0,0 +1,358 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils"
+	"github.com/juju/utils/set"
+)
+
+var cleanMachinesDoc = `
+The purpose of the clean-machines command is to remove the configuration
+that 1.25 leaves on the machines of an environment, and that is no longer
+used once the agents have been upgraded to 2.x. It should be run after
+upgrade-agents, once the 2.x agents are running.
+
+The configuration is removed in named groups:
+
+    rsyslog   the rsyslog forwarding configuration in /etc/rsyslog.d, and
+              the certificates and logrotate helpers it uses in
+              /etc/juju/rsyslog; rsyslog is restarted once they are gone
+    juju-db   the juju-db service, and the server certificate and shared
+              secret it used; the database directory is moved aside to
+              /var/lib/juju/db.1.25 rather than removed. This is only done
+              on machines that are not 1.25 state servers.
+    proxy     the ~ubuntu/.juju-proxy file and the lines in ~ubuntu/.profile
+              that source it, which are replaced by the 2.x
+              /etc/profile.d/juju-proxy.sh
+    helpers   the juju cron entries in /etc/cron.d, and the juju-run
+              symlinks in /usr/bin and /usr/local/bin that are broken or
+              still point at the 1.25 agent binaries; the 2.x machine
+              agent recreates /usr/bin/juju-run when it next starts
+
+Use --keep to leave some of the groups in place. With --dry-run, what would
+be removed from each machine is listed, and nothing is changed.
+
+Anything that has already been removed is skipped, so the command may be
+run again if it fails part way through.
+
+The --machines, --services and --exclude flags may be used to restrict the
+command to a subset of the machines in the environment. Containers are
+selected or excluded along with their host machine.
+`
+
+// The groups of 1.25 configuration removed by clean-machines.
+const (
+	cleanRsyslog = "rsyslog"
+	cleanJujuDB  = "juju-db"
+	cleanProxy   = "proxy"
+	cleanHelpers = "helpers"
+)
+
+// cleanGroups holds the groups in the order they are removed.
+var cleanGroups = []string{cleanRsyslog, cleanJujuDB, cleanProxy, cleanHelpers}
+
+// cleanRoot is prepended to every path the clean-machines scripts touch.
+// It is only changed by tests, which run the scripts against a temporary
+// directory.
+var cleanRoot = ""
+
+func newCleanMachinesCommand() cmd.Command {
+	command := &cleanMachinesCommand{}
+	command.selectable = true
+	command.remoteCommand = "clean-machines-impl"
+	return wrap(command)
+}
+
+type cleanMachinesCommand struct {
+	baseClientCommand
+
+	keep   []string
+	dryRun bool
+}
+
+func (c *cleanMachinesCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "clean-machines",
+		Args:    "<environment name>",
+		Purpose: "remove the 1.25 configuration from the machines of the specified environment",
+		Doc:     cleanMachinesDoc,
+	}
+}
+
+func (c *cleanMachinesCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseClientCommand.SetFlags(f)
+	f.Var(cmd.NewStringsValue(nil, &c.keep), "keep", "Leave these groups of configuration in place (comma separated)")
+	f.BoolVar(&c.dryRun, "dry-run", false, "List what would be removed without changing anything")
+}
+
+func (c *cleanMachinesCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := validateCleanGroups(c.keep); err != nil {
+		return errors.Trace(err)
+	}
+	if len(c.keep) > 0 {
+		c.remoteFlags = append(c.remoteFlags, "--keep", strings.Join(c.keep, ","))
+	}
+	if c.dryRun {
+		c.remoteFlags = append(c.remoteFlags, "--dry-run")
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func validateCleanGroups(groups []string) error {
+	known := set.NewStrings(cleanGroups...)
+	for _, group := range groups {
+		if !known.Contains(group) {
+			return errors.NotValidf("configuration group %q (expected one of %s)", group, strings.Join(cleanGroups, ", "))
+		}
+	}
+	return nil
+}
+
+var cleanMachinesImplDoc = `
+
+clean-machines-impl must be executed on an API server machine of a 1.25
+environment.
+
+The command will get a list of all the machines, and their addresses, and
+then ssh to all the machines to remove the 1.25 configuration.
+
+`
+
+func newCleanMachinesImplCommand() cmd.Command {
+	command := &cleanMachinesImplCommand{}
+	command.selectable = true
+	return command
+}
+
+type cleanMachinesImplCommand struct {
+	baseRemoteCommand
+
+	keep   []string
+	dryRun bool
+}
+
+func (c *cleanMachinesImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "clean-machines-impl",
+		Purpose: "controller aspect of clean-machines",
+		Doc:     cleanMachinesImplDoc,
+	}
+}
+
+func (c *cleanMachinesImplCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseRemoteCommand.SetFlags(f)
+	f.Var(cmd.NewStringsValue(nil, &c.keep), "keep", "")
+	f.BoolVar(&c.dryRun, "dry-run", false, "")
+}
+
+func (c *cleanMachinesImplCommand) Init(args []string) error {
+	args, err := c.baseRemoteCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := validateCleanGroups(c.keep); err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *cleanMachinesImplCommand) Run(ctx *cmd.Context) error {
+	states, err := c.getStates(ctx)
+	if err != nil {
+		return errors.Annotate(err, "getting state")
+	}
+	defer closeStates(states)
+
+	machines, err := c.selector.selectMachines(states)
+	if err != nil {
+		return errors.Annotate(err, "unable to get addresses for machines")
+	}
+
+	audit := c.startAudit(ctx, states, c.Info().Name)
+
+	operation := "clean machines"
+	if c.dryRun {
+		operation = "list machine configuration"
+	}
+	keep := set.NewStrings(c.keep...)
+	progress := newProgressWriter(ctx.Stderr, operation)
+	results := parallelCallEach(audit, progress, operation, machines, func(machine FlatMachine) string {
+		return cleanMachineScript(machine, keep, c.dryRun)
+	})
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].MachineID < results[j].MachineID
+	})
+	var failed bool
+	for _, r := range results {
+		if r.Error != nil || r.Code != 0 {
+			logger.Warningf("machine: %s rc: %d\nstdout:%s\nstderr:%s", r.MachineID, r.Code, r.Stdout, r.Stderr)
+			failed = true
+		}
+		lines := strings.Split(strings.TrimSpace(r.Stdout), "\n")
+		if len(lines) == 1 && lines[0] == "" {
+			lines = nil
+		}
+		if r.Error != nil {
+			lines = append(lines, fmt.Sprintf("error: %v", r.Error))
+		} else if r.Code != 0 {
+			lines = append(lines, fmt.Sprintf("failed with exit code %d", r.Code))
+		} else if len(lines) == 0 {
+			lines = []string{"nothing to clean up"}
+		}
+		for _, line := range lines {
+			fmt.Fprintf(ctx.Stdout, "machine %s: %s\n", r.MachineID, line)
+		}
+	}
+	if failed {
+		return errors.New("some machines were not cleaned up")
+	}
+	return nil
+}
+
+// cleanMachineScript returns the script that removes the 1.25
+// configuration from the machine, apart from the groups in keep. The
+// juju-db group is always kept on state servers, which still run the 1.25
+// environment's database.
+func cleanMachineScript(machine FlatMachine, keep set.Strings, dryRun bool) string {
+	var script bytes.Buffer
+	dryRunValue := ""
+	if dryRun {
+		dryRunValue = "yes"
+	}
+	fmt.Fprintf(&script, cleanScriptPrelude, utils.ShQuote(cleanRoot), dryRunValue)
+	for _, group := range cleanGroups {
+		if keep.Contains(group) || (group == cleanJujuDB && machine.Controller) {
+			continue
+		}
+		script.WriteString(cleanGroupScripts[group])
+	}
+	script.WriteString(`[ -z "$failed" ]` + "\n")
+	return script.String()
+}
+
+// cleanScriptPrelude defines the helpers used by the group scripts. Each
+// helper writes a line saying what it did, or would do in a dry run, and
+// does nothing if there is nothing left to do.
+const cleanScriptPrelude = `
+root=%s
+dry_run=%s
+failed=
+changed=
+
+remove() {
+    for path in "$@"; do
+        [ -e "$path" ] || [ -L "$path" ] || continue
+        changed=yes
+        if [ -n "$dry_run" ]; then
+            echo "would remove $path"
+        elif rm -rf "$path"; then
+            echo "removed $path"
+        else
+            echo "failed to remove $path"
+            failed=yes
+        fi
+    done
+}
+
+move() {
+    [ -e "$1" ] || return 0
+    changed=yes
+    if [ -e "$2" ]; then
+        echo "cannot move $1: $2 already exists"
+        failed=yes
+    elif [ -n "$dry_run" ]; then
+        echo "would move $1 to $2"
+    elif mv "$1" "$2"; then
+        echo "moved $1 to $2"
+    else
+        echo "failed to move $1"
+        failed=yes
+    fi
+}
+
+run() {
+    description=$1
+    shift
+    changed=yes
+    if [ -n "$dry_run" ]; then
+        echo "would $description"
+    elif "$@" > /dev/null 2>&1; then
+        echo "done: $description"
+    else
+        echo "failed to $description"
+        failed=yes
+    fi
+}
+`
+
+// cleanGroupScripts holds the script that removes each group.
+var cleanGroupScripts = map[string]string{
+	cleanRsyslog: `
+changed=
+remove "$root"/etc/rsyslog.d/25-juju*.conf "$root"/etc/rsyslog.d/26-juju-*.conf
+remove "$root"/etc/juju/rsyslog "$root"/etc/juju-*/rsyslog
+if [ -n "$changed" ]; then
+    run "restart rsyslog" service rsyslog restart
+fi
+`,
+	cleanJujuDB: `
+for conf in "$root"/etc/init/juju-db*.conf; do
+    [ -e "$conf" ] || continue
+    name=$(basename "$conf" .conf)
+    if status "$name" 2> /dev/null | grep -q running; then
+        run "stop $name" stop "$name"
+    fi
+    remove "$conf"
+done
+for dir in "$root"/var/lib/juju/init/juju-db*; do
+    [ -d "$dir" ] || continue
+    name=$(basename "$dir")
+    run "stop $name" systemctl stop "$name"
+    run "disable $name" systemctl disable "$name"
+    remove "$dir"
+done
+move "$root"/var/lib/juju/db "$root"/var/lib/juju/db.1.25
+remove "$root"/var/lib/juju/server.pem "$root"/var/lib/juju/shared-secret
+`,
+	cleanProxy: `
+remove "$root"/home/ubuntu/.juju-proxy
+if grep -q '\.juju-proxy' "$root"/home/ubuntu/.profile 2> /dev/null; then
+    run "remove .juju-proxy from $root/home/ubuntu/.profile" \
+        sed -i -e '/^# Added by juju$/{N;/\.juju-proxy/d;}' -e '/\.juju-proxy/d' "$root"/home/ubuntu/.profile
+fi
+if [ ! -e "$root"/etc/profile.d/juju-proxy.sh ]; then
+    run "write $root/etc/profile.d/juju-proxy.sh" sh -c \
+        'printf "\n# Added by juju\n[ -f \"/etc/juju-proxy.conf\" ] && . \"/etc/juju-proxy.conf\"\n" > "$1"' \
+        sh "$root"/etc/profile.d/juju-proxy.sh
+fi
+`,
+	cleanHelpers: `
+remove "$root"/etc/cron.d/juju-* "$root"/etc/cron.d/juju_*
+for link in "$root"/usr/bin/juju-run "$root"/usr/local/bin/juju-run; do
+    [ -L "$link" ] || continue
+    case "$(readlink -f "$link")" in
+    "$root"/var/lib/juju/tools/1.25*)
+        remove "$link"
+        ;;
+    *)
+        [ -e "$link" ] || remove "$link"
+        ;;
+    esac
+done
+`,
+}
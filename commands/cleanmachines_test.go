@@ -0,0 +1,191 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	jujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/set"
+	gc "gopkg.in/check.v1"
+)
+
+type cleanMachinesSuite struct {
+	jujutesting.CleanupSuite
+}
+
+var _ = gc.Suite(&cleanMachinesSuite{})
+
+func (*cleanMachinesSuite) TestScript(c *gc.C) {
+	script := cleanMachineScript(FlatMachine{ID: "1"}, set.NewStrings(), false)
+	c.Assert(script, jc.Contains, "dry_run=\n")
+	c.Assert(script, jc.Contains, cleanGroupScripts[cleanRsyslog])
+	c.Assert(script, jc.Contains, cleanGroupScripts[cleanJujuDB])
+	c.Assert(script, jc.Contains, cleanGroupScripts[cleanProxy])
+	c.Assert(script, jc.Contains, cleanGroupScripts[cleanHelpers])
+}
+
+func (*cleanMachinesSuite) TestScriptKeep(c *gc.C) {
+	script := cleanMachineScript(FlatMachine{ID: "1"}, set.NewStrings(cleanRsyslog), true)
+	c.Assert(script, jc.Contains, "dry_run=yes\n")
+	c.Assert(script, gc.Not(jc.Contains), cleanGroupScripts[cleanRsyslog])
+	c.Assert(script, jc.Contains, cleanGroupScripts[cleanJujuDB])
+}
+
+func (*cleanMachinesSuite) TestScriptKeepsJujuDBOnController(c *gc.C) {
+	script := cleanMachineScript(FlatMachine{ID: "0", Controller: true}, set.NewStrings(), false)
+	c.Assert(script, gc.Not(jc.Contains), cleanGroupScripts[cleanJujuDB])
+	c.Assert(script, jc.Contains, cleanGroupScripts[cleanProxy])
+	c.Assert(script, jc.Contains, cleanGroupScripts[cleanHelpers])
+}
+
+func (*cleanMachinesSuite) TestValidateGroups(c *gc.C) {
+	c.Assert(validateCleanGroups([]string{"rsyslog", "proxy"}), jc.ErrorIsNil)
+	c.Assert(validateCleanGroups([]string{"cron"}), gc.ErrorMatches,
+		`configuration group "cron" \(expected one of rsyslog, juju-db, proxy, helpers\) not valid`)
+}
+
+// cleanMachineFiles holds the 1.25 configuration on a machine, and the
+// files around it that must be left alone.
+var cleanMachineFiles = map[string]string{
+	"etc/rsyslog.d/25-juju.conf":                    "",
+	"etc/rsyslog.d/26-juju-unit.conf":               "",
+	"etc/rsyslog.d/50-default.conf":                 "",
+	"etc/juju/rsyslog/ca-cert.pem":                  "",
+	"etc/init/juju-db.conf":                         "",
+	"var/lib/juju/db/juju.0":                        "",
+	"var/lib/juju/server.pem":                       "",
+	"var/lib/juju/shared-secret":                    "",
+	"var/lib/juju/tools/1.25.10-trusty-amd64/jujud": "",
+	"var/lib/juju/tools/machine-1/jujud":            "",
+	"home/ubuntu/.juju-proxy":                       "",
+	"home/ubuntu/.profile":                          "export EDITOR=vi\n\n# Added by juju\n[ -f \"$HOME/.juju-proxy\" ] && . \"$HOME/.juju-proxy\"\n",
+	"etc/cron.d/juju-ensure-rsyslog":                "",
+	"etc/cron.d/sysstat":                            "",
+}
+
+// writeCleanMachine writes the 1.25 configuration under a temporary root,
+// and makes the scripts use it. It returns the root.
+func (s *cleanMachinesSuite) writeCleanMachine(c *gc.C) string {
+	root, err := filepath.EvalSymlinks(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	for name, content := range cleanMachineFiles {
+		path := filepath.Join(root, name)
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0755), jc.ErrorIsNil)
+		c.Assert(ioutil.WriteFile(path, []byte(content), 0644), jc.ErrorIsNil)
+	}
+	for _, dir := range []string{"etc/profile.d", "usr/bin", "usr/local/bin"} {
+		c.Assert(os.MkdirAll(filepath.Join(root, dir), 0755), jc.ErrorIsNil)
+	}
+	err = os.Symlink(filepath.Join(root, "var/lib/juju/tools/1.25.10-trusty-amd64/jujud"), filepath.Join(root, "usr/bin/juju-run"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = os.Symlink(filepath.Join(root, "var/lib/juju/tools/machine-1/jujud"), filepath.Join(root, "usr/local/bin/juju-run"))
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchValue(&cleanRoot, root)
+	return root
+}
+
+// runCleanScript runs the script under sh, with the service management
+// commands it uses replaced by stubs that log their arguments. It returns
+// the output of the script, with the root removed from paths, and the
+// commands run.
+func runCleanScript(c *gc.C, root, script string) (string, []string) {
+	bin := c.MkDir()
+	commandLog := filepath.Join(bin, "commands.log")
+	for _, name := range []string{"service", "status", "stop", "systemctl"} {
+		stub := "#!/bin/sh\necho \"$(basename \"$0\") $*\" >> " + commandLog + "\n"
+		if name == "status" {
+			stub += "echo \"$1 start/running, process 1234\"\n"
+		}
+		c.Assert(ioutil.WriteFile(filepath.Join(bin, name), []byte(stub), 0755), jc.ErrorIsNil)
+	}
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, jc.ErrorIsNil, gc.Commentf("%s", output))
+	var commands []string
+	if data, err := ioutil.ReadFile(commandLog); err == nil {
+		commands = strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	return strings.Replace(string(output), root, "", -1), commands
+}
+
+func (s *cleanMachinesSuite) TestRunScript(c *gc.C) {
+	root := s.writeCleanMachine(c)
+	output, commands := runCleanScript(c, root, cleanMachineScript(FlatMachine{ID: "1"}, set.NewStrings(), false))
+	c.Check(output, gc.Equals, `removed /etc/rsyslog.d/25-juju.conf
+removed /etc/rsyslog.d/26-juju-unit.conf
+removed /etc/juju/rsyslog
+done: restart rsyslog
+done: stop juju-db
+removed /etc/init/juju-db.conf
+moved /var/lib/juju/db to /var/lib/juju/db.1.25
+removed /var/lib/juju/server.pem
+removed /var/lib/juju/shared-secret
+removed /home/ubuntu/.juju-proxy
+done: remove .juju-proxy from /home/ubuntu/.profile
+done: write /etc/profile.d/juju-proxy.sh
+removed /etc/cron.d/juju-ensure-rsyslog
+removed /usr/bin/juju-run
+`)
+	c.Check(commands, jc.DeepEquals, []string{"service rsyslog restart", "status juju-db", "stop juju-db"})
+
+	for _, name := range []string{
+		"etc/rsyslog.d/25-juju.conf", "etc/juju/rsyslog", "etc/init/juju-db.conf", "var/lib/juju/db",
+		"var/lib/juju/server.pem", "home/ubuntu/.juju-proxy", "etc/cron.d/juju-ensure-rsyslog", "usr/bin/juju-run",
+	} {
+		_, err := os.Lstat(filepath.Join(root, name))
+		c.Check(os.IsNotExist(err), jc.IsTrue, gc.Commentf(name))
+	}
+	for _, name := range []string{
+		"etc/rsyslog.d/50-default.conf", "var/lib/juju/db.1.25/juju.0", "etc/cron.d/sysstat", "usr/local/bin/juju-run",
+	} {
+		_, err := os.Lstat(filepath.Join(root, name))
+		c.Check(err, jc.ErrorIsNil, gc.Commentf(name))
+	}
+	profile, err := ioutil.ReadFile(filepath.Join(root, "home/ubuntu/.profile"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(profile), gc.Equals, "export EDITOR=vi\n\n")
+	proxy, err := ioutil.ReadFile(filepath.Join(root, "etc/profile.d/juju-proxy.sh"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(proxy), gc.Equals, "\n# Added by juju\n[ -f \"/etc/juju-proxy.conf\" ] && . \"/etc/juju-proxy.conf\"\n")
+}
+
+func (s *cleanMachinesSuite) TestRunScriptAgain(c *gc.C) {
+	root := s.writeCleanMachine(c)
+	script := cleanMachineScript(FlatMachine{ID: "1"}, set.NewStrings(), false)
+	runCleanScript(c, root, script)
+	// Everything has been cleaned up, so the command reports
+	// "nothing to clean up".
+	output, commands := runCleanScript(c, root, script)
+	c.Check(output, gc.Equals, "")
+	c.Check(commands, gc.HasLen, 0)
+}
+
+func (s *cleanMachinesSuite) TestRunScriptDryRun(c *gc.C) {
+	root := s.writeCleanMachine(c)
+	output, commands := runCleanScript(c, root, cleanMachineScript(FlatMachine{ID: "1"}, set.NewStrings(cleanJujuDB), true))
+	c.Check(output, gc.Equals, `would remove /etc/rsyslog.d/25-juju.conf
+would remove /etc/rsyslog.d/26-juju-unit.conf
+would remove /etc/juju/rsyslog
+would restart rsyslog
+would remove /home/ubuntu/.juju-proxy
+would remove .juju-proxy from /home/ubuntu/.profile
+would write /etc/profile.d/juju-proxy.sh
+would remove /etc/cron.d/juju-ensure-rsyslog
+would remove /usr/bin/juju-run
+`)
+	c.Check(commands, gc.HasLen, 0)
+	for name := range cleanMachineFiles {
+		_, err := os.Lstat(filepath.Join(root, name))
+		c.Check(err, jc.ErrorIsNil, gc.Commentf(name))
+	}
+	_, err := os.Lstat(filepath.Join(root, "etc/profile.d/juju-proxy.sh"))
+	c.Check(os.IsNotExist(err), jc.IsTrue)
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/utils"
+	"github.com/kardianos/osext"
+)
+
+var cleanupDoc = `
+The purpose of the cleanup command is to remove everything the upgrader has
+left on the API server and the machines of the environment: the installed
+plugin, the cache of downloaded 2.x tools, and any temporary files. It
+should be run once the upgrade is finished, or abandoned.
+
+The audit log in /var/log/juju-1.25-upgrade is kept.
+
+Any of the other commands will install the plugin again if it is needed.
+`
+
+func newCleanupCommand() cmd.Command {
+	command := &cleanupCommand{}
+	command.remoteCommand = "cleanup-impl"
+	return wrap(command)
+}
+
+type cleanupCommand struct {
+	baseClientCommand
+}
+
+func (c *cleanupCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "cleanup",
+		Args:    "<environment name>",
+		Purpose: "remove the upgrader's files from the specified environment",
+		Doc:     cleanupDoc,
+	}
+}
+
+func (c *cleanupCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+var cleanupImplDoc = `
+
+cleanup-impl must be executed on an API server machine of a 1.25
+environment.
+
+The command will get a list of all the machines, and their addresses, and
+then ssh to all the machines to remove the upgrader's files, before
+removing them from the API server itself.
+
+`
+
+func newCleanupImplCommand() cmd.Command {
+	return &cleanupImplCommand{}
+}
+
+type cleanupImplCommand struct {
+	baseRemoteCommand
+}
+
+func (c *cleanupImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "cleanup-impl",
+		Purpose: "controller aspect of cleanup",
+		Doc:     cleanupImplDoc,
+	}
+}
+
+func (c *cleanupImplCommand) Init(args []string) error {
+	args, err := c.baseRemoteCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *cleanupImplCommand) Run(ctx *cmd.Context) error {
+	plugin, err := osext.Executable()
+	if err != nil {
+		return errors.Annotate(err, "finding plugin location")
+	}
+	pluginBase := filepath.Base(plugin)
+
+	states, err := c.getStates(ctx)
+	if err != nil {
+		return errors.Annotate(err, "getting state")
+	}
+	defer closeStates(states)
+
+	// Every machine is cleaned up, as the upgrader may have left
+	// files on any of them.
+	var machines []FlatMachine
+	for _, st := range states {
+		envMachines, err := getMachines(st)
+		if err != nil {
+			return errors.Annotate(err, "unable to get addresses for machines")
+		}
+		machines = append(machines, envMachines...)
+	}
+
+	audit := c.startAudit(ctx, states, c.Info().Name)
+
+	operation := "clean up"
+	progress := newProgressWriter(ctx.Stderr, operation)
+	results := parallelCall(audit, progress, operation, machines, cleanupScript(pluginBase, false))
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].MachineID < results[j].MachineID
+	})
+
+	var failed bool
+	for _, r := range results {
+		if r.Error != nil || r.Code != 0 {
+			logger.Warningf("machine: %s rc: %d\nstdout:%s\nstderr:%s", r.MachineID, r.Code, r.Stdout, r.Stderr)
+			fmt.Fprintf(ctx.Stdout, "machine %s: cannot clean up\n", r.MachineID)
+			failed = true
+			continue
+		}
+		for _, line := range nonEmptyLines(r.Stdout) {
+			fmt.Fprintf(ctx.Stdout, "machine %s: %s\n", r.MachineID, line)
+		}
+	}
+
+	// The API server is cleaned up last, as this command is running
+	// from the plugin installed there. It is usually one of the
+	// machines already cleaned up, in which case there is nothing
+	// left to do.
+	var stdout, stderr bytes.Buffer
+	local := exec.Command("bash", "-c", cleanupScript(pluginBase, true))
+	local.Stdout = &stdout
+	local.Stderr = &stderr
+	if err := local.Run(); err != nil {
+		logger.Warningf("cleaning up API server: %v\nstdout:%s\nstderr:%s", err, stdout.String(), stderr.String())
+		fmt.Fprintln(ctx.Stdout, "API server: cannot clean up")
+		failed = true
+	}
+	for _, line := range nonEmptyLines(stdout.String()) {
+		fmt.Fprintf(ctx.Stdout, "API server: %s\n", line)
+	}
+	audit.record(operation+" API server", map[string]interface{}{
+		"removed": nonEmptyLines(stdout.String()),
+	})
+
+	if failed {
+		return errors.New("some machines were not cleaned up")
+	}
+	return nil
+}
+
+// cleanupScript returns a script that removes the upgrader's files from a
+// machine, writing a line for each path it removes. As well as the
+// directory everything is now kept in, it removes the plugin and tools
+// cache from where earlier versions of the upgrader left them. On the API
+// server, where upgrade-agents and convert-uniter-state do their work, it
+// also removes the temporary files they leave if they are interrupted.
+func cleanupScript(pluginBase string, apiServer bool) string {
+	paths := []string{
+		upgraderDir,
+		pluginStagingPath(pluginBase),
+		"/home/ubuntu/" + pluginBase,
+		"/home/ubuntu/juju-1.25-upgrade-tools",
+	}
+	for i, path := range paths {
+		paths[i] = utils.ShQuote(path)
+	}
+	if apiServer {
+		paths = append(paths, "/tmp/tools-tar*", "/tmp/uniter-state*")
+	}
+	return fmt.Sprintf(`
+failed=
+for path in %s; do
+    [ -e "$path" ] || continue
+    if rm -rf "$path"; then
+        echo "removed $path"
+    else
+        failed=yes
+    fi
+done
+[ -z "$failed" ]
+`, strings.Join(paths, " "))
+}
+
+func nonEmptyLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,25 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type cleanupSuite struct{}
+
+var _ = gc.Suite(&cleanupSuite{})
+
+func (*cleanupSuite) TestCleanupScript(c *gc.C) {
+	script := cleanupScript("juju-1.25-upgrade", false)
+	c.Assert(script, jc.Contains, "for path in '"+upgraderDir+"' ")
+	c.Assert(script, jc.Contains, "'/home/ubuntu/juju-1.25-upgrade'")
+	c.Assert(script, gc.Not(jc.Contains), "/tmp/")
+}
+
+func (*cleanupSuite) TestCleanupScriptAPIServer(c *gc.C) {
+	script := cleanupScript("juju-1.25-upgrade", true)
+	c.Assert(script, jc.Contains, "'/home/ubuntu/juju-1.25-upgrade-tools' /tmp/tools-tar* /tmp/uniter-state*; do")
+}
@@ -58,26 +58,34 @@ func (c *dumpSourceDBImpl) Info() *cmd.Info {
 }
 
 func (c *dumpSourceDBImpl) Run(ctx *cmd.Context) error {
-	st, err := c.getState(ctx)
+	states, err := c.getStates(ctx)
 	if err != nil {
 		return errors.Annotate(err, "getting state")
 	}
-	defer st.Close()
+	defer closeStates(states)
 
-	data, err := st.DumpAll()
-	if err != nil {
-		return errors.Annotate(err, "dumping state collections")
-	}
+	c.startAudit(ctx, states, c.Info().Name)
 
-	// Check for LXC containers
-	bytes, err := yaml.Marshal(data)
-	if err != nil {
-		return errors.Annotate(err, "marshalling data")
-	}
+	// Each environment is written as a separate YAML document.
+	for i, st := range states {
+		data, err := st.DumpAll()
+		if err != nil {
+			return errors.Annotatef(err, "dumping state collections for %s", st.EnvironUUID())
+		}
 
-	_, err = ctx.GetStdout().Write(bytes)
-	if err != nil {
-		return errors.Annotate(err, "writing yaml data")
+		// Check for LXC containers
+		bytes, err := yaml.Marshal(data)
+		if err != nil {
+			return errors.Annotate(err, "marshalling data")
+		}
+
+		if i > 0 {
+			bytes = append([]byte(yamlDocumentSeparator), bytes...)
+		}
+		_, err = ctx.GetStdout().Write(bytes)
+		if err != nil {
+			return errors.Annotate(err, "writing yaml data")
+		}
 	}
 
 	return nil
@@ -0,0 +1,155 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/names"
+	"github.com/juju/utils/set"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+// yamlDocumentSeparator separates the YAML documents written by the remote
+// commands for each environment.
+const yamlDocumentSeparator = "---\n"
+
+// environmentSelector holds the flags used to choose which of the
+// environments hosted by a 1.25 state server the commands act on. If no
+// environments are selected, only the state server environment is used.
+// As with machineSelector, the client passes the flags through to the
+// remote command.
+type environmentSelector struct {
+	environments []string
+	all          bool
+}
+
+// SetFlags adds the environment selection flags to f.
+func (s *environmentSelector) SetFlags(f *gnuflag.FlagSet) {
+	f.Var(cmd.NewStringsValue(nil, &s.environments), "environments", "Act on these hosted environments (comma separated names or UUIDs)")
+	f.BoolVar(&s.all, "all-environments", false, "Act on all the environments hosted by the state server")
+}
+
+// validate checks that the selection flags are consistent.
+func (s *environmentSelector) validate() error {
+	if s.all && len(s.environments) > 0 {
+		return errors.New("--environments and --all-environments cannot be used together")
+	}
+	return nil
+}
+
+// remoteArgs returns the selection flags to pass on to the remote command.
+func (s *environmentSelector) remoteArgs() []string {
+	var args []string
+	if len(s.environments) > 0 {
+		args = append(args, "--environments", strings.Join(s.environments, ","))
+	}
+	if s.all {
+		args = append(args, "--all-environments")
+	}
+	return args
+}
+
+// openEnvironments returns a State for each of the selected environments,
+// given st for the state server environment. If st is not one of the
+// selected environments it is closed. The caller is responsible for
+// closing the States returned, using closeStates.
+func (s *environmentSelector) openEnvironments(st *state.State) (_ []*state.State, err error) {
+	if !s.all && len(s.environments) == 0 {
+		return []*state.State{st}, nil
+	}
+
+	environments, err := st.AllEnvironments()
+	if err != nil {
+		st.Close()
+		return nil, errors.Annotate(err, "getting environments")
+	}
+	selected, err := s.selectEnvironments(environments)
+	if err != nil {
+		st.Close()
+		return nil, errors.Trace(err)
+	}
+
+	var states []*state.State
+	defer func() {
+		if err != nil {
+			closeStates(states)
+		}
+	}()
+	keepServerState := false
+	for _, env := range selected {
+		if env.UUID() == st.EnvironUUID() {
+			states = append(states, st)
+			keepServerState = true
+			continue
+		}
+		envState, err := st.ForEnviron(names.NewEnvironTag(env.UUID()))
+		if err != nil {
+			if !keepServerState {
+				st.Close()
+			}
+			return nil, errors.Annotatef(err, "opening environment %q", env.Name())
+		}
+		states = append(states, envState)
+	}
+	if !keepServerState {
+		st.Close()
+	}
+	return states, nil
+}
+
+// selectEnvironments returns the environments matching the selection
+// flags, in the order given.
+func (s *environmentSelector) selectEnvironments(environments []*state.Environment) ([]*state.Environment, error) {
+	if s.all {
+		return environments, nil
+	}
+	var selected []*state.Environment
+	seen := set.NewStrings()
+	for _, nameOrUUID := range s.environments {
+		var found *state.Environment
+		for _, env := range environments {
+			if env.UUID() == nameOrUUID || env.Name() == nameOrUUID {
+				if found != nil {
+					return nil, errors.Errorf("more than one environment named %q, use the UUID", nameOrUUID)
+				}
+				found = env
+			}
+		}
+		if found == nil {
+			return nil, errors.NotFoundf("environment %q", nameOrUUID)
+		}
+		if !seen.Contains(found.UUID()) {
+			seen.Add(found.UUID())
+			selected = append(selected, found)
+		}
+	}
+	return selected, nil
+}
+
+// closeStates closes all of the States.
+func closeStates(states []*state.State) {
+	for _, st := range states {
+		if err := st.Close(); err != nil {
+			logger.Warningf("closing state for %s: %v", st.EnvironUUID(), err)
+		}
+	}
+}
+
+// splitYAMLDocuments splits the output of a remote command into the YAML
+// documents written for each environment.
+func splitYAMLDocuments(data string) []string {
+	var documents []string
+	for _, document := range strings.Split("\n"+data, "\n"+yamlDocumentSeparator) {
+		document = strings.TrimPrefix(document, "\n")
+		if strings.TrimSpace(document) != "" {
+			documents = append(documents, document)
+		}
+	}
+	return documents
+}
@@ -0,0 +1,35 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type environmentsSuite struct{}
+
+var _ = gc.Suite(&environmentsSuite{})
+
+func (*environmentsSuite) TestValidate(c *gc.C) {
+	s := environmentSelector{environments: []string{"prod"}}
+	c.Assert(s.validate(), jc.ErrorIsNil)
+	s.all = true
+	c.Assert(s.validate(), gc.ErrorMatches, "--environments and --all-environments cannot be used together")
+}
+
+func (*environmentsSuite) TestRemoteArgs(c *gc.C) {
+	c.Assert((&environmentSelector{}).remoteArgs(), gc.HasLen, 0)
+	s := environmentSelector{environments: []string{"prod", "staging"}}
+	c.Assert(s.remoteArgs(), jc.DeepEquals, []string{"--environments", "prod,staging"})
+	s = environmentSelector{all: true}
+	c.Assert(s.remoteArgs(), jc.DeepEquals, []string{"--all-environments"})
+}
+
+func (*environmentsSuite) TestSplitYAMLDocuments(c *gc.C) {
+	c.Assert(splitYAMLDocuments(""), gc.HasLen, 0)
+	c.Assert(splitYAMLDocuments("a: 1\n"), jc.DeepEquals, []string{"a: 1\n"})
+	c.Assert(splitYAMLDocuments("a: 1\n---\nb: 2\n"), jc.DeepEquals, []string{"a: 1", "b: 2\n"})
+	c.Assert(splitYAMLDocuments("---\na: 1\n"), jc.DeepEquals, []string{"a: 1\n"})
+}
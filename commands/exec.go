@@ -2,6 +2,8 @@ package commands
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"sync"
 
 	"github.com/juju/cmd"
@@ -12,12 +14,27 @@ import (
 
 const systemIdentity = "/var/lib/juju/system-identity"
 
+// sshConnectionFailedCode is the exit code ssh uses when it cannot
+// connect to the remote machine.
+const sshConnectionFailedCode = 255
+
 type FlatMachine struct {
 	Model   string
 	Series  string
 	ID      string
 	Address string
 	Tools   string
+
+	// Controller is true for the 1.25 state server machines.
+	Controller bool
+
+	// For a container, ParentID and ParentAddress identify the
+	// machine hosting it, ContainerType is the kind of container, and
+	// InstanceID is the name of the container on its host.
+	ParentID      string
+	ParentAddress string
+	ContainerType string
+	InstanceID    string
 }
 
 type RunResult struct {
@@ -28,17 +45,52 @@ type RunResult struct {
 
 // runViaSSH runs script in the remote machine with address addr.
 func runViaSSH(addr string, script, identity string) (RunResult, error) {
-	// This is taken from cmd/juju/ssh.go there is no other clear way to set user
-	userAddr := "ubuntu@" + addr
-	sshOptions := ssh.Options{}
+	return runViaSSHStreaming(addr, script, identity, nil, nil)
+}
+
+// runViaSSHStreaming runs script in the remote machine with address addr,
+// as runViaSSH does. If stdin is not nil, the script reads its input from
+// it; this keeps secrets out of the command line, where other users of
+// the machine could see them. If onStderr is not nil, it is also called
+// with each line of stderr as the script writes it.
+func runViaSSHStreaming(addr string, script, identity string, stdin io.Reader, onStderr func(line string)) (RunResult, error) {
+	return runSSH(addr, script, newSSHOptions(identity, ""), stdin, onStderr)
+}
+
+// newSSHOptions returns the options for connecting to a machine with the
+// identity. If proxyAddr is not empty, the connection is made through
+// the machine with that address.
+func newSSHOptions(identity, proxyAddr string) *ssh.Options {
+	sshOptions := &ssh.Options{}
 	if identity != "" {
 		sshOptions.SetIdentities(identity) //
 	}
-	userCmd := ssh.Command(userAddr, []string{"sudo", "-n", "bash", "-c " + utils.ShQuote(script)}, &sshOptions)
+	if proxyAddr != "" {
+		proxy := []string{"ssh", "-q", "-o", "StrictHostKeyChecking=no"}
+		if identity != "" {
+			proxy = append(proxy, "-i", identity)
+		}
+		sshOptions.SetProxyCommand(append(proxy, "ubuntu@"+proxyAddr, "nc %h %p")...)
+	}
+	return sshOptions
+}
+
+// runSSH runs script as root on the machine with address addr. It is a
+// variable so that tests can stub out ssh.
+var runSSH = func(addr string, script string, sshOptions *ssh.Options, stdin io.Reader, onStderr func(line string)) (RunResult, error) {
+	// This is taken from cmd/juju/ssh.go there is no other clear way to set user
+	userAddr := "ubuntu@" + addr
+	userCmd := ssh.Command(userAddr, []string{"sudo", "-n", "bash", "-c " + utils.ShQuote(script)}, sshOptions)
 	var stdoutBuf bytes.Buffer
 	var stderrBuf bytes.Buffer
+	userCmd.Stdin = stdin
 	userCmd.Stdout = &stdoutBuf
 	userCmd.Stderr = &stderrBuf
+	if onStderr != nil {
+		lines := &lineWriter{fn: onStderr}
+		defer lines.flush()
+		userCmd.Stderr = io.MultiWriter(&stderrBuf, lines)
+	}
 	var result RunResult
 	// logger.Debugf("executing %s, script:\n%s", addr, script)
 	err := userCmd.Run()
@@ -55,6 +107,54 @@ func runViaSSH(addr string, script, identity string) (RunResult, error) {
 	return result, nil
 }
 
+// runOnMachine runs script on the machine. If the machine is a container
+// that cannot be reached directly, as happens with LXC containers on hosts
+// without bridged networking, the script is run through the machine
+// hosting the container instead.
+//
+// Whether a container can be reached is found out before the script is
+// run, so that the script is run exactly once: a script may exit with the
+// same code as ssh does when it cannot connect, and the scripts that stop
+// and upgrade agents must not be run twice.
+func runOnMachine(machine FlatMachine, script, identity string) (RunResult, error) {
+	if machine.ParentID == "" || sshReachable(machine.Address, newSSHOptions(identity, "")) {
+		return runViaSSH(machine.Address, script, identity)
+	}
+	logger.Debugf("cannot reach machine %s directly, trying through machine %s", machine.ID, machine.ParentID)
+	switch machine.ContainerType {
+	case "lxc":
+		return runViaSSH(machine.ParentAddress, lxcAttachScript(machine, script), identity)
+	case "kvm":
+		// Unlike an LXC container, a KVM guest cannot be entered from
+		// the host without a login, and virsh console is interactive.
+		// The guest is always reachable from its host though, so ssh
+		// to it through the host, which needs nc to forward the
+		// connection.
+		found, err := runViaSSH(machine.ParentAddress, "command -v nc", identity)
+		if err != nil {
+			return found, errors.Annotatef(err, "checking for nc on machine %s", machine.ParentID)
+		}
+		if found.Code != 0 {
+			return found, errors.Errorf("machine %s can only be reached through machine %s, which needs nc installed", machine.ID, machine.ParentID)
+		}
+		return runSSH(machine.Address, script, newSSHOptions(identity, machine.ParentAddress), nil, nil)
+	}
+	return runViaSSH(machine.Address, script, identity)
+}
+
+// sshReachable returns whether the machine with address addr accepts ssh
+// connections, by running true on it.
+func sshReachable(addr string, sshOptions *ssh.Options) bool {
+	result, err := runSSH(addr, "true", sshOptions, nil, nil)
+	return err == nil && result.Code != sshConnectionFailedCode
+}
+
+// lxcAttachScript returns a script to run on the container's host, that
+// runs script inside the container.
+func lxcAttachScript(machine FlatMachine, script string) string {
+	return fmt.Sprintf("lxc-attach -n %s -- bash -c %s\n", utils.ShQuote(machine.InstanceID), utils.ShQuote(script))
+}
+
 type DistResult struct {
 	Model     string
 	Series    string
@@ -65,7 +165,18 @@ type DistResult struct {
 	Stderr    string
 }
 
-func parallelCall(machines []FlatMachine, script string) []DistResult {
+// parallelCall runs script on all of the machines, recording the result
+// for each machine in the audit log under the given operation, and
+// reporting progress as each call starts and finishes.
+func parallelCall(audit *auditor, progress *progressWriter, operation string, machines []FlatMachine, script string) []DistResult {
+	return parallelCallEach(audit, progress, operation, machines, func(FlatMachine) string {
+		return script
+	})
+}
+
+// parallelCallEach runs a script on all of the machines, as parallelCall
+// does, with the script for each machine given by scriptFor.
+func parallelCallEach(audit *auditor, progress *progressWriter, operation string, machines []FlatMachine, scriptFor func(FlatMachine) string) []DistResult {
 
 	var (
 		wg      sync.WaitGroup
@@ -73,11 +184,14 @@ func parallelCall(machines []FlatMachine, script string) []DistResult {
 		lock    sync.Mutex
 	)
 
+	progress.begin(len(machines))
 	for _, machine := range machines {
 		wg.Add(1)
 		go func(machine FlatMachine) {
 			defer wg.Done()
-			run, err := runViaSSH(machine.Address, script, systemIdentity)
+			progress.started(machine.ID)
+			run, err := runOnMachine(machine, scriptFor(machine), systemIdentity)
+			progress.finished(machine.ID, run.Code, err)
 			result := DistResult{
 				Model:     machine.Model,
 				Series:    machine.Series,
@@ -87,6 +201,15 @@ func parallelCall(machines []FlatMachine, script string) []DistResult {
 				Stdout:    run.Stdout,
 				Stderr:    run.Stderr,
 			}
+			auditData := map[string]interface{}{
+				"machine":   machine.ID,
+				"address":   machine.Address,
+				"exit-code": run.Code,
+			}
+			if err != nil {
+				auditData["error"] = err.Error()
+			}
+			audit.recordFor(machine.Model, operation, auditData)
 			lock.Lock()
 			defer lock.Unlock()
 			results = append(results, result)
@@ -95,6 +218,7 @@ func parallelCall(machines []FlatMachine, script string) []DistResult {
 
 	logger.Debugf("Waiting for copies for finish")
 	wg.Wait()
+	progress.end()
 
 	// Sort the results
 	return results
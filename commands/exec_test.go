@@ -0,0 +1,120 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"io"
+
+	jujutesting "github.com/juju/testing"
+	"github.com/juju/utils/ssh"
+	gc "gopkg.in/check.v1"
+)
+
+type execSuite struct {
+	jujutesting.CleanupSuite
+}
+
+var _ = gc.Suite(&execSuite{})
+
+func (*execSuite) TestLXCAttachScript(c *gc.C) {
+	machine := FlatMachine{
+		ID:            "0/lxc/1",
+		ParentID:      "0",
+		ContainerType: "lxc",
+		InstanceID:    "juju-machine-0-lxc-1",
+	}
+	script := lxcAttachScript(machine, "echo 'hello'\n")
+	c.Assert(script, gc.Equals, `lxc-attach -n 'juju-machine-0-lxc-1' -- bash -c 'echo '"'"'hello'"'"'
+'
+`)
+}
+
+// sshCall records a call made through runSSH.
+type sshCall struct {
+	addr   string
+	script string
+}
+
+// stubSSH replaces runSSH for the test, recording each call and giving
+// the exit code for it from codes, keyed by address and script. Calls
+// not in codes succeed.
+func (s *execSuite) stubSSH(codes map[sshCall]int) *[]sshCall {
+	var calls []sshCall
+	s.PatchValue(&runSSH, func(addr string, script string, _ *ssh.Options, _ io.Reader, _ func(string)) (RunResult, error) {
+		call := sshCall{addr, script}
+		calls = append(calls, call)
+		return RunResult{Code: codes[call]}, nil
+	})
+	return &calls
+}
+
+var lxcMachine = FlatMachine{
+	ID:            "0/lxc/1",
+	Address:       "10.0.3.5",
+	ParentID:      "0",
+	ParentAddress: "10.0.0.1",
+	ContainerType: "lxc",
+	InstanceID:    "juju-machine-0-lxc-1",
+}
+
+var kvmMachine = FlatMachine{
+	ID:            "0/kvm/0",
+	Address:       "192.168.122.5",
+	ParentID:      "0",
+	ParentAddress: "10.0.0.1",
+	ContainerType: "kvm",
+	InstanceID:    "juju-machine-0-kvm-0",
+}
+
+func (s *execSuite) TestRunOnMachineNotContainer(c *gc.C) {
+	calls := s.stubSSH(map[sshCall]int{{"10.0.0.1", "stop"}: 255})
+	result, err := runOnMachine(FlatMachine{ID: "0", Address: "10.0.0.1"}, "stop", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 255)
+	c.Assert(*calls, gc.DeepEquals, []sshCall{{"10.0.0.1", "stop"}})
+}
+
+func (s *execSuite) TestRunOnMachineReachableContainer(c *gc.C) {
+	// The script exits with ssh's connection failure code itself,
+	// and is not run again through the host.
+	calls := s.stubSSH(map[sshCall]int{{"10.0.3.5", "stop"}: 255})
+	result, err := runOnMachine(lxcMachine, "stop", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 255)
+	c.Assert(*calls, gc.DeepEquals, []sshCall{{"10.0.3.5", "true"}, {"10.0.3.5", "stop"}})
+}
+
+func (s *execSuite) TestRunOnMachineLXCThroughHost(c *gc.C) {
+	calls := s.stubSSH(map[sshCall]int{{"10.0.3.5", "true"}: 255})
+	_, err := runOnMachine(lxcMachine, "stop", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(*calls, gc.DeepEquals, []sshCall{
+		{"10.0.3.5", "true"},
+		{"10.0.0.1", lxcAttachScript(lxcMachine, "stop")},
+	})
+}
+
+func (s *execSuite) TestRunOnMachineKVMThroughHost(c *gc.C) {
+	calls := s.stubSSH(map[sshCall]int{{"192.168.122.5", "true"}: 255})
+	_, err := runOnMachine(kvmMachine, "stop", "")
+	c.Assert(err, gc.IsNil)
+	c.Assert(*calls, gc.DeepEquals, []sshCall{
+		{"192.168.122.5", "true"},
+		{"10.0.0.1", "command -v nc"},
+		{"192.168.122.5", "stop"},
+	})
+}
+
+func (s *execSuite) TestRunOnMachineKVMHostWithoutNC(c *gc.C) {
+	calls := s.stubSSH(map[sshCall]int{
+		{"192.168.122.5", "true"}:     255,
+		{"10.0.0.1", "command -v nc"}: 1,
+	})
+	_, err := runOnMachine(kvmMachine, "stop", "")
+	c.Assert(err, gc.ErrorMatches, "machine 0/kvm/0 can only be reached through machine 0, which needs nc installed")
+	c.Assert(*calls, gc.DeepEquals, []sshCall{
+		{"192.168.122.5", "true"},
+		{"10.0.0.1", "command -v nc"},
+	})
+}
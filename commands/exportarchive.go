@@ -0,0 +1,459 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/juju/cmd"
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils"
+	"github.com/juju/utils/set"
+	"github.com/juju/utils/ssh"
+	"github.com/juju/version"
+	charm1 "gopkg.in/juju/charm.v5"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+	"github.com/juju/1.25-upgrade/juju1/state/storage"
+	version1 "github.com/juju/1.25-upgrade/juju1/version"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/migration"
+)
+
+// archiveDir holds the archives written by export-archive-impl on the
+// API server, until the client has copied them.
+const archiveDir = upgraderDir + "/archives"
+
+var exportArchiveDoc = `
+The purpose of the export-archive command is to save a 1.25 environment to
+an archive file, so that it can be imported into a Juju 2.x controller later
+with import-archive, rather than straight away.
+
+The archive holds the exported environment, the charms and agent binaries it
+uses, and its logs, along with a manifest of the size and SHA256 hash of each
+of them. Agent binaries that the API server does not have are left out, and
+--no-logs leaves out the logs. As with juju migrate, --log-max-age,
+--log-level, --log-include and --log-exclude limit which log records are
+archived. The archive is written to the --output-dir directory, and named
+after the environment and its UUID.
+
+The environment is exported as it would be with the --model-name, --owner,
+--cloud, --region and --credential flags, which are described in the help for
+verify-source. With --environments or --all-environments an archive is
+written for each of the selected environments.
+
+The archive holds the environment's cloud credentials unless --credential is
+given, so it should be kept as securely as the environment itself.
+
+`
+
+func newExportArchiveCommand() cmd.Command {
+	command := &exportArchiveCommand{}
+	command.overridable = true
+	command.remoteCommand = "export-archive-impl"
+	return wrap(command)
+}
+
+type exportArchiveCommand struct {
+	baseClientCommand
+
+	outputDir string
+	noLogs    bool
+	logFilter archiveLogFilter
+}
+
+func (c *exportArchiveCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "export-archive",
+		Args:    "<environment name>",
+		Purpose: "save a 1.25 environment to an archive for importing later",
+		Doc:     exportArchiveDoc,
+	}
+}
+
+func (c *exportArchiveCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseClientCommand.SetFlags(f)
+	f.StringVar(&c.outputDir, "output-dir", ".", "Directory to write the archives to")
+	f.BoolVar(&c.noLogs, "no-logs", false, "Leave the environment's logs out of the archives")
+	c.logFilter.SetFlags(f)
+}
+
+func (c *exportArchiveCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.logFilter.validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if c.noLogs {
+		c.remoteFlags = append(c.remoteFlags, "--no-logs")
+	}
+	c.remoteFlags = append(c.remoteFlags, c.logFilter.remoteArgs()...)
+	return cmd.CheckEmpty(args)
+}
+
+func (c *exportArchiveCommand) Run(ctx *cmd.Context) error {
+	outputDir := ctx.AbsPath(c.outputDir)
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		return errors.Trace(err)
+	}
+	result, err := c.runRemote(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if result.Code != 0 {
+		fmt.Fprintf(ctx.Stderr, result.Stderr)
+		return &cmd.RcPassthroughError{result.Code}
+	}
+
+	// The remote command writes the path of each archive it wrote.
+	// They are copied here and then removed from the API server,
+	// which would otherwise be left holding the credentials.
+	remotePaths := nonEmptyLines(result.Stdout)
+	if len(remotePaths) == 0 {
+		return errors.New("no archives written")
+	}
+	options := newSSHOptions("", "")
+	for _, remotePath := range remotePaths {
+		local := filepath.Join(outputDir, path.Base(remotePath))
+		ctx.Infof("copying %s", path.Base(remotePath))
+		source := fmt.Sprintf("ubuntu@%s:%s", c.address, remotePath)
+		if err := ssh.Copy([]string{source, local}, options); err != nil {
+			return errors.Annotatef(err, "copying archive %s", remotePath)
+		}
+		removed, err := runViaSSH(c.address, "rm -f "+utils.ShQuote(remotePath), "")
+		if err == nil && removed.Code != 0 {
+			err = errors.New(removed.Stderr)
+		}
+		if err != nil {
+			logger.Warningf("removing archive %s from API server: %v", remotePath, err)
+		}
+		fmt.Fprintf(ctx.Stdout, "Archive written to %s\n", local)
+	}
+	return nil
+}
+
+var exportArchiveImplDoc = `
+
+export-archive-impl must be executed on an API server machine of a 1.25
+environment.
+
+The command writes an archive of each environment selected to the upgrader's
+directory on the API server, and writes the path of each archive to stdout.
+The archives are owned by the ubuntu user, so that the client can copy them.
+
+`
+
+func newExportArchiveImplCommand() cmd.Command {
+	command := &exportArchiveImplCommand{}
+	command.overridable = true
+	return command
+}
+
+type exportArchiveImplCommand struct {
+	baseRemoteCommand
+
+	noLogs    bool
+	logFilter archiveLogFilter
+}
+
+func (c *exportArchiveImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "export-archive-impl",
+		Purpose: "controller aspect of export-archive",
+		Doc:     exportArchiveImplDoc,
+	}
+}
+
+func (c *exportArchiveImplCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseRemoteCommand.SetFlags(f)
+	f.BoolVar(&c.noLogs, "no-logs", false, "Leave the environment's logs out of the archives")
+	c.logFilter.SetFlags(f)
+}
+
+func (c *exportArchiveImplCommand) Init(args []string) error {
+	args, err := c.baseRemoteCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := c.logFilter.validate(); err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *exportArchiveImplCommand) Run(ctx *cmd.Context) error {
+	states, err := c.getStates(ctx)
+	if err != nil {
+		return errors.Annotate(err, "getting state")
+	}
+	defer closeStates(states)
+
+	if c.overrides.modelName != "" && len(states) > 1 {
+		return errors.New("--model-name cannot be used with more than one environment")
+	}
+	audit := c.startAudit(ctx, states, c.Info().Name)
+	if args := c.overrides.remoteArgs(); len(args) > 0 {
+		audit.record("export overrides", map[string]interface{}{"overrides": args})
+	}
+	if err := os.MkdirAll(archiveDir, 0700); err != nil {
+		return errors.Trace(err)
+	}
+	if err := chownToHomeOwner(archiveDir); err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, st := range states {
+		archivePath, files, err := c.writeArchive(ctx, st)
+		if err != nil {
+			return errors.Annotatef(err, "writing archive for %s", st.EnvironUUID())
+		}
+		audit.recordFor(st.EnvironUUID(), "write archive", map[string]interface{}{
+			"path":  archivePath,
+			"files": files,
+		})
+		fmt.Fprintln(ctx.Stdout, archivePath)
+	}
+	return nil
+}
+
+// writeArchive writes an archive of the environment to archiveDir,
+// returning its path and the number of files in it.
+func (c *exportArchiveImplCommand) writeArchive(ctx *cmd.Context, st *state.State) (_ string, _ int, err error) {
+	model, err := st.ExportWithOverrides(c.overrides.stateOverrides())
+	if err != nil {
+		return "", 0, errors.Annotate(err, "exporting model representation")
+	}
+	if err := saveSourceSummary(sourceSummaryDir, st.EnvironUUID(), summariseSourceModel(model)); err != nil {
+		return "", 0, errors.Annotate(err, "saving environment summary")
+	}
+	serialized, err := description.Serialize(model)
+	if err != nil {
+		return "", 0, errors.Annotate(err, "serializing model representation")
+	}
+	config := model.Config()
+	name, _ := config["name"].(string)
+	agentVersion, _ := config["agent-version"].(string)
+
+	archivePath := path.Join(archiveDir, fmt.Sprintf("%s-%s.tar.gz", name, model.Tag().Id()))
+	f, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", 0, errors.Trace(err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = errors.Trace(closeErr)
+		}
+		if err != nil {
+			os.Remove(archivePath)
+		}
+	}()
+
+	w := migration.NewArchiveWriter(f, migration.ArchiveManifest{
+		Created:       time.Now().UTC().Format(time.RFC3339),
+		ModelUUID:     model.Tag().Id(),
+		ModelName:     name,
+		SourceVersion: agentVersion,
+	})
+	if err := w.AddModel(serialized); err != nil {
+		return "", 0, errors.Trace(err)
+	}
+	files := 1
+	for _, curl := range archiveCharms(model) {
+		ctx.Infof("adding charm %s", curl)
+		if err := addArchiveCharm(w, st, curl); err != nil {
+			return "", 0, errors.Annotatef(err, "adding charm %s", curl)
+		}
+		files++
+	}
+	added, err := addArchiveTools(w, st, archiveTools(model))
+	if err != nil {
+		return "", 0, errors.Trace(err)
+	}
+	files += added
+	if !c.noLogs {
+		ctx.Infof("adding logs")
+		if err := addArchiveLogs(w, st, c.logFilter.tailerParams(time.Now())); err != nil {
+			return "", 0, errors.Annotate(err, "adding logs")
+		}
+		files++
+	}
+	if err := w.Close(); err != nil {
+		return "", 0, errors.Trace(err)
+	}
+	if err := chownToHomeOwner(archivePath); err != nil {
+		return "", 0, errors.Trace(err)
+	}
+	return archivePath, files, nil
+}
+
+// archiveCharms returns the URLs of the charms used by the model's
+// applications.
+func archiveCharms(model description.Model) []string {
+	charms := set.NewStrings()
+	for _, app := range model.Applications() {
+		charms.Add(app.CharmURL())
+	}
+	return charms.SortedValues()
+}
+
+// archiveTools returns the versions of the agent binaries used by the
+// model's machines and units.
+func archiveTools(model description.Model) []version.Binary {
+	versions := make(map[version.Binary]bool)
+	var addMachines func([]description.Machine)
+	addMachines = func(machines []description.Machine) {
+		for _, m := range machines {
+			if tools := m.Tools(); tools != nil {
+				versions[tools.Version()] = true
+			}
+			addMachines(m.Containers())
+		}
+	}
+	addMachines(model.Machines())
+	for _, app := range model.Applications() {
+		for _, unit := range app.Units() {
+			if tools := unit.Tools(); tools != nil {
+				versions[tools.Version()] = true
+			}
+		}
+	}
+	result := make([]version.Binary, 0, len(versions))
+	for v := range versions {
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+	return result
+}
+
+// addArchiveCharm adds the charm archive from the environment's storage,
+// checking it against the hash recorded when it was uploaded.
+func addArchiveCharm(w *migration.ArchiveWriter, st *state.State, curl string) error {
+	ch, err := st.Charm(charm1.MustParseURL(curl))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	stor := storage.NewStorage(st.EnvironUUID(), st.MongoSession())
+	r, size, err := stor.Get(ch.StoragePath())
+	if err != nil {
+		return errors.Annotate(err, "reading charm from storage")
+	}
+	defer r.Close()
+	file, err := w.AddCharm(curl, r, size)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if expected := ch.BundleSha256(); expected != "" && file.SHA256 != expected {
+		return errors.Errorf("sha256 %s, expected %s", file.SHA256, expected)
+	}
+	return nil
+}
+
+// addArchiveTools adds the agent binaries of each version from the
+// environment's tools storage, returning how many were added. Those not
+// in storage are left out; this happens when the agents downloaded them
+// from elsewhere.
+func addArchiveTools(w *migration.ArchiveWriter, st *state.State, versions []version.Binary) (int, error) {
+	toolsStorage, err := st.ToolsStorage()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer toolsStorage.Close()
+
+	added := 0
+	for _, v := range versions {
+		v1, err := version1.ParseBinary(v.String())
+		if err != nil {
+			return added, errors.Trace(err)
+		}
+		metadata, r, err := toolsStorage.Tools(v1)
+		if errors.IsNotFound(err) {
+			logger.Warningf("agent binaries %s not in storage, leaving them out of the archive", v)
+			continue
+		} else if err != nil {
+			return added, errors.Annotatef(err, "reading agent binaries %s", v)
+		}
+		file, err := w.AddTools(v, r, metadata.Size)
+		r.Close()
+		if err != nil {
+			return added, errors.Annotatef(err, "adding agent binaries %s", v)
+		}
+		if metadata.SHA256 != "" && file.SHA256 != metadata.SHA256 {
+			return added, errors.Errorf("agent binaries %s have sha256 %s, expected %s", v, file.SHA256, metadata.SHA256)
+		}
+		added++
+	}
+	return added, nil
+}
+
+// addArchiveLogs adds the environment's logs that match params, in the
+// form they are sent to a 2.x controller after a migration. They are
+// written to a temporary file first, as the archive needs to know their
+// size.
+func addArchiveLogs(w *migration.ArchiveWriter, st *state.State, params *state.LogTailerParams) error {
+	tempFile, err := ioutil.TempFile("", "juju-archive-logs")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}()
+
+	encoder := json.NewEncoder(tempFile)
+	err = state.ExportLogs(st, params, func(record *state.LogRecord) error {
+		return encoder.Encode(logRecordToParams(record))
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	size, err := tempFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	_, err = w.AddLogs(tempFile, size)
+	return errors.Trace(err)
+}
+
+func logRecordToParams(record *state.LogRecord) params.LogRecord {
+	return params.LogRecord{
+		Time:     record.Time,
+		Module:   record.Module,
+		Location: record.Location,
+		Level:    record.Level.String(),
+		Message:  record.Message,
+		Entity:   record.Entity,
+	}
+}
+
+// chownToHomeOwner gives the file to the owner of the ubuntu user's home
+// directory, so that it can be copied from the API server over SSH.
+func chownToHomeOwner(filePath string) error {
+	info, err := os.Stat("/home/ubuntu")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("cannot find owner of /home/ubuntu")
+	}
+	return errors.Trace(os.Chown(filePath, int(stat.Uid), int(stat.Gid)))
+}
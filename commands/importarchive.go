@@ -0,0 +1,401 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/juju/cmd"
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils/clock"
+	"github.com/juju/version"
+	"gopkg.in/juju/charm.v6-unstable"
+
+	"github.com/juju/1.25-upgrade/juju2/api/base"
+	"github.com/juju/1.25-upgrade/juju2/api/migrationtarget"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/cmd/modelcmd"
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
+	"github.com/juju/1.25-upgrade/juju2/migration"
+	"github.com/juju/1.25-upgrade/juju2/resource"
+	"github.com/juju/1.25-upgrade/juju2/tools"
+)
+
+var importArchiveDoc = `
+The purpose of the import-archive command is to import an environment saved
+by export-archive into a Juju 2.x controller.
+
+Every file in the archive is checked against the manifest before anything is
+sent to the controller. Only Juju 2.1 and 2.2 controllers are supported.
+
+The controller runs its migration prechecks on the archived model first. If
+they fail and the controller is known to accept a later version of the model
+description, the description is upgraded to that version and the prechecks
+are run again. Archives written by this tool use the only version there is
+so far, so no upgrade is needed for the supported controllers. Once the
+prechecks pass, the model is imported, its charms and agent binaries are
+uploaded, and the model is activated. The environment's logs, if the archive
+has them, are sent last; --no-logs leaves them out, and
+--log-records-per-second and --log-kib-per-second limit how quickly they are
+sent, as with juju migrate.
+
+If anything fails before the model is activated, the model is removed from
+the controller again, and the command can be run again once the problem has
+been fixed.
+
+`
+
+// archiveUploadParallelism is the number of binaries uploaded to the
+// controller at once.
+const archiveUploadParallelism = 4
+
+func newImportArchiveCommand() cmd.Command {
+	return modelcmd.WrapController(&importArchiveCommand{}, modelcmd.WrapControllerSkipControllerFlags)
+}
+
+type importArchiveCommand struct {
+	modelcmd.ControllerCommandBase
+
+	archivePath      string
+	noLogs           bool
+	logRecordsPerSec int
+	logKiBPerSec     int
+}
+
+func (c *importArchiveCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "import-archive",
+		Args:    "<archive file> <controller name>",
+		Purpose: "import an environment archive into a controller",
+		Doc:     importArchiveDoc,
+	}
+}
+
+func (c *importArchiveCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.ControllerCommandBase.SetFlags(f)
+	f.BoolVar(&c.noLogs, "no-logs", false, "Do not send the environment's logs to the controller")
+	f.IntVar(&c.logRecordsPerSec, "log-records-per-second", 0, "Send at most this many log records per second (default unlimited)")
+	f.IntVar(&c.logKiBPerSec, "log-kib-per-second", 0, "Send at most this many KiB of logs per second (default unlimited)")
+}
+
+func (c *importArchiveCommand) Init(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no archive file specified")
+	}
+	c.archivePath, args = args[0], args[1:]
+	if len(args) == 0 {
+		return errors.New("no controller name specified")
+	}
+	if err := c.SetControllerName(args[0], false); err != nil {
+		return errors.Trace(err)
+	}
+	if c.logRecordsPerSec < 0 {
+		return errors.New("--log-records-per-second must not be negative")
+	}
+	if c.logKiBPerSec < 0 {
+		return errors.New("--log-kib-per-second must not be negative")
+	}
+	return cmd.CheckEmpty(args[1:])
+}
+
+func (c *importArchiveCommand) Run(ctx *cmd.Context) error {
+	f, err := os.Open(ctx.AbsPath(c.archivePath))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	dir, err := ioutil.TempDir("", "juju-import-archive")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx.Infof("checking archive")
+	archive, err := migration.ReadArchive(f, dir)
+	if err != nil {
+		return errors.Annotate(err, "reading archive")
+	}
+
+	conn, err := c.NewAPIRoot()
+	if err != nil {
+		return errors.Annotate(err, "connecting to target controller")
+	}
+	defer conn.Close()
+	controllerVersion, ok := conn.ServerVersion()
+	if !ok {
+		return errors.New("controller version not available")
+	}
+
+	importer := &archiveImporter{
+		ctx:               ctx,
+		client:            migrationtarget.NewClient(conn),
+		archive:           archive,
+		controllerVersion: controllerVersion,
+		transferLogs:      !c.noLogs,
+		logTransfer: coremigration.LogTransferOptions{
+			MaxRecordsPerSecond: c.logRecordsPerSec,
+			MaxBytesPerSecond:   c.logKiBPerSec * 1024,
+		},
+		clock: clock.WallClock,
+	}
+	if err := importer.run(); err != nil {
+		return errors.Trace(err)
+	}
+	controllerName, _ := c.ControllerName()
+	fmt.Fprintf(ctx.Stdout, "Model %q imported into controller %q\n", archive.Manifest.ModelName, controllerName)
+	return nil
+}
+
+// archiveTargetClient holds the methods of the migrationtarget client
+// used to import an archive.
+type archiveTargetClient interface {
+	Prechecks(coremigration.ModelInfo) error
+	StreamModel(modelUUID string, content io.ReadSeeker) error
+	UploadedBinaries(modelUUID string) (coremigration.UploadedBinaries, error)
+	UploadCharm(modelUUID string, curl *charm.URL, content io.ReadSeeker) (*charm.URL, error)
+	UploadTools(modelUUID string, r io.ReadSeeker, vers version.Binary, additionalSeries ...string) (tools.List, error)
+	UploadResource(modelUUID string, res resource.Resource, r io.ReadSeeker) error
+	SetPlaceholderResource(modelUUID string, res resource.Resource) error
+	SetUnitResource(modelUUID, unit string, res resource.Resource) error
+	Activate(modelUUID string) error
+	Abort(modelUUID string) error
+	OpenLogTransferStream(modelUUID string) (base.Stream, error)
+}
+
+// archiveImporter imports an unpacked archive into a controller.
+type archiveImporter struct {
+	ctx               *cmd.Context
+	client            archiveTargetClient
+	archive           *migration.Archive
+	controllerVersion version.Number
+	transferLogs      bool
+
+	// logTransfer limits how quickly the logs are sent. Only its
+	// rate limits are used, as the logs were filtered when the
+	// archive was written.
+	logTransfer coremigration.LogTransferOptions
+	clock       clock.Clock
+}
+
+func (i *archiveImporter) run() (err error) {
+	original, err := i.archive.Model()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// The description is deserialized as it was exported, since this
+	// tool may not understand the version it is upgraded to.
+	model, err := description.Deserialize(original)
+	if err != nil {
+		return errors.Annotate(err, "reading archived model")
+	}
+	upgraded, info, err := i.prepareModel(model, original)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	i.ctx.Infof("importing model")
+	if err := i.client.StreamModel(info.UUID, bytes.NewReader(upgraded)); err != nil {
+		return errors.Annotate(err, "importing model")
+	}
+	activated := false
+	defer func() {
+		if err == nil || activated {
+			return
+		}
+		if abortErr := i.client.Abort(info.UUID); abortErr != nil {
+			logger.Errorf("removing imported model: %v", abortErr)
+		}
+	}()
+	if err := i.uploadBinaries(model, upgraded, info.UUID); err != nil {
+		return errors.Trace(err)
+	}
+	if err := i.client.Activate(info.UUID); err != nil {
+		return errors.Annotate(err, "activating model")
+	}
+	// The model is in use once it has been activated, so it is
+	// kept even if the logs cannot be sent.
+	activated = true
+	if i.transferLogs {
+		if err := i.sendLogs(info.UUID); err != nil {
+			return errors.Annotate(err, "model imported, but sending logs failed")
+		}
+	}
+	return nil
+}
+
+// prepareModel returns the serialized model, in a version of the model
+// description the controller accepts, and the model info that passed the
+// controller's prechecks. The controller's prechecks decide whether the
+// archived description can be imported as it is; this tool's
+// compatibility table is only used to find the version to upgrade it to
+// when it cannot.
+func (i *archiveImporter) prepareModel(model description.Model, original []byte) ([]byte, coremigration.ModelInfo, error) {
+	var empty coremigration.ModelInfo
+	sourceVersion, err := version.Parse(i.archive.Manifest.SourceVersion)
+	if err != nil {
+		return nil, empty, errors.Annotate(err, "parsing archive source version")
+	}
+	compat, err := migration.FindCompatibility(sourceVersion, i.controllerVersion)
+	if err != nil {
+		return nil, empty, errors.Trace(err)
+	}
+	info, err := sourceModelInfo(model, original)
+	if err != nil {
+		return nil, empty, errors.Annotate(err, "getting model info")
+	}
+	precheckErr := i.client.Prechecks(info)
+	if precheckErr == nil {
+		return original, info, nil
+	}
+	from := info.DescriptionVersion
+	to, err := compat.DescriptionUpgradeTarget(from)
+	if err != nil || to == from {
+		// There is no other version to offer the controller.
+		return nil, empty, errors.Annotate(precheckErr, "controller prechecks")
+	}
+	i.ctx.Infof("upgrading model description from version %d to %d", from, to)
+	upgraded, err := migration.UpgradeDescription(original, to)
+	if err != nil {
+		return nil, empty, errors.Trace(err)
+	}
+	info.DescriptionVersion = to
+	if err := i.client.Prechecks(info); err != nil {
+		return nil, empty, errors.Annotate(err, "controller prechecks")
+	}
+	return upgraded, info, nil
+}
+
+// uploadBinaries uploads the archived charms, tools and resources that
+// the controller does not already have.
+func (i *archiveImporter) uploadBinaries(model description.Model, upgraded []byte, modelUUID string) error {
+	serialized, err := i.archive.SerializedModel(model, upgraded)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	uploaded, err := i.client.UploadedBinaries(modelUUID)
+	if params.IsCodeNotImplemented(err) {
+		uploaded = coremigration.UploadedBinaries{}
+	} else if err != nil {
+		return errors.Annotate(err, "getting binaries uploaded to controller")
+	}
+
+	i.ctx.Infof("uploading charms and agent binaries")
+	uploader := &archiveUploader{i.client, modelUUID}
+	err = migration.UploadBinaries(migration.UploadBinariesConfig{
+		Charms:          serialized.Charms,
+		CharmDownloader: i.archive,
+		CharmUploader:   uploader,
+		CharmSHA256s:    serialized.CharmSHA256s,
+
+		Tools:           serialized.Tools,
+		ToolsDownloader: i.archive,
+		ToolsUploader:   uploader,
+		ToolsSHA256s:    serialized.ToolsSHA256s,
+
+		Resources:          serialized.Resources,
+		ResourceDownloader: i.archive,
+		ResourceUploader:   uploader,
+
+		Uploaded:    uploaded,
+		Parallelism: archiveUploadParallelism,
+		Progress: func(kind, name string) {
+			i.ctx.Verbosef("uploaded %s %s", kind, name)
+		},
+	})
+	return errors.Annotate(err, "uploading binaries")
+}
+
+// sendLogs sends the archived log records to the controller.
+func (i *archiveImporter) sendLogs(modelUUID string) error {
+	logs, err := i.archive.OpenLogs()
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return errors.Trace(err)
+	}
+	defer logs.Close()
+
+	i.ctx.Infof("sending logs")
+	stream, err := i.client.OpenLogTransferStream(modelUUID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer stream.Close()
+
+	throttle := coremigration.NewLogThrottle(i.logTransfer)
+	throttled := i.logTransfer.MaxRecordsPerSecond > 0 || i.logTransfer.MaxBytesPerSecond > 0
+	decoder := json.NewDecoder(logs)
+	sent := 0
+	for {
+		var record params.LogRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Annotatef(err, "reading log record %d", sent+1)
+		}
+		if throttled {
+			if err := i.throttleLogRecord(throttle, record); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if err := stream.WriteJSON(record); err != nil {
+			return errors.Annotatef(err, "sending log record %d", sent+1)
+		}
+		sent++
+	}
+	i.ctx.Verbosef("sent %d log records", sent)
+	return nil
+}
+
+// throttleLogRecord waits until the record can be sent without
+// exceeding the log transfer rate limits.
+func (i *archiveImporter) throttleLogRecord(throttle *coremigration.LogThrottle, record params.LogRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if delay := throttle.Delay(len(data), i.clock.Now()); delay > 0 {
+		<-i.clock.After(delay)
+	}
+	return nil
+}
+
+// archiveUploader adds the model UUID to the uploads made by
+// migration.UploadBinaries.
+type archiveUploader struct {
+	client    archiveTargetClient
+	modelUUID string
+}
+
+// UploadCharm is part of migration.CharmUploader.
+func (u *archiveUploader) UploadCharm(curl *charm.URL, content io.ReadSeeker) (*charm.URL, error) {
+	return u.client.UploadCharm(u.modelUUID, curl, content)
+}
+
+// UploadTools is part of migration.ToolsUploader.
+func (u *archiveUploader) UploadTools(r io.ReadSeeker, vers version.Binary, additionalSeries ...string) (tools.List, error) {
+	return u.client.UploadTools(u.modelUUID, r, vers, additionalSeries...)
+}
+
+// UploadResource is part of migration.ResourceUploader.
+func (u *archiveUploader) UploadResource(res resource.Resource, content io.ReadSeeker) error {
+	return u.client.UploadResource(u.modelUUID, res, content)
+}
+
+// SetPlaceholderResource is part of migration.ResourceUploader.
+func (u *archiveUploader) SetPlaceholderResource(res resource.Resource) error {
+	return u.client.SetPlaceholderResource(u.modelUUID, res)
+}
+
+// SetUnitResource is part of migration.ResourceUploader.
+func (u *archiveUploader) SetUnitResource(unitName string, res resource.Resource) error {
+	return u.client.SetUnitResource(u.modelUUID, unitName, res)
+}
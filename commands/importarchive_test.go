@@ -0,0 +1,321 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/juju/cmd/cmdtesting"
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/clock"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v6-unstable"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/api/base"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
+	"github.com/juju/1.25-upgrade/juju2/migration"
+	"github.com/juju/1.25-upgrade/juju2/resource"
+	"github.com/juju/1.25-upgrade/juju2/tools"
+)
+
+const (
+	archiveModelUUID = "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6"
+	archiveCharmURL  = "cs:trusty/mysql-38"
+	archiveLogRecord = `{"t":"2017-08-01T12:00:00Z","m":"juju.worker","l":"foo.go:1","v":"INFO","x":"hello","e":"machine-0"}` + "\n"
+)
+
+type importArchiveSuite struct {
+	client *stubTargetClient
+	clock  *stubClock
+}
+
+var _ = gc.Suite(&importArchiveSuite{})
+
+func (s *importArchiveSuite) SetUpTest(c *gc.C) {
+	s.client = &stubTargetClient{}
+	s.clock = &stubClock{now: time.Date(2017, 8, 2, 9, 0, 0, 0, time.UTC)}
+}
+
+// readTestArchive writes an archive of a 1.25 environment using one
+// charm, with one log record if withLogs is true, and unpacks it.
+func (s *importArchiveSuite) readTestArchive(c *gc.C, withLogs bool) *migration.Archive {
+	logs := ""
+	if withLogs {
+		logs = archiveLogRecord
+	}
+	return s.readTestArchiveWithLogs(c, logs)
+}
+
+// readTestArchiveWithLogs writes an archive like readTestArchive, with
+// the given log records, and unpacks it.
+func (s *importArchiveSuite) readTestArchiveWithLogs(c *gc.C, logs string) *migration.Archive {
+	model := description.NewModel(description.ModelArgs{
+		Owner: names.NewUserTag("admin"),
+		Config: map[string]interface{}{
+			"name":          "prod",
+			"uuid":          archiveModelUUID,
+			"agent-version": "1.25.10",
+		},
+	})
+	model.AddApplication(description.ApplicationArgs{
+		Tag:      names.NewApplicationTag("mysql"),
+		CharmURL: archiveCharmURL,
+	})
+	serialized, err := description.Serialize(model)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var buf bytes.Buffer
+	w := migration.NewArchiveWriter(&buf, migration.ArchiveManifest{
+		ModelUUID:     archiveModelUUID,
+		ModelName:     "prod",
+		SourceVersion: "1.25.10",
+	})
+	c.Assert(w.AddModel(serialized), jc.ErrorIsNil)
+	_, err = w.AddCharm(archiveCharmURL, strings.NewReader("charm"), 5)
+	c.Assert(err, jc.ErrorIsNil)
+	if logs != "" {
+		_, err = w.AddLogs(strings.NewReader(logs), int64(len(logs)))
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	archive, err := migration.ReadArchive(&buf, c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	return archive
+}
+
+func (s *importArchiveSuite) importer(c *gc.C, archive *migration.Archive, controllerVersion string) *archiveImporter {
+	return &archiveImporter{
+		ctx:               cmdtesting.Context(c),
+		client:            s.client,
+		archive:           archive,
+		controllerVersion: version.MustParse(controllerVersion),
+		transferLogs:      true,
+		clock:             s.clock,
+	}
+}
+
+func (s *importArchiveSuite) TestImport(c *gc.C) {
+	err := s.importer(c, s.readTestArchive(c, true), "2.2.2").run()
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Check(s.client.calls, jc.DeepEquals, []string{
+		"Prechecks", "StreamModel", "UploadedBinaries", "UploadCharm", "Activate", "OpenLogTransferStream",
+	})
+	info := s.client.prechecked
+	c.Check(info.UUID, gc.Equals, archiveModelUUID)
+	c.Check(info.Name, gc.Equals, "prod")
+	c.Check(info.Owner, gc.Equals, names.NewUserTag("admin"))
+	c.Check(info.DescriptionVersion, gc.Equals, migration.CurrentDescriptionVersion)
+	c.Check(s.client.charms, jc.DeepEquals, map[string]string{archiveCharmURL: "charm"})
+	c.Check(s.client.logs, jc.DeepEquals, []params.LogRecord{{
+		Time:     time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC),
+		Module:   "juju.worker",
+		Location: "foo.go:1",
+		Level:    "INFO",
+		Message:  "hello",
+		Entity:   "machine-0",
+	}})
+	c.Check(s.client.streamClosed, jc.IsTrue)
+}
+
+func (s *importArchiveSuite) TestImportWithoutLogs(c *gc.C) {
+	err := s.importer(c, s.readTestArchive(c, false), "2.2.2").run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.client.calls, jc.DeepEquals, []string{
+		"Prechecks", "StreamModel", "UploadedBinaries", "UploadCharm", "Activate",
+	})
+}
+
+func (s *importArchiveSuite) TestImportThrottlesLogs(c *gc.C) {
+	importer := s.importer(c, s.readTestArchiveWithLogs(c, strings.Repeat(archiveLogRecord, 3)), "2.2.2")
+	importer.logTransfer.MaxRecordsPerSecond = 2
+	err := importer.run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.client.logs, gc.HasLen, 3)
+	// The first record is sent straight away.
+	c.Check(s.clock.waits, jc.DeepEquals, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond})
+}
+
+func (s *importArchiveSuite) TestImportUnthrottledLogs(c *gc.C) {
+	err := s.importer(c, s.readTestArchiveWithLogs(c, strings.Repeat(archiveLogRecord, 3)), "2.2.2").run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.client.logs, gc.HasLen, 3)
+	c.Check(s.clock.waits, gc.HasLen, 0)
+}
+
+func (s *importArchiveSuite) TestImportUploadedCharmMismatch(c *gc.C) {
+	s.client.uploaded.Charms = map[string]string{
+		archiveCharmURL: "b0f1bc7f9e5e2ba4e55cbe4d1fe13d4fd6ad0ee69b9f2eb2f2b1f34a3e8b67df",
+	}
+	importer := s.importer(c, s.readTestArchive(c, true), "2.2.2")
+	importer.transferLogs = false
+	err := importer.run()
+	// The target has a different charm under the same URL.
+	c.Assert(err, gc.ErrorMatches, "uploading binaries: binaries failed verification:\n.*charm cs:trusty/mysql-38: target has sha256 .*")
+	c.Check(s.client.calls, jc.DeepEquals, []string{
+		"Prechecks", "StreamModel", "UploadedBinaries", "Abort",
+	})
+}
+
+func (s *importArchiveSuite) TestImportAbortsOnFailure(c *gc.C) {
+	s.client.uploadErr = errors.New("boom")
+	err := s.importer(c, s.readTestArchive(c, true), "2.2.2").run()
+	c.Assert(err, gc.ErrorMatches, "uploading binaries: cannot upload charm: boom")
+	c.Check(s.client.calls, jc.DeepEquals, []string{
+		"Prechecks", "StreamModel", "UploadedBinaries", "UploadCharm", "Abort",
+	})
+}
+
+func (s *importArchiveSuite) TestImportKeepsModelIfLogsFail(c *gc.C) {
+	s.client.streamErr = errors.New("boom")
+	err := s.importer(c, s.readTestArchive(c, true), "2.2.2").run()
+	c.Assert(err, gc.ErrorMatches, "model imported, but sending logs failed: boom")
+	c.Check(s.client.calls, jc.DeepEquals, []string{
+		"Prechecks", "StreamModel", "UploadedBinaries", "UploadCharm", "Activate", "OpenLogTransferStream",
+	})
+}
+
+func (s *importArchiveSuite) TestImportPrecheckFailure(c *gc.C) {
+	s.client.precheckErr = errors.New("model already exists")
+	err := s.importer(c, s.readTestArchive(c, true), "2.2.2").run()
+	c.Assert(err, gc.ErrorMatches, "controller prechecks: model already exists")
+	c.Check(s.client.calls, jc.DeepEquals, []string{"Prechecks"})
+}
+
+func (s *importArchiveSuite) TestImportUnsupportedController(c *gc.C) {
+	err := s.importer(c, s.readTestArchive(c, true), "2.3.0").run()
+	c.Assert(err, gc.ErrorMatches, "migrating models from 1.25 controllers to 2.3 controllers is not supported")
+	c.Check(s.client.calls, gc.HasLen, 0)
+}
+
+// stubTargetClient is an archiveTargetClient that records the calls made
+// to it.
+type stubTargetClient struct {
+	calls        []string
+	prechecked   coremigration.ModelInfo
+	uploaded     coremigration.UploadedBinaries
+	charms       map[string]string
+	logs         []params.LogRecord
+	streamClosed bool
+
+	precheckErr error
+	uploadErr   error
+	streamErr   error
+}
+
+func (s *stubTargetClient) Prechecks(info coremigration.ModelInfo) error {
+	s.calls = append(s.calls, "Prechecks")
+	s.prechecked = info
+	return s.precheckErr
+}
+
+func (s *stubTargetClient) StreamModel(modelUUID string, content io.ReadSeeker) error {
+	s.calls = append(s.calls, "StreamModel")
+	return nil
+}
+
+func (s *stubTargetClient) UploadedBinaries(modelUUID string) (coremigration.UploadedBinaries, error) {
+	s.calls = append(s.calls, "UploadedBinaries")
+	return s.uploaded, nil
+}
+
+func (s *stubTargetClient) UploadCharm(modelUUID string, curl *charm.URL, content io.ReadSeeker) (*charm.URL, error) {
+	s.calls = append(s.calls, "UploadCharm")
+	if s.uploadErr != nil {
+		return nil, s.uploadErr
+	}
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	if s.charms == nil {
+		s.charms = make(map[string]string)
+	}
+	s.charms[curl.String()] = string(data)
+	return curl, nil
+}
+
+func (s *stubTargetClient) UploadTools(modelUUID string, r io.ReadSeeker, vers version.Binary, additionalSeries ...string) (tools.List, error) {
+	s.calls = append(s.calls, "UploadTools")
+	return nil, s.uploadErr
+}
+
+func (s *stubTargetClient) UploadResource(modelUUID string, res resource.Resource, r io.ReadSeeker) error {
+	s.calls = append(s.calls, "UploadResource")
+	return s.uploadErr
+}
+
+func (s *stubTargetClient) SetPlaceholderResource(modelUUID string, res resource.Resource) error {
+	s.calls = append(s.calls, "SetPlaceholderResource")
+	return nil
+}
+
+func (s *stubTargetClient) SetUnitResource(modelUUID, unit string, res resource.Resource) error {
+	s.calls = append(s.calls, "SetUnitResource")
+	return nil
+}
+
+func (s *stubTargetClient) Activate(modelUUID string) error {
+	s.calls = append(s.calls, "Activate")
+	return nil
+}
+
+func (s *stubTargetClient) Abort(modelUUID string) error {
+	s.calls = append(s.calls, "Abort")
+	return nil
+}
+
+func (s *stubTargetClient) OpenLogTransferStream(modelUUID string) (base.Stream, error) {
+	s.calls = append(s.calls, "OpenLogTransferStream")
+	if s.streamErr != nil {
+		return nil, s.streamErr
+	}
+	return &stubLogStream{client: s}, nil
+}
+
+// stubLogStream records the log records written to it.
+type stubLogStream struct {
+	base.Stream
+	client *stubTargetClient
+}
+
+func (s *stubLogStream) WriteJSON(v interface{}) error {
+	s.client.logs = append(s.client.logs, v.(params.LogRecord))
+	return nil
+}
+
+func (s *stubLogStream) Close() error {
+	s.client.streamClosed = true
+	return nil
+}
+
+// stubClock records the waits made with it, and moves its time on by
+// each of them instead of waiting.
+type stubClock struct {
+	clock.Clock
+	now   time.Time
+	waits []time.Duration
+}
+
+func (s *stubClock) Now() time.Time {
+	return s.now
+}
+
+func (s *stubClock) After(d time.Duration) <-chan time.Time {
+	s.waits = append(s.waits, d)
+	s.now = s.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- s.now
+	return ch
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"strings"
+	"time"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/loggo"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+// archiveLogFilter holds the flags that limit which of an environment's
+// log records export-archive puts in an archive. They match the log
+// flags of juju migrate. As with exportOverrides, the client command
+// passes the flags through to the remote command, which reads the logs.
+type archiveLogFilter struct {
+	maxAge  time.Duration
+	level   string
+	include []string
+	exclude []string
+}
+
+// SetFlags adds the log filter flags to f.
+func (l *archiveLogFilter) SetFlags(f *gnuflag.FlagSet) {
+	f.DurationVar(&l.maxAge, "log-max-age", 0, "Only archive logs written within this long of the export (default all)")
+	f.StringVar(&l.level, "log-level", "", "Only archive logs of this level or above (default all)")
+	f.Var(cmd.NewStringsValue(nil, &l.include), "log-include", "Only archive logs from these comma-separated entities")
+	f.Var(cmd.NewStringsValue(nil, &l.exclude), "log-exclude", "Do not archive logs from these comma-separated entities")
+}
+
+// validate checks that the log filter flags are well formed.
+func (l *archiveLogFilter) validate() error {
+	if l.maxAge < 0 {
+		return errors.New("--log-max-age must not be negative")
+	}
+	if l.level != "" {
+		if level, ok := loggo.ParseLevel(l.level); !ok || level == loggo.UNSPECIFIED {
+			return errors.Errorf("invalid log level %q", l.level)
+		}
+	}
+	for _, entities := range [][]string{l.include, l.exclude} {
+		for _, entity := range entities {
+			if entity == "" {
+				return errors.New("log entities must not be empty")
+			}
+		}
+	}
+	return nil
+}
+
+// remoteArgs returns the log filter flags to pass on to the remote
+// command.
+func (l *archiveLogFilter) remoteArgs() []string {
+	var args []string
+	if l.maxAge > 0 {
+		args = append(args, "--log-max-age", l.maxAge.String())
+	}
+	if l.level != "" {
+		args = append(args, "--log-level", l.level)
+	}
+	if len(l.include) > 0 {
+		args = append(args, "--log-include", strings.Join(l.include, ","))
+	}
+	if len(l.exclude) > 0 {
+		args = append(args, "--log-exclude", strings.Join(l.exclude, ","))
+	}
+	return args
+}
+
+// tailerParams returns the parameters that select the log records to
+// archive, for an export made at the given time.
+func (l *archiveLogFilter) tailerParams(now time.Time) *state.LogTailerParams {
+	params := &state.LogTailerParams{
+		IncludeEntity: l.include,
+		ExcludeEntity: l.exclude,
+	}
+	if l.maxAge > 0 {
+		params.StartTime = now.Add(-l.maxAge)
+	}
+	if l.level != "" {
+		params.MinLevel, _ = loggo.ParseLevel(l.level)
+	}
+	return params
+}
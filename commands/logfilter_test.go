@@ -0,0 +1,57 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"time"
+
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+type logFilterSuite struct{}
+
+var _ = gc.Suite(&logFilterSuite{})
+
+func (*logFilterSuite) TestValidate(c *gc.C) {
+	c.Assert((&archiveLogFilter{}).validate(), jc.ErrorIsNil)
+	c.Assert((&archiveLogFilter{maxAge: time.Hour, level: "warning", include: []string{"unit-*"}}).validate(), jc.ErrorIsNil)
+	c.Assert((&archiveLogFilter{maxAge: -time.Hour}).validate(), gc.ErrorMatches, "--log-max-age must not be negative")
+	c.Assert((&archiveLogFilter{level: "LOUD"}).validate(), gc.ErrorMatches, `invalid log level "LOUD"`)
+	c.Assert((&archiveLogFilter{exclude: []string{""}}).validate(), gc.ErrorMatches, "log entities must not be empty")
+}
+
+func (*logFilterSuite) TestRemoteArgs(c *gc.C) {
+	c.Assert((&archiveLogFilter{}).remoteArgs(), gc.IsNil)
+	l := &archiveLogFilter{
+		maxAge:  72 * time.Hour,
+		level:   "WARNING",
+		include: []string{"machine-0", "unit-*"},
+		exclude: []string{"unit-noisy-*"},
+	}
+	c.Assert(l.remoteArgs(), jc.DeepEquals, []string{
+		"--log-max-age", "72h0m0s",
+		"--log-level", "WARNING",
+		"--log-include", "machine-0,unit-*",
+		"--log-exclude", "unit-noisy-*",
+	})
+}
+
+func (*logFilterSuite) TestTailerParams(c *gc.C) {
+	now := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	c.Assert((&archiveLogFilter{}).tailerParams(now), jc.DeepEquals, &state.LogTailerParams{})
+	l := &archiveLogFilter{
+		maxAge:  time.Hour,
+		level:   "warning",
+		exclude: []string{"unit-noisy-*"},
+	}
+	c.Assert(l.tailerParams(now), jc.DeepEquals, &state.LogTailerParams{
+		StartTime:     now.Add(-time.Hour),
+		MinLevel:      loggo.WARNING,
+		ExcludeEntity: []string{"unit-noisy-*"},
+	})
+}
@@ -12,8 +12,11 @@ import (
 )
 
 const (
-	toolsDir  = "/home/ubuntu/juju-1.25-upgrade-tools"
-	toolsFile = "downloaded-tools.txt"
+	// upgraderDir holds everything the upgrader keeps on the 1.25
+	// machines, other than the audit log.
+	upgraderDir = "/home/ubuntu/.juju-1.25-upgrade"
+	toolsDir    = upgraderDir + "/tools"
+	toolsFile   = "downloaded-tools.txt"
 )
 
 var (
@@ -39,6 +42,10 @@ func NewUpgradeCommand(ctx *cmd.Context) cmd.Command {
 func registerCommands(super *cmd.SuperCommand) {
 	super.Register(newVerifySourceCommand())
 	super.Register(newVerifySourceImplCommand())
+	super.Register(newPrecheckTargetCommand())
+	super.Register(newExportArchiveCommand())
+	super.Register(newExportArchiveImplCommand())
+	super.Register(newImportArchiveCommand())
 	super.Register(newDumpSourceDBCommand())
 	super.Register(newDumpSourceDBImplCommand())
 	super.Register(newAgentStatusCommand())
@@ -47,6 +54,16 @@ func registerCommands(super *cmd.SuperCommand) {
 	super.Register(newStartAgentsImplCommand())
 	super.Register(newStopAgentsCommand())
 	super.Register(newStopAgentsImplCommand())
+	super.Register(newAgentServiceImplCommand())
 	super.Register(newUpgradeAgentsCommand())
 	super.Register(newUpgradeAgentsImplCommand())
+	super.Register(newVerifyTargetCommand())
+	super.Register(newVerifyTargetImplCommand())
+	super.Register(newConvertUniterStateCommand())
+	super.Register(newConvertUniterStateImplCommand())
+	super.Register(newCleanMachinesCommand())
+	super.Register(newCleanMachinesImplCommand())
+	super.Register(newCleanupCommand())
+	super.Register(newCleanupImplCommand())
+	super.Register(newMigratePlanCommand())
 }
@@ -0,0 +1,542 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/kardianos/osext"
+	"gopkg.in/juju/names.v2"
+	"gopkg.in/yaml.v2"
+)
+
+var migratePlanDoc = `
+The purpose of the migrate-plan command is to migrate many 1.25
+environments, as described by a YAML plan file, by running the other
+commands for each of them in turn:
+
+    verify    verify-source and precheck-target
+    backup    dump-source-db, with the output kept in the log directory
+    import    (see below)
+    check     verify-target
+
+The plan names each environment, and the controller it is to be moved to:
+
+    concurrency: 2
+    environments:
+      prod-web:
+        controller: prod-controller
+        model: web
+        owner: web-team
+        credential: web-team-aws
+        rollout: canary
+      staging-web:
+        controller: staging-controller
+
+model, owner and credential are the name, owner and cloud credential of the
+model on the controller; they default to those of the 1.25 environment. They
+are passed to verify-source and precheck-target as --model-name, --owner and
+--credential, so the environment is checked as it is to be imported.
+
+rollout is one of:
+
+    full      migrate the environment (the default)
+    canary    migrate the environment before any of the others; they
+              are not imported until every canary has been migrated and
+              has passed verify-target
+    verify    only run the verify step
+
+Up to --concurrency environments (or the plan's concurrency, or 1) are
+migrated at once. The steps for an environment stop at the first failure.
+
+The import step is not run by the plan, so each environment stops before
+it, with its agents still running. To import an environment, stop its agents
+with stop-agents, import it with export-archive and import-archive, and then
+upgrade and start its agents with upgrade-agents and start-agents. The plan
+does not stop the agents itself, as it cannot yet bring them back up on the
+controller.
+
+The output of every command is written to a log file for each environment
+in the --log-dir directory, along with report.yaml, which records how far
+each environment got. The report is also written to stdout.
+
+When the plan is run again with the same --log-dir, environments that were
+waiting for import continue with the check step, and environments that were
+complete are left alone. So the plan is run once to prepare the canaries for
+import, again to check them and prepare the remaining environments, and once
+more to check those.
+`
+
+// The rollout policies an environment may have in a migration plan.
+const (
+	rolloutFull   = "full"
+	rolloutCanary = "canary"
+	rolloutVerify = "verify"
+)
+
+// The statuses an environment may end up with after running a plan.
+const (
+	planStatusComplete = "complete"
+	planStatusFailed   = "failed"
+	planStatusManual   = "waiting for import"
+	planStatusWaiting  = "waiting for canaries"
+	planStatusSkipped  = "skipped"
+)
+
+// migrationPlan is the content of a migration plan file.
+type migrationPlan struct {
+	Concurrency  int                           `yaml:"concurrency,omitempty"`
+	Environments map[string]plannedEnvironment `yaml:"environments"`
+}
+
+// plannedEnvironment describes how one environment is to be migrated.
+type plannedEnvironment struct {
+	Controller string `yaml:"controller"`
+	Model      string `yaml:"model,omitempty"`
+	Owner      string `yaml:"owner,omitempty"`
+	Credential string `yaml:"credential,omitempty"`
+	Rollout    string `yaml:"rollout,omitempty"`
+}
+
+// planStep is one of the steps run for each environment in a plan.
+type planStep struct {
+	name     string
+	commands []planCommand
+}
+
+// planCommand is one of the commands run for a step.
+type planCommand struct {
+	name            string
+	needsController bool
+	// overridable is true for commands that take the model name,
+	// owner and credential from the plan.
+	overridable bool
+	// output, if set, is the suffix of the file in the log directory
+	// that the command's stdout is written to.
+	output string
+}
+
+// planSteps holds the steps run for each environment, in order. A step
+// with no commands cannot be done by this tool, and the environment
+// stops there.
+var planSteps = []planStep{{
+	name: "verify",
+	commands: []planCommand{
+		{name: "verify-source", overridable: true},
+		{name: "precheck-target", needsController: true, overridable: true},
+	},
+}, {
+	name: "backup",
+	commands: []planCommand{
+		{name: "dump-source-db", output: "source-db.yaml"},
+	},
+}, {
+	// The agents are stopped, the environment imported, and the agents
+	// upgraded and started by hand: upgrade-agents cannot yet finish, so
+	// the plan does not stop agents it cannot bring back up.
+	name: "import",
+}, {
+	name: "check",
+	commands: []planCommand{
+		{name: "verify-target", needsController: true},
+	},
+}}
+
+func planStepIndex(name string) int {
+	for i, step := range planSteps {
+		if step.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func newMigratePlanCommand() cmd.Command {
+	return &migratePlanCommand{}
+}
+
+type migratePlanCommand struct {
+	cmd.CommandBase
+
+	planFile    string
+	logDir      string
+	from        string
+	concurrency int
+}
+
+func (c *migratePlanCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "migrate-plan",
+		Args:    "<plan file>",
+		Purpose: "migrate the environments described by a plan file",
+		Doc:     migratePlanDoc,
+	}
+}
+
+func (c *migratePlanCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.CommandBase.SetFlags(f)
+	f.StringVar(&c.logDir, "log-dir", "migrate-plan-logs", "Directory to write the logs and report to")
+	f.StringVar(&c.from, "from", planSteps[0].name, "Step to start each environment from")
+	f.IntVar(&c.concurrency, "concurrency", 0, "Number of environments to migrate at once (overrides the plan)")
+}
+
+func (c *migratePlanCommand) Init(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no plan file specified")
+	}
+	c.planFile, args = args[0], args[1:]
+	if planStepIndex(c.from) < 0 {
+		return errors.NotValidf("step %q", c.from)
+	}
+	if c.concurrency < 0 {
+		return errors.NotValidf("concurrency %d", c.concurrency)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *migratePlanCommand) Run(ctx *cmd.Context) error {
+	plan, err := readMigrationPlan(ctx.AbsPath(c.planFile))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	logDir := ctx.AbsPath(c.logDir)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	plugin, err := osext.Executable()
+	if err != nil {
+		return errors.Annotate(err, "finding plugin location")
+	}
+
+	previous, err := readPlanReport(filepath.Join(logDir, "report.yaml"))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	concurrency := plan.Concurrency
+	if c.concurrency > 0 {
+		concurrency = c.concurrency
+	}
+	runner := &planRunner{
+		plan:        plan,
+		previous:    previous,
+		from:        planStepIndex(c.from),
+		concurrency: concurrency,
+		progress:    ctx.Stderr,
+		runCommand: func(env string, planned plannedEnvironment, command planCommand) error {
+			return runPlanCommand(plugin, logDir, env, planned, command)
+		},
+	}
+	report := runner.run()
+
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(logDir, "report.yaml"), data, 0644); err != nil {
+		return errors.Trace(err)
+	}
+	ctx.Stdout.Write(data)
+
+	for _, result := range report.Environments {
+		if result.Status == planStatusFailed {
+			return errors.New("some environments were not migrated")
+		}
+	}
+	return nil
+}
+
+// readMigrationPlan reads and validates the plan file.
+func readMigrationPlan(path string) (*migrationPlan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "reading plan")
+	}
+	var plan migrationPlan
+	if err := yaml.Unmarshal(data, &plan); err != nil {
+		return nil, errors.Annotate(err, "parsing plan")
+	}
+	if err := plan.validate(); err != nil {
+		return nil, errors.Annotate(err, "invalid plan")
+	}
+	return &plan, nil
+}
+
+func (p *migrationPlan) validate() error {
+	if len(p.Environments) == 0 {
+		return errors.New("no environments specified")
+	}
+	if p.Concurrency < 0 {
+		return errors.NotValidf("concurrency %d", p.Concurrency)
+	}
+	for name, env := range p.Environments {
+		if env.Controller == "" {
+			return errors.Errorf("environment %q: no controller specified", name)
+		}
+		if env.Model != "" && !names.IsValidModelName(env.Model) {
+			return errors.Errorf("environment %q: model name %q not valid", name, env.Model)
+		}
+		if env.Owner != "" && !names.IsValidUser(env.Owner) {
+			return errors.Errorf("environment %q: owner %q not valid", name, env.Owner)
+		}
+		switch env.Rollout {
+		case "", rolloutFull, rolloutCanary, rolloutVerify:
+		default:
+			return errors.Errorf("environment %q: rollout %q not valid", name, env.Rollout)
+		}
+	}
+	return nil
+}
+
+// readPlanReport reads the report left by an earlier run of the plan, if
+// there is one.
+func readPlanReport(path string) (*planReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Annotate(err, "reading previous report")
+	}
+	var report planReport
+	if err := yaml.Unmarshal(data, &report); err != nil {
+		return nil, errors.Annotate(err, "parsing previous report")
+	}
+	return &report, nil
+}
+
+// planReport records how far each environment got.
+type planReport struct {
+	Started      string                            `yaml:"started"`
+	Finished     string                            `yaml:"finished"`
+	Environments map[string]*planEnvironmentReport `yaml:"environments"`
+}
+
+// planEnvironmentReport records how far an environment got.
+type planEnvironmentReport struct {
+	Controller string   `yaml:"controller"`
+	Model      string   `yaml:"model,omitempty"`
+	Owner      string   `yaml:"owner,omitempty"`
+	Credential string   `yaml:"credential,omitempty"`
+	Status     string   `yaml:"status"`
+	Completed  []string `yaml:"completed-steps,omitempty"`
+	FailedStep string   `yaml:"failed-step,omitempty"`
+	Error      string   `yaml:"error,omitempty"`
+	Duration   string   `yaml:"duration"`
+}
+
+// planRunner runs the steps of a plan for each of its environments.
+type planRunner struct {
+	plan *migrationPlan
+	// previous, if set, is the report from an earlier run of the plan.
+	previous    *planReport
+	from        int
+	concurrency int
+	progress    io.Writer
+	runCommand  func(env string, planned plannedEnvironment, command planCommand) error
+
+	mu sync.Mutex
+}
+
+// run migrates the canary environments, and then if they have all been
+// migrated and checked, the rest of them. Until then only the steps before
+// import are run for the rest.
+func (r *planRunner) run() *planReport {
+	report := &planReport{
+		Started:      time.Now().UTC().Format(time.RFC3339),
+		Environments: make(map[string]*planEnvironmentReport),
+	}
+	var canaries, others []string
+	for name, env := range r.plan.Environments {
+		report.Environments[name] = &planEnvironmentReport{
+			Controller: env.Controller,
+			Model:      env.Model,
+			Owner:      env.Owner,
+			Credential: env.Credential,
+			Status:     planStatusSkipped,
+		}
+		if env.Rollout == rolloutCanary {
+			canaries = append(canaries, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(canaries)
+	sort.Strings(others)
+
+	r.runEnvironments(canaries, report, len(planSteps))
+	canariesFailed, canariesDone := false, true
+	for _, name := range canaries {
+		switch report.Environments[name].Status {
+		case planStatusComplete:
+		case planStatusFailed:
+			canariesFailed = true
+		default:
+			canariesDone = false
+		}
+	}
+	switch {
+	case canariesFailed:
+		r.printf("not migrating the remaining environments, as a canary failed\n")
+	case canariesDone:
+		r.runEnvironments(others, report, len(planSteps))
+	default:
+		r.printf("not importing the remaining environments until the canaries have been migrated and checked\n")
+		r.runEnvironments(others, report, planStepIndex("import"))
+	}
+	report.Finished = time.Now().UTC().Format(time.RFC3339)
+	return report
+}
+
+// runEnvironments migrates the environments, running up to concurrency of
+// them at once. The steps from last on are not run.
+func (r *planRunner) runEnvironments(envs []string, report *planReport, last int) {
+	concurrency := r.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	limit := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, name := range envs {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			r.runEnvironment(name, report.Environments[name], last)
+		}(name)
+	}
+	wg.Wait()
+}
+
+// firstStep returns the step the environment starts from, taking into
+// account how far it got in the previous run. It returns false if the
+// environment was completed by the previous run.
+func (r *planRunner) firstStep(name string, result *planEnvironmentReport) (int, bool) {
+	if r.previous == nil {
+		return r.from, true
+	}
+	previous, ok := r.previous.Environments[name]
+	if !ok {
+		return r.from, true
+	}
+	switch previous.Status {
+	case planStatusComplete:
+		*result = *previous
+		return 0, false
+	case planStatusManual:
+		result.Completed = append(result.Completed, previous.Completed...)
+		return planStepIndex("import") + 1, true
+	}
+	return r.from, true
+}
+
+func (r *planRunner) runEnvironment(name string, result *planEnvironmentReport, last int) {
+	first, ok := r.firstStep(name, result)
+	if !ok {
+		r.printf("%s: already migrated\n", name)
+		return
+	}
+	planned := r.plan.Environments[name]
+	start := time.Now()
+	defer func() {
+		result.Duration = (time.Since(start) / time.Second * time.Second).String()
+	}()
+
+	for i := first; i < len(planSteps); i++ {
+		step := planSteps[i]
+		if planned.Rollout == rolloutVerify && step.name != "verify" {
+			break
+		}
+		if i >= last {
+			r.printf("%s: waiting for the canaries before %s\n", name, step.name)
+			result.Status = planStatusWaiting
+			return
+		}
+		if step.commands == nil {
+			r.printf("%s: stopped before %s\n", name, step.name)
+			result.Status = planStatusManual
+			return
+		}
+		r.printf("%s: %s\n", name, step.name)
+		for _, command := range step.commands {
+			if err := r.runCommand(name, planned, command); err != nil {
+				r.printf("%s: %s failed: %v\n", name, step.name, err)
+				result.Status = planStatusFailed
+				result.FailedStep = step.name
+				result.Error = err.Error()
+				return
+			}
+		}
+		result.Completed = append(result.Completed, step.name)
+	}
+	r.printf("%s: done\n", name)
+	result.Status = planStatusComplete
+}
+
+func (r *planRunner) printf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.progress, format, args...)
+}
+
+// runPlanCommand runs the command for the environment, using another
+// instance of the plugin. Its output is appended to the environment's log
+// file, unless the command's stdout is to be kept in a file of its own.
+func runPlanCommand(plugin, logDir, env string, planned plannedEnvironment, command planCommand) error {
+	args := []string{command.name}
+	if command.overridable {
+		overrides := exportOverrides{
+			modelName:  planned.Model,
+			owner:      planned.Owner,
+			credential: planned.Credential,
+		}
+		args = append(args, overrides.remoteArgs()...)
+	}
+	args = append(args, env)
+	if command.needsController {
+		args = append(args, planned.Controller)
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(logDir, env+".log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer logFile.Close()
+	fmt.Fprintf(logFile, "%s: running %s\n", time.Now().UTC().Format(time.RFC3339), strings.Join(args, " "))
+
+	var stderr bytes.Buffer
+	run := exec.Command(plugin, args...)
+	run.Stdout = logFile
+	run.Stderr = io.MultiWriter(logFile, &stderr)
+	if command.output != "" {
+		output, err := os.Create(filepath.Join(logDir, env+"-"+command.output))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer output.Close()
+		run.Stdout = output
+	}
+	if err := run.Run(); err != nil {
+		// The last line written to stderr is usually the error.
+		lines := nonEmptyLines(stderr.String())
+		if len(lines) > 0 {
+			return errors.Errorf("%s: %s", command.name, lines[len(lines)-1])
+		}
+		return errors.Annotate(err, command.name)
+	}
+	return nil
+}
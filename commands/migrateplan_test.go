@@ -0,0 +1,211 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type migratePlanSuite struct{}
+
+var _ = gc.Suite(&migratePlanSuite{})
+
+func (*migratePlanSuite) TestReadPlan(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "plan.yaml")
+	err := ioutil.WriteFile(path, []byte(`
+concurrency: 3
+environments:
+  prod:
+    controller: ctrl
+    model: web
+    owner: web-team
+    credential: web-aws
+    rollout: canary
+  staging:
+    controller: ctrl
+`), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	plan, err := readMigrationPlan(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(plan, jc.DeepEquals, &migrationPlan{
+		Concurrency: 3,
+		Environments: map[string]plannedEnvironment{
+			"prod": {
+				Controller: "ctrl",
+				Model:      "web",
+				Owner:      "web-team",
+				Credential: "web-aws",
+				Rollout:    rolloutCanary,
+			},
+			"staging": {Controller: "ctrl"},
+		},
+	})
+}
+
+func (*migratePlanSuite) TestValidate(c *gc.C) {
+	for _, test := range []struct {
+		env plannedEnvironment
+		err string
+	}{{
+		env: plannedEnvironment{},
+		err: `environment "prod": no controller specified`,
+	}, {
+		env: plannedEnvironment{Controller: "ctrl", Model: "Not Valid"},
+		err: `environment "prod": model name "Not Valid" not valid`,
+	}, {
+		env: plannedEnvironment{Controller: "ctrl", Owner: "not/valid"},
+		err: `environment "prod": owner "not/valid" not valid`,
+	}, {
+		env: plannedEnvironment{Controller: "ctrl", Rollout: "yolo"},
+		err: `environment "prod": rollout "yolo" not valid`,
+	}} {
+		plan := migrationPlan{Environments: map[string]plannedEnvironment{"prod": test.env}}
+		c.Check(plan.validate(), gc.ErrorMatches, test.err)
+	}
+	c.Check((&migrationPlan{}).validate(), gc.ErrorMatches, "no environments specified")
+}
+
+type fakePlanCommands struct {
+	mu    sync.Mutex
+	calls map[string][]string
+	fail  map[string]string
+}
+
+func (f *fakePlanCommands) run(env string, planned plannedEnvironment, command planCommand) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string][]string)
+	}
+	f.calls[env] = append(f.calls[env], command.name)
+	if f.fail[env] == command.name {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (*migratePlanSuite) TestRunStopsBeforeImport(c *gc.C) {
+	commands := &fakePlanCommands{}
+	runner := &planRunner{
+		plan: &migrationPlan{Environments: map[string]plannedEnvironment{
+			"prod":    {Controller: "ctrl"},
+			"staging": {Controller: "ctrl", Rollout: rolloutVerify},
+		}},
+		concurrency: 2,
+		progress:    ioutil.Discard,
+		runCommand:  commands.run,
+	}
+	report := runner.run()
+	c.Assert(commands.calls, jc.DeepEquals, map[string][]string{
+		"prod":    {"verify-source", "precheck-target", "dump-source-db"},
+		"staging": {"verify-source", "precheck-target"},
+	})
+	c.Assert(report.Environments["prod"].Status, gc.Equals, planStatusManual)
+	c.Assert(report.Environments["prod"].Completed, jc.DeepEquals, []string{"verify", "backup"})
+	c.Assert(report.Environments["staging"].Status, gc.Equals, planStatusComplete)
+}
+
+func (*migratePlanSuite) TestRunFrom(c *gc.C) {
+	commands := &fakePlanCommands{}
+	runner := &planRunner{
+		plan: &migrationPlan{Environments: map[string]plannedEnvironment{
+			"prod": {Controller: "ctrl"},
+		}},
+		from:       planStepIndex("check"),
+		progress:   ioutil.Discard,
+		runCommand: commands.run,
+	}
+	report := runner.run()
+	c.Assert(commands.calls["prod"], jc.DeepEquals, []string{"verify-target"})
+	c.Assert(report.Environments["prod"].Status, gc.Equals, planStatusComplete)
+}
+
+func (*migratePlanSuite) TestRunWaitsForCanaries(c *gc.C) {
+	commands := &fakePlanCommands{}
+	runner := &planRunner{
+		plan: &migrationPlan{Environments: map[string]plannedEnvironment{
+			"canary": {Controller: "ctrl", Rollout: rolloutCanary},
+			"prod":   {Controller: "ctrl"},
+		}},
+		progress:   ioutil.Discard,
+		runCommand: commands.run,
+	}
+	report := runner.run()
+	// The canary is waiting for import, so it hasn't been checked, and
+	// the other environment must wait for it before being imported.
+	c.Assert(commands.calls, jc.DeepEquals, map[string][]string{
+		"canary": {"verify-source", "precheck-target", "dump-source-db"},
+		"prod":   {"verify-source", "precheck-target", "dump-source-db"},
+	})
+	c.Assert(report.Environments["canary"].Status, gc.Equals, planStatusManual)
+	c.Assert(report.Environments["prod"].Status, gc.Equals, planStatusWaiting)
+	c.Assert(report.Environments["prod"].Completed, jc.DeepEquals, []string{"verify", "backup"})
+
+	// Running the plan again checks the canary, and once it has passed,
+	// leaves the other environment waiting for import.
+	commands.calls = nil
+	runner.previous = report
+	report = runner.run()
+	c.Assert(commands.calls, jc.DeepEquals, map[string][]string{
+		"canary": {"verify-target"},
+		"prod":   {"verify-source", "precheck-target", "dump-source-db"},
+	})
+	c.Assert(report.Environments["canary"].Status, gc.Equals, planStatusComplete)
+	c.Assert(report.Environments["canary"].Completed, jc.DeepEquals, []string{"verify", "backup", "check"})
+	c.Assert(report.Environments["prod"].Status, gc.Equals, planStatusManual)
+
+	// Completed environments are left alone.
+	commands.calls = nil
+	runner.previous = report
+	report = runner.run()
+	c.Assert(commands.calls, jc.DeepEquals, map[string][]string{
+		"prod": {"verify-target"},
+	})
+	c.Assert(report.Environments["canary"].Status, gc.Equals, planStatusComplete)
+	c.Assert(report.Environments["prod"].Status, gc.Equals, planStatusComplete)
+}
+
+func (*migratePlanSuite) TestRunCanaryCheckFailure(c *gc.C) {
+	commands := &fakePlanCommands{fail: map[string]string{"canary": "verify-target"}}
+	runner := &planRunner{
+		plan: &migrationPlan{Environments: map[string]plannedEnvironment{
+			"canary": {Controller: "ctrl", Rollout: rolloutCanary},
+			"prod":   {Controller: "ctrl"},
+		}},
+		previous: &planReport{Environments: map[string]*planEnvironmentReport{
+			"canary": {Status: planStatusManual, Completed: []string{"verify", "backup"}},
+		}},
+		progress:   ioutil.Discard,
+		runCommand: commands.run,
+	}
+	report := runner.run()
+	c.Assert(commands.calls["prod"], gc.HasLen, 0)
+	c.Assert(report.Environments["prod"].Status, gc.Equals, planStatusSkipped)
+	c.Assert(report.Environments["canary"].FailedStep, gc.Equals, "check")
+}
+
+func (*migratePlanSuite) TestRunCanaryFailure(c *gc.C) {
+	commands := &fakePlanCommands{fail: map[string]string{"canary": "dump-source-db"}}
+	runner := &planRunner{
+		plan: &migrationPlan{Environments: map[string]plannedEnvironment{
+			"canary": {Controller: "ctrl", Rollout: rolloutCanary},
+			"prod":   {Controller: "ctrl"},
+		}},
+		progress:   ioutil.Discard,
+		runCommand: commands.run,
+	}
+	report := runner.run()
+	c.Assert(commands.calls["prod"], gc.HasLen, 0)
+	c.Assert(report.Environments["prod"].Status, gc.Equals, planStatusSkipped)
+	canary := report.Environments["canary"]
+	c.Assert(canary.Status, gc.Equals, planStatusFailed)
+	c.Assert(canary.FailedStep, gc.Equals, "backup")
+	c.Assert(canary.Error, gc.Equals, "boom")
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"regexp"
+
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	names2 "gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+// validRegion matches the cloud region names accepted by --region.
+var validRegion = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// exportOverrides holds the flags used to change how an environment is
+// exported, so that it is imported with a different name, owner, cloud or
+// credential on the controller. As with machineSelector, the client
+// command passes the flags through to the remote command, which does the
+// export.
+type exportOverrides struct {
+	modelName  string
+	owner      string
+	cloud      string
+	region     string
+	credential string
+}
+
+// SetFlags adds the override flags to f.
+func (o *exportOverrides) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&o.modelName, "model-name", "", "Name of the model on the controller (defaults to the environment name)")
+	f.StringVar(&o.owner, "owner", "", "Owner of the model on the controller (defaults to the environment owner)")
+	f.StringVar(&o.cloud, "cloud", "", "Cloud on the controller to import the model into")
+	f.StringVar(&o.region, "region", "", "Cloud region to import the model into")
+	f.StringVar(&o.credential, "credential", "", "Existing cloud credential of the owner on the controller to use, rather than the environment's")
+}
+
+// validate checks that the overrides are well formed.
+func (o *exportOverrides) validate() error {
+	if o.modelName != "" && !names2.IsValidModelName(o.modelName) {
+		return errors.NotValidf("model name %q", o.modelName)
+	}
+	if o.owner != "" && !names2.IsValidUser(o.owner) {
+		return errors.NotValidf("owner %q", o.owner)
+	}
+	if o.cloud != "" && !names2.IsValidCloud(o.cloud) {
+		return errors.NotValidf("cloud %q", o.cloud)
+	}
+	if o.region != "" && !validRegion.MatchString(o.region) {
+		return errors.NotValidf("region %q", o.region)
+	}
+	if o.region != "" && o.cloud == "" {
+		return errors.New("--region requires --cloud")
+	}
+	if o.credential != "" && !names2.IsValidCloudCredentialName(o.credential) {
+		return errors.NotValidf("credential %q", o.credential)
+	}
+	return nil
+}
+
+// remoteArgs returns the override flags to pass on to the remote command.
+func (o *exportOverrides) remoteArgs() []string {
+	var args []string
+	for _, flag := range []struct {
+		name  string
+		value string
+	}{
+		{"--model-name", o.modelName},
+		{"--owner", o.owner},
+		{"--cloud", o.cloud},
+		{"--region", o.region},
+		{"--credential", o.credential},
+	} {
+		if flag.value != "" {
+			args = append(args, flag.name, flag.value)
+		}
+	}
+	return args
+}
+
+// stateOverrides returns the overrides to export the environment with.
+func (o *exportOverrides) stateOverrides() state.ExportOverrides {
+	overrides := state.ExportOverrides{
+		ModelName:      o.modelName,
+		Cloud:          o.cloud,
+		CloudRegion:    o.region,
+		CredentialName: o.credential,
+	}
+	if o.owner != "" {
+		overrides.Owner = names2.NewUserTag(o.owner)
+	}
+	return overrides
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	names2 "gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+type overridesSuite struct{}
+
+var _ = gc.Suite(&overridesSuite{})
+
+func (*overridesSuite) TestValidate(c *gc.C) {
+	c.Assert((&exportOverrides{}).validate(), jc.ErrorIsNil)
+	c.Assert((&exportOverrides{modelName: "web", owner: "web-team", cloud: "aws", region: "us-east-1"}).validate(), jc.ErrorIsNil)
+	c.Assert((&exportOverrides{modelName: "Web"}).validate(), gc.ErrorMatches, `model name "Web" not valid`)
+	c.Assert((&exportOverrides{owner: "a/b"}).validate(), gc.ErrorMatches, `owner "a/b" not valid`)
+	c.Assert((&exportOverrides{region: "us-east-1"}).validate(), gc.ErrorMatches, "--region requires --cloud")
+	c.Assert((&exportOverrides{cloud: "aws;reboot"}).validate(), gc.ErrorMatches, `cloud "aws;reboot" not valid`)
+	c.Assert((&exportOverrides{cloud: "aws", region: "$(reboot)"}).validate(), gc.ErrorMatches, `region "\$\(reboot\)" not valid`)
+	c.Assert((&exportOverrides{credential: "web-aws"}).validate(), jc.ErrorIsNil)
+	c.Assert((&exportOverrides{credential: "a b"}).validate(), gc.ErrorMatches, `credential "a b" not valid`)
+}
+
+func (*overridesSuite) TestRemoteArgsQuoted(c *gc.C) {
+	o := &exportOverrides{modelName: "web", credential: "it's"}
+	c.Assert(shQuoteArgs(o.remoteArgs()), gc.Equals, `'--model-name' 'web' '--credential' 'it'\''s'`)
+}
+
+func (*overridesSuite) TestRemoteArgs(c *gc.C) {
+	c.Assert((&exportOverrides{}).remoteArgs(), gc.IsNil)
+	o := &exportOverrides{modelName: "web", owner: "web-team", credential: "web-aws"}
+	c.Assert(o.remoteArgs(), jc.DeepEquals, []string{
+		"--model-name", "web", "--owner", "web-team", "--credential", "web-aws",
+	})
+}
+
+func (*overridesSuite) TestStateOverrides(c *gc.C) {
+	c.Assert((&exportOverrides{}).stateOverrides(), jc.DeepEquals, state.ExportOverrides{})
+	o := &exportOverrides{modelName: "web", owner: "web-team", cloud: "aws", region: "us-east-1", credential: "web-aws"}
+	c.Assert(o.stateOverrides(), jc.DeepEquals, state.ExportOverrides{
+		ModelName:      "web",
+		Owner:          names2.NewUserTag("web-team"),
+		Cloud:          "aws",
+		CloudRegion:    "us-east-1",
+		CredentialName: "web-aws",
+	})
+}
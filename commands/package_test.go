@@ -6,9 +6,10 @@ package commands
 import (
 	"testing"
 
-	gc "gopkg.in/check.v1"
+	coretesting "github.com/juju/1.25-upgrade/juju1/testing"
 )
 
 func Test(t *testing.T) {
-	gc.TestingT(t)
+	// The selector tests need a 1.25 state, and so a mongo server.
+	coretesting.MgoTestPackage(t)
 }
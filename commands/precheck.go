@@ -0,0 +1,435 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/juju/cmd"
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/utils/set"
+	"github.com/juju/version"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/api"
+	"github.com/juju/1.25-upgrade/juju2/api/base"
+	cloudapi "github.com/juju/1.25-upgrade/juju2/api/cloud"
+	"github.com/juju/1.25-upgrade/juju2/api/controller"
+	"github.com/juju/1.25-upgrade/juju2/api/migrationtarget"
+	"github.com/juju/1.25-upgrade/juju2/api/usermanager"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
+	"github.com/juju/1.25-upgrade/juju2/migration"
+)
+
+var precheckTargetDoc = `
+The purpose of the precheck-target command is to check that a 1.25
+environment can be imported into a Juju 2.x controller, before any changes
+are made to either of them.
+
+The environment is exported from the 1.25 API server, and the controller is
+asked to run its migration prechecks on it. The exported environment is first
+checked as a 2.x source controller checks a model before migrating it:
+ - every machine is provisioned, and its agent started
+ - every unit agent is idle or executing
+ - every agent is running the environment's agent version
+ - no application has fewer units than its minimum
+The command also checks that:
+ - the controller version can import 1.25 environments
+ - the controller supports the environment's model description version,
+   and everything the environment uses (such as storage or payloads)
+ - the controller's cloud (or the one given with --cloud) is of the same
+   type as the environment's provider
+ - the environment owner exists on the controller
+ - the credential given with --credential exists on the controller
+ - there is no model with the same name or UUID on the controller
+ - the controller has agent binaries for every series and architecture
+   used by the environment's machines
+
+The environment is checked as it would be imported with the --model-name,
+--owner, --cloud, --region and --credential flags, which are described in
+the help for verify-source.
+
+All of the problems found are reported. With --environments or
+--all-environments each of the selected environments is checked.
+
+`
+
+func newPrecheckTargetCommand() cmd.Command {
+	return wrap(&precheckTargetCommand{
+		baseClientCommand{
+			needsController: true,
+			overridable:     true,
+			remoteCommand:   "verify-source-impl",
+		},
+	})
+}
+
+type precheckTargetCommand struct {
+	baseClientCommand
+}
+
+func (c *precheckTargetCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "precheck-target",
+		Args:    "<environment name> <controller name>",
+		Purpose: "check a controller can accept the specified environment",
+		Doc:     precheckTargetDoc,
+	}
+}
+
+func (c *precheckTargetCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *precheckTargetCommand) Run(ctx *cmd.Context) error {
+	// The remote command only exports the environment, so it is not
+	// given the controller info; all of the checks against the
+	// controller are made from here.
+	result, err := c.runRemote(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if result.Code != 0 {
+		fmt.Fprintf(ctx.Stderr, result.Stderr)
+		return &cmd.RcPassthroughError{result.Code}
+	}
+	documents := splitYAMLDocuments(result.Stdout)
+	if len(documents) == 0 {
+		return errors.New("no environments exported")
+	}
+
+	conn, err := c.NewAPIRoot()
+	if err != nil {
+		return errors.Annotate(err, "connecting to target controller")
+	}
+	defer conn.Close()
+
+	// Each environment selected is checked on its own, but the
+	// problems are reported for all of them together.
+	failed := 0
+	for _, document := range documents {
+		model, err := description.Deserialize([]byte(document))
+		if err != nil {
+			return errors.Annotate(err, "reading exported environment")
+		}
+		name := model.Config()["name"]
+		problems := c.precheck(conn, model, []byte(document))
+		if len(problems) == 0 {
+			fmt.Fprintf(ctx.Stdout, "Environment %q can be imported into controller\n", name)
+			continue
+		}
+		fmt.Fprintf(ctx.Stdout, "Environment %q cannot be imported into controller:\n", name)
+		for _, problem := range problems {
+			fmt.Fprintf(ctx.Stdout, "  %s\n", problem)
+		}
+		failed += len(problems)
+	}
+	if failed > 0 {
+		return errors.Errorf("%d prechecks failed", failed)
+	}
+	return nil
+}
+
+// precheck runs every check against the target controller, and returns
+// all of the problems found.
+func (c *precheckTargetCommand) precheck(conn api.Connection, model description.Model, serialized []byte) []string {
+	var problems []string
+	addProblem := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	info, err := sourceModelInfo(model, serialized)
+	if err != nil {
+		// Without the model info none of the remaining checks
+		// are meaningful.
+		addProblem(errors.Annotate(err, "getting model info"))
+		return problems
+	}
+
+	for _, err := range checkSource(model, info.AgentVersion) {
+		addProblem(err)
+	}
+
+	controllerVersion, ok := conn.ServerVersion()
+	if !ok {
+		addProblem(errors.New("controller version not available"))
+	} else {
+		addProblem(checkTargetVersion(info.ControllerAgentVersion, controllerVersion))
+	}
+	addProblem(errors.Annotate(migrationtarget.NewClient(conn).Prechecks(info), "controller prechecks"))
+	providerType, _ := model.Config()["type"].(string)
+	addProblem(checkTargetCloud(conn, model.Cloud(), providerType))
+	addProblem(checkTargetOwner(conn, info.Owner))
+	addProblem(checkTargetCredential(conn, model.CloudCredential()))
+	addProblem(checkTargetModels(conn, info))
+	if ok {
+		addProblem(c.checkTargetTools(model, controllerVersion))
+	}
+	return problems
+}
+
+// sourceModelInfo returns the information about the exported environment
+// that the controller needs to run its prechecks. The serialized model is
+// needed for the version of the model description.
+func sourceModelInfo(model description.Model, serialized []byte) (coremigration.ModelInfo, error) {
+	var empty coremigration.ModelInfo
+	config := model.Config()
+	name, _ := config["name"].(string)
+	agentVersion, _ := config["agent-version"].(string)
+	number, err := version.Parse(agentVersion)
+	if err != nil {
+		return empty, errors.Annotate(err, "parsing agent-version")
+	}
+	info := coremigration.ModelInfo{
+		UUID:         model.Tag().Id(),
+		Owner:        model.Owner(),
+		Name:         name,
+		AgentVersion: number,
+		// The 1.25 API server is the source controller.
+		ControllerAgentVersion: number,
+		Features:               migration.ModelFeatures(model),
+	}
+	info.DescriptionVersion, err = migration.DescriptionVersion(serialized)
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	if err := info.Validate(); err != nil {
+		return empty, errors.Trace(err)
+	}
+	return info, nil
+}
+
+// checkSource returns the problems that the source controller's
+// migration prechecks would find with the exported environment. The 1.25
+// API server has no prechecks of its own, so they are made here against
+// the export.
+func checkSource(model description.Model, agentVersion version.Number) []error {
+	var problems []error
+	checkTools := func(agentTools description.AgentTools, label string) {
+		if agentTools == nil {
+			problems = append(problems, errors.Errorf("%s has no agent binaries", label))
+		} else if v := agentTools.Version().Number; v != agentVersion {
+			problems = append(problems, errors.Errorf("%s tools don't match model (%s != %s)", label, v, agentVersion))
+		}
+	}
+
+	var checkMachines func([]description.Machine)
+	checkMachines = func(machines []description.Machine) {
+		for _, m := range machines {
+			if m.Instance() == nil {
+				problems = append(problems, errors.Errorf("machine %s not provisioned", m.Id()))
+			}
+			if agentStatus := statusValue(m.Status()); agentStatus != "started" {
+				problems = append(problems, errors.Errorf("machine %s agent not functioning at this time (%s)", m.Id(), agentStatus))
+			}
+			checkTools(m.Tools(), "machine "+m.Id())
+			checkMachines(m.Containers())
+		}
+	}
+	checkMachines(model.Machines())
+
+	for _, app := range model.Applications() {
+		units := app.Units()
+		if len(units) < app.MinUnits() {
+			problems = append(problems, errors.Errorf("application %s is below its minimum units threshold", app.Name()))
+		}
+		for _, unit := range units {
+			switch agentStatus := statusValue(unit.AgentStatus()); agentStatus {
+			case "idle", "executing":
+			default:
+				problems = append(problems, errors.Errorf("unit %s not idle or executing (%s)", unit.Name(), agentStatus))
+			}
+			checkTools(unit.Tools(), "unit "+unit.Name())
+		}
+	}
+	return problems
+}
+
+// statusValue returns the value of an exported status, which may be
+// missing.
+func statusValue(s description.Status) string {
+	if s == nil {
+		return "unknown"
+	}
+	return s.Value()
+}
+
+// checkTargetVersion returns an error if environments of the given 1.25
+// version may not be imported into a controller running the given version.
+// Controllers that predate the compatibility table don't check this
+// themselves, so it is checked here against the tool's copy of the table.
+func checkTargetVersion(sourceVersion, controllerVersion version.Number) error {
+	_, err := migration.FindCompatibility(sourceVersion, controllerVersion)
+	return errors.Trace(err)
+}
+
+// checkTargetCloud returns an error if the cloud the environment will be
+// imported into is not of the same type as the 1.25 provider. Unless the
+// cloud was given when the environment was exported, the cloud is named
+// after the provider type, and the controller's own cloud is checked.
+func checkTargetCloud(conn base.APICallCloser, cloudName, providerType string) error {
+	client := cloudapi.NewClient(conn)
+	tag := names.NewCloudTag(cloudName)
+	if cloudName == providerType {
+		var err error
+		tag, err = client.DefaultCloud()
+		if err != nil {
+			return errors.Annotate(err, "getting controller cloud")
+		}
+	}
+	cloud, err := client.Cloud(tag)
+	if err != nil {
+		return errors.Annotatef(err, "getting cloud %q", tag.Id())
+	}
+	if cloud.Type != providerType {
+		return errors.Errorf("controller cloud %q is of type %q, environment uses %q",
+			tag.Id(), cloud.Type, providerType)
+	}
+	return nil
+}
+
+// checkTargetOwner returns an error if the owner of the environment does
+// not exist, or is disabled, on the controller.
+func checkTargetOwner(conn base.APICallCloser, owner names.UserTag) error {
+	if !owner.IsLocal() {
+		// External users are not recorded by the controller
+		// until they first log in.
+		return nil
+	}
+	users, err := usermanager.NewClient(conn).UserInfo([]string{owner.Name()}, usermanager.AllUsers)
+	if err != nil {
+		return errors.Annotatef(err, "owner %q not found on controller", owner.Name())
+	}
+	if len(users) != 1 {
+		return errors.Errorf("owner %q not found on controller", owner.Name())
+	}
+	if users[0].Disabled {
+		return errors.Errorf("owner %q is disabled on controller", owner.Name())
+	}
+	return nil
+}
+
+// checkTargetCredential returns an error if the credential refers to one
+// that should already exist on the controller, and it doesn't. A
+// credential exported with its attributes is added to the controller when
+// the model is imported.
+func checkTargetCredential(conn base.APICallCloser, creds description.CloudCredential) error {
+	if creds == nil || len(creds.Attributes()) > 0 {
+		return nil
+	}
+	id := fmt.Sprintf("%s/%s/%s", creds.Cloud(), creds.Owner(), creds.Name())
+	if !names.IsValidCloudCredential(id) {
+		return errors.NotValidf("credential %q", id)
+	}
+	results, err := cloudapi.NewClient(conn).Credentials(names.NewCloudCredentialTag(id))
+	if err != nil {
+		return errors.Annotatef(err, "getting credential %q", id)
+	}
+	if len(results) != 1 || results[0].Error != nil {
+		return errors.Errorf("credential %q not found on controller", id)
+	}
+	return nil
+}
+
+// checkTargetModels returns an error if there is already a model with the
+// same UUID, or name and owner, on the controller.
+func checkTargetModels(conn base.APICallCloser, info coremigration.ModelInfo) error {
+	models, err := controller.NewClient(conn).AllModels()
+	if err != nil {
+		return errors.Annotate(err, "getting controller models")
+	}
+	for _, model := range models {
+		if model.UUID == info.UUID {
+			return errors.Errorf("model %s/%s has the same UUID (%s)", model.Owner, model.Name, info.UUID)
+		}
+		if model.Name == info.Name && model.Owner == info.Owner.Id() {
+			return errors.Errorf("model %s/%s already exists", model.Owner, model.Name)
+		}
+	}
+	return nil
+}
+
+// checkTargetTools returns an error if the controller does not have agent
+// binaries of its own version for every series and architecture used by
+// the environment's machines.
+func (c *precheckTargetCommand) checkTargetTools(model description.Model, controllerVersion version.Number) error {
+	needed := set.NewStrings()
+	var addMachines func([]description.Machine)
+	addMachines = func(machines []description.Machine) {
+		for _, m := range machines {
+			if tools := m.Tools(); tools != nil {
+				needed.Add(fmt.Sprintf("%s-%s", tools.Version().Series, tools.Version().Arch))
+			}
+			addMachines(m.Containers())
+		}
+	}
+	addMachines(model.Machines())
+
+	// Agent binaries are found through the controller model.
+	conn, err := c.controllerModelConnection()
+	if err != nil {
+		return errors.Annotate(err, "connecting to controller model")
+	}
+	defer conn.Close()
+	client := conn.Client()
+
+	var missing []string
+	for _, seriesArch := range needed.SortedValues() {
+		binary, err := version.ParseBinary(fmt.Sprintf("%s-%s", controllerVersion, seriesArch))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		result, err := client.FindTools(controllerVersion.Major, controllerVersion.Minor, binary.Series, binary.Arch)
+		if err == nil && result.Error != nil {
+			err = result.Error
+		}
+		if params.IsCodeNotFound(err) {
+			missing = append(missing, binary.String())
+			continue
+		} else if err != nil {
+			return errors.Annotatef(err, "finding agent binaries for %s", seriesArch)
+		}
+		found := false
+		for _, tools := range result.List {
+			if tools.Version == binary {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, binary.String())
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("controller missing agent binaries: %v", missing)
+	}
+	return nil
+}
+
+// controllerModelConnection returns a connection to the controller model
+// of the target controller.
+func (c *precheckTargetCommand) controllerModelConnection() (api.Connection, error) {
+	controllerName, err := c.ControllerName()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	details, err := c.ClientStore().ControllerByName(controllerName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	info, err := c.GetControllerAPIInfo()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	info.ModelTag = names.NewModelTag(details.ControllerModelUUID)
+	return api.Open(info, api.DefaultDialOpts())
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/names.v2"
+
+	basetesting "github.com/juju/1.25-upgrade/juju2/api/base/testing"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
+)
+
+type precheckSuite struct{}
+
+var _ = gc.Suite(&precheckSuite{})
+
+func (*precheckSuite) TestCheckTargetVersion(c *gc.C) {
+	source := version.MustParse("1.25.10")
+	for _, supported := range []string{"2.1.0", "2.1.3", "2.2-beta1", "2.2.2", "2.2.9"} {
+		c.Check(checkTargetVersion(source, version.MustParse(supported)), jc.ErrorIsNil, gc.Commentf(supported))
+	}
+	for _, unsupported := range []string{"2.0.4", "2.3.0", "3.0.0"} {
+		c.Check(checkTargetVersion(source, version.MustParse(unsupported)), gc.ErrorMatches,
+			`migrating models from 1.25 controllers to .* controllers is not supported`, gc.Commentf(unsupported))
+	}
+}
+
+// controllerAPI returns an API caller that answers the calls made by the
+// precheck functions from the given cloud, users, credentials and models.
+func controllerAPI(clouds map[string]params.Cloud, users map[string]params.UserInfo, credentials []string, models []params.UserModel) basetesting.APICallerFunc {
+	return func(facade string, version int, id, request string, args, response interface{}) error {
+		switch facade + "." + request {
+		case "Cloud.DefaultCloud":
+			*(response.(*params.StringResult)) = params.StringResult{Result: "cloud-default"}
+		case "Cloud.Cloud":
+			tag := args.(params.Entities).Entities[0].Tag
+			result := params.CloudResult{}
+			if cloud, ok := clouds[tag]; ok {
+				result.Cloud = &cloud
+			} else {
+				result.Error = &params.Error{Message: "cloud not found", Code: params.CodeNotFound}
+			}
+			*(response.(*params.CloudResults)) = params.CloudResults{[]params.CloudResult{result}}
+		case "UserManager.UserInfo":
+			tag := args.(params.UserInfoRequest).Entities[0].Tag
+			result := params.UserInfoResult{}
+			if user, ok := users[tag]; ok {
+				result.Result = &user
+			} else {
+				result.Error = &params.Error{Message: "user not found", Code: params.CodeNotFound}
+			}
+			*(response.(*params.UserInfoResults)) = params.UserInfoResults{[]params.UserInfoResult{result}}
+		case "Cloud.Credential":
+			tag := args.(params.Entities).Entities[0].Tag
+			result := params.CloudCredentialResult{
+				Error: &params.Error{Message: "credential not found", Code: params.CodeNotFound},
+			}
+			for _, credential := range credentials {
+				if tag == credential {
+					result = params.CloudCredentialResult{Result: &params.CloudCredential{AuthType: "userpass"}}
+				}
+			}
+			*(response.(*params.CloudCredentialResults)) = params.CloudCredentialResults{[]params.CloudCredentialResult{result}}
+		case "Controller.AllModels":
+			*(response.(*params.UserModelList)) = params.UserModelList{models}
+		default:
+			return errors.Errorf("unexpected call %s.%s", facade, request)
+		}
+		return nil
+	}
+}
+
+func (*precheckSuite) TestCheckTargetCloud(c *gc.C) {
+	conn := controllerAPI(map[string]params.Cloud{
+		"cloud-default": {Type: "ec2"},
+		"cloud-other":   {Type: "openstack"},
+	}, nil, nil, nil)
+
+	// The cloud is named after the provider type unless it was
+	// overridden, in which case the controller's cloud is checked.
+	c.Check(checkTargetCloud(conn, "ec2", "ec2"), jc.ErrorIsNil)
+	c.Check(checkTargetCloud(conn, "openstack", "openstack"), gc.ErrorMatches,
+		`controller cloud "default" is of type "ec2", environment uses "openstack"`)
+	c.Check(checkTargetCloud(conn, "other", "openstack"), jc.ErrorIsNil)
+	c.Check(checkTargetCloud(conn, "other", "ec2"), gc.ErrorMatches,
+		`controller cloud "other" is of type "openstack", environment uses "ec2"`)
+	c.Check(checkTargetCloud(conn, "missing", "ec2"), gc.ErrorMatches,
+		`getting cloud "missing": cloud not found`)
+}
+
+func (*precheckSuite) TestCheckTargetOwner(c *gc.C) {
+	conn := controllerAPI(nil, map[string]params.UserInfo{
+		"user-bob":   {Username: "bob"},
+		"user-alice": {Username: "alice", Disabled: true},
+	}, nil, nil)
+
+	c.Check(checkTargetOwner(conn, names.NewUserTag("bob")), jc.ErrorIsNil)
+	c.Check(checkTargetOwner(conn, names.NewUserTag("alice")), gc.ErrorMatches,
+		`owner "alice" is disabled on controller`)
+	c.Check(checkTargetOwner(conn, names.NewUserTag("mallory")), gc.ErrorMatches,
+		`owner "mallory" not found on controller: mallory: user not found`)
+	// External users aren't looked up.
+	c.Check(checkTargetOwner(conn, names.NewUserTag("eve@external")), jc.ErrorIsNil)
+}
+
+func (*precheckSuite) TestCheckTargetCredential(c *gc.C) {
+	conn := controllerAPI(nil, nil, []string{"cloudcred-ec2_bob_main"}, nil)
+	credential := func(name string, attributes map[string]string) description.CloudCredential {
+		model := description.NewModel(description.ModelArgs{Owner: names.NewUserTag("bob")})
+		model.SetCloudCredential(description.CloudCredentialArgs{
+			Owner:      names.NewUserTag("bob"),
+			Cloud:      names.NewCloudTag("ec2"),
+			Name:       name,
+			AuthType:   "userpass",
+			Attributes: attributes,
+		})
+		return model.CloudCredential()
+	}
+
+	c.Check(checkTargetCredential(conn, nil), jc.ErrorIsNil)
+	// A credential exported with its attributes is added on import.
+	c.Check(checkTargetCredential(conn, credential("new", map[string]string{"password": "secret"})), jc.ErrorIsNil)
+	c.Check(checkTargetCredential(conn, credential("main", nil)), jc.ErrorIsNil)
+	c.Check(checkTargetCredential(conn, credential("other", nil)), gc.ErrorMatches,
+		`credential "ec2/bob/other" not found on controller`)
+}
+
+func (*precheckSuite) TestCheckTargetModels(c *gc.C) {
+	conn := controllerAPI(nil, nil, nil, []params.UserModel{{
+		Model: params.Model{Name: "prod", UUID: "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6", OwnerTag: "user-bob"},
+	}})
+	info := coremigration.ModelInfo{
+		UUID:  "4ef1ba63-5a07-4bed-8bb8-3d3a8cbf4c5e",
+		Name:  "prod",
+		Owner: names.NewUserTag("alice"),
+	}
+	c.Check(checkTargetModels(conn, info), jc.ErrorIsNil)
+
+	info.Owner = names.NewUserTag("bob")
+	c.Check(checkTargetModels(conn, info), gc.ErrorMatches, "model bob/prod already exists")
+
+	info.Name = "staging"
+	info.UUID = "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6"
+	c.Check(checkTargetModels(conn, info), gc.ErrorMatches,
+		`model bob/prod has the same UUID \(bd3fae18-5ea1-4bc5-8837-45400cf1f8f6\)`)
+}
+
+func (*precheckSuite) TestCheckSource(c *gc.C) {
+	agentVersion := version.MustParse("1.25.10")
+	tools := description.AgentToolsArgs{Version: version.MustParseBinary("1.25.10-trusty-amd64")}
+	model := description.NewModel(description.ModelArgs{
+		Owner: names.NewUserTag("alice"),
+	})
+	machine := model.AddMachine(description.MachineArgs{Id: names.NewMachineTag("0")})
+	machine.SetInstance(description.CloudInstanceArgs{InstanceId: "i-0"})
+	machine.SetStatus(description.StatusArgs{Value: "started"})
+	machine.SetTools(tools)
+	app := model.AddApplication(description.ApplicationArgs{
+		Tag:      names.NewApplicationTag("wordpress"),
+		CharmURL: "cs:trusty/wordpress-5",
+		MinUnits: 1,
+	})
+	unit := app.AddUnit(description.UnitArgs{Tag: names.NewUnitTag("wordpress/0")})
+	unit.SetAgentStatus(description.StatusArgs{Value: "idle"})
+	unit.SetTools(tools)
+	c.Check(checkSource(model, agentVersion), gc.HasLen, 0)
+
+	container := machine.AddContainer(description.MachineArgs{Id: names.NewMachineTag("0/lxc/0")})
+	container.SetStatus(description.StatusArgs{Value: "down"})
+	container.SetTools(description.AgentToolsArgs{Version: version.MustParseBinary("1.25.9-trusty-amd64")})
+	unit.SetAgentStatus(description.StatusArgs{Value: "failed"})
+	model.AddApplication(description.ApplicationArgs{
+		Tag:      names.NewApplicationTag("mysql"),
+		CharmURL: "cs:trusty/mysql-3",
+		MinUnits: 1,
+	})
+	var problems []string
+	for _, err := range checkSource(model, agentVersion) {
+		problems = append(problems, err.Error())
+	}
+	c.Check(problems, jc.DeepEquals, []string{
+		"machine 0/lxc/0 not provisioned",
+		"machine 0/lxc/0 agent not functioning at this time (down)",
+		"machine 0/lxc/0 tools don't match model (1.25.9 != 1.25.10)",
+		"unit wordpress/0 not idle or executing (failed)",
+		"application mysql is below its minimum units threshold",
+	})
+}
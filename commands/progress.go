@@ -0,0 +1,259 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	// progressEventPrefix marks the lines of the remote command's
+	// stderr that hold progress events, for the client to display.
+	progressEventPrefix = "progress-event: "
+
+	// slowMachineThreshold is how long a call to a machine may take
+	// before the machine is shown as slow.
+	slowMachineThreshold = 30 * time.Second
+)
+
+// The types of progress event.
+const (
+	progressBegin     = "begin"
+	progressStarted   = "started"
+	progressSucceeded = "succeeded"
+	progressFailed    = "failed"
+	progressEnd       = "end"
+)
+
+// progressEvent describes a change in the progress of the calls made by
+// parallelCall.
+type progressEvent struct {
+	Type      string    `json:"type"`
+	Operation string    `json:"operation"`
+	Time      time.Time `json:"time"`
+	Total     int       `json:"total,omitempty"`
+	Machine   string    `json:"machine,omitempty"`
+	Code      int       `json:"code,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// progressWriter is used by the remote commands to write progress events
+// for the client. All methods may be called on a nil progressWriter, which
+// writes nothing.
+type progressWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	operation string
+}
+
+func newProgressWriter(w io.Writer, operation string) *progressWriter {
+	return &progressWriter{w: w, operation: operation}
+}
+
+func (p *progressWriter) write(event progressEvent) {
+	if p == nil {
+		return
+	}
+	event.Operation = p.operation
+	event.Time = time.Now().UTC()
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Warningf("cannot write progress event: %v", err)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "%s%s\n", progressEventPrefix, bytes)
+}
+
+// begin reports that calls are about to be made to total machines.
+func (p *progressWriter) begin(total int) {
+	p.write(progressEvent{Type: progressBegin, Total: total})
+}
+
+// started reports that the call to the machine has started.
+func (p *progressWriter) started(machine string) {
+	p.write(progressEvent{Type: progressStarted, Machine: machine})
+}
+
+// finished reports the result of the call to the machine.
+func (p *progressWriter) finished(machine string, code int, err error) {
+	event := progressEvent{Type: progressSucceeded, Machine: machine, Code: code}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	if err != nil || code != 0 {
+		event.Type = progressFailed
+	}
+	p.write(event)
+}
+
+// end reports that all of the calls have finished.
+func (p *progressWriter) end() {
+	p.write(progressEvent{Type: progressEnd})
+}
+
+// progressDisplay shows the progress events written by the remote command
+// to the operator. On a terminal, a status line with the counts of calls
+// started, succeeded and failed, the elapsed time, and any slow machines,
+// is kept up to date. Otherwise the events are written as they arrive,
+// one JSON object per line.
+type progressDisplay struct {
+	mu  sync.Mutex
+	out io.Writer
+	tty bool
+	now func() time.Time
+
+	operation string
+	start     time.Time
+	total     int
+	succeeded int
+	failed    int
+	running   map[string]time.Time
+	shown     bool
+}
+
+func newProgressDisplay(out io.Writer) *progressDisplay {
+	return &progressDisplay{
+		out:     out,
+		tty:     isTerminal(out),
+		now:     time.Now,
+		running: make(map[string]time.Time),
+	}
+}
+
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd())
+}
+
+// handleLine displays the progress event held in the line, and returns
+// whether the line was a progress event.
+func (d *progressDisplay) handleLine(line string) bool {
+	if !strings.HasPrefix(line, progressEventPrefix) {
+		return false
+	}
+	data := strings.TrimPrefix(line, progressEventPrefix)
+	var event progressEvent
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		logger.Warningf("cannot read progress event: %v", err)
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.tty {
+		fmt.Fprintln(d.out, data)
+		return true
+	}
+	now := d.now()
+	switch event.Type {
+	case progressBegin:
+		d.operation = event.Operation
+		d.start = now
+		d.total = event.Total
+		d.succeeded = 0
+		d.failed = 0
+		d.running = make(map[string]time.Time)
+	case progressStarted:
+		d.running[event.Machine] = now
+	case progressSucceeded:
+		delete(d.running, event.Machine)
+		d.succeeded++
+	case progressFailed:
+		delete(d.running, event.Machine)
+		d.failed++
+	}
+	d.render(now)
+	if event.Type == progressEnd {
+		fmt.Fprintln(d.out)
+		d.shown = false
+	}
+	return true
+}
+
+// refresh updates the elapsed time and slow machines in the status line.
+func (d *progressDisplay) refresh() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tty && d.shown {
+		d.render(d.now())
+	}
+}
+
+// status returns the status line.
+func (d *progressDisplay) status(now time.Time) string {
+	started := d.succeeded + d.failed + len(d.running)
+	line := fmt.Sprintf("%s: %d/%d started, %d succeeded, %d failed, %s elapsed",
+		d.operation, started, d.total, d.succeeded, d.failed,
+		now.Sub(d.start)/time.Second*time.Second)
+	var slow []string
+	for machine, start := range d.running {
+		if now.Sub(start) >= slowMachineThreshold {
+			slow = append(slow, machine)
+		}
+	}
+	if len(slow) > 0 {
+		sort.Strings(slow)
+		line += fmt.Sprintf(", slow: %s", strings.Join(slow, ", "))
+	}
+	return line
+}
+
+func (d *progressDisplay) render(now time.Time) {
+	// Return to the start of the line and clear it.
+	fmt.Fprintf(d.out, "\r\x1b[K%s", d.status(now))
+	d.shown = true
+}
+
+// finish ends the status line, if one is being shown.
+func (d *progressDisplay) finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.shown {
+		fmt.Fprintln(d.out)
+		d.shown = false
+	}
+}
+
+// lineWriter is an io.Writer that calls fn with each complete line
+// written to it, without the trailing newline.
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush calls fn with any incomplete last line.
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type progressSuite struct{}
+
+var _ = gc.Suite(&progressSuite{})
+
+func (*progressSuite) TestLineWriter(c *gc.C) {
+	var lines []string
+	w := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthree"))
+	c.Assert(lines, jc.DeepEquals, []string{"one", "two"})
+	w.flush()
+	c.Assert(lines, jc.DeepEquals, []string{"one", "two", "three"})
+}
+
+func (*progressSuite) TestProgressWriter(c *gc.C) {
+	var buf bytes.Buffer
+	p := newProgressWriter(&buf, "service stop")
+	p.begin(2)
+	p.started("0")
+	p.finished("0", 0, nil)
+	p.started("1")
+	p.finished("1", 0, errors.New("boom"))
+	p.end()
+
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		c.Assert(strings.HasPrefix(line, progressEventPrefix), jc.IsTrue)
+		var event progressEvent
+		err := json.Unmarshal([]byte(strings.TrimPrefix(line, progressEventPrefix)), &event)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(event.Operation, gc.Equals, "service stop")
+		types = append(types, event.Type+":"+event.Machine)
+	}
+	c.Assert(types, jc.DeepEquals, []string{
+		"begin:", "started:0", "succeeded:0", "started:1", "failed:1", "end:",
+	})
+}
+
+func (*progressSuite) TestNilProgressWriter(c *gc.C) {
+	var p *progressWriter
+	p.begin(1)
+	p.started("0")
+	p.finished("0", 1, nil)
+	p.end()
+}
+
+func (*progressSuite) TestDisplayIgnoresOtherLines(c *gc.C) {
+	var out bytes.Buffer
+	d := newProgressDisplay(&out)
+	c.Assert(d.handleLine("some output"), jc.IsFalse)
+	c.Assert(out.String(), gc.Equals, "")
+}
+
+func (*progressSuite) TestDisplayNotTerminal(c *gc.C) {
+	var events, out bytes.Buffer
+	p := newProgressWriter(&events, "service start")
+	p.begin(1)
+	p.started("0")
+
+	d := newProgressDisplay(&out)
+	for _, line := range strings.Split(strings.TrimSpace(events.String()), "\n") {
+		c.Assert(d.handleLine(line), jc.IsTrue)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	c.Assert(lines, gc.HasLen, 2)
+	c.Assert(lines[1], gc.Equals, strings.TrimPrefix(strings.Split(events.String(), "\n")[1], progressEventPrefix))
+}
+
+func (*progressSuite) TestDisplayTerminal(c *gc.C) {
+	var events, out bytes.Buffer
+	p := newProgressWriter(&events, "service stop")
+	p.begin(3)
+	p.started("0")
+	p.started("1")
+	p.started("2")
+	p.finished("0", 0, nil)
+	p.finished("1", 1, nil)
+
+	now := time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC)
+	d := newProgressDisplay(&out)
+	d.tty = true
+	d.now = func() time.Time { return now }
+	for _, line := range strings.Split(strings.TrimSpace(events.String()), "\n") {
+		d.handleLine(line)
+	}
+	c.Assert(d.status(now), gc.Equals, "service stop: 3/3 started, 1 succeeded, 1 failed, 0s elapsed")
+
+	now = now.Add(45 * time.Second)
+	d.refresh()
+	c.Assert(strings.HasSuffix(out.String(),
+		"\r\x1b[Kservice stop: 3/3 started, 1 succeeded, 1 failed, 45s elapsed, slow: 2"), jc.IsTrue)
+
+	d.finish()
+	c.Assert(strings.HasSuffix(out.String(), "\n"), jc.IsTrue)
+}
@@ -4,72 +4,118 @@
 package commands
 
 import (
-	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
-	"io/ioutil"
-	"os/exec"
+	"io"
+	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/utils"
+	"github.com/juju/utils/ssh"
 )
 
-func remoteMD5Sum(plugin, address string) (string, error) {
-	pluginBase := filepath.Base(plugin)
+// remotePluginPath returns where the plugin is installed on the 1.25
+// machines. Each version of the plugin is installed in its own directory,
+// so that a client only ever runs the remote commands of its own version.
+func remotePluginPath(plugin string) string {
+	return path.Join(upgraderDir, "bin", upgraderVersion.String(), filepath.Base(plugin))
+}
 
-	result, err := runViaSSH(
-		address,
-		fmt.Sprintf("md5sum %s | cut -f 1 -d ' '\n", pluginBase),
-		"")
+// pluginStagingPath returns where the plugin is copied to on a machine
+// before it is checked and installed. It is in the ubuntu user's home
+// directory, so that it can be copied there without root access.
+func pluginStagingPath(plugin string) string {
+	return path.Join("/home/ubuntu", filepath.Base(plugin)+".new")
+}
 
+func localSHA256Sum(plugin string) (string, error) {
+	f, err := os.Open(plugin)
 	if err != nil {
-		return "", errors.Annotate(err, "getting md5sum")
+		return "", errors.Annotate(err, "opening plugin")
 	}
-
-	if result.Code != 0 {
-		return "", errors.Errorf("getting md5: %q, %q", result.Stdout, result.Stderr)
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", errors.Annotate(err, "reading plugin")
 	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
 
-	return strings.TrimSpace(result.Stdout), nil
+// pluginCheckScript returns a script that writes the SHA256 sum of the
+// installed plugin, or nothing if it isn't installed.
+func pluginCheckScript(plugin string) string {
+	return fmt.Sprintf("sha256sum %s 2> /dev/null | cut -f 1 -d ' '\n", utils.ShQuote(remotePluginPath(plugin)))
 }
 
-func localMD5Sum(plugin string) (string, error) {
-	content, err := ioutil.ReadFile(plugin)
-	if err != nil {
-		return "", errors.Annotate(err, "opening plugin")
-	}
-	bytes := md5.Sum(content)
-	return fmt.Sprintf("%x", bytes), nil
+// pluginInstallScript returns a script that checks the staged copy of the
+// plugin against sum, and then installs it. The plugin is installed in
+// the filesystem rooted at root; this is "" other than for installing into
+// an LXC container from its host.
+func pluginInstallScript(plugin, sum, root string) string {
+	staged := pluginStagingPath(plugin)
+	return fmt.Sprintf(`
+set -e
+staged=%s
+dest=%s
+echo "%s  $staged" | sha256sum -c --quiet -
+mkdir -p "$(dirname "$dest")"
+cp "$staged" "$dest.tmp"
+chmod 0755 "$dest.tmp"
+mv "$dest.tmp" "$dest"
+rm -f "$staged"
+`, utils.ShQuote(staged), utils.ShQuote(root+remotePluginPath(plugin)), sum)
 }
 
-func updateRemotePlugin(plugin, address string) error {
-	scp := exec.Command("scp", "-C", plugin, fmt.Sprintf("ubuntu@%s:~", address))
-	copyResult, err := scp.CombinedOutput()
+// runInstallScript runs the plugin install script, returning an error if
+// it fails.
+func runInstallScript(address, script string, options *ssh.Options) error {
+	result, err := runSSH(address, script, options, nil, nil)
 	if err != nil {
-		return errors.Annotate(err, "copying command to environment")
+		return errors.Trace(err)
+	}
+	if result.Code != 0 {
+		return errors.Errorf("installing plugin: %s", strings.TrimSpace(result.Stdout+result.Stderr))
 	}
-	logger.Debugf("scp: %s", copyResult)
 	return nil
 }
 
+// copyViaSSH copies the file to dest on the machine with the address.
+func copyViaSSH(file, dest, address string, options *ssh.Options) error {
+	args := []string{file, fmt.Sprintf("ubuntu@%s:%s", address, dest)}
+	return ssh.Copy(args, options)
+}
+
+// checkUpdatePlugin installs the plugin on the API server if the version
+// installed there is missing or differs from the local one.
 func checkUpdatePlugin(ctx *cmd.Context, plugin, address string) error {
 	ctx.Infof("checking remote plugin")
-	local, err := localMD5Sum(plugin)
+	local, err := localSHA256Sum(plugin)
 	if err != nil {
-		return errors.Annotate(err, "generating local md5sum")
+		return errors.Annotate(err, "generating local sha256sum")
 	}
 	ctx.Verbosef("local: %q", local)
 
-	remote, err := remoteMD5Sum(plugin, address)
+	result, err := runViaSSH(address, pluginCheckScript(plugin), "")
 	if err != nil {
-		return errors.Annotate(err, "generating remote md5sum")
+		return errors.Annotate(err, "generating remote sha256sum")
 	}
+	if result.Code != 0 {
+		return errors.Errorf("getting sha256: %q, %q", result.Stdout, result.Stderr)
+	}
+	remote := strings.TrimSpace(result.Stdout)
 	ctx.Verbosef("remote: %q", remote)
 
-	if local != remote {
-		ctx.Infof("updating remote plugin")
-		return updateRemotePlugin(plugin, address)
+	if local == remote {
+		return nil
 	}
-	return nil
+	ctx.Infof("installing remote plugin %s", upgraderVersion)
+	options := newSSHOptions("", "")
+	if err := copyViaSSH(plugin, pluginStagingPath(plugin), address, options); err != nil {
+		return errors.Annotate(err, "copying plugin to environment")
+	}
+	return errors.Trace(runInstallScript(address, pluginInstallScript(plugin, local, ""), options))
 }
@@ -0,0 +1,37 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type remoteSuite struct{}
+
+var _ = gc.Suite(&remoteSuite{})
+
+func (*remoteSuite) TestRemotePluginPath(c *gc.C) {
+	c.Assert(remotePluginPath("/usr/local/bin/juju-1.25-upgrade"), gc.Equals,
+		"/home/ubuntu/.juju-1.25-upgrade/bin/"+upgraderVersion.String()+"/juju-1.25-upgrade")
+}
+
+func (*remoteSuite) TestLocalSHA256Sum(c *gc.C) {
+	plugin := filepath.Join(c.MkDir(), "juju-1.25-upgrade")
+	err := ioutil.WriteFile(plugin, []byte("plugin"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	sum, err := localSHA256Sum(plugin)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sum, gc.Equals, "5e689e2b01672bf33996e75d5e372ff60c536ce1599a1458e867cd8f4bef5160")
+}
+
+func (*remoteSuite) TestPluginInstallScript(c *gc.C) {
+	script := pluginInstallScript("/usr/local/bin/juju-1.25-upgrade", "abc123", "/var/lib/lxc/juju-machine-1-lxc-0/rootfs")
+	c.Assert(script, jc.Contains, `echo "abc123  $staged" | sha256sum -c --quiet -`)
+	c.Assert(script, jc.Contains, "staged='/home/ubuntu/juju-1.25-upgrade.new'")
+	c.Assert(script, jc.Contains, "dest='/var/lib/lxc/juju-machine-1-lxc-0/rootfs/home/ubuntu/.juju-1.25-upgrade/bin/")
+}
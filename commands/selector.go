@@ -0,0 +1,233 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/names"
+	"github.com/juju/utils/set"
+
+	"github.com/juju/1.25-upgrade/juju1/state"
+)
+
+// machineSelector holds the flags used to restrict the agent commands to
+// a subset of the machines in the environment. The client command passes
+// the flags through unchanged to the remote command, where they are
+// resolved against the 1.25 state.
+//
+// Selection is done by machine: all the agents on a selected machine are
+// acted upon. A container is selected (or excluded) along with a machine
+// given by id that hosts it, but not along with a machine that was picked
+// out by a service or unit.
+type machineSelector struct {
+	machines []string
+	services []string
+	exclude  []string
+}
+
+// SetFlags adds the selection flags to f.
+func (s *machineSelector) SetFlags(f *gnuflag.FlagSet) {
+	f.Var(cmd.NewStringsValue(nil, &s.machines), "machines", "Only act on these machines (comma separated ids)")
+	f.Var(cmd.NewStringsValue(nil, &s.services), "services", "Only act on machines hosting these services or units")
+	f.Var(cmd.NewStringsValue(nil, &s.exclude), "exclude", "Do not act on these machines, or machines hosting these services or units")
+}
+
+// validate checks that the selectors are well formed.
+func (s *machineSelector) validate() error {
+	for _, id := range s.machines {
+		if !names.IsValidMachine(id) {
+			return errors.NotValidf("machine id %q", id)
+		}
+	}
+	for _, name := range s.services {
+		if !names.IsValidService(name) && !names.IsValidUnit(name) {
+			return errors.NotValidf("service or unit name %q", name)
+		}
+	}
+	for _, name := range s.exclude {
+		if !names.IsValidMachine(name) && !names.IsValidService(name) && !names.IsValidUnit(name) {
+			return errors.NotValidf("machine, service or unit %q", name)
+		}
+	}
+	return nil
+}
+
+// remoteArgs returns the selection flags to pass on to the remote command.
+func (s *machineSelector) remoteArgs() []string {
+	var args []string
+	if len(s.machines) > 0 {
+		args = append(args, "--machines", strings.Join(s.machines, ","))
+	}
+	if len(s.services) > 0 {
+		args = append(args, "--services", strings.Join(s.services, ","))
+	}
+	if len(s.exclude) > 0 {
+		args = append(args, "--exclude", strings.Join(s.exclude, ","))
+	}
+	return args
+}
+
+// selectMachines returns the machines in the environments that match the
+// selection flags. An empty selector matches every machine. When there is
+// more than one environment the selectors are applied to each of them, and
+// need only match in one.
+func (s *machineSelector) selectMachines(states []*state.State) ([]FlatMachine, error) {
+	var selected []FlatMachine
+	matched := set.NewStrings()
+	for _, st := range states {
+		machines, err := s.selectEnvironMachines(st, matched)
+		if err != nil {
+			return nil, errors.Annotatef(err, "environment %s", st.EnvironUUID())
+		}
+		selected = append(selected, machines...)
+	}
+	for _, values := range [][]string{s.machines, s.services, s.exclude} {
+		for _, value := range values {
+			if !matched.Contains(value) {
+				return nil, errors.NotFoundf("machine, service or unit %q", value)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no machines selected")
+	}
+	return selected, nil
+}
+
+// selectEnvironMachines returns the machines in the environment that match
+// the selection flags, adding the selectors found in the environment to
+// matched.
+func (s *machineSelector) selectEnvironMachines(st *state.State, matched set.Strings) ([]FlatMachine, error) {
+	machines, err := getMachines(st)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	known := set.NewStrings()
+	for _, m := range machines {
+		known.Add(m.ID)
+	}
+
+	// resolve adds the machines identified by the selector in this
+	// environment to match.
+	resolve := func(value string, match *machineMatch) error {
+		if names.IsValidMachine(value) {
+			if known.Contains(value) {
+				matched.Add(value)
+				match.hosts.Add(value)
+			}
+			return nil
+		}
+		ids, err := hostMachineIds(st, value)
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return errors.Trace(err)
+		}
+		matched.Add(value)
+		match.exact = match.exact.Union(ids)
+		return nil
+	}
+
+	var include *machineMatch
+	if len(s.machines) > 0 || len(s.services) > 0 {
+		include = newMachineMatch()
+		values := append(append([]string(nil), s.machines...), s.services...)
+		for _, value := range values {
+			if err := resolve(value, include); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	}
+
+	exclude := newMachineMatch()
+	for _, value := range s.exclude {
+		if err := resolve(value, exclude); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return filterMachines(machines, include, exclude), nil
+}
+
+// hostMachineIds returns the ids of the machines hosting the named unit, or
+// all the units of the named service.
+func hostMachineIds(st *state.State, name string) (set.Strings, error) {
+	var units []*state.Unit
+	if names.IsValidUnit(name) {
+		unit, err := st.Unit(name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		units = append(units, unit)
+	} else {
+		service, err := st.Service(name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		units, err = service.AllUnits()
+		if err != nil {
+			return nil, errors.Annotatef(err, "getting units for service %q", name)
+		}
+	}
+	ids := set.NewStrings()
+	for _, unit := range units {
+		id, err := unit.AssignedMachineId()
+		if errors.IsNotAssigned(err) {
+			logger.Debugf("unit %q is not assigned to a machine", unit.Name())
+			continue
+		} else if err != nil {
+			return nil, errors.Annotatef(err, "getting machine for unit %q", unit.Name())
+		}
+		ids.Add(id)
+	}
+	return ids, nil
+}
+
+// machineMatch holds the machines picked out by selectors. The machines
+// in hosts match along with the containers they host; those in exact
+// match only themselves.
+type machineMatch struct {
+	hosts set.Strings
+	exact set.Strings
+}
+
+func newMachineMatch() *machineMatch {
+	return &machineMatch{
+		hosts: set.NewStrings(),
+		exact: set.NewStrings(),
+	}
+}
+
+// contains returns whether the machine with the given id matches.
+func (m *machineMatch) contains(id string) bool {
+	if m.exact.Contains(id) {
+		return true
+	}
+	for ; id != ""; id = state.ParentId(id) {
+		if m.hosts.Contains(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterMachines returns the machines that match include, or all of them
+// if include is nil, less those that match exclude.
+func filterMachines(machines []FlatMachine, include, exclude *machineMatch) []FlatMachine {
+	var result []FlatMachine
+	for _, m := range machines {
+		if include != nil && !include.contains(m.ID) {
+			continue
+		}
+		if exclude.contains(m.ID) {
+			continue
+		}
+		result = append(result, m)
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju1/network"
+	"github.com/juju/1.25-upgrade/juju1/state"
+	statetesting "github.com/juju/1.25-upgrade/juju1/state/testing"
+	"github.com/juju/1.25-upgrade/juju1/testing/factory"
+)
+
+type selectorSuite struct{}
+
+var _ = gc.Suite(&selectorSuite{})
+
+var selectorMachines = []FlatMachine{
+	{ID: "0"},
+	{ID: "0/lxc/0"},
+	{ID: "1"},
+	{ID: "1/lxc/0"},
+	{ID: "1/lxc/0/kvm/0"},
+	{ID: "2"},
+}
+
+func machineIds(machines []FlatMachine) []string {
+	var ids []string
+	for _, m := range machines {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// hostMatch returns a machineMatch of the given machines and the
+// containers they host.
+func hostMatch(ids ...string) *machineMatch {
+	match := newMachineMatch()
+	for _, id := range ids {
+		match.hosts.Add(id)
+	}
+	return match
+}
+
+// exactMatch returns a machineMatch of just the given machines.
+func exactMatch(ids ...string) *machineMatch {
+	match := newMachineMatch()
+	for _, id := range ids {
+		match.exact.Add(id)
+	}
+	return match
+}
+
+func (*selectorSuite) TestFilterMachinesAll(c *gc.C) {
+	result := filterMachines(selectorMachines, nil, newMachineMatch())
+	c.Assert(machineIds(result), gc.DeepEquals, machineIds(selectorMachines))
+}
+
+func (*selectorSuite) TestFilterMachinesIncludesContainers(c *gc.C) {
+	result := filterMachines(selectorMachines, hostMatch("1"), newMachineMatch())
+	c.Assert(machineIds(result), gc.DeepEquals, []string{"1", "1/lxc/0", "1/lxc/0/kvm/0"})
+}
+
+func (*selectorSuite) TestFilterMachinesIncludeContainerOnly(c *gc.C) {
+	result := filterMachines(selectorMachines, hostMatch("0/lxc/0", "2"), newMachineMatch())
+	c.Assert(machineIds(result), gc.DeepEquals, []string{"0/lxc/0", "2"})
+}
+
+func (*selectorSuite) TestFilterMachinesExclude(c *gc.C) {
+	result := filterMachines(selectorMachines, nil, hostMatch("1/lxc/0", "2"))
+	c.Assert(machineIds(result), gc.DeepEquals, []string{"0", "0/lxc/0", "1"})
+}
+
+func (*selectorSuite) TestFilterMachinesIncludeAndExclude(c *gc.C) {
+	result := filterMachines(selectorMachines, hostMatch("0", "1"), hostMatch("0/lxc/0", "1"))
+	c.Assert(machineIds(result), gc.DeepEquals, []string{"0"})
+}
+
+func (*selectorSuite) TestFilterMachinesExact(c *gc.C) {
+	result := filterMachines(selectorMachines, exactMatch("1", "2"), exactMatch("2"))
+	c.Assert(machineIds(result), gc.DeepEquals, []string{"1"})
+	result = filterMachines(selectorMachines, nil, exactMatch("0", "1/lxc/0"))
+	c.Assert(machineIds(result), gc.DeepEquals, []string{"0/lxc/0", "1", "1/lxc/0/kvm/0", "2"})
+}
+
+func (*selectorSuite) TestValidate(c *gc.C) {
+	s := machineSelector{
+		machines: []string{"0", "1/lxc/2"},
+		services: []string{"mysql", "wordpress/0"},
+		exclude:  []string{"3", "haproxy", "mysql/1"},
+	}
+	c.Assert(s.validate(), gc.IsNil)
+
+	s = machineSelector{machines: []string{"mysql"}}
+	c.Assert(s.validate(), gc.ErrorMatches, `machine id "mysql" not valid`)
+
+	s = machineSelector{services: []string{"0"}}
+	c.Assert(s.validate(), gc.ErrorMatches, `service or unit name "0" not valid`)
+}
+
+func (*selectorSuite) TestRemoteArgs(c *gc.C) {
+	s := machineSelector{
+		machines: []string{"0", "1"},
+		exclude:  []string{"mysql"},
+	}
+	c.Assert(s.remoteArgs(), gc.DeepEquals, []string{"--machines", "0,1", "--exclude", "mysql"})
+	c.Assert((&machineSelector{}).remoteArgs(), gc.IsNil)
+}
+
+// selectorStateSuite checks that selectors are resolved against a 1.25
+// environment with mysql on machine 0, wordpress in a container on
+// machine 0, and nothing on machine 1.
+type selectorStateSuite struct {
+	statetesting.StateSuite
+}
+
+var _ = gc.Suite(&selectorStateSuite{})
+
+func (s *selectorStateSuite) SetUpTest(c *gc.C) {
+	s.StateSuite.SetUpTest(c)
+	host := s.Factory.MakeMachine(c, &factory.MachineParams{
+		Addresses: network.NewAddresses("10.0.0.1"),
+	})
+	container := s.Factory.MakeMachineNested(c, host.Id(), nil)
+	err := container.SetProvisioned("juju-machine-0-lxc-0", "nonce", nil)
+	c.Assert(err, jc.ErrorIsNil)
+	err = container.SetProviderAddresses(network.NewAddresses("10.0.3.1")...)
+	c.Assert(err, jc.ErrorIsNil)
+	s.Factory.MakeMachine(c, &factory.MachineParams{
+		Addresses: network.NewAddresses("10.0.0.2"),
+	})
+
+	mysql := s.Factory.MakeService(c, &factory.ServiceParams{
+		Name:  "mysql",
+		Charm: s.Factory.MakeCharm(c, &factory.CharmParams{Name: "mysql"}),
+	})
+	s.Factory.MakeUnit(c, &factory.UnitParams{Service: mysql, Machine: host})
+	wordpress := s.Factory.MakeService(c, &factory.ServiceParams{
+		Name:  "wordpress",
+		Charm: s.Factory.MakeCharm(c, &factory.CharmParams{Name: "wordpress"}),
+	})
+	s.Factory.MakeUnit(c, &factory.UnitParams{Service: wordpress, Machine: container})
+}
+
+func (s *selectorStateSuite) selectIds(c *gc.C, selector machineSelector) []string {
+	machines, err := selector.selectMachines([]*state.State{s.State})
+	c.Assert(err, jc.ErrorIsNil)
+	return machineIds(machines)
+}
+
+func (s *selectorStateSuite) TestSelectAll(c *gc.C) {
+	c.Check(s.selectIds(c, machineSelector{}), jc.SameContents, []string{"0", "0/lxc/0", "1"})
+}
+
+func (s *selectorStateSuite) TestSelectMachineIncludesContainers(c *gc.C) {
+	c.Check(s.selectIds(c, machineSelector{machines: []string{"0"}}), jc.SameContents, []string{"0", "0/lxc/0"})
+}
+
+func (s *selectorStateSuite) TestSelectService(c *gc.C) {
+	// The container on mysql's machine is not selected with it.
+	c.Check(s.selectIds(c, machineSelector{services: []string{"mysql"}}), jc.SameContents, []string{"0"})
+	c.Check(s.selectIds(c, machineSelector{services: []string{"wordpress"}}), jc.SameContents, []string{"0/lxc/0"})
+}
+
+func (s *selectorStateSuite) TestSelectUnit(c *gc.C) {
+	c.Check(s.selectIds(c, machineSelector{services: []string{"wordpress/0"}}), jc.SameContents, []string{"0/lxc/0"})
+}
+
+func (s *selectorStateSuite) TestExcludeService(c *gc.C) {
+	// Excluding mysql leaves the container on its machine selected.
+	c.Check(s.selectIds(c, machineSelector{exclude: []string{"mysql"}}), jc.SameContents, []string{"0/lxc/0", "1"})
+}
+
+func (s *selectorStateSuite) TestExcludeMachineExcludesContainers(c *gc.C) {
+	c.Check(s.selectIds(c, machineSelector{exclude: []string{"0"}}), jc.SameContents, []string{"1"})
+}
+
+func (s *selectorStateSuite) TestSelectUnknown(c *gc.C) {
+	_, err := (&machineSelector{services: []string{"haproxy"}}).selectMachines([]*state.State{s.State})
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+	c.Check(err, gc.ErrorMatches, `machine, service or unit "haproxy" not found`)
+}
+
+func (s *selectorStateSuite) TestSelectNothing(c *gc.C) {
+	_, err := (&machineSelector{machines: []string{"1"}, exclude: []string{"1"}}).selectMachines([]*state.State{s.State})
+	c.Check(err, gc.ErrorMatches, "no machines selected")
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils/shell"
+	names2 "gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/service"
+	"github.com/juju/1.25-upgrade/juju2/service/systemd"
+	"github.com/juju/1.25-upgrade/juju2/service/upstart"
+)
+
+// serviceBackupSuffix is added to the path of each 1.25 service file when
+// it is replaced, so that it can be restored to roll back the upgrade.
+const serviceBackupSuffix = ".1.25"
+
+// serviceFile holds the content of one of the files that defines an
+// agent's service.
+type serviceFile struct {
+	path string
+	data []byte
+	perm os.FileMode
+}
+
+// agentServiceFiles returns the files that define the 2.x service for the
+// agent, in the same way as the 2.x agents would write them.
+func agentServiceFiles(initSystem, agent, dataDir, logDir string) ([]serviceFile, error) {
+	tag, err := names2.ParseTag(agent)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var info service.AgentInfo
+	switch tag := tag.(type) {
+	case names2.MachineTag:
+		info = service.NewMachineAgentInfo(tag.Id(), dataDir, logDir)
+	case names2.UnitTag:
+		info = service.NewUnitAgentInfo(tag.Id(), dataDir, logDir)
+	default:
+		return nil, errors.NotSupportedf("agent %q", agent)
+	}
+
+	renderer := &shell.BashRenderer{}
+	conf := service.AgentConf(info, renderer)
+	if containerType := agentContainerType(tag); containerType != "" {
+		conf = service.ContainerAgentConf(info, renderer, containerType)
+	}
+
+	name := "jujud-" + agent
+	switch initSystem {
+	case service.InitSystemUpstart:
+		data, err := upstart.Serialize(name, conf)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return []serviceFile{{
+			path: filepath.Join(upstart.InitDir, name+".conf"),
+			data: data,
+			perm: 0644,
+		}}, nil
+	case service.InitSystemSystemd:
+		svc, err := systemd.NewService(name, conf, dataDir)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		data, err := svc.UnitFile()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		var files []serviceFile
+		if svc.Script != nil {
+			files = append(files, serviceFile{
+				path: svc.Conf().ExecStart,
+				data: svc.Script,
+				perm: 0755,
+			})
+		}
+		return append(files, serviceFile{
+			path: filepath.Join(svc.Dirname, svc.ConfName),
+			data: data,
+			perm: 0644,
+		}), nil
+	}
+	return nil, errors.NotSupportedf("init system %q", initSystem)
+}
+
+// agentContainerType returns the type of container the machine agent runs
+// in, or "" if it is not in a container.
+func agentContainerType(tag names2.Tag) string {
+	if tag.Kind() != names2.MachineTagKind || !names2.IsContainerMachine(tag.Id()) {
+		return ""
+	}
+	parts := strings.Split(tag.Id(), "/")
+	return parts[len(parts)-2]
+}
+
+// writeServiceFiles atomically replaces each of the files. The first time
+// a file is replaced a copy of it is kept, with serviceBackupSuffix added
+// to its path; the copy is never overwritten, so that it always holds the
+// 1.25 definition.
+func writeServiceFiles(files []serviceFile) error {
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0755); err != nil {
+			return errors.Trace(err)
+		}
+		if err := backupServiceFile(file.path); err != nil {
+			return errors.Annotatef(err, "backing up %s", file.path)
+		}
+		if err := atomicWriteFile(file.path, file.data, file.perm); err != nil {
+			return errors.Annotatef(err, "writing %s", file.path)
+		}
+	}
+	return nil
+}
+
+func backupServiceFile(path string) error {
+	backup := path + serviceBackupSuffix
+	if _, err := os.Stat(backup); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return errors.Trace(err)
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Trace(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return atomicWriteFile(backup, data, info.Mode().Perm())
+}
+
+// atomicWriteFile writes the data to a temporary file alongside path, and
+// then renames it over path.
+func atomicWriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		return errors.Trace(err)
+	}
+	// WriteFile only applies perm to new files.
+	if err := os.Chmod(tmp, perm); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(tmp, path))
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/service"
+)
+
+type serviceFilesSuite struct{}
+
+var _ = gc.Suite(&serviceFilesSuite{})
+
+// The expected content of each of the files is in testdata, named for the
+// init system and the path of the file.
+var agentServiceFilesTests = []struct {
+	initSystem string
+	agent      string
+	files      map[string]string
+}{{
+	initSystem: service.InitSystemUpstart,
+	agent:      "machine-0",
+	files: map[string]string{
+		"/etc/init/jujud-machine-0.conf": "upstart/jujud-machine-0.conf",
+	},
+}, {
+	initSystem: service.InitSystemUpstart,
+	agent:      "unit-mysql-0",
+	files: map[string]string{
+		"/etc/init/jujud-unit-mysql-0.conf": "upstart/jujud-unit-mysql-0.conf",
+	},
+}, {
+	initSystem: service.InitSystemSystemd,
+	agent:      "machine-0-lxc-1",
+	files: map[string]string{
+		"/var/lib/juju/init/jujud-machine-0-lxc-1/jujud-machine-0-lxc-1.service": "systemd/jujud-machine-0-lxc-1/jujud-machine-0-lxc-1.service",
+		"/var/lib/juju/init/jujud-machine-0-lxc-1/exec-start.sh":                 "systemd/jujud-machine-0-lxc-1/exec-start.sh",
+	},
+}, {
+	initSystem: service.InitSystemSystemd,
+	agent:      "unit-mysql-0",
+	files: map[string]string{
+		"/var/lib/juju/init/jujud-unit-mysql-0/jujud-unit-mysql-0.service": "systemd/jujud-unit-mysql-0/jujud-unit-mysql-0.service",
+		"/var/lib/juju/init/jujud-unit-mysql-0/exec-start.sh":              "systemd/jujud-unit-mysql-0/exec-start.sh",
+	},
+}}
+
+func (*serviceFilesSuite) TestAgentServiceFiles(c *gc.C) {
+	for i, test := range agentServiceFilesTests {
+		c.Logf("test %d: %s %s", i, test.initSystem, test.agent)
+		files, err := agentServiceFiles(test.initSystem, test.agent, "/var/lib/juju", "/var/log/juju")
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(files, gc.HasLen, len(test.files))
+		for _, file := range files {
+			golden, ok := test.files[file.path]
+			c.Assert(ok, jc.IsTrue, gc.Commentf("unexpected file %s", file.path))
+			expected, err := ioutil.ReadFile(filepath.Join("testdata", golden))
+			c.Assert(err, jc.ErrorIsNil)
+			c.Check(string(file.data), gc.Equals, string(expected))
+		}
+	}
+}
+
+func (*serviceFilesSuite) TestAgentServiceFilesUnknownInitSystem(c *gc.C) {
+	_, err := agentServiceFiles("windows", "machine-0", "/var/lib/juju", "/var/log/juju")
+	c.Assert(err, gc.ErrorMatches, `init system "windows" not supported`)
+}
+
+func (*serviceFilesSuite) TestWriteServiceFilesKeepsBackup(c *gc.C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "jujud-machine-0.conf")
+	err := ioutil.WriteFile(path, []byte("1.25"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+
+	for _, content := range []string{"2.x", "2.x again"} {
+		err = writeServiceFiles([]serviceFile{{path: path, data: []byte(content), perm: 0755}})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "2.x again")
+	info, err := os.Stat(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0755))
+
+	data, err = ioutil.ReadFile(path + serviceBackupSuffix)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "1.25")
+
+	_, err = os.Stat(path + ".tmp")
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (*serviceFilesSuite) TestWriteServiceFilesNewFile(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "init", "jujud-machine-0", "exec-start.sh")
+	err := writeServiceFiles([]serviceFile{{path: path, data: []byte("script"), perm: 0755}})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = os.Stat(path + serviceBackupSuffix)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+}
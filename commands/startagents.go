@@ -11,10 +11,15 @@ import (
 var startAgentsDoc = ` 
 The purpose of the start-agents command is to start all the agents of a 1.25
 environment. The agents may be running the 1.25 binary, or a 2.x binary.
+
+The --machines, --services and --exclude flags may be used to restrict the
+command to a subset of the machines in the environment. Containers are
+selected or excluded along with their host machine.
 `
 
 func newStartAgentsCommand() cmd.Command {
 	command := &startAgentsCommand{}
+	command.selectable = true
 	command.remoteCommand = "start-agents-impl"
 	return wrap(command)
 }
@@ -51,7 +56,9 @@ ssh to all the machines to start the various agents on those machines.
 `
 
 func newStartAgentsImplCommand() cmd.Command {
-	return &startAgentsImplCommand{}
+	command := &startAgentsImplCommand{}
+	command.selectable = true
+	return command
 }
 
 type startAgentsImplCommand struct {
@@ -67,25 +74,27 @@ func (c *startAgentsImplCommand) Info() *cmd.Info {
 }
 
 func (c *startAgentsImplCommand) Run(ctx *cmd.Context) error {
-	st, err := c.getState(ctx)
+	states, err := c.getStates(ctx)
 	if err != nil {
 		return errors.Annotate(err, "getting state")
 	}
-	defer st.Close()
+	defer closeStates(states)
 
 	// Here we always use the 1.25 environment to get all of the machine
 	// addresses. We then use those to ssh into every one of those machine
 	// and run the service status script against all the agents.
-	machines, err := getMachines(st)
+	machines, err := c.selector.selectMachines(states)
 	if err != nil {
 		return errors.Annotate(err, "unable to get addresses for machines")
 	}
 
-	serviceCommand(ctx, machines, "start")
+	audit := c.startAudit(ctx, states, c.Info().Name)
+
+	serviceCommand(ctx, audit, machines, serviceStartAction)
 
 	// The information is then gathered and parsed and formatted here before
 	// the data is passed back to the caller.
-	serviceStatus(ctx, machines)
+	serviceStatus(ctx, audit, machines)
 
 	return nil
 }
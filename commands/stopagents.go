@@ -6,15 +6,21 @@ package commands
 import (
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/utils/set"
 )
 
 var stopAgentsDoc = ` 
 The purpose of the stop-agents command is to stop all the agents of a 1.25
 environment. The agents may be running the 1.25 binary, or a 2.x binary.
+
+The --machines, --services and --exclude flags may be used to restrict the
+command to a subset of the machines in the environment. Containers are
+selected or excluded along with their host machine.
 `
 
 func newStopAgentsCommand() cmd.Command {
 	command := &stopAgentsCommand{}
+	command.selectable = true
 	command.remoteCommand = "stop-agents-impl"
 	return wrap(command)
 }
@@ -51,7 +57,9 @@ ssh to all the machines to stop the various agents on those machines.
 `
 
 func newStopAgentsImplCommand() cmd.Command {
-	return &stopAgentsImplCommand{}
+	command := &stopAgentsImplCommand{}
+	command.selectable = true
+	return command
 }
 
 type stopAgentsImplCommand struct {
@@ -67,35 +75,52 @@ func (c *stopAgentsImplCommand) Info() *cmd.Info {
 }
 
 func (c *stopAgentsImplCommand) Run(ctx *cmd.Context) error {
-	st, err := c.getState(ctx)
+	states, err := c.getStates(ctx)
 	if err != nil {
 		return errors.Annotate(err, "getting state")
 	}
-	defer st.Close()
+	defer closeStates(states)
 
 	// Here we always use the 1.25 environment to get all of the machine
 	// addresses. We then use those to ssh into every one of those machine
 	// and run the service status script against all the agents.
-	machines, err := getMachines(st)
+	machines, err := c.selector.selectMachines(states)
 	if err != nil {
 		return errors.Annotate(err, "unable to get addresses for machines")
 	}
 
-	serviceCommand(ctx, machines, "stop")
+	audit := c.startAudit(ctx, states, c.Info().Name)
+
+	serviceCommand(ctx, audit, machines, serviceStopAction)
 
 	// The information is then gathered and parsed and formatted here before
 	// the data is passed back to the caller.
-	serviceStatus(ctx, machines)
+	serviceStatus(ctx, audit, machines)
 
 	return nil
 }
 
-func serviceCommand(ctx *cmd.Context, machines []FlatMachine, verb string) {
-	results := serviceCall(machines, verb)
+// serviceCommand takes the action on the agent services of the machines,
+// and returns the status of each service the action failed on.
+func serviceCommand(ctx *cmd.Context, audit *auditor, machines []FlatMachine, action string) []statusResult {
+	results := serviceCall(ctx, audit, machines, action)
 
-	for _, r := range results {
-		if r.Code != 0 {
-			logger.Warningf("machine: %s rc: %d\nstdout:%s\nstderr:%s", r.MachineID, r.Code, r.Stdout, r.Stderr)
+	var failed []statusResult
+	for _, r := range parseStatus(results) {
+		if r.err != "" {
+			logger.Warningf("machine: %s agent: %s %s: %s", r.machine, r.agent, action, r.err)
+			failed = append(failed, r)
 		}
 	}
+	return failed
+}
+
+// failedMachines returns the sorted ids of the machines with a failed
+// agent service.
+func failedMachines(failed []statusResult) []string {
+	machines := set.NewStrings()
+	for _, r := range failed {
+		machines.Add(r.machine)
+	}
+	return machines.SortedValues()
 }
@@ -0,0 +1,11 @@
+#!/usr/bin/env bash
+
+# Set up logging.
+touch '/var/log/juju/machine-0-lxc-1.log'
+chown syslog:syslog '/var/log/juju/machine-0-lxc-1.log'
+chmod 0600 '/var/log/juju/machine-0-lxc-1.log'
+exec >> '/var/log/juju/machine-0-lxc-1.log'
+exec 2>&1
+
+# Run the script.
+'/var/lib/juju/tools/machine-0-lxc-1/jujud' machine --data-dir '/var/lib/juju' --machine-id 0/lxc/1 --debug
\ No newline at end of file
@@ -0,0 +1,11 @@
+#!/usr/bin/env bash
+
+# Set up logging.
+touch '/var/log/juju/unit-mysql-0.log'
+chown syslog:syslog '/var/log/juju/unit-mysql-0.log'
+chmod 0600 '/var/log/juju/unit-mysql-0.log'
+exec >> '/var/log/juju/unit-mysql-0.log'
+exec 2>&1
+
+# Run the script.
+'/var/lib/juju/tools/unit-mysql-0/jujud' unit --data-dir '/var/lib/juju' --unit-name mysql/0 --debug
\ No newline at end of file
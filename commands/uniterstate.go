@@ -0,0 +1,397 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"github.com/juju/utils"
+	"gopkg.in/juju/charm.v5/hooks"
+	charm2 "gopkg.in/juju/charm.v6-unstable"
+	hooks2 "gopkg.in/juju/charm.v6-unstable/hooks"
+
+	"github.com/juju/1.25-upgrade/juju1/worker/uniter/operation"
+	hook2 "github.com/juju/1.25-upgrade/juju2/worker/uniter/hook"
+	operation2 "github.com/juju/1.25-upgrade/juju2/worker/uniter/operation"
+)
+
+var convertUniterStateDoc = `
+The purpose of the convert-uniter-state command is to convert the state
+the unit agents of a 1.25 environment keep on disk into the format used by
+the 2.x unit agents. It should be run once the agents have been stopped,
+before they are started with the 2.x binaries.
+
+Before a unit's state is converted, a copy of its state directory is kept
+in state-1.25 in the unit's agent directory; copying it back over the
+state directory restores the 1.25 state. Units that have already been
+converted are left alone, so the command may be run again if it fails part
+way through. Units whose agents are running, or that stopped part way
+through running a hook, action or charm operation, are not converted;
+resolve them with the 1.25 agents and run the command again.
+
+Only the uniter state file needs converting. The relation state
+directories and the manifest-based charm deployer state are read and
+written by the same code in 2.x as in 1.25, so they are left as they are.
+Units whose charm is still deployed with the git-based deployer used
+before 1.19, which 2.x cannot read, are not converted. The 1.25 agent
+replaces that deployer when it starts, unless a charm upgrade is in
+conflict; resolve the conflict with the 1.25 agent and run the command
+again.
+
+The --machines, --services and --exclude flags may be used to restrict the
+command to a subset of the machines in the environment. Containers are
+selected or excluded along with their host machine.
+`
+
+func newConvertUniterStateCommand() cmd.Command {
+	command := &convertUniterStateCommand{}
+	command.selectable = true
+	command.remoteCommand = "convert-uniter-state-impl"
+	return wrap(command)
+}
+
+type convertUniterStateCommand struct {
+	baseClientCommand
+}
+
+func (c *convertUniterStateCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "convert-uniter-state",
+		Args:    "<environment name>",
+		Purpose: "convert the unit agent state for the specified environment to 2.x",
+		Doc:     convertUniterStateDoc,
+	}
+}
+
+func (c *convertUniterStateCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+var convertUniterStateImplDoc = `
+
+convert-uniter-state-impl must be executed on an API server machine of a
+1.25 environment.
+
+The command will get a list of all the machines, and their addresses, and
+then ssh to all the machines to read the state of the unit agents. The
+state is converted here, and written back to the machines.
+
+`
+
+func newConvertUniterStateImplCommand() cmd.Command {
+	command := &convertUniterStateImplCommand{}
+	command.selectable = true
+	return command
+}
+
+type convertUniterStateImplCommand struct {
+	baseRemoteCommand
+}
+
+func (c *convertUniterStateImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "convert-uniter-state-impl",
+		Purpose: "controller aspect of convert-uniter-state",
+		Doc:     convertUniterStateImplDoc,
+	}
+}
+
+func (c *convertUniterStateImplCommand) Run(ctx *cmd.Context) error {
+	states, err := c.getStates(ctx)
+	if err != nil {
+		return errors.Annotate(err, "getting state")
+	}
+	defer closeStates(states)
+
+	machines, err := c.selector.selectMachines(states)
+	if err != nil {
+		return errors.Annotate(err, "unable to get addresses for machines")
+	}
+
+	audit := c.startAudit(ctx, states, c.Info().Name)
+
+	readOperation := "read uniter state"
+	progress := newProgressWriter(ctx.Stderr, readOperation)
+	readResults := parallelCall(audit, progress, readOperation, machines, readUniterStateScript)
+
+	// Convert the state of each unit here, and work out what needs
+	// to be written back to each machine.
+	var report []string
+	var failed bool
+	converted := make(map[string][]unitStateFile)
+	for _, r := range readResults {
+		key := r.Model + "/" + r.MachineID
+		if r.Error != nil || r.Code != 0 {
+			logger.Warningf("machine: %s rc: %d\nstdout:%s\nstderr:%s", r.MachineID, r.Code, r.Stdout, r.Stderr)
+			report = append(report, fmt.Sprintf("machine %s: cannot read unit state", r.MachineID))
+			failed = true
+			continue
+		}
+		units, err := parseUnitStates(r.Stdout)
+		if err != nil {
+			report = append(report, fmt.Sprintf("machine %s: %v", r.MachineID, err))
+			failed = true
+			continue
+		}
+		for _, unit := range units {
+			message, file, err := unit.convert()
+			if err != nil {
+				message = err.Error()
+				failed = true
+			}
+			if file != nil {
+				converted[key] = append(converted[key], *file)
+			}
+			report = append(report, fmt.Sprintf("machine %s: %s %s", r.MachineID, unit.tag, message))
+		}
+	}
+
+	var toWrite []FlatMachine
+	for _, machine := range machines {
+		if len(converted[machine.Model+"/"+machine.ID]) > 0 {
+			toWrite = append(toWrite, machine)
+		}
+	}
+	if len(toWrite) > 0 {
+		writeOperation := "write uniter state"
+		progress = newProgressWriter(ctx.Stderr, writeOperation)
+		writeResults := parallelCallEach(audit, progress, writeOperation, toWrite, func(machine FlatMachine) string {
+			return writeUniterStateScript(converted[machine.Model+"/"+machine.ID])
+		})
+		for _, r := range writeResults {
+			if r.Error != nil || r.Code != 0 {
+				logger.Warningf("machine: %s rc: %d\nstdout:%s\nstderr:%s", r.MachineID, r.Code, r.Stdout, r.Stderr)
+				report = append(report, fmt.Sprintf("machine %s: cannot write unit state", r.MachineID))
+				failed = true
+			}
+		}
+	}
+
+	sort.Strings(report)
+	for _, line := range report {
+		fmt.Fprintln(ctx.Stdout, line)
+	}
+	if failed {
+		return errors.New("some units were not converted")
+	}
+	return nil
+}
+
+// The states a unit's uniter state may be found in by
+// readUniterStateScript.
+const (
+	unitStateFound     = "found"
+	unitStateNone      = "none"
+	unitStateConverted = "converted"
+	unitStateRunning   = "running"
+	unitStateGitCharm  = "git-deployer"
+)
+
+// readUniterStateScript writes a line for each unit agent on the machine,
+// holding the unit's tag, its state, and for units to be converted, the
+// base64 encoded 1.25 uniter state file. If a backup of the state has been
+// taken, the file is read from there, so that a conversion that failed
+// part way through starts again from the 1.25 state.
+const readUniterStateScript = `
+for dir in /var/lib/juju/agents/unit-*; do
+    [ -d "$dir" ] || continue
+    tag=$(basename "$dir")
+    name="${tag#unit-}"
+    name="${name%-*}/${name##*-}"
+    if [ -e "$dir/state-1.25/converted" ]; then
+        echo "$tag converted"
+    elif pgrep -f "jujud unit .*--unit-name $name( |$)" > /dev/null; then
+        echo "$tag running"
+    elif [ -e "$dir/state/deployer/current" ]; then
+        echo "$tag git-deployer"
+    elif [ -f "$dir/state-1.25/uniter" ]; then
+        echo "$tag found $(base64 -w 0 "$dir/state-1.25/uniter")"
+    elif [ -f "$dir/state/uniter" ]; then
+        echo "$tag found $(base64 -w 0 "$dir/state/uniter")"
+    else
+        echo "$tag none"
+    fi
+done
+`
+
+// unitState holds what readUniterStateScript found for a unit agent.
+type unitState struct {
+	tag    string
+	state  string
+	uniter []byte
+}
+
+// unitStateFile holds the converted uniter state file for a unit agent.
+type unitStateFile struct {
+	tag    string
+	uniter []byte
+}
+
+// parseUnitStates parses the output of readUniterStateScript.
+func parseUnitStates(output string) ([]unitState, error) {
+	var units []unitState
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, errors.Errorf("unexpected output %q", line)
+		}
+		unit := unitState{tag: fields[0], state: fields[1]}
+		if unit.state == unitStateFound {
+			if len(fields) != 3 {
+				return nil, errors.Errorf("missing uniter state for %s", unit.tag)
+			}
+			data, err := base64.StdEncoding.DecodeString(fields[2])
+			if err != nil {
+				return nil, errors.Annotatef(err, "decoding uniter state for %s", unit.tag)
+			}
+			unit.uniter = data
+		}
+		units = append(units, unit)
+	}
+	return units, nil
+}
+
+// convert returns a message describing what is to be done with the unit,
+// and the converted state file to write if there is one.
+func (u unitState) convert() (string, *unitStateFile, error) {
+	switch u.state {
+	case unitStateConverted:
+		return "already converted", nil, nil
+	case unitStateNone:
+		return "has no uniter state", nil, nil
+	case unitStateRunning:
+		return "", nil, errors.New("agent is running, stop it first")
+	case unitStateGitCharm:
+		return "", nil, errors.New("charm is deployed with the git deployer, resolve the charm upgrade conflict with the 1.25 agent first")
+	case unitStateFound:
+		data, err := convertUniterStateFile(u.uniter)
+		if err != nil {
+			return "", nil, errors.Trace(err)
+		}
+		return "converted", &unitStateFile{tag: u.tag, uniter: data}, nil
+	}
+	return "", nil, errors.Errorf("unexpected state %q", u.state)
+}
+
+// writeUniterStateScript returns a script that backs up the state
+// directory of each of the units, if that hasn't already been done, and
+// then atomically replaces the uniter state file with the converted one.
+func writeUniterStateScript(files []unitStateFile) string {
+	var script bytes.Buffer
+	script.WriteString("set -e\n")
+	for _, file := range files {
+		fmt.Fprintf(&script, `
+dir=/var/lib/juju/agents/%s
+if [ ! -d "$dir/state-1.25" ]; then
+    rm -rf "$dir/state-1.25.tmp"
+    cp -a "$dir/state" "$dir/state-1.25.tmp"
+    mv "$dir/state-1.25.tmp" "$dir/state-1.25"
+fi
+echo %s | base64 -d > "$dir/state/uniter.tmp"
+mv "$dir/state/uniter.tmp" "$dir/state/uniter"
+touch "$dir/state-1.25/converted"
+`, file.tag, utils.ShQuote(base64.StdEncoding.EncodeToString(file.uniter)))
+	}
+	return script.String()
+}
+
+// convertUniterStateFile converts the content of a 1.25 uniter state file
+// into the content of the 2.x file. The state is read and written with
+// the uniter's own StateFile types so that it is validated on both sides.
+func convertUniterStateFile(data []byte) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "uniter-state")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "uniter")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return nil, errors.Trace(err)
+	}
+	st, err := operation.NewStateFile(path).Read()
+	if err != nil {
+		return nil, errors.Annotate(err, "reading 1.25 uniter state")
+	}
+	st2, err := convertUniterState(st)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := operation2.NewStateFile(path).Write(st2); err != nil {
+		return nil, errors.Annotate(err, "writing 2.x uniter state")
+	}
+	return ioutil.ReadFile(path)
+}
+
+// convertUniterState converts a 1.25 uniter state into the 2.x state. It
+// refuses to convert a unit that was part way through an operation, as the
+// 2.x uniter may not be able to carry it on.
+//
+// The times the metrics and update-status hooks last ran are not kept in
+// the 2.x state; those hooks will be run again soon after the agent starts.
+func convertUniterState(st *operation.State) (*operation2.State, error) {
+	if st.Step == operation.Pending && st.Kind != operation.Continue {
+		what := string(st.Kind)
+		if st.Hook != nil {
+			what = fmt.Sprintf("%s %q", what, st.Hook.Kind)
+		}
+		return nil, errors.Errorf("unit stopped part way through %s, resolve it before converting", what)
+	}
+	st2 := &operation2.State{
+		Leader:    st.Leader,
+		Started:   st.Started,
+		Stopped:   st.Stopped,
+		Installed: uniterInstalled(st),
+		StatusSet: st.StatusSet,
+		Kind:      operation2.Kind(st.Kind),
+		Step:      operation2.Step(st.Step),
+		ActionId:  st.ActionId,
+	}
+	if st.Hook != nil {
+		st2.Hook = &hook2.Info{
+			Kind:          hooks2.Kind(st.Hook.Kind),
+			RelationId:    st.Hook.RelationId,
+			RemoteUnit:    st.Hook.RemoteUnit,
+			ChangeVersion: st.Hook.ChangeVersion,
+			StorageId:     st.Hook.StorageId,
+		}
+	}
+	if st.CharmURL != nil {
+		curl, err := charm2.ParseURL(st.CharmURL.String())
+		if err != nil {
+			return nil, errors.Annotate(err, "converting charm URL")
+		}
+		st2.CharmURL = curl
+	}
+	return st2, nil
+}
+
+// uniterInstalled returns whether the install hook has run. The 1.25 state
+// doesn't record this, but the uniter only moves on from the install hook
+// once it has completed.
+func uniterInstalled(st *operation.State) bool {
+	switch st.Kind {
+	case operation.Install:
+		return false
+	case operation.RunHook:
+		return st.Hook.Kind != hooks.Install || st.Step == operation.Done
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"encoding/base64"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5"
+	"gopkg.in/juju/charm.v5/hooks"
+	goyaml "gopkg.in/yaml.v2"
+
+	"github.com/juju/1.25-upgrade/juju1/worker/uniter/hook"
+	"github.com/juju/1.25-upgrade/juju1/worker/uniter/operation"
+	"github.com/juju/1.25-upgrade/juju1/worker/uniter/relation"
+	operation2 "github.com/juju/1.25-upgrade/juju2/worker/uniter/operation"
+	relation2 "github.com/juju/1.25-upgrade/juju2/worker/uniter/relation"
+)
+
+type uniterStateSuite struct{}
+
+var _ = gc.Suite(&uniterStateSuite{})
+
+func (*uniterStateSuite) TestConvertContinue(c *gc.C) {
+	actionId := "666"
+	st2, err := convertUniterState(&operation.State{
+		Leader:           true,
+		Started:          true,
+		StatusSet:        true,
+		Kind:             operation.Continue,
+		Step:             operation.Pending,
+		ActionId:         &actionId,
+		UpdateStatusTime: 1234,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(st2, jc.DeepEquals, &operation2.State{
+		Leader:    true,
+		Started:   true,
+		Installed: true,
+		StatusSet: true,
+		Kind:      operation2.Continue,
+		Step:      operation2.Pending,
+		ActionId:  &actionId,
+	})
+}
+
+func (*uniterStateSuite) TestConvertRelationHook(c *gc.C) {
+	st2, err := convertUniterState(&operation.State{
+		Started: true,
+		Kind:    operation.RunHook,
+		Step:    operation.Queued,
+		Hook: &hook.Info{
+			Kind:          hooks.RelationChanged,
+			RelationId:    1,
+			RemoteUnit:    "mysql/0",
+			ChangeVersion: 3,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(st2.Installed, jc.IsTrue)
+	c.Assert(string(st2.Hook.Kind), gc.Equals, "relation-changed")
+	c.Assert(st2.Hook.RelationId, gc.Equals, 1)
+	c.Assert(st2.Hook.RemoteUnit, gc.Equals, "mysql/0")
+	c.Assert(st2.Hook.ChangeVersion, gc.Equals, int64(3))
+}
+
+func (*uniterStateSuite) TestConvertInstall(c *gc.C) {
+	st2, err := convertUniterState(&operation.State{
+		Kind:     operation.Install,
+		Step:     operation.Done,
+		CharmURL: charm.MustParseURL("cs:trusty/wordpress-1"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(st2.Installed, jc.IsFalse)
+	c.Assert(st2.CharmURL.String(), gc.Equals, "cs:trusty/wordpress-1")
+
+	st2, err = convertUniterState(&operation.State{
+		Kind: operation.RunHook,
+		Step: operation.Queued,
+		Hook: &hook.Info{Kind: hooks.Install},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(st2.Installed, jc.IsFalse)
+}
+
+func (*uniterStateSuite) TestConvertRefusesPending(c *gc.C) {
+	_, err := convertUniterState(&operation.State{
+		Started: true,
+		Kind:    operation.RunHook,
+		Step:    operation.Pending,
+		Hook:    &hook.Info{Kind: hooks.ConfigChanged},
+	})
+	c.Assert(err, gc.ErrorMatches, `unit stopped part way through run-hook "config-changed", resolve it before converting`)
+}
+
+func (*uniterStateSuite) TestConvertFile(c *gc.C) {
+	data, err := goyaml.Marshal(&operation.State{
+		Started:         true,
+		Kind:            operation.Continue,
+		Step:            operation.Done,
+		SendMetricsTime: 1234,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	converted, err := convertUniterStateFile(data)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var st2 operation2.State
+	err = goyaml.Unmarshal(converted, &st2)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(st2, jc.DeepEquals, operation2.State{
+		Started:   true,
+		Installed: true,
+		Kind:      operation2.Continue,
+		Step:      operation2.Done,
+	})
+}
+
+func (*uniterStateSuite) TestParseUnitStates(c *gc.C) {
+	output := "unit-mysql-0 found " + base64.StdEncoding.EncodeToString([]byte("op: continue\n")) + "\n" +
+		"unit-wordpress-0 running\n" +
+		"unit-nrpe-1 converted\n"
+	units, err := parseUnitStates(output)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(units, jc.DeepEquals, []unitState{
+		{tag: "unit-mysql-0", state: unitStateFound, uniter: []byte("op: continue\n")},
+		{tag: "unit-wordpress-0", state: unitStateRunning},
+		{tag: "unit-nrpe-1", state: unitStateConverted},
+	})
+
+	_, err = parseUnitStates("unit-mysql-0 found\n")
+	c.Assert(err, gc.ErrorMatches, "missing uniter state for unit-mysql-0")
+}
+
+func (*uniterStateSuite) TestRelationStateUnchanged(c *gc.C) {
+	// Relation state is left as it is, so check that what the 1.25
+	// uniter writes is read back the same by the 2.x uniter.
+	dir := c.MkDir()
+	d, err := relation.ReadStateDir(dir, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(d.Ensure(), jc.ErrorIsNil)
+	for _, hi := range []hook.Info{
+		{Kind: hooks.RelationJoined, RelationId: 1, RemoteUnit: "mysql/0", ChangeVersion: 3},
+		{Kind: hooks.RelationChanged, RelationId: 1, RemoteUnit: "mysql/0", ChangeVersion: 4},
+		{Kind: hooks.RelationJoined, RelationId: 1, RemoteUnit: "mysql/1", ChangeVersion: 7},
+	} {
+		c.Assert(d.Write(hi), jc.ErrorIsNil)
+	}
+
+	d2, err := relation2.ReadStateDir(dir, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(d2.State(), jc.DeepEquals, &relation2.State{
+		RelationId:     1,
+		Members:        map[string]int64{"mysql/0": 4, "mysql/1": 7},
+		ChangedPending: "mysql/1",
+	})
+}
+
+func (*uniterStateSuite) TestConvertRefusesGitDeployer(c *gc.C) {
+	units, err := parseUnitStates("unit-mysql-0 git-deployer\n")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(units, jc.DeepEquals, []unitState{{tag: "unit-mysql-0", state: unitStateGitCharm}})
+	_, file, err := units[0].convert()
+	c.Assert(err, gc.ErrorMatches, "charm is deployed with the git deployer, .*")
+	c.Assert(file, gc.IsNil)
+}
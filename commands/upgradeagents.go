@@ -33,12 +33,23 @@ This command updates the tools symlinks for the agents, and updates their
 agent config files to specify the correct version, along with the CA Cert and
 addersses of the controller.
 
+The upstart or systemd service definitions for the agents are rewritten for
+the 2.x agents. The agents must be stopped first. The 1.25 definitions are
+kept alongside, with a .1.25 suffix, so that they may be restored. The
+command fails, listing the machines affected, if any of the definitions
+cannot be rewritten.
+
+The --machines, --services and --exclude flags may be used to restrict the
+command to a subset of the machines in the environment. Containers are
+selected or excluded along with their host machine.
+
 `
 
 func newUpgradeAgentsCommand() cmd.Command {
 	return wrap(&upgradeAgentsCommand{
 		baseClientCommand{
 			needsController: true,
+			selectable:      true,
 			remoteCommand:   "upgrade-agents-impl",
 		},
 	})
@@ -77,7 +88,10 @@ ssh to all the machines to upgrade the various agents on those machines.
 
 func newUpgradeAgentsImplCommand() cmd.Command {
 	return &upgradeAgentsImplCommand{
-		baseRemoteCommand{needsController: true},
+		baseRemoteCommand{
+			needsController: true,
+			selectable:      true,
+		},
 	}
 }
 
@@ -103,16 +117,18 @@ func (c *upgradeAgentsImplCommand) Info() *cmd.Info {
 }
 
 func (c *upgradeAgentsImplCommand) Run(ctx *cmd.Context) error {
-	st, err := c.getState(ctx)
+	states, err := c.getStates(ctx)
 	if err != nil {
 		return errors.Annotate(err, "getting state")
 	}
-	defer st.Close()
+	defer closeStates(states)
+
+	audit := c.startAudit(ctx, states, c.Info().Name)
 
 	// Here we always use the 1.25 environment to get all of the machine
 	// addresses. We then use those to ssh into every one of those machine
 	// and run the service status script against all the agents.
-	machines, err := getMachines(st)
+	machines, err := c.selector.selectMachines(states)
 	if err != nil {
 		return errors.Annotate(err, "unable to get addresses for machines")
 	}
@@ -151,6 +167,19 @@ func (c *upgradeAgentsImplCommand) Run(ctx *cmd.Context) error {
 		}
 	}
 
+	// Replace the 1.25 service definitions with the ones the 2.x agents
+	// expect. The 1.25 definitions are kept alongside them.
+	if failed := serviceCommand(ctx, audit, machines, serviceRewriteAction); len(failed) > 0 {
+		for _, r := range failed {
+			if r.agent == "" {
+				fmt.Fprintf(ctx.Stdout, "machine %s: %s\n", r.machine, r.err)
+			} else {
+				fmt.Fprintf(ctx.Stdout, "machine %s: %s: %s\n", r.machine, r.agent, r.err)
+			}
+		}
+		return errors.Errorf("rewriting agent services failed on machines %s", strings.Join(failedMachines(failed), ", "))
+	}
+
 	//
 
 	return errors.Errorf("this command not yet finished")
@@ -4,6 +4,8 @@
 package commands
 
 import (
+	"io"
+
 	"github.com/juju/cmd"
 	"github.com/juju/description"
 	"github.com/juju/errors"
@@ -13,10 +15,21 @@ var verifySourceDoc = `
 The purpose of the verify-source command is to check connectivity, status, and
 viability of a 1.25 juju environment for migration into a Juju 2.x controller.
 
+Storage pools are translated for the 2.x storage providers. Any pool, volume,
+filesystem or storage constraint that cannot be used in 2.x is reported, and
+must be dealt with in the environment before it is migrated.
+
+The --model-name, --owner, --cloud, --region and --credential flags change the
+name, owner, cloud and cloud credential the environment is exported with, for
+when the model must be named or owned differently on the controller. The
+--credential flag names a credential the owner already has on the controller;
+the environment's own cloud secrets are then not exported.
+
 `
 
 func newVerifySourceCommand() cmd.Command {
 	command := &verifySourceCommand{}
+	command.overridable = true
 	command.remoteCommand = "verify-source-impl"
 	return wrap(command)
 }
@@ -48,12 +61,15 @@ verify-source-impl must be executed on an API server machine of a 1.25
 environment.
 
 The command will check the export of the environment into the 2.0 model
-format.
+format. If more than one environment is selected, each is written as a
+separate YAML document.
 
 `
 
 func newVerifySourceImplCommand() cmd.Command {
-	return &verifySourceImplCommand{}
+	command := &verifySourceImplCommand{}
+	command.overridable = true
+	return command
 }
 
 type verifySourceImplCommand struct {
@@ -69,26 +85,50 @@ func (c *verifySourceImplCommand) Info() *cmd.Info {
 }
 
 func (c *verifySourceImplCommand) Run(ctx *cmd.Context) error {
-	st, err := c.getState(ctx)
+	states, err := c.getStates(ctx)
 	if err != nil {
 		return errors.Annotate(err, "getting state")
 	}
-	defer st.Close()
+	defer closeStates(states)
 
-	model, err := st.Export()
-	if err != nil {
-		return errors.Annotate(err, "exporting model representation")
+	if c.overrides.modelName != "" && len(states) > 1 {
+		return errors.New("--model-name cannot be used with more than one environment")
 	}
-
-	// Check for LXC containers
-	bytes, err := description.Serialize(model)
-	if err != nil {
-		return errors.Annotate(err, "serializing model representation")
+	audit := c.startAudit(ctx, states, c.Info().Name)
+	if args := c.overrides.remoteArgs(); len(args) > 0 {
+		audit.record("export overrides", map[string]interface{}{"overrides": args})
 	}
 
-	_, err = ctx.GetStdout().Write(bytes)
-	if err != nil {
-		return errors.Annotate(err, "writing model representation")
+	// Each environment is written as a separate YAML document.
+	for i, st := range states {
+		model, err := st.ExportWithOverrides(c.overrides.stateOverrides())
+		if err != nil {
+			return errors.Annotatef(err, "exporting model representation for %s", st.EnvironUUID())
+		}
+
+		// The summary is compared with the migrated model by
+		// verify-target.
+		if err := saveSourceSummary(sourceSummaryDir, st.EnvironUUID(), summariseSourceModel(model)); err != nil {
+			return errors.Annotatef(err, "saving summary of %s", st.EnvironUUID())
+		}
+
+		// Check for LXC containers
+		bytes, err := description.Serialize(model)
+		if err != nil {
+			return errors.Annotate(err, "serializing model representation")
+		}
+
+		// The separator is written on its own rather than prepended,
+		// which would copy what may be a very large document.
+		if i > 0 {
+			if _, err := io.WriteString(ctx.GetStdout(), yamlDocumentSeparator); err != nil {
+				return errors.Annotate(err, "writing model representation")
+			}
+		}
+		_, err = ctx.GetStdout().Write(bytes)
+		if err != nil {
+			return errors.Annotate(err, "writing model representation")
+		}
 	}
 
 	return nil
@@ -0,0 +1,394 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/juju/cmd"
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/utils"
+
+	"github.com/juju/1.25-upgrade/juju2/api"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/status"
+)
+
+const (
+	defaultVerifyTargetTimeout = 10 * time.Minute
+	verifyTargetPollInterval   = 10 * time.Second
+)
+
+// sourceSummaryDir holds the summaries of the environments saved when
+// they are exported for migration, which verify-target compares the
+// migrated models with.
+const sourceSummaryDir = upgraderDir + "/summaries"
+
+var verifyTargetDoc = `
+The purpose of the verify-target command is to check that an environment has
+been successfully moved to a Juju 2.x controller, after the agents have been
+upgraded and started.
+
+The command waits until every machine and unit agent in the imported model has
+connected to the controller, and the workload status of every unit and the
+number of relations match those of the 1.25 environment. If they do not match
+within the timeout, the differences are reported and the command fails.
+
+The model is compared with the environment as it was when it was last
+exported by verify-source (which precheck-target also runs) or export-archive,
+before its agents were stopped and upgraded.
+
+`
+
+func newVerifyTargetCommand() cmd.Command {
+	return wrap(&verifyTargetCommand{
+		baseClientCommand: baseClientCommand{
+			needsController: true,
+			remoteCommand:   "verify-target-impl",
+		},
+	})
+}
+
+type verifyTargetCommand struct {
+	baseClientCommand
+
+	timeout time.Duration
+}
+
+func (c *verifyTargetCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "verify-target",
+		Args:    "<environment name> <controller name>",
+		Purpose: "check that the migrated model is healthy on the controller",
+		Doc:     verifyTargetDoc,
+	}
+}
+
+func (c *verifyTargetCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseClientCommand.SetFlags(f)
+	f.DurationVar(&c.timeout, "timeout", defaultVerifyTargetTimeout, "How long to wait for the model to match the environment")
+}
+
+func (c *verifyTargetCommand) Init(args []string) error {
+	args, err := c.baseClientCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.remoteFlags = append(c.remoteFlags, "--timeout", c.timeout.String())
+	return cmd.CheckEmpty(args)
+}
+
+var verifyTargetImplDoc = `
+
+verify-target-impl must be executed on an API server machine of a 1.25
+environment.
+
+The command will compare the summary of the 1.25 environment saved when it
+was exported with the status of the imported model on the controller.
+
+`
+
+func newVerifyTargetImplCommand() cmd.Command {
+	return &verifyTargetImplCommand{
+		baseRemoteCommand: baseRemoteCommand{needsController: true},
+	}
+}
+
+type verifyTargetImplCommand struct {
+	baseRemoteCommand
+
+	timeout time.Duration
+}
+
+func (c *verifyTargetImplCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "verify-target-impl",
+		Purpose: "controller aspect of verify-target",
+		Doc:     verifyTargetImplDoc,
+	}
+}
+
+func (c *verifyTargetImplCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.baseRemoteCommand.SetFlags(f)
+	f.DurationVar(&c.timeout, "timeout", defaultVerifyTargetTimeout, "")
+}
+
+func (c *verifyTargetImplCommand) Init(args []string) error {
+	args, err := c.baseRemoteCommand.init(args)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *verifyTargetImplCommand) Run(ctx *cmd.Context) error {
+	states, err := c.getStates(ctx)
+	if err != nil {
+		return errors.Annotate(err, "getting state")
+	}
+	defer closeStates(states)
+
+	c.startAudit(ctx, states, c.Info().Name)
+
+	// Each environment is imported as a separate model, which keeps
+	// the UUID of the environment.
+	var targets []*verifyTarget
+	defer func() {
+		for _, target := range targets {
+			target.conn.Close()
+		}
+	}()
+	for _, st := range states {
+		source, err := loadSourceSummary(sourceSummaryDir, st.EnvironUUID())
+		if errors.IsNotFound(err) {
+			return errors.Errorf("environment %s was not exported before migrating: run verify-source or export-archive before stopping the agents", st.EnvironUUID())
+		} else if err != nil {
+			return errors.Trace(err)
+		}
+		conn, err := c.getModelConnection(st.EnvironUUID())
+		if err != nil {
+			return errors.Annotatef(err, "connecting to target model %s", st.EnvironUUID())
+		}
+		targets = append(targets, &verifyTarget{
+			uuid:   st.EnvironUUID(),
+			source: source,
+			conn:   conn,
+			client: conn.Client(),
+		})
+	}
+
+	timeout := time.After(c.timeout)
+	for {
+		healthy := true
+		for _, target := range targets {
+			fullStatus, err := target.client.Status(nil)
+			if err != nil {
+				return errors.Annotatef(err, "getting target model status for %s", target.uuid)
+			}
+			target.problems = compareModels(target.source, summariseTargetStatus(fullStatus))
+			if len(target.problems) > 0 {
+				logger.Debugf("waiting for target model %s, %d problems", target.uuid, len(target.problems))
+				healthy = false
+			}
+		}
+		if healthy {
+			for _, target := range targets {
+				fmt.Fprintf(ctx.Stdout, "Model %s: all %d machines and %d units connected, model matches environment\n",
+					target.uuid, len(target.source.machines), len(target.source.units))
+			}
+			return nil
+		}
+
+		select {
+		case <-timeout:
+			for _, target := range targets {
+				if len(target.problems) == 0 {
+					continue
+				}
+				fmt.Fprintf(ctx.Stdout, "Model %s does not match environment:\n", target.uuid)
+				for _, problem := range target.problems {
+					fmt.Fprintf(ctx.Stdout, "  %s\n", problem)
+				}
+			}
+			return errors.Errorf("target models not healthy after %v", c.timeout)
+		case <-time.After(verifyTargetPollInterval):
+		}
+	}
+}
+
+// verifyTarget holds what verify-target knows about one of the migrated
+// models.
+type verifyTarget struct {
+	uuid     string
+	source   modelSummary
+	conn     api.Connection
+	client   *api.Client
+	problems []string
+}
+
+// modelSummary holds the parts of a model compared by verify-target.
+type modelSummary struct {
+	// machines maps machine ids to the machine agent status.
+	machines map[string]string
+	// units maps unit names to the unit agent status.
+	units map[string]string
+	// workloads maps unit names to the unit workload status.
+	workloads map[string]string
+	relations int
+}
+
+func newModelSummary() modelSummary {
+	return modelSummary{
+		machines:  make(map[string]string),
+		units:     make(map[string]string),
+		workloads: make(map[string]string),
+	}
+}
+
+// summariseSourceModel returns the summary of the exported 1.25
+// environment. Agent statuses are not recorded, as the agents are
+// expected to have been stopped.
+func summariseSourceModel(model description.Model) modelSummary {
+	summary := newModelSummary()
+	var addMachines func([]description.Machine)
+	addMachines = func(machines []description.Machine) {
+		for _, m := range machines {
+			summary.machines[m.Id()] = ""
+			addMachines(m.Containers())
+		}
+	}
+	addMachines(model.Machines())
+	for _, app := range model.Applications() {
+		for _, unit := range app.Units() {
+			summary.units[unit.Name()] = ""
+			if workload := unit.WorkloadStatus(); workload != nil {
+				summary.workloads[unit.Name()] = workload.Value()
+			}
+		}
+	}
+	summary.relations = len(model.Relations())
+	return summary
+}
+
+// savedSummary is the form in which the summary of an exported
+// environment is saved.
+type savedSummary struct {
+	Machines  []string          `json:"machines"`
+	Units     []string          `json:"units"`
+	Workloads map[string]string `json:"workloads"`
+	Relations int               `json:"relations"`
+}
+
+// saveSourceSummary saves the summary of the exported environment with
+// the given UUID in dir, replacing any summary saved before.
+func saveSourceSummary(dir, modelUUID string, summary modelSummary) error {
+	saved := savedSummary{
+		Workloads: summary.workloads,
+		Relations: summary.relations,
+	}
+	for id := range summary.machines {
+		saved.Machines = append(saved.Machines, id)
+	}
+	for name := range summary.units {
+		saved.Units = append(saved.Units, name)
+	}
+	sort.Strings(saved.Machines)
+	sort.Strings(saved.Units)
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(utils.AtomicWriteFile(filepath.Join(dir, modelUUID+".json"), data, 0600))
+}
+
+// loadSourceSummary returns the summary of the environment with the given
+// UUID saved in dir, or a NotFound error if there is none.
+func loadSourceSummary(dir, modelUUID string) (modelSummary, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, modelUUID+".json"))
+	if os.IsNotExist(err) {
+		return modelSummary{}, errors.NotFoundf("summary of environment %s", modelUUID)
+	} else if err != nil {
+		return modelSummary{}, errors.Trace(err)
+	}
+	var saved savedSummary
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return modelSummary{}, errors.Annotatef(err, "reading summary of environment %s", modelUUID)
+	}
+	summary := newModelSummary()
+	for _, id := range saved.Machines {
+		summary.machines[id] = ""
+	}
+	for _, name := range saved.Units {
+		summary.units[name] = ""
+	}
+	for name, workload := range saved.Workloads {
+		summary.workloads[name] = workload
+	}
+	summary.relations = saved.Relations
+	return summary, nil
+}
+
+// summariseTargetStatus returns the summary of the model status reported
+// by the controller.
+func summariseTargetStatus(fullStatus *params.FullStatus) modelSummary {
+	summary := newModelSummary()
+	var addMachines func(map[string]params.MachineStatus)
+	addMachines = func(machines map[string]params.MachineStatus) {
+		for id, m := range machines {
+			summary.machines[id] = m.AgentStatus.Status
+			addMachines(m.Containers)
+		}
+	}
+	addMachines(fullStatus.Machines)
+	var addUnits func(map[string]params.UnitStatus)
+	addUnits = func(units map[string]params.UnitStatus) {
+		for name, unit := range units {
+			summary.units[name] = unit.AgentStatus.Status
+			summary.workloads[name] = unit.WorkloadStatus.Status
+			addUnits(unit.Subordinates)
+		}
+	}
+	for _, app := range fullStatus.Applications {
+		addUnits(app.Units)
+	}
+	summary.relations = len(fullStatus.Relations)
+	return summary
+}
+
+// compareModels returns a sorted description of every way in which the
+// target model differs from the source, including agents that have not
+// yet connected to the controller.
+func compareModels(source, target modelSummary) []string {
+	var problems []string
+	for id := range source.machines {
+		agentStatus, ok := target.machines[id]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("machine %s missing", id))
+		case agentStatus != string(status.Started):
+			problems = append(problems, fmt.Sprintf("machine %s agent not connected (%s)", id, agentStatus))
+		}
+	}
+	for id := range target.machines {
+		if _, ok := source.machines[id]; !ok {
+			problems = append(problems, fmt.Sprintf("machine %s unexpected", id))
+		}
+	}
+	for name := range source.units {
+		agentStatus, ok := target.units[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unit %s missing", name))
+			continue
+		}
+		switch status.Status(agentStatus) {
+		case status.Empty, status.Allocating, status.Lost:
+			problems = append(problems, fmt.Sprintf("unit %s agent not connected (%s)", name, agentStatus))
+		}
+		if source.workloads[name] != target.workloads[name] {
+			problems = append(problems, fmt.Sprintf("unit %s workload status %q, expected %q",
+				name, target.workloads[name], source.workloads[name]))
+		}
+	}
+	for name := range target.units {
+		if _, ok := source.units[name]; !ok {
+			problems = append(problems, fmt.Sprintf("unit %s unexpected", name))
+		}
+	}
+	if source.relations != target.relations {
+		problems = append(problems, fmt.Sprintf("%d relations, expected %d", target.relations, source.relations))
+	}
+	sort.Strings(problems)
+	return problems
+}
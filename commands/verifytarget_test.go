@@ -0,0 +1,124 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package commands
+
+import (
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+)
+
+type verifyTargetSuite struct{}
+
+var _ = gc.Suite(&verifyTargetSuite{})
+
+func sourceSummary() modelSummary {
+	summary := newModelSummary()
+	summary.machines["0"] = ""
+	summary.machines["0/lxc/0"] = ""
+	summary.units["mysql/0"] = ""
+	summary.units["logging/0"] = ""
+	summary.workloads["mysql/0"] = "active"
+	summary.workloads["logging/0"] = "unknown"
+	summary.relations = 1
+	return summary
+}
+
+func targetStatus() *params.FullStatus {
+	return &params.FullStatus{
+		Machines: map[string]params.MachineStatus{
+			"0": {
+				AgentStatus: params.DetailedStatus{Status: "started"},
+				Containers: map[string]params.MachineStatus{
+					"0/lxc/0": {AgentStatus: params.DetailedStatus{Status: "started"}},
+				},
+			},
+		},
+		Applications: map[string]params.ApplicationStatus{
+			"mysql": {
+				Units: map[string]params.UnitStatus{
+					"mysql/0": {
+						AgentStatus:    params.DetailedStatus{Status: "idle"},
+						WorkloadStatus: params.DetailedStatus{Status: "active"},
+						Subordinates: map[string]params.UnitStatus{
+							"logging/0": {
+								AgentStatus:    params.DetailedStatus{Status: "executing"},
+								WorkloadStatus: params.DetailedStatus{Status: "unknown"},
+							},
+						},
+					},
+				},
+			},
+			"logging": {},
+		},
+		Relations: []params.RelationStatus{{Id: 0}},
+	}
+}
+
+func (*verifyTargetSuite) TestSummariseTargetStatus(c *gc.C) {
+	summary := summariseTargetStatus(targetStatus())
+	c.Assert(summary.machines, gc.DeepEquals, map[string]string{
+		"0":       "started",
+		"0/lxc/0": "started",
+	})
+	c.Assert(summary.units, gc.DeepEquals, map[string]string{
+		"mysql/0":   "idle",
+		"logging/0": "executing",
+	})
+	c.Assert(summary.workloads, gc.DeepEquals, map[string]string{
+		"mysql/0":   "active",
+		"logging/0": "unknown",
+	})
+	c.Assert(summary.relations, gc.Equals, 1)
+}
+
+func (*verifyTargetSuite) TestCompareModelsMatch(c *gc.C) {
+	problems := compareModels(sourceSummary(), summariseTargetStatus(targetStatus()))
+	c.Assert(problems, gc.HasLen, 0)
+}
+
+func (*verifyTargetSuite) TestCompareModelsDifferences(c *gc.C) {
+	target := summariseTargetStatus(targetStatus())
+	target.machines["0/lxc/0"] = "down"
+	target.machines["1"] = "started"
+	target.units["mysql/0"] = "lost"
+	target.workloads["mysql/0"] = "blocked"
+	delete(target.units, "logging/0")
+	target.relations = 0
+
+	problems := compareModels(sourceSummary(), target)
+	c.Assert(problems, gc.DeepEquals, []string{
+		"0 relations, expected 1",
+		"machine 0/lxc/0 agent not connected (down)",
+		"machine 1 unexpected",
+		"unit logging/0 missing",
+		"unit mysql/0 agent not connected (lost)",
+		`unit mysql/0 workload status "blocked", expected "active"`,
+	})
+}
+
+func (*verifyTargetSuite) TestSaveSourceSummary(c *gc.C) {
+	dir := c.MkDir()
+	err := saveSourceSummary(dir, "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6", sourceSummary())
+	c.Assert(err, jc.ErrorIsNil)
+	summary, err := loadSourceSummary(dir, "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(summary, jc.DeepEquals, sourceSummary())
+
+	// A later export replaces the summary.
+	changed := sourceSummary()
+	changed.relations = 2
+	err = saveSourceSummary(dir, "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6", changed)
+	c.Assert(err, jc.ErrorIsNil)
+	summary, err = loadSourceSummary(dir, "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(summary.relations, gc.Equals, 2)
+}
+
+func (*verifyTargetSuite) TestLoadSourceSummaryNotSaved(c *gc.C) {
+	_, err := loadSourceSummary(c.MkDir(), "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
@@ -230,7 +230,7 @@ func (t *logTailer) loop() error {
 
 func (t *logTailer) processCollection() error {
 	// Create a selector from the params.
-	sel := t.paramsToSelector(t.params, "")
+	sel := logsSelector(t.envUUID, t.params, "")
 	query := t.logsColl.Find(sel)
 
 	if t.params.InitialLines > 0 {
@@ -263,7 +263,7 @@ func (t *logTailer) tailOplog() error {
 
 	newParams := t.params
 	newParams.StartTime = t.lastTime
-	oplogSel := append(t.paramsToSelector(newParams, "o."),
+	oplogSel := append(logsSelector(t.envUUID, newParams, "o."),
 		bson.DocElem{"ns", logsDB + "." + logsC},
 	)
 
@@ -313,9 +313,11 @@ func (t *logTailer) tailOplog() error {
 	}
 }
 
-func (t *logTailer) paramsToSelector(params *LogTailerParams, prefix string) bson.D {
+// logsSelector returns the selector for the environment's log records
+// that match params.
+func logsSelector(envUUID string, params *LogTailerParams, prefix string) bson.D {
 	sel := bson.D{
-		{"e", t.envUUID},
+		{"e", envUUID},
 		{"t", bson.M{"$gte": params.StartTime}},
 	}
 	if params.MinLevel > loggo.UNSPECIFIED {
@@ -423,6 +425,27 @@ func logDocToRecord(doc *logDoc) *LogRecord {
 	}
 }
 
+// ExportLogs calls fn with each of the environment's log records that
+// match params, oldest first, stopping at the first error fn returns.
+// The records are selected as a LogTailer selects them, but
+// InitialLines is ignored. Unlike a LogTailer, it returns once the
+// records already in the logs collection have been read.
+func ExportLogs(st LoggingState, params *LogTailerParams, fn func(*LogRecord) error) error {
+	session := st.MongoSession().Copy()
+	defer session.Close()
+	logsColl := session.DB(logsDB).C(logsC)
+
+	iter := logsColl.Find(logsSelector(st.EnvironUUID(), params, "")).Sort("t", "_id").Iter()
+	doc := new(logDoc)
+	for iter.Next(doc) {
+		if err := fn(logDocToRecord(doc)); err != nil {
+			iter.Close()
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(iter.Close())
+}
+
 // PruneLogs removes old log documents in order to control the size of
 // logs collection. All logs older than minLogTime are
 // removed. Further removal is also performed if the logs collection
@@ -4,6 +4,7 @@
 package state_test
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 	"time"
@@ -154,6 +155,71 @@ func (s *LogsSuite) TestPruneLogsBySize(c *gc.C) {
 	assertLatestTs(s2)
 }
 
+func (s *LogsSuite) TestExportLogs(c *gc.C) {
+	dbLogger := state.NewDbLogger(s.State, names.NewMachineTag("22"))
+	defer dbLogger.Close()
+	t0 := time.Now().Truncate(time.Millisecond) // MongoDB only stores timestamps with ms precision.
+	t1 := t0.Add(time.Second)
+	err := dbLogger.Log(t1, "else.where", "bar.go:42", loggo.ERROR, "oh noes")
+	c.Assert(err, jc.ErrorIsNil)
+	err = dbLogger.Log(t0, "some.where", "foo.go:99", loggo.INFO, "all is well")
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Logs of other environments are not exported.
+	st := s.Factory.MakeEnvironment(c, nil)
+	defer st.Close()
+	s.generateLogs(c, st, t0, 3)
+
+	var records []*state.LogRecord
+	err = state.ExportLogs(s.State, &state.LogTailerParams{}, func(record *state.LogRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(records, gc.HasLen, 2)
+	c.Check(records[0].Time.Equal(t0), jc.IsTrue)
+	c.Check(*records[0], jc.DeepEquals, state.LogRecord{
+		Time:     records[0].Time,
+		Entity:   "machine-22",
+		Module:   "some.where",
+		Location: "foo.go:99",
+		Level:    loggo.INFO,
+		Message:  "all is well",
+	})
+	c.Check(records[1].Message, gc.Equals, "oh noes")
+
+	err = state.ExportLogs(s.State, &state.LogTailerParams{}, func(*state.LogRecord) error {
+		return errors.New("boom")
+	})
+	c.Check(err, gc.ErrorMatches, "boom")
+}
+
+func (s *LogsSuite) TestExportLogsFiltered(c *gc.C) {
+	t0 := time.Now().Truncate(time.Millisecond)
+	for _, tag := range []names.Tag{names.NewMachineTag("0"), names.NewUnitTag("mysql/0")} {
+		dbLogger := state.NewDbLogger(s.State, tag)
+		err := dbLogger.Log(t0, "juju.old", "foo.go:1", loggo.ERROR, "old")
+		c.Assert(err, jc.ErrorIsNil)
+		err = dbLogger.Log(t0.Add(time.Hour), "juju.debug", "foo.go:2", loggo.DEBUG, "chatty")
+		c.Assert(err, jc.ErrorIsNil)
+		err = dbLogger.Log(t0.Add(time.Hour), "juju.warn", "foo.go:3", loggo.WARNING, "careful")
+		c.Assert(err, jc.ErrorIsNil)
+		dbLogger.Close()
+	}
+
+	var records []string
+	err := state.ExportLogs(s.State, &state.LogTailerParams{
+		StartTime:     t0.Add(time.Minute),
+		MinLevel:      loggo.INFO,
+		ExcludeEntity: []string{"unit-*"},
+	}, func(record *state.LogRecord) error {
+		records = append(records, record.Entity+" "+record.Message)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(records, jc.DeepEquals, []string{"machine-0 careful"})
+}
+
 func (s *LogsSuite) generateLogs(c *gc.C, st *state.State, endTime time.Time, count int) {
 	dbLogger := state.NewDbLogger(st, names.NewMachineTag("0"))
 	defer dbLogger.Close()
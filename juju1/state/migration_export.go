@@ -22,17 +22,47 @@ import (
 	version1 "github.com/juju/1.25-upgrade/juju1/version"
 )
 
+// ExportOverrides holds values that replace those of the 1.25
+// environment in the exported model, so that it can be imported under a
+// different name, owner or cloud on the target controller.
+type ExportOverrides struct {
+	// ModelName replaces the name of the environment.
+	ModelName string
+
+	// Owner replaces the owner of the environment. The owner is
+	// added to the model's users as an admin if they are not
+	// already one.
+	Owner names2.UserTag
+
+	// Cloud and CloudRegion replace the cloud and region derived from
+	// the environment's provider.
+	Cloud       string
+	CloudRegion string
+
+	// CredentialName, if set, names a cloud credential that already
+	// exists on the target controller for the owner. The
+	// environment's own cloud secrets are not exported.
+	CredentialName string
+}
+
 // Export the current model for the State.
 func (st *State) Export() (description.Model, error) {
+	return st.ExportWithOverrides(ExportOverrides{})
+}
+
+// ExportWithOverrides exports the current model for the State, as Export
+// does, with the overrides applied.
+func (st *State) ExportWithOverrides(overrides ExportOverrides) (description.Model, error) {
 	dbModel, err := st.Environment()
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	export := exporter{
-		st:      st,
-		dbModel: dbModel,
-		logger:  loggo.GetLogger("juju.state.export-model"),
+		st:        st,
+		dbModel:   dbModel,
+		overrides: overrides,
+		logger:    loggo.GetLogger("juju.state.export-model"),
 	}
 	if err := export.readAllStatuses(); err != nil {
 		return nil, errors.Annotate(err, "reading statuses")
@@ -80,6 +110,13 @@ func (st *State) Export() (description.Model, error) {
 	export.model = description.NewModel(args)
 	export.model.SetCloudCredential(creds)
 
+	// The storage pools are exported first, as the storage constraints
+	// of the applications are checked against them.
+	export.pools = newStoragePoolTranslator(modelConfig["type"].(string))
+	if err := export.storagePools(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	modelKey := dbModel.globalKey()
 	export.model.SetAnnotations(export.getAnnotations(modelKey))
 	if err := export.sequences(); err != nil {
@@ -144,10 +181,12 @@ func (st *State) Export() (description.Model, error) {
 }
 
 type exporter struct {
-	st      *State
-	dbModel *Environment
-	model   description.Model
-	logger  loggo.Logger
+	st        *State
+	dbModel   *Environment
+	overrides ExportOverrides
+	model     description.Model
+	logger    loggo.Logger
+	pools     *storagePoolTranslator
 
 	annotations             map[string]annotatorDoc
 	constraints             map[string]bson.M
@@ -188,7 +227,6 @@ func (e *exporter) splitEnvironConfig() (map[string]interface{}, description.Clo
 	cloudType := modelConfig["type"].(string)
 	creds.Cloud = names2.NewCloudTag(cloudType)
 	creds.Owner = e.userTag(e.dbModel.Owner())
-	creds.Name = fmt.Sprintf("%s-%s", creds.Owner.Name(), creds.Cloud.Id())
 
 	switch cloudType {
 	case "ec2":
@@ -245,9 +283,37 @@ func (e *exporter) splitEnvironConfig() (map[string]interface{}, description.Clo
 	// TODO: delete all bootstrap only config values from modelConfig
 	//
 
+	e.applyOverrides(modelConfig, &creds, &region)
 	return modelConfig, creds, region, nil
 }
 
+// applyOverrides replaces the values split out of the environment config
+// with any that have been overridden.
+func (e *exporter) applyOverrides(modelConfig map[string]interface{}, creds *description.CloudCredentialArgs, region *string) {
+	overrides := e.overrides
+	if overrides.ModelName != "" {
+		modelConfig["name"] = overrides.ModelName
+	}
+	if overrides.Owner != (names2.UserTag{}) {
+		creds.Owner = overrides.Owner
+	}
+	if overrides.Cloud != "" {
+		creds.Cloud = names2.NewCloudTag(overrides.Cloud)
+	}
+	if overrides.CloudRegion != "" {
+		*region = overrides.CloudRegion
+	}
+	if overrides.CredentialName != "" {
+		// The credential is only referred to; the controller
+		// already has its secrets.
+		creds.Name = overrides.CredentialName
+		creds.AuthType = ""
+		creds.Attributes = nil
+	} else {
+		creds.Name = fmt.Sprintf("%s-%s", creds.Owner.Name(), creds.Cloud.Id())
+	}
+}
+
 func (e *exporter) userTag(t names1.UserTag) names2.UserTag {
 	if t.IsLocal() {
 		return names2.NewUserTag(t.Name())
@@ -321,9 +387,34 @@ func (e *exporter) modelUsers() error {
 		}
 		e.model.AddUser(arg)
 	}
+	e.addOwnerOverride()
 	return nil
 }
 
+// addOwnerOverride adds the overridden owner to the model's users as an
+// admin, if they are not already one of them.
+func (e *exporter) addOwnerOverride() {
+	owner := e.overrides.Owner
+	if owner == (names2.UserTag{}) || e.hasUser(owner) {
+		return
+	}
+	e.model.AddUser(description.UserArgs{
+		Name:        owner,
+		CreatedBy:   owner,
+		DateCreated: time.Now(),
+		Access:      "admin",
+	})
+}
+
+func (e *exporter) hasUser(tag names2.UserTag) bool {
+	for _, user := range e.model.Users() {
+		if user.Name() == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *exporter) machines() error {
 	machines, err := e.st.AllMachines()
 	if err != nil {
@@ -677,9 +768,10 @@ func (e *exporter) readAllStorageConstraints() error {
 	return nil
 }
 
-func (e *exporter) storageConstraints(doc storageConstraintsDoc) map[string]description.StorageConstraintArgs {
+func (e *exporter) storageConstraints(usedBy string, doc storageConstraintsDoc) map[string]description.StorageConstraintArgs {
 	result := make(map[string]description.StorageConstraintArgs)
 	for key, value := range doc.Constraints {
+		e.pools.checkPool(fmt.Sprintf("%s storage %q", usedBy, key), value.Pool)
 		result[key] = description.StorageConstraintArgs{
 			Pool:  value.Pool,
 			Size:  value.Size,
@@ -746,7 +838,7 @@ func (e *exporter) addApplication(ctx addApplicationContext) error {
 		MetricsCredentials: application.doc.MetricCredentials,
 	}
 	if constraints, found := e.modelStorageConstraints[globalKey]; found {
-		args.StorageConstraints = e.storageConstraints(constraints)
+		args.StorageConstraints = e.storageConstraints("application "+application.Name(), constraints)
 	}
 
 	e.logger.Debugf("Adding application %q", args.Tag.Id())
@@ -1366,10 +1458,7 @@ func (e *exporter) storage() error {
 	if err := e.storageInstances(); err != nil {
 		return errors.Trace(err)
 	}
-	if err := e.storagePools(); err != nil {
-		return errors.Trace(err)
-	}
-	return nil
+	return errors.Trace(e.pools.err())
 }
 
 func (e *exporter) volumes() error {
@@ -1424,6 +1513,7 @@ func (e *exporter) addVolume(vol *volume, volAttachments []volumeAttachmentDoc)
 		args.Size = params.Size
 		args.Pool = params.Pool
 	}
+	e.pools.checkPool("volume "+vol.VolumeTag().Id(), args.Pool)
 
 	globalKey := vol.globalKey()
 	statusArgs, err := e.statusArgs(globalKey)
@@ -1528,6 +1618,7 @@ func (e *exporter) addFilesystem(fs *filesystem, fsAttachments []filesystemAttac
 		args.Size = params.Size
 		args.Pool = params.Pool
 	}
+	e.pools.checkPool("filesystem "+fs.FilesystemTag().Id(), args.Pool)
 
 	exFilesystem := e.model.AddFilesystem(args)
 	// No status for filesystems in 1.25
@@ -1648,11 +1739,9 @@ func (e *exporter) storagePools() error {
 		return errors.Annotate(err, "listing pools")
 	}
 	for _, cfg := range poolConfigs {
-		e.model.AddStoragePool(description.StoragePoolArgs{
-			Name:       cfg.Name(),
-			Provider:   string(cfg.Provider()),
-			Attributes: cfg.Attrs(),
-		})
+		if args, ok := e.pools.translatePool(cfg); ok {
+			e.model.AddStoragePool(args)
+		}
 	}
 	return nil
 }
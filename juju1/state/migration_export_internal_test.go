@@ -0,0 +1,84 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	names2 "gopkg.in/juju/names.v2"
+)
+
+type ExportOverridesSuite struct{}
+
+var _ = gc.Suite(&ExportOverridesSuite{})
+
+func (s *ExportOverridesSuite) split() (map[string]interface{}, description.CloudCredentialArgs, string) {
+	modelConfig := map[string]interface{}{"name": "prod", "type": "ec2"}
+	creds := description.CloudCredentialArgs{
+		Owner:      names2.NewUserTag("admin"),
+		Cloud:      names2.NewCloudTag("ec2"),
+		AuthType:   "access-key",
+		Attributes: map[string]string{"access-key": "key", "secret-key": "secret"},
+	}
+	return modelConfig, creds, "us-east-1"
+}
+
+func (s *ExportOverridesSuite) TestApplyNoOverrides(c *gc.C) {
+	modelConfig, creds, region := s.split()
+	e := &exporter{}
+	e.applyOverrides(modelConfig, &creds, &region)
+	c.Assert(modelConfig["name"], gc.Equals, "prod")
+	c.Assert(region, gc.Equals, "us-east-1")
+	// The environment's secrets are exported as a credential named
+	// after the owner and cloud.
+	c.Assert(creds, jc.DeepEquals, description.CloudCredentialArgs{
+		Owner:      names2.NewUserTag("admin"),
+		Cloud:      names2.NewCloudTag("ec2"),
+		Name:       "admin-ec2",
+		AuthType:   "access-key",
+		Attributes: map[string]string{"access-key": "key", "secret-key": "secret"},
+	})
+}
+
+func (s *ExportOverridesSuite) TestApplyOverrides(c *gc.C) {
+	modelConfig, creds, region := s.split()
+	e := &exporter{overrides: ExportOverrides{
+		ModelName:      "web",
+		Owner:          names2.NewUserTag("web-team"),
+		Cloud:          "aws-china",
+		CloudRegion:    "cn-north-1",
+		CredentialName: "web-aws",
+	}}
+	e.applyOverrides(modelConfig, &creds, &region)
+	c.Assert(modelConfig["name"], gc.Equals, "web")
+	c.Assert(region, gc.Equals, "cn-north-1")
+	// The credential is referred to by name only, so that the one
+	// on the controller is used when the model is imported.
+	c.Assert(creds, jc.DeepEquals, description.CloudCredentialArgs{
+		Owner: names2.NewUserTag("web-team"),
+		Cloud: names2.NewCloudTag("aws-china"),
+		Name:  "web-aws",
+	})
+}
+
+func (s *ExportOverridesSuite) TestOwnerOverrideAddedAsAdmin(c *gc.C) {
+	e := &exporter{
+		overrides: ExportOverrides{Owner: names2.NewUserTag("web-team")},
+		model:     description.NewModel(description.ModelArgs{Owner: names2.NewUserTag("web-team")}),
+	}
+	e.model.AddUser(description.UserArgs{
+		Name:   names2.NewUserTag("admin"),
+		Access: "admin",
+	})
+	e.addOwnerOverride()
+	users := e.model.Users()
+	c.Assert(users, gc.HasLen, 2)
+	c.Assert(users[1].Name(), gc.Equals, names2.NewUserTag("web-team"))
+	c.Assert(users[1].Access(), gc.Equals, "admin")
+
+	// The owner is not added twice.
+	e.addOwnerOverride()
+	c.Assert(e.model.Users(), gc.HasLen, 2)
+}
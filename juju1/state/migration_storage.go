@@ -0,0 +1,154 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/utils/set"
+
+	"github.com/juju/1.25-upgrade/juju1/storage"
+)
+
+// storageProviderTranslation describes how the pools of a 1.25 storage
+// provider are exported, so that they can be created with the 2.x storage
+// provider of the same name.
+type storageProviderTranslation struct {
+	// cloudTypes holds the types of cloud that the 2.x provider is
+	// available in. It is available in all of them if empty.
+	cloudTypes []string
+
+	// attributes holds the pool attributes understood by the 2.x
+	// provider.
+	attributes []string
+}
+
+// storageProviderTranslations holds the translation for each 1.25 storage
+// provider that has a 2.x equivalent.
+var storageProviderTranslations = map[storage.ProviderType]storageProviderTranslation{
+	"ebs": {
+		cloudTypes: []string{"ec2"},
+		attributes: []string{"volume-type", "iops", "encrypted"},
+	},
+	"cinder": {
+		cloudTypes: []string{"openstack"},
+	},
+	"maas": {
+		cloudTypes: []string{"maas"},
+		attributes: []string{"tags"},
+	},
+	"loop":     {},
+	"hostloop": {},
+	"rootfs":   {},
+	"tmpfs":    {},
+}
+
+// droppedStorageAttributes holds the 1.25 pool attributes that 2.x has no
+// equivalent for, and which are left out of the exported pools. In 2.x a
+// volume is persistent if its provider supports it, rather than by choice
+// of pool.
+var droppedStorageAttributes = set.NewStrings(storage.Persistent)
+
+// storagePoolTranslator translates the storage pools of a 1.25
+// environment for 2.x, and checks the pools used by its volumes,
+// filesystems and storage constraints. It collects every incompatibility
+// rather than stopping at the first, so that verify-source can report
+// them all at once.
+type storagePoolTranslator struct {
+	cloudType string
+	pools     map[string]storage.ProviderType
+	problems  []string
+	reported  set.Strings
+}
+
+func newStoragePoolTranslator(cloudType string) *storagePoolTranslator {
+	return &storagePoolTranslator{
+		cloudType: cloudType,
+		pools:     make(map[string]storage.ProviderType),
+		reported:  set.NewStrings(),
+	}
+}
+
+func (t *storagePoolTranslator) addProblem(format string, args ...interface{}) {
+	problem := fmt.Sprintf(format, args...)
+	if !t.reported.Contains(problem) {
+		t.reported.Add(problem)
+		t.problems = append(t.problems, problem)
+	}
+}
+
+// checkProvider returns why the 1.25 storage provider cannot be used in
+// 2.x, or "" if it can.
+func (t *storagePoolTranslator) checkProvider(providerType storage.ProviderType) string {
+	translation, ok := storageProviderTranslations[providerType]
+	if !ok {
+		return fmt.Sprintf("storage provider %q is not supported by 2.x", providerType)
+	}
+	if len(translation.cloudTypes) > 0 && !set.NewStrings(translation.cloudTypes...).Contains(t.cloudType) {
+		return fmt.Sprintf("storage provider %q is not available for %s in 2.x", providerType, t.cloudType)
+	}
+	return ""
+}
+
+// translatePool returns the 2.x pool for the 1.25 pool config, and
+// whether it can be exported. Attributes that the 2.x provider does not
+// understand are recorded as problems, other than those that are dropped.
+func (t *storagePoolTranslator) translatePool(cfg *storage.Config) (description.StoragePoolArgs, bool) {
+	t.pools[cfg.Name()] = cfg.Provider()
+	if problem := t.checkProvider(cfg.Provider()); problem != "" {
+		t.addProblem("pool %q: %s", cfg.Name(), problem)
+		return description.StoragePoolArgs{}, false
+	}
+	known := set.NewStrings(storageProviderTranslations[cfg.Provider()].attributes...)
+	attrs := make(map[string]interface{})
+	var unknown []string
+	for key, value := range cfg.Attrs() {
+		switch {
+		case known.Contains(key):
+			attrs[key] = value
+		case !droppedStorageAttributes.Contains(key):
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		t.addProblem("pool %q: attributes not supported by %q storage in 2.x: %s",
+			cfg.Name(), cfg.Provider(), strings.Join(unknown, ", "))
+		return description.StoragePoolArgs{}, false
+	}
+	return description.StoragePoolArgs{
+		Name:       cfg.Name(),
+		Provider:   string(cfg.Provider()),
+		Attributes: attrs,
+	}, true
+}
+
+// checkPool records a problem if the pool used by the named entity cannot
+// be used in 2.x. The pool is either one of the environment's pools, which
+// will have been checked by translatePool, or the name of a storage
+// provider.
+func (t *storagePoolTranslator) checkPool(usedBy, pool string) {
+	if pool == "" {
+		return
+	}
+	if _, ok := t.pools[pool]; ok {
+		return
+	}
+	if problem := t.checkProvider(storage.ProviderType(pool)); problem != "" {
+		t.addProblem("%s: %s", usedBy, problem)
+	}
+}
+
+// err returns an error describing all the problems found, or nil if
+// there are none.
+func (t *storagePoolTranslator) err() error {
+	if len(t.problems) == 0 {
+		return nil
+	}
+	return errors.Errorf("storage incompatible with 2.x:\n    %s", strings.Join(t.problems, "\n    "))
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package state
+
+import (
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju1/storage"
+)
+
+type StoragePoolTranslatorSuite struct{}
+
+var _ = gc.Suite(&StoragePoolTranslatorSuite{})
+
+func (s *StoragePoolTranslatorSuite) newConfig(c *gc.C, name, provider string, attrs map[string]interface{}) *storage.Config {
+	cfg, err := storage.NewConfig(name, storage.ProviderType(provider), attrs)
+	c.Assert(err, jc.ErrorIsNil)
+	return cfg
+}
+
+func (s *StoragePoolTranslatorSuite) TestTranslatePool(c *gc.C) {
+	t := newStoragePoolTranslator("ec2")
+	args, ok := t.translatePool(s.newConfig(c, "fast", "ebs", map[string]interface{}{
+		"volume-type": "provisioned-iops",
+		"iops":        30,
+		"persistent":  true,
+	}))
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(args, jc.DeepEquals, description.StoragePoolArgs{
+		Name:     "fast",
+		Provider: "ebs",
+		Attributes: map[string]interface{}{
+			"volume-type": "provisioned-iops",
+			"iops":        30,
+		},
+	})
+	c.Assert(t.err(), jc.ErrorIsNil)
+}
+
+func (s *StoragePoolTranslatorSuite) TestTranslatePoolCommonProvider(c *gc.C) {
+	t := newStoragePoolTranslator("maas")
+	args, ok := t.translatePool(s.newConfig(c, "scratch", "tmpfs", nil))
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(args, jc.DeepEquals, description.StoragePoolArgs{
+		Name:       "scratch",
+		Provider:   "tmpfs",
+		Attributes: map[string]interface{}{},
+	})
+	c.Assert(t.err(), jc.ErrorIsNil)
+}
+
+func (s *StoragePoolTranslatorSuite) TestTranslatePoolWrongCloud(c *gc.C) {
+	t := newStoragePoolTranslator("openstack")
+	_, ok := t.translatePool(s.newConfig(c, "fast", "ebs", nil))
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(t.err(), gc.ErrorMatches, `storage incompatible with 2.x:
+    pool "fast": storage provider "ebs" is not available for openstack in 2.x`)
+}
+
+func (s *StoragePoolTranslatorSuite) TestTranslatePoolUnsupportedProvider(c *gc.C) {
+	t := newStoragePoolTranslator("ec2")
+	_, ok := t.translatePool(s.newConfig(c, "old", "dummy", nil))
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(t.err(), gc.ErrorMatches, `storage incompatible with 2.x:
+    pool "old": storage provider "dummy" is not supported by 2.x`)
+}
+
+func (s *StoragePoolTranslatorSuite) TestTranslatePoolUnknownAttributes(c *gc.C) {
+	t := newStoragePoolTranslator("maas")
+	_, ok := t.translatePool(s.newConfig(c, "tagged", "maas", map[string]interface{}{
+		"tags":  "ssd",
+		"zone":  "a",
+		"speed": "fast",
+	}))
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(t.err(), gc.ErrorMatches, `storage incompatible with 2.x:
+    pool "tagged": attributes not supported by "maas" storage in 2.x: speed, zone`)
+}
+
+func (s *StoragePoolTranslatorSuite) TestCheckPool(c *gc.C) {
+	t := newStoragePoolTranslator("ec2")
+	t.translatePool(s.newConfig(c, "fast", "ebs", nil))
+	t.checkPool("volume 0", "fast")
+	t.checkPool("volume 1", "ebs")
+	t.checkPool("volume 2", "loop")
+	t.checkPool("volume 3", "")
+	c.Assert(t.err(), jc.ErrorIsNil)
+
+	t.checkPool("volume 4", "cinder")
+	t.checkPool("volume 4", "cinder")
+	t.checkPool("filesystem 5", "nfs")
+	c.Assert(t.err(), gc.ErrorMatches, `storage incompatible with 2.x:
+    volume 4: storage provider "cinder" is not available for ec2 in 2.x
+    filesystem 5: storage provider "nfs" is not supported by 2.x`)
+}
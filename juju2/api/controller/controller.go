@@ -15,6 +15,7 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/api/common"
 	"github.com/juju/1.25-upgrade/juju2/api/common/cloudspec"
 	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/environs"
 	"github.com/juju/1.25-upgrade/juju2/permission"
 )
@@ -224,6 +225,7 @@ type MigrationSpec struct {
 	TargetUser           string
 	TargetPassword       string
 	TargetMacaroons      []macaroon.Slice
+	LogTransfer          migration.LogTransferOptions
 }
 
 // Validate performs sanity checks on the migration configuration it
@@ -244,7 +246,7 @@ func (s *MigrationSpec) Validate() error {
 	if s.TargetPassword == "" && len(s.TargetMacaroons) == 0 {
 		return errors.NotValidf("missing authentication secrets")
 	}
-	return nil
+	return s.LogTransfer.Validate()
 }
 
 // InitiateMigration attempts to start a migration for the specified
@@ -274,6 +276,7 @@ func (c *Client) InitiateMigration(spec MigrationSpec) (string, error) {
 				Password:      spec.TargetPassword,
 				Macaroons:     string(macsJSON),
 			},
+			LogTransfer: params.LogTransferToParams(spec.LogTransfer),
 		}},
 	}
 	response := params.InitiateMigrationResults{}
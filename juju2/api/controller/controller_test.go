@@ -6,7 +6,9 @@ package controller_test
 import (
 	"encoding/json"
 	"errors"
+	"time"
 
+	"github.com/juju/loggo"
 	jujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
@@ -18,6 +20,7 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/api/controller"
 	"github.com/juju/1.25-upgrade/juju2/apiserver/common"
 	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/environs"
 )
 
@@ -75,6 +78,41 @@ func specToArgs(spec controller.MigrationSpec) params.InitiateMigrationArgs {
 	}
 }
 
+func (s *Suite) TestInitiateMigrationLogTransfer(c *gc.C) {
+	client, stub := makeClient(params.InitiateMigrationResults{
+		Results: []params.InitiateMigrationResult{{
+			MigrationId: "id",
+		}},
+	})
+	spec := makeSpec()
+	spec.LogTransfer = migration.LogTransferOptions{
+		MaxAge:            24 * time.Hour,
+		Level:             loggo.INFO,
+		IncludeEntities:   []string{"unit-mysql-*"},
+		MaxBytesPerSecond: 1 << 20,
+	}
+	_, err := client.InitiateMigration(spec)
+	c.Assert(err, jc.ErrorIsNil)
+
+	stub.CheckCallNames(c, "Controller.InitiateMigration")
+	args := stub.Calls()[0].Args[0].(params.InitiateMigrationArgs)
+	c.Check(args.Specs[0].LogTransfer, jc.DeepEquals, params.MigrationLogTransferOptions{
+		MaxAge:            24 * time.Hour,
+		Level:             "INFO",
+		IncludeEntities:   []string{"unit-mysql-*"},
+		MaxBytesPerSecond: 1 << 20,
+	})
+}
+
+func (s *Suite) TestInitiateMigrationLogTransferValidationError(c *gc.C) {
+	client, stub := makeClient(params.InitiateMigrationResults{})
+	spec := makeSpec()
+	spec.LogTransfer.MaxAge = -time.Hour
+	_, err := client.InitiateMigration(spec)
+	c.Check(err, gc.ErrorMatches, "client-side validation failed: negative MaxAge not valid")
+	c.Check(stub.Calls(), gc.HasLen, 0)
+}
+
 func (s *Suite) TestInitiateMigrationError(c *gc.C) {
 	client, _ := makeClient(params.InitiateMigrationResults{
 		Results: []params.InitiateMigrationResult{{
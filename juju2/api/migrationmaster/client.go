@@ -30,16 +30,20 @@ type NewWatcherFunc func(base.APICaller, params.NotifyWatchResult) watcher.Notif
 
 // NewClient returns a new Client based on an existing API connection.
 func NewClient(caller base.APICaller, newWatcher NewWatcherFunc) *Client {
+	facadeCaller := base.NewFacadeCaller(caller, "MigrationMaster")
 	return &Client{
-		caller:            base.NewFacadeCaller(caller, "MigrationMaster"),
-		newWatcher:        newWatcher,
-		httpClientFactory: caller.HTTPClient,
+		ControllerConfigAPI: common.NewControllerConfig(facadeCaller),
+		caller:              facadeCaller,
+		newWatcher:          newWatcher,
+		httpClientFactory:   caller.HTTPClient,
 	}
 }
 
 // Client describes the client side API for the MigrationMaster facade
 // (used by the migrationmaster worker).
 type Client struct {
+	*common.ControllerConfigAPI
+
 	caller            base.FacadeCaller
 	newWatcher        NewWatcherFunc
 	httpClientFactory func() (*httprequest.Client, error)
@@ -97,6 +101,11 @@ func (c *Client) MigrationStatus() (migration.MigrationStatus, error) {
 		}
 	}
 
+	logTransfer, err := params.LogTransferFromParams(status.Spec.LogTransfer)
+	if err != nil {
+		return empty, errors.Annotate(err, "log transfer options")
+	}
+
 	return migration.MigrationStatus{
 		MigrationId:      status.MigrationId,
 		ModelUUID:        modelTag.Id(),
@@ -110,6 +119,8 @@ func (c *Client) MigrationStatus() (migration.MigrationStatus, error) {
 			Password:      target.Password,
 			Macaroons:     macs,
 		},
+		ImportProgress: status.ImportProgress,
+		LogTransfer:    logTransfer,
 	}, nil
 }
 
@@ -130,6 +141,15 @@ func (c *Client) SetStatusMessage(message string) error {
 	return c.caller.FacadeCall("SetStatusMessage", args, nil)
 }
 
+// AddImportProgress records steps of the IMPORT phase of the currently
+// active model migration as completed.
+func (c *Client) AddImportProgress(steps ...string) error {
+	args := params.AddMigrationImportProgressArgs{
+		Steps: steps,
+	}
+	return c.caller.FacadeCall("AddImportProgress", args, nil)
+}
+
 // ModelInfo return basic information about the model to migrated.
 func (c *Client) ModelInfo() (migration.ModelInfo, error) {
 	var info params.MigrationModelInfo
@@ -147,6 +167,8 @@ func (c *Client) ModelInfo() (migration.ModelInfo, error) {
 		Owner:                  owner,
 		AgentVersion:           info.AgentVersion,
 		ControllerAgentVersion: info.ControllerAgentVersion,
+		DescriptionVersion:     info.DescriptionVersion,
+		Features:               info.Features,
 	}, nil
 }
 
@@ -167,14 +189,18 @@ func (c *Client) Export() (migration.SerializedModel, error) {
 		return empty, errors.Trace(err)
 	}
 
-	// Convert tools info to output map.
+	// Convert tools info to output maps.
 	tools := make(map[version.Binary]string)
+	toolsSHA256s := make(map[version.Binary]string)
 	for _, toolsInfo := range serialized.Tools {
 		v, err := version.ParseBinary(toolsInfo.Version)
 		if err != nil {
 			return migration.SerializedModel{}, errors.Annotate(err, "error parsing tools version")
 		}
 		tools[v] = toolsInfo.URI
+		if toolsInfo.SHA256 != "" {
+			toolsSHA256s[v] = toolsInfo.SHA256
+		}
 	}
 
 	resources, err := convertResources(serialized.Resources)
@@ -183,10 +209,14 @@ func (c *Client) Export() (migration.SerializedModel, error) {
 	}
 
 	return migration.SerializedModel{
-		Bytes:     serialized.Bytes,
-		Charms:    serialized.Charms,
-		Tools:     tools,
-		Resources: resources,
+		Bytes:        serialized.Bytes,
+		Size:         serialized.Size,
+		SHA256:       serialized.SHA256,
+		Charms:       serialized.Charms,
+		Tools:        tools,
+		Resources:    resources,
+		CharmSHA256s: serialized.CharmSHA256s,
+		ToolsSHA256s: toolsSHA256s,
 	}, nil
 }
 
@@ -205,6 +235,20 @@ func (c *Client) OpenResource(application, name string) (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
+// OpenSerializedModel downloads the serialized model staged by Export.
+func (c *Client) OpenSerializedModel() (io.ReadCloser, error) {
+	httpClient, err := c.httpClientFactory()
+	if err != nil {
+		return nil, errors.Annotate(err, "unable to create HTTP client")
+	}
+
+	var resp *http.Response
+	if err := httpClient.Get("/migrate/export", &resp); err != nil {
+		return nil, errors.Annotate(err, "unable to retrieve serialized model")
+	}
+	return resp.Body, nil
+}
+
 // Reap removes the documents for the model associated with the API
 // connection.
 func (c *Client) Reap() error {
@@ -263,12 +307,16 @@ func (c *Client) MinionReports() (migration.MinionReports, error) {
 // StreamModelLog takes a starting time and returns a channel that
 // will yield the logs on or after that time - these are the logs that
 // need to be transferred to the target after the migration is
-// successful.
-func (c *Client) StreamModelLog(start time.Time) (<-chan common.LogMessage, error) {
+// successful. Only the records matching the level and entity limits
+// in opts are yielded; applying the other limits is up to the caller.
+func (c *Client) StreamModelLog(start time.Time, opts migration.LogTransferOptions) (<-chan common.LogMessage, error) {
 	return common.StreamDebugLog(c.caller.RawAPICaller(), common.DebugLogParams{
-		Replay:    true,
-		NoTail:    true,
-		StartTime: start,
+		Replay:        true,
+		NoTail:        true,
+		StartTime:     start,
+		Level:         opts.Level,
+		IncludeEntity: opts.IncludeEntities,
+		ExcludeEntity: opts.ExcludeEntities,
 	})
 }
 
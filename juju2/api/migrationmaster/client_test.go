@@ -14,6 +14,7 @@ import (
 
 	"github.com/juju/errors"
 	"github.com/juju/httprequest"
+	"github.com/juju/loggo"
 	jujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
@@ -93,10 +94,17 @@ func (s *ClientSuite) TestMigrationStatus(c *gc.C) {
 					Password:      "secret",
 					Macaroons:     string(macsJSON),
 				},
+				LogTransfer: params.MigrationLogTransferOptions{
+					MaxAge:              time.Hour,
+					Level:               "ERROR",
+					ExcludeEntities:     []string{"unit-noisy-*"},
+					MaxRecordsPerSecond: 100,
+				},
 			},
 			MigrationId:      "id",
 			Phase:            "IMPORT",
 			PhaseChangedTime: timestamp,
+			ImportProgress:   []string{"model"},
 		}
 		return nil
 	})
@@ -116,7 +124,35 @@ func (s *ClientSuite) TestMigrationStatus(c *gc.C) {
 			Password:      "secret",
 			Macaroons:     macs,
 		},
+		ImportProgress: []string{"model"},
+		LogTransfer: migration.LogTransferOptions{
+			MaxAge:              time.Hour,
+			Level:               loggo.ERROR,
+			ExcludeEntities:     []string{"unit-noisy-*"},
+			MaxRecordsPerSecond: 100,
+		},
+	})
+}
+
+func (s *ClientSuite) TestMigrationStatusBadLogLevel(c *gc.C) {
+	apiCaller := apitesting.APICallerFunc(func(_ string, _ int, _, _ string, _, result interface{}) error {
+		out := result.(*params.MasterMigrationStatus)
+		*out = params.MasterMigrationStatus{
+			Spec: params.MigrationSpec{
+				ModelTag: names.NewModelTag(utils.MustNewUUID().String()).String(),
+				TargetInfo: params.MigrationTargetInfo{
+					ControllerTag: names.NewControllerTag(utils.MustNewUUID().String()).String(),
+					AuthTag:       names.NewUserTag("admin").String(),
+				},
+				LogTransfer: params.MigrationLogTransferOptions{Level: "LOUD"},
+			},
+			Phase: "IMPORT",
+		}
+		return nil
 	})
+	client := migrationmaster.NewClient(apiCaller, nil)
+	_, err := client.MigrationStatus()
+	c.Assert(err, gc.ErrorMatches, `log transfer options: log level "LOUD" not valid`)
 }
 
 func (s *ClientSuite) TestSetPhase(c *gc.C) {
@@ -158,6 +194,24 @@ func (s *ClientSuite) TestSetStatusMessage(c *gc.C) {
 	})
 }
 
+func (s *ClientSuite) TestControllerConfig(c *gc.C) {
+	var stub jujutesting.Stub
+	apiCaller := apitesting.APICallerFunc(func(objType string, version int, id, request string, arg, result interface{}) error {
+		stub.AddCall(objType+"."+request, id, arg)
+		*(result.(*params.ControllerConfigResult)) = params.ControllerConfigResult{
+			Config: params.ControllerConfig{"migration-webhook-url": "https://example.com/hook"},
+		}
+		return nil
+	})
+	client := migrationmaster.NewClient(apiCaller, nil)
+	cfg, err := client.ControllerConfig()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cfg.MigrationWebhookURL(), gc.Equals, "https://example.com/hook")
+	stub.CheckCalls(c, []jujutesting.StubCall{
+		{"MigrationMaster.ControllerConfig", []interface{}{"", nil}},
+	})
+}
+
 func (s *ClientSuite) TestSetStatusMessageError(c *gc.C) {
 	apiCaller := apitesting.APICallerFunc(func(string, int, string, string, interface{}, interface{}) error {
 		return errors.New("boom")
@@ -167,6 +221,21 @@ func (s *ClientSuite) TestSetStatusMessageError(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, "boom")
 }
 
+func (s *ClientSuite) TestAddImportProgress(c *gc.C) {
+	var stub jujutesting.Stub
+	apiCaller := apitesting.APICallerFunc(func(objType string, version int, id, request string, arg, result interface{}) error {
+		stub.AddCall(objType+"."+request, id, arg)
+		return nil
+	})
+	client := migrationmaster.NewClient(apiCaller, nil)
+	err := client.AddImportProgress("model", "charm cs:foo-1")
+	c.Assert(err, jc.ErrorIsNil)
+	expectedArg := params.AddMigrationImportProgressArgs{Steps: []string{"model", "charm cs:foo-1"}}
+	stub.CheckCalls(c, []jujutesting.StubCall{
+		{"MigrationMaster.AddImportProgress", []interface{}{"", expectedArg}},
+	})
+}
+
 func (s *ClientSuite) TestModelInfo(c *gc.C) {
 	var stub jujutesting.Stub
 	owner := names.NewUserTag("owner")
@@ -178,6 +247,8 @@ func (s *ClientSuite) TestModelInfo(c *gc.C) {
 			OwnerTag:               owner.String(),
 			AgentVersion:           version.MustParse("1.2.3"),
 			ControllerAgentVersion: version.MustParse("1.2.4"),
+			DescriptionVersion:     1,
+			Features:               []string{"storage"},
 		}
 		return nil
 	})
@@ -193,6 +264,8 @@ func (s *ClientSuite) TestModelInfo(c *gc.C) {
 		Owner:                  owner,
 		AgentVersion:           version.MustParse("1.2.3"),
 		ControllerAgentVersion: version.MustParse("1.2.4"),
+		DescriptionVersion:     1,
+		Features:               []string{"storage"},
 	})
 }
 
@@ -224,12 +297,15 @@ func (s *ClientSuite) TestExport(c *gc.C) {
 		stub.AddCall(objType+"."+request, id, arg)
 		out := result.(*params.SerializedModel)
 		*out = params.SerializedModel{
-			Bytes:  []byte("foo"),
+			Size:   3,
+			SHA256: "model-sha",
 			Charms: []string{"cs:foo-1"},
 			Tools: []params.SerializedModelTools{{
 				Version: "2.0.0-trusty-amd64",
 				URI:     "/tools/0",
+				SHA256:  "tools-sha",
 			}},
+			CharmSHA256s: map[string]string{"cs:foo-1": "charm-sha"},
 			Resources: []params.SerializedModelResource{{
 				Application: "fooapp",
 				Name:        "bin",
@@ -279,7 +355,8 @@ func (s *ClientSuite) TestExport(c *gc.C) {
 		{"MigrationMaster.Export", []interface{}{"", nil}},
 	})
 	c.Assert(out, gc.DeepEquals, migration.SerializedModel{
-		Bytes:  []byte("foo"),
+		Size:   3,
+		SHA256: "model-sha",
 		Charms: []string{"cs:foo-1"},
 		Tools: map[version.Binary]string{
 			version.MustParseBinary("2.0.0-trusty-amd64"): "/tools/0",
@@ -337,6 +414,10 @@ func (s *ClientSuite) TestExport(c *gc.C) {
 				},
 			},
 		}},
+		CharmSHA256s: map[string]string{"cs:foo-1": "charm-sha"},
+		ToolsSHA256s: map[version.Binary]string{
+			version.MustParseBinary("2.0.0-trusty-amd64"): "tools-sha",
+		},
 	})
 }
 
@@ -375,6 +456,15 @@ func (s *ClientSuite) TestOpenResource(c *gc.C) {
 	c.Check(doer.url, gc.Equals, "/applications/app/resources/blob")
 }
 
+func (s *ClientSuite) TestOpenSerializedModel(c *gc.C) {
+	client, doer := setupFakeHTTP()
+	r, err := client.OpenSerializedModel()
+	c.Assert(err, jc.ErrorIsNil)
+	checkReader(c, r, "resourceful")
+	c.Check(doer.method, gc.Equals, "GET")
+	c.Check(doer.url, gc.Equals, "/migrate/export")
+}
+
 func (s *ClientSuite) TestReap(c *gc.C) {
 	var stub jujutesting.Stub
 	apiCaller := apitesting.APICallerFunc(func(objType string, version int, id, request string, arg, result interface{}) error {
@@ -524,7 +614,7 @@ func (s *ClientSuite) TestMinionReportsBadFailedTag(c *gc.C) {
 func (s *ClientSuite) TestStreamModelLogs(c *gc.C) {
 	caller := fakeConnector{path: new(string), attrs: &url.Values{}}
 	client := migrationmaster.NewClient(caller, nil)
-	stream, err := client.StreamModelLog(time.Date(2016, 12, 2, 10, 24, 1, 1000000, time.UTC))
+	stream, err := client.StreamModelLog(time.Date(2016, 12, 2, 10, 24, 1, 1000000, time.UTC), migration.LogTransferOptions{})
 	c.Assert(stream, gc.IsNil)
 	c.Assert(err, gc.ErrorMatches, "colonel abrams")
 
@@ -540,6 +630,32 @@ func (s *ClientSuite) TestStreamModelLogs(c *gc.C) {
 	})
 }
 
+func (s *ClientSuite) TestStreamModelLogsFiltered(c *gc.C) {
+	caller := fakeConnector{path: new(string), attrs: &url.Values{}}
+	client := migrationmaster.NewClient(caller, nil)
+	stream, err := client.StreamModelLog(time.Date(2016, 12, 2, 10, 24, 1, 1000000, time.UTC), migration.LogTransferOptions{
+		MaxAge:              time.Hour,
+		Level:               loggo.WARNING,
+		IncludeEntities:     []string{"machine-0", "unit-mysql-*"},
+		ExcludeEntities:     []string{"unit-mysql-1"},
+		MaxRecordsPerSecond: 10,
+	})
+	c.Assert(stream, gc.IsNil)
+	c.Assert(err, gc.ErrorMatches, "colonel abrams")
+
+	// Only the level and entity limits are passed on to the stream.
+	c.Assert(*caller.attrs, gc.DeepEquals, url.Values{
+		"replay":        {"true"},
+		"noTail":        {"true"},
+		"startTime":     {"2016-12-02T10:24:01.001Z"},
+		"level":         {"WARNING"},
+		"includeEntity": {"machine-0", "unit-mysql-*"},
+		"includeModule": nil,
+		"excludeEntity": {"unit-mysql-1"},
+		"excludeModule": nil,
+	})
+}
+
 type fakeConnector struct {
 	base.APICaller
 
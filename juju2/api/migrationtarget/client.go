@@ -4,8 +4,11 @@
 package migrationtarget
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -50,6 +53,8 @@ func (c *Client) Prechecks(model coremigration.ModelInfo) error {
 		OwnerTag:               model.Owner.String(),
 		AgentVersion:           model.AgentVersion,
 		ControllerAgentVersion: model.ControllerAgentVersion,
+		DescriptionVersion:     model.DescriptionVersion,
+		Features:               model.Features,
 	}
 	return c.caller.FacadeCall("Prechecks", args, nil)
 }
@@ -61,6 +66,115 @@ func (c *Client) Import(bytes []byte) error {
 	return c.caller.FacadeCall("Import", serialized, nil)
 }
 
+// modelChunkSize is the largest chunk of a serialized model sent to the
+// target controller in one request by StreamModel.
+var modelChunkSize int64 = 4 << 20
+
+// maxModelChunkAttempts is the number of times StreamModel tries to send
+// a chunk before giving up.
+const maxModelChunkAttempts = 3
+
+// StreamModel sends a serialized model to the target controller in
+// chunks, rather than in a single API call like Import, and then imports
+// it. Chunks the target controller already has from an earlier,
+// interrupted stream of the same model are not sent again. The target
+// controller checks the SHA256 hash of the whole stream before importing
+// the model.
+//
+// Target controllers older than version 2 of the MigrationTarget facade
+// have no endpoint to stream the model to, so it is sent to them with
+// Import.
+func (c *Client) StreamModel(modelUUID string, content io.ReadSeeker) error {
+	if c.caller.BestAPIVersion() < 2 {
+		bytes, err := ioutil.ReadAll(content)
+		if err != nil {
+			return errors.Annotate(err, "reading model")
+		}
+		return errors.Trace(c.Import(bytes))
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, content)
+	if err != nil {
+		return errors.Annotate(err, "reading model")
+	}
+	offset, err := c.resumeModelStream(modelUUID, content, size)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	chunk := make([]byte, modelChunkSize)
+	for attempt := 1; offset < size; {
+		if _, err := content.Seek(offset, io.SeekStart); err != nil {
+			return errors.Trace(err)
+		}
+		n, err := io.ReadFull(content, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return errors.Annotate(err, "reading model")
+		}
+		query := url.Values{"offset": {fmt.Sprint(offset)}}
+		var staged params.StagedModel
+		err = c.modelStreamRequest("PUT", modelUUID, query, bytes.NewReader(chunk[:n]), &staged)
+		if err == nil {
+			offset = staged.Size
+			attempt = 1
+			continue
+		}
+		if attempt == maxModelChunkAttempts {
+			return errors.Annotatef(err, "sending model from offset %d", offset)
+		}
+		attempt++
+		// Some of the chunk may have been staged, or none of it,
+		// so ask where to carry on from.
+		if err := c.modelStreamRequest("GET", modelUUID, nil, nil, &staged); err != nil {
+			return errors.Trace(err)
+		}
+		if staged.Size > size {
+			return errors.Errorf("target controller has %d bytes of a %d byte model", staged.Size, size)
+		}
+		offset = staged.Size
+	}
+
+	query := url.Values{
+		"size":   {fmt.Sprint(size)},
+		"sha256": {fmt.Sprintf("%x", hash.Sum(nil))},
+	}
+	return errors.Trace(c.modelStreamRequest("POST", modelUUID, query, nil, nil))
+}
+
+// resumeModelStream returns the offset to stream the model from. What the
+// target controller has already staged is kept if it is the start of the
+// content, and discarded otherwise.
+func (c *Client) resumeModelStream(modelUUID string, content io.ReadSeeker, size int64) (int64, error) {
+	var staged params.StagedModel
+	if err := c.modelStreamRequest("GET", modelUUID, nil, nil, &staged); err != nil {
+		return 0, errors.Trace(err)
+	}
+	if staged.Size == 0 {
+		return 0, nil
+	}
+	if staged.Size <= size {
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return 0, errors.Trace(err)
+		}
+		hash := sha256.New()
+		if _, err := io.CopyN(hash, content, staged.Size); err != nil {
+			return 0, errors.Annotate(err, "reading model")
+		}
+		if fmt.Sprintf("%x", hash.Sum(nil)) == staged.SHA256 {
+			return staged.Size, nil
+		}
+	}
+	if err := c.modelStreamRequest("DELETE", modelUUID, nil, nil, nil); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return 0, nil
+}
+
+func (c *Client) modelStreamRequest(method, modelUUID string, query url.Values, content io.ReadSeeker, response interface{}) error {
+	apiURI := url.URL{Path: "/migrate/model", RawQuery: query.Encode()}
+	return errors.Trace(c.httpRequest(method, modelUUID, content, apiURI.String(), "application/octet-stream", response))
+}
+
 // Abort removes all data relating to a previously imported model.
 func (c *Client) Abort(modelUUID string) error {
 	args := params.ModelArgs{ModelTag: names.NewModelTag(modelUUID).String()}
@@ -162,7 +276,11 @@ func makeResourceArgs(res resource.Resource) url.Values {
 }
 
 func (c *Client) httpPost(modelUUID string, content io.ReadSeeker, endpoint, contentType string, response interface{}) error {
-	req, err := http.NewRequest("POST", endpoint, nil)
+	return c.httpRequest("POST", modelUUID, content, endpoint, contentType, response)
+}
+
+func (c *Client) httpRequest(method, modelUUID string, content io.ReadSeeker, endpoint, contentType string, response interface{}) error {
+	req, err := http.NewRequest(method, endpoint, nil)
 	if err != nil {
 		return errors.Annotate(err, "cannot create upload request")
 	}
@@ -210,6 +328,30 @@ func (c *Client) LatestLogTime(modelUUID string) (time.Time, error) {
 	return result, nil
 }
 
+// UploadedBinaries returns the charms, tools and resources the target
+// controller already has for the model being imported, with their
+// hashes.
+func (c *Client) UploadedBinaries(modelUUID string) (coremigration.UploadedBinaries, error) {
+	var result params.UploadedMigrationBinaries
+	args := params.ModelArgs{names.NewModelTag(modelUUID).String()}
+	if err := c.caller.FacadeCall("UploadedBinaries", args, &result); err != nil {
+		return coremigration.UploadedBinaries{}, errors.Trace(err)
+	}
+	tools := make(map[version.Binary]string)
+	for vers, hash := range result.Tools {
+		v, err := version.ParseBinary(vers)
+		if err != nil {
+			return coremigration.UploadedBinaries{}, errors.Annotatef(err, "parsing tools version %q", vers)
+		}
+		tools[v] = hash
+	}
+	return coremigration.UploadedBinaries{
+		Charms:    result.Charms,
+		Tools:     tools,
+		Resources: result.Resources,
+	}, nil
+}
+
 // AdoptResources asks the cloud provider to update the controller
 // tags for a model's resources. This prevents the resources from
 // being destroyed if the source controller is destroyed after the
@@ -5,6 +5,7 @@ package migrationtarget_test
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -62,6 +63,8 @@ func (s *ClientSuite) TestPrechecks(c *gc.C) {
 		Name:                   "name",
 		AgentVersion:           vers,
 		ControllerAgentVersion: controllerVers,
+		DescriptionVersion:     1,
+		Features:               []string{"storage", "payloads"},
 	})
 	c.Assert(err, gc.ErrorMatches, "boom")
 
@@ -71,6 +74,8 @@ func (s *ClientSuite) TestPrechecks(c *gc.C) {
 		OwnerTag:               ownerTag.String(),
 		AgentVersion:           vers,
 		ControllerAgentVersion: controllerVers,
+		DescriptionVersion:     1,
+		Features:               []string{"storage", "payloads"},
 	}
 	stub.CheckCalls(c, []jujutesting.StubCall{
 		{"MigrationTarget.Prechecks", []interface{}{"", expectedArg}},
@@ -144,6 +149,34 @@ func (s *ClientSuite) TestLatestLogTimeError(c *gc.C) {
 	s.AssertModelCall(c, stub, names.NewModelTag("fake"), "LatestLogTime", err, true)
 }
 
+func (s *ClientSuite) TestUploadedBinaries(c *gc.C) {
+	var stub jujutesting.Stub
+	apiCaller := apitesting.APICallerFunc(func(objType string, version int, id, request string, arg, result interface{}) error {
+		stub.AddCall(objType+"."+request, id, arg)
+		*(result.(*params.UploadedMigrationBinaries)) = params.UploadedMigrationBinaries{
+			Charms:    map[string]string{"cs:foo-1": "charm-sha256"},
+			Tools:     map[string]string{"2.2.2-xenial-amd64": "tools-sha256"},
+			Resources: map[string]string{"foo/bar": "fingerprint"},
+		}
+		return nil
+	})
+	client := migrationtarget.NewClient(apiCaller)
+	uploaded, err := client.UploadedBinaries("fake")
+
+	s.AssertModelCall(c, &stub, names.NewModelTag("fake"), "UploadedBinaries", err, false)
+	c.Assert(uploaded, jc.DeepEquals, coremigration.UploadedBinaries{
+		Charms:    map[string]string{"cs:foo-1": "charm-sha256"},
+		Tools:     map[version.Binary]string{version.MustParseBinary("2.2.2-xenial-amd64"): "tools-sha256"},
+		Resources: map[string]string{"foo/bar": "fingerprint"},
+	})
+}
+
+func (s *ClientSuite) TestUploadedBinariesError(c *gc.C) {
+	client, stub := s.getClientAndStub(c)
+	_, err := client.UploadedBinaries("fake")
+	s.AssertModelCall(c, stub, names.NewModelTag("fake"), "UploadedBinaries", err, true)
+}
+
 func (s *ClientSuite) TestAdoptResources(c *gc.C) {
 	client, stub := s.getClientAndStub(c)
 	err := client.AdoptResources("the-model")
@@ -254,6 +287,107 @@ func (s *ClientSuite) TestPlaceholderResource(c *gc.C) {
 	c.Assert(doer.body, gc.Equals, "")
 }
 
+func (s *ClientSuite) streamModel(c *gc.C, target *fakeModelTarget, content string) error {
+	s.PatchValue(migrationtarget.ModelChunkSize, int64(4))
+	caller := &fakeHTTPCaller{
+		httpClient: &httprequest.Client{Doer: target},
+		version:    2,
+	}
+	client := migrationtarget.NewClient(caller)
+	return client.StreamModel("uuid", strings.NewReader(content))
+}
+
+func commitQuery(content string) string {
+	return fmt.Sprintf("sha256=%x&size=%d", sha256.Sum256([]byte(content)), len(content))
+}
+
+func (s *ClientSuite) TestStreamModel(c *gc.C) {
+	target := &fakeModelTarget{}
+	err := s.streamModel(c, target, "model: {}")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(target.staged, gc.Equals, "model: {}")
+	c.Assert(target.requests, jc.DeepEquals, []string{
+		"GET ",
+		"PUT offset=0 mode",
+		"PUT offset=4 l: {",
+		"PUT offset=8 }",
+		"POST " + commitQuery("model: {}"),
+	})
+}
+
+func (s *ClientSuite) TestStreamModelResumes(c *gc.C) {
+	target := &fakeModelTarget{staged: "model"}
+	err := s.streamModel(c, target, "model: {}")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(target.staged, gc.Equals, "model: {}")
+	c.Assert(target.requests, jc.DeepEquals, []string{
+		"GET ",
+		"PUT offset=5 : {}",
+		"POST " + commitQuery("model: {}"),
+	})
+}
+
+func (s *ClientSuite) TestStreamModelDiscardsOtherStream(c *gc.C) {
+	target := &fakeModelTarget{staged: "other"}
+	err := s.streamModel(c, target, "model: {}")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(target.staged, gc.Equals, "model: {}")
+	c.Assert(target.requests, jc.DeepEquals, []string{
+		"GET ",
+		"DELETE ",
+		"PUT offset=0 mode",
+		"PUT offset=4 l: {",
+		"PUT offset=8 }",
+		"POST " + commitQuery("model: {}"),
+	})
+}
+
+func (s *ClientSuite) TestStreamModelRetriesChunk(c *gc.C) {
+	// The second chunk is only partly staged before the request fails.
+	target := &fakeModelTarget{failPuts: map[int]int{2: 2}}
+	err := s.streamModel(c, target, "model: {}")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(target.staged, gc.Equals, "model: {}")
+	c.Assert(target.requests, jc.DeepEquals, []string{
+		"GET ",
+		"PUT offset=0 mode",
+		"PUT offset=4 l: {",
+		"GET ",
+		"PUT offset=6  {}",
+		"POST " + commitQuery("model: {}"),
+	})
+}
+
+func (s *ClientSuite) TestStreamModelGivesUp(c *gc.C) {
+	target := &fakeModelTarget{failPuts: map[int]int{2: 0, 3: 0, 4: 0}}
+	err := s.streamModel(c, target, "model: {}")
+	c.Assert(err, gc.ErrorMatches, "sending model from offset 4: .*connection reset")
+	c.Assert(target.staged, gc.Equals, "mode")
+	c.Assert(target.requests, jc.DeepEquals, []string{
+		"GET ",
+		"PUT offset=0 mode",
+		"PUT offset=4 l: {",
+		"GET ",
+		"PUT offset=4 l: {",
+		"GET ",
+		"PUT offset=4 l: {",
+	})
+}
+
+func (s *ClientSuite) TestStreamModelImportsWithoutEndpoint(c *gc.C) {
+	// The API caller is for version 0 of the facade, which predates
+	// the endpoint.
+	client, stub := s.getClientAndStub(c)
+
+	err := client.StreamModel("uuid", strings.NewReader("model: {}"))
+
+	expectedArg := params.SerializedModel{Bytes: []byte("model: {}")}
+	stub.CheckCalls(c, []jujutesting.StubCall{
+		{"MigrationTarget.Import", []interface{}{"", expectedArg}},
+	})
+	c.Assert(err, gc.ErrorMatches, "boom")
+}
+
 func (s *ClientSuite) TestCACert(c *gc.C) {
 	call := func(objType string, version int, id, request string, args, response interface{}) error {
 		c.Check(objType, gc.Equals, "MigrationTarget")
@@ -300,10 +434,11 @@ type fakeHTTPCaller struct {
 	base.APICaller
 	httpClient *httprequest.Client
 	err        error
+	version    int
 }
 
-func (fakeHTTPCaller) BestFacadeVersion(string) int {
-	return 0
+func (c fakeHTTPCaller) BestFacadeVersion(string) int {
+	return c.version
 }
 
 func (c fakeHTTPCaller) HTTPClient() (*httprequest.Client, error) {
@@ -342,3 +477,61 @@ func (d *fakeDoer) Do(req *http.Request) (*http.Response, error) {
 	d.body = string(body)
 	return d.response, nil
 }
+
+// fakeModelTarget stages a streamed model as the target controller's
+// /migrate/model endpoint does, recording each request made.
+type fakeModelTarget struct {
+	staged   string
+	requests []string
+
+	// failPuts holds the number of bytes of the nth PUT request
+	// to stage before failing it.
+	failPuts map[int]int
+	puts     int
+}
+
+func (t *fakeModelTarget) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			panic(err)
+		}
+	}
+	request := req.Method + " " + req.URL.RawQuery
+	if len(body) > 0 {
+		request += " " + string(body)
+	}
+	t.requests = append(t.requests, request)
+
+	var result params.StagedModel
+	switch req.Method {
+	case "GET":
+		result.SHA256 = fmt.Sprintf("%x", sha256.Sum256([]byte(t.staged)))
+	case "PUT":
+		t.puts++
+		if req.URL.Query().Get("offset") != fmt.Sprint(len(t.staged)) {
+			panic("unexpected offset")
+		}
+		if n, ok := t.failPuts[t.puts]; ok {
+			t.staged += string(body[:n])
+			return nil, errors.New("connection reset")
+		}
+		t.staged += string(body)
+	case "DELETE":
+		t.staged = ""
+	}
+	result.Size = int64(len(t.staged))
+	respBody, err := json.Marshal(result)
+	if err != nil {
+		panic(err)
+	}
+	resp := &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewReader(respBody)),
+		Header:     make(http.Header),
+	}
+	resp.Header.Add("Content-Type", "application/json")
+	return resp, nil
+}
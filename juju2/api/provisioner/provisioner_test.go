@@ -412,10 +412,10 @@ func (s *provisionerSuite) TestProvisioningInfo(c *gc.C) {
 	// Add 2 subnets into each space.
 	// Each subnet is in a matching zone (e.g "subnet-#" in "zone#").
 	testing.AddSubnetsWithTemplate(c, s.State, 4, state.SubnetInfo{
-		CIDR:             "10.{{.}}.0.0/16",
-		ProviderId:       "subnet-{{.}}",
-		AvailabilityZone: "zone{{.}}",
-		SpaceName:        "{{if (lt . 2)}}space1{{else}}space2{{end}}",
+		CIDR:              "10.{{.}}.0.0/16",
+		ProviderId:        "subnet-{{.}}",
+		AvailabilityZones: []string{"zone{{.}}"},
+		SpaceName:         "{{if (lt . 2)}}space1{{else}}space2{{end}}",
 	})
 
 	cons := constraints.MustParse("cores=12 mem=8G spaces=^space1,space2")
@@ -160,9 +160,11 @@ func AllFacades() *facade.Registry {
 	reg("MetricsManager", 1, metricsmanager.NewFacade)
 
 	reg("MigrationFlag", 1, migrationflag.NewFacade)
-	reg("MigrationMaster", 1, migrationmaster.NewFacade)
+	reg("MigrationMaster", 1, migrationmaster.NewFacadeV1)
+	reg("MigrationMaster", 2, migrationmaster.NewFacade)
 	reg("MigrationMinion", 1, migrationminion.NewFacade)
 	reg("MigrationTarget", 1, migrationtarget.NewFacade)
+	reg("MigrationTarget", 2, migrationtarget.NewFacade)
 
 	reg("ModelConfig", 1, modelconfig.NewFacade)
 	reg("ModelManager", 2, modelmanager.NewFacadeV2)
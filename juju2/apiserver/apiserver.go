@@ -719,6 +719,17 @@ func (srv *Server) endpoints() []apihttp.Endpoint {
 			stateAuthFunc: httpCtxt.stateForMigrationImporting,
 		},
 	)
+	add("/migrate/model",
+		&modelMigrationStreamHandler{
+			ctxt:       httpCtxt,
+			stagingDir: filepath.Join(srv.dataDir, "migrations"),
+		},
+	)
+	add("/model/:modeluuid/migrate/export",
+		&modelMigrationExportHandler{
+			ctxt: httpCtxt,
+		},
+	)
 	add("/model/:modeluuid/tools/:version",
 		&toolsDownloadHandler{
 			ctxt: httpCtxt,
@@ -89,9 +89,9 @@ func (s *applicationSuite) SetUpTest(c *gc.C) {
 
 	// Add a space in othermodel that applications can be bound to.
 	_, err := s.otherModel.AddSubnet(state.SubnetInfo{
-		ProviderId:       "juju-subnet-1",
-		CIDR:             "4.3.2.0/24",
-		AvailabilityZone: "az1",
+		ProviderId:        "juju-subnet-1",
+		CIDR:              "4.3.2.0/24",
+		AvailabilityZones: []string{"az1"},
 	})
 	c.Assert(err, jc.ErrorIsNil)
 	_, err = s.otherModel.AddSpace("myspace", "juju-space-myspace", []string{"4.3.2.0/24"}, true)
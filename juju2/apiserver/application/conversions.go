@@ -77,7 +77,7 @@ func spaceInfoFromState(space *state.Space) (*network.SpaceInfo, error) {
 			ProviderId:        subnet.ProviderId(),
 			ProviderNetworkId: subnet.ProviderNetworkId(),
 			VLANTag:           subnet.VLANTag(),
-			AvailabilityZones: []string{subnet.AvailabilityZone()},
+			AvailabilityZones: subnet.AvailabilityZones(),
 		}
 		result.Subnets = append(result.Subnets, resultSubnet)
 	}
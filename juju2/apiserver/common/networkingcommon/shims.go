@@ -37,8 +37,7 @@ func (s *subnetShim) ProviderId() network.Id {
 }
 
 func (s *subnetShim) AvailabilityZones() []string {
-	// TODO(dimitern): Add multiple zones to state.Subnet.
-	return []string{s.subnet.AvailabilityZone()}
+	return s.subnet.AvailabilityZones()
 }
 
 func (s *subnetShim) Life() params.Life {
@@ -112,18 +111,12 @@ func (s *stateShim) AllSpaces() ([]BackingSpace, error) {
 }
 
 func (s *stateShim) AddSubnet(info BackingSubnetInfo) (BackingSubnet, error) {
-	// TODO(babbageclunk): we only take the first zone because
-	// state.Subnet currently only stores one.
-	var firstZone string
-	if len(info.AvailabilityZones) > 0 {
-		firstZone = info.AvailabilityZones[0]
-	}
 	_, err := s.st.AddSubnet(state.SubnetInfo{
 		CIDR:              info.CIDR,
 		VLANTag:           info.VLANTag,
 		ProviderId:        info.ProviderId,
 		ProviderNetworkId: info.ProviderNetworkId,
-		AvailabilityZone:  firstZone,
+		AvailabilityZones: info.AvailabilityZones,
 		SpaceName:         info.SpaceName,
 	})
 	return nil, err // Drop the first result, as it's unused.
@@ -432,6 +432,10 @@ func (c *ControllerAPI) initiateOneMigration(spec params.MigrationSpec) (string,
 		Password:      specTarget.Password,
 		Macaroons:     macs,
 	}
+	logTransfer, err := params.LogTransferFromParams(spec.LogTransfer)
+	if err != nil {
+		return "", errors.Annotate(err, "log transfer options")
+	}
 
 	// Check if the migration is likely to succeed.
 	if err := runMigrationPrechecks(hostedState, &targetInfo); err != nil {
@@ -442,6 +446,7 @@ func (c *ControllerAPI) initiateOneMigration(spec params.MigrationSpec) (string,
 	mig, err := hostedState.CreateMigration(state.MigrationSpec{
 		InitiatedBy: c.apiUser,
 		TargetInfo:  targetInfo,
+		LogTransfer: logTransfer,
 	})
 	if err != nil {
 		return "", errors.Trace(err)
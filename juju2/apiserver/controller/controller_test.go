@@ -23,6 +23,7 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
 	apiservertesting "github.com/juju/1.25-upgrade/juju2/apiserver/testing"
 	"github.com/juju/1.25-upgrade/juju2/cloud"
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/environs"
 	"github.com/juju/1.25-upgrade/juju2/environs/config"
 	"github.com/juju/1.25-upgrade/juju2/permission"
@@ -465,6 +466,71 @@ func (s *controllerSuite) TestInitiateMigrationSpecError(c *gc.C) {
 	c.Check(result.Error, gc.ErrorMatches, "controller tag: .+ is not a valid tag")
 }
 
+func (s *controllerSuite) TestInitiateMigrationLogTransfer(c *gc.C) {
+	st := s.Factory.MakeModel(c, nil)
+	defer st.Close()
+	controller.SetPrecheckResult(s, nil)
+
+	args := params.InitiateMigrationArgs{
+		Specs: []params.MigrationSpec{{
+			ModelTag: st.ModelTag().String(),
+			TargetInfo: params.MigrationTargetInfo{
+				ControllerTag: randomControllerTag(),
+				Addrs:         []string{"1.1.1.1:1111"},
+				CACert:        "cert",
+				AuthTag:       names.NewUserTag("admin").String(),
+				Password:      "secret",
+			},
+			LogTransfer: params.MigrationLogTransferOptions{
+				MaxAge:            time.Hour,
+				Level:             "WARNING",
+				ExcludeEntities:   []string{"unit-noisy-*"},
+				MaxBytesPerSecond: 1024,
+			},
+		}},
+	}
+	out, err := s.controller.InitiateMigration(args)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out.Results, gc.HasLen, 1)
+	c.Assert(out.Results[0].Error, gc.IsNil)
+
+	mig, err := st.LatestMigration()
+	c.Assert(err, jc.ErrorIsNil)
+	logTransfer, err := mig.LogTransferOptions()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(logTransfer, jc.DeepEquals, coremigration.LogTransferOptions{
+		MaxAge:            time.Hour,
+		Level:             loggo.WARNING,
+		ExcludeEntities:   []string{"unit-noisy-*"},
+		MaxBytesPerSecond: 1024,
+	})
+}
+
+func (s *controllerSuite) TestInitiateMigrationBadLogLevel(c *gc.C) {
+	st := s.Factory.MakeModel(c, nil)
+	defer st.Close()
+
+	args := params.InitiateMigrationArgs{
+		Specs: []params.MigrationSpec{{
+			ModelTag: st.ModelTag().String(),
+			TargetInfo: params.MigrationTargetInfo{
+				ControllerTag: randomControllerTag(),
+				Addrs:         []string{"1.1.1.1:1111"},
+				CACert:        "cert",
+				AuthTag:       names.NewUserTag("admin").String(),
+				Password:      "secret",
+			},
+			LogTransfer: params.MigrationLogTransferOptions{
+				Level: "LOUD",
+			},
+		}},
+	}
+	out, err := s.controller.InitiateMigration(args)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out.Results, gc.HasLen, 1)
+	c.Check(out.Results[0].Error, gc.ErrorMatches, `log transfer options: log level "LOUD" not valid`)
+}
+
 func (s *controllerSuite) TestInitiateMigrationPartialFailure(c *gc.C) {
 	st := s.Factory.MakeModel(c, nil)
 	defer st.Close()
@@ -116,30 +116,38 @@ func checkPermissions(tag names.Tag, acceptFunc common.GetAuthFunc) (bool, error
 	return false, errors.NotValidf("tag kind %v", tag.Kind())
 }
 
-// stateForMigration asserts that the incoming connection is from a user that
-// has admin permissions on the controller model. The method also gets the
-// model uuid for the model being migrated from a request header, and returns
-// the state instance for that model.
-func (ctxt *httpContext) stateForMigration(
-	r *http.Request,
-	requiredMode state.MigrationMode,
-) (st *state.State, returnReleaser state.StatePoolReleaser, err error) {
-	var user state.Entity
+// checkControllerAdmin asserts that the incoming connection is from a user
+// that has admin permissions on the controller model.
+func (ctxt *httpContext) checkControllerAdmin(r *http.Request) error {
 	st, releaser, user, err := ctxt.stateAndEntityForRequestAuthenticatedUser(r)
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 	defer releaser()
 
 	if !st.IsController() {
-		return nil, nil, errors.BadRequestf("model is not controller model")
+		return errors.BadRequestf("model is not controller model")
 	}
 	admin, err := st.IsControllerAdmin(user.Tag().(names.UserTag))
 	if err != nil {
-		return nil, nil, errors.Trace(err)
+		return errors.Trace(err)
 	}
 	if !admin {
-		return nil, nil, errors.Unauthorizedf("not a controller admin")
+		return errors.Unauthorizedf("not a controller admin")
+	}
+	return nil
+}
+
+// stateForMigration asserts that the incoming connection is from a user that
+// has admin permissions on the controller model. The method also gets the
+// model uuid for the model being migrated from a request header, and returns
+// the state instance for that model.
+func (ctxt *httpContext) stateForMigration(
+	r *http.Request,
+	requiredMode state.MigrationMode,
+) (st *state.State, returnReleaser state.StatePoolReleaser, err error) {
+	if err := ctxt.checkControllerAdmin(r); err != nil {
+		return nil, nil, err
 	}
 
 	modelUUID, err := validateModelUUID(validateArgs{
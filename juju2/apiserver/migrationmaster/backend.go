@@ -7,6 +7,7 @@ import (
 	"github.com/juju/version"
 	"gopkg.in/juju/names.v2"
 
+	"github.com/juju/1.25-upgrade/juju2/controller"
 	"github.com/juju/1.25-upgrade/juju2/migration"
 	"github.com/juju/1.25-upgrade/juju2/state"
 )
@@ -21,6 +22,11 @@ type Backend interface {
 	ModelOwner() (names.UserTag, error)
 	AgentVersion() (version.Number, error)
 	RemoveExportingModelDocs() error
+	CharmSHA256(curl string) (string, error)
+	ControllerConfig() (controller.Config, error)
+	MigrationEntityCounts() (state.MigrationEntityCounts, error)
+	StageSerializedModel([]byte) error
+	RemoveSerializedModel() error
 
 	migration.StateExporter
 }
@@ -4,7 +4,9 @@
 package migrationmaster
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 
 	"github.com/juju/description"
 	"github.com/juju/errors"
@@ -19,11 +21,14 @@ import (
 	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/migration"
 	"github.com/juju/1.25-upgrade/juju2/state/watcher"
+	jujuversion "github.com/juju/1.25-upgrade/juju2/version"
 )
 
-// API implements the API required for the model migration
-// master worker.
+// API implements version 2 of the API required for the model
+// migration master worker.
 type API struct {
+	*common.ControllerConfigAPI
+
 	backend         Backend
 	precheckBackend migration.PrecheckBackend
 	authorizer      facade.Authorizer
@@ -42,13 +47,37 @@ func NewAPI(
 		return nil, common.ErrPerm
 	}
 	return &API{
-		backend:         backend,
-		precheckBackend: precheckBackend,
-		authorizer:      authorizer,
-		resources:       resources,
+		ControllerConfigAPI: common.NewControllerConfig(backend),
+		backend:             backend,
+		precheckBackend:     precheckBackend,
+		authorizer:          authorizer,
+		resources:           resources,
 	}, nil
 }
 
+// APIV1 implements version 1 of the API required for the model
+// migration master worker. Its Export returns the serialized model
+// rather than staging it, and it doesn't have the AddImportProgress or
+// ControllerConfig methods.
+type APIV1 struct {
+	*API
+}
+
+// NewAPIV1 creates a new version 1 API server endpoint for the model
+// migration master worker.
+func NewAPIV1(
+	backend Backend,
+	precheckBackend migration.PrecheckBackend,
+	resources facade.Resources,
+	authorizer facade.Authorizer,
+) (*APIV1, error) {
+	api, err := NewAPI(backend, precheckBackend, resources, authorizer)
+	if err != nil {
+		return nil, err
+	}
+	return &APIV1{api}, nil
+}
+
 // Watch starts watching for an active migration for the model
 // associated with the API connection. The returned id should be used
 // with the NotifyWatcher facade to receive events.
@@ -77,6 +106,10 @@ func (api *API) MigrationStatus() (params.MasterMigrationStatus, error) {
 	if err != nil {
 		return empty, errors.Annotate(err, "retrieving target info")
 	}
+	logTransfer, err := mig.LogTransferOptions()
+	if err != nil {
+		return empty, errors.Annotate(err, "retrieving log transfer options")
+	}
 	phase, err := mig.Phase()
 	if err != nil {
 		return empty, errors.Annotate(err, "retrieving phase")
@@ -96,10 +129,12 @@ func (api *API) MigrationStatus() (params.MasterMigrationStatus, error) {
 				Password:      target.Password,
 				Macaroons:     string(macsJSON),
 			},
+			LogTransfer: params.LogTransferToParams(logTransfer),
 		},
 		MigrationId:      mig.Id(),
 		Phase:            phase.String(),
 		PhaseChangedTime: mig.PhaseChangedTime(),
+		ImportProgress:   mig.ImportProgress(),
 	}, nil
 }
 
@@ -123,11 +158,24 @@ func (api *API) ModelInfo() (params.MigrationModelInfo, error) {
 		return empty, errors.Annotate(err, "retrieving agent version")
 	}
 
+	// The target checks the model's contents against what it can
+	// import from this controller. The features are found from entity
+	// counts, as exporting the whole model here would be expensive,
+	// and the model is exported in the description version this
+	// controller writes.
+	counts, err := api.backend.MigrationEntityCounts()
+	if err != nil {
+		return empty, errors.Annotate(err, "counting model entities")
+	}
+
 	return params.MigrationModelInfo{
-		UUID:         api.backend.ModelUUID(),
-		Name:         name,
-		OwnerTag:     owner.String(),
-		AgentVersion: vers,
+		UUID:                   api.backend.ModelUUID(),
+		Name:                   name,
+		OwnerTag:               owner.String(),
+		AgentVersion:           vers,
+		ControllerAgentVersion: jujuversion.Current,
+		DescriptionVersion:     migration.CurrentDescriptionVersion,
+		Features:               migration.EntityFeatures(counts),
 	}, nil
 }
 
@@ -167,32 +215,90 @@ func (api *API) SetStatusMessage(args params.SetMigrationStatusMessageArgs) erro
 	return errors.Annotate(err, "failed to set status message")
 }
 
-// Export serializes the model associated with the API connection.
+// AddImportProgress records steps of the IMPORT phase of the active
+// model migration as completed, so that a restarted migrationmaster
+// need not repeat them.
+func (api *API) AddImportProgress(args params.AddMigrationImportProgressArgs) error {
+	mig, err := api.backend.LatestMigration()
+	if err != nil {
+		return errors.Annotate(err, "could not get migration")
+	}
+	err = mig.AddImportProgress(args.Steps...)
+	return errors.Annotate(err, "failed to add import progress")
+}
+
+// Export serializes the model associated with the API connection. The
+// serialized model is staged to be downloaded from the migrate/export
+// endpoint rather than returned, and only its size and hash are
+// included in the result.
 func (api *API) Export() (params.SerializedModel, error) {
+	serialized, bytes, err := api.export()
+	if err != nil {
+		return serialized, err
+	}
+	if err := api.backend.StageSerializedModel(bytes); err != nil {
+		return serialized, errors.Trace(err)
+	}
+	serialized.Size = int64(len(bytes))
+	serialized.SHA256 = fmt.Sprintf("%x", sha256.Sum256(bytes))
+	return serialized, nil
+}
+
+// Export serializes the model associated with the API connection,
+// returning it in the result.
+func (api *APIV1) Export() (params.SerializedModel, error) {
+	serialized, bytes, err := api.export()
+	if err != nil {
+		return serialized, err
+	}
+	serialized.Bytes = bytes
+	return serialized, nil
+}
+
+// export serializes the model associated with the API connection,
+// returning it along with a result describing the binaries it uses.
+func (api *API) export() (params.SerializedModel, []byte, error) {
 	var serialized params.SerializedModel
 
 	model, err := api.backend.Export()
 	if err != nil {
-		return serialized, err
+		return serialized, nil, err
 	}
 
 	bytes, err := description.Serialize(model)
 	if err != nil {
-		return serialized, err
+		return serialized, nil, err
 	}
-	serialized.Bytes = bytes
 	serialized.Charms = getUsedCharms(model)
 	serialized.Tools = getUsedTools(model)
 	serialized.Resources = getUsedResources(model)
-	return serialized, nil
+	serialized.CharmSHA256s, err = getCharmSHA256s(api.backend, serialized.Charms)
+	if err != nil {
+		return serialized, nil, errors.Trace(err)
+	}
+	return serialized, bytes, nil
 }
 
 // Reap removes all documents for the model associated with the API
-// connection.
+// connection, along with the serialized model staged by Export.
 func (api *API) Reap() error {
+	if err := api.backend.RemoveSerializedModel(); err != nil {
+		return errors.Trace(err)
+	}
 	return api.backend.RemoveExportingModelDocs()
 }
 
+// Mask the methods added in version 2 from the V1 API. The API
+// reflection code in rpc/rpcreflect/type.go:newMethod skips 2-argument
+// methods, so this removes the method as far as the RPC machinery is
+// concerned.
+
+// AddImportProgress isn't on the V1 API.
+func (api *APIV1) AddImportProgress(_, _ struct{}) {}
+
+// ControllerConfig isn't on the V1 API.
+func (api *APIV1) ControllerConfig(_, _ struct{}) {}
+
 // WatchMinionReports sets up a watcher which reports when a report
 // for a migration minion has arrived.
 func (api *API) WatchMinionReports() params.NotifyWatchResult {
@@ -273,8 +379,9 @@ func getUsedCharms(model description.Model) []string {
 }
 
 func getUsedTools(model description.Model) []params.SerializedModelTools {
-	// Iterate through the model for all tools, and make a map of them.
-	usedVersions := make(map[version.Binary]bool)
+	// Iterate through the model for all tools, and make a map of them
+	// to their SHA256 hashes.
+	usedVersions := make(map[version.Binary]string)
 	// It is most likely that the preconditions will limit the number of
 	// tools versions in use, but that is not relied on here.
 	for _, machine := range model.Machines() {
@@ -283,29 +390,46 @@ func getUsedTools(model description.Model) []params.SerializedModelTools {
 
 	for _, application := range model.Applications() {
 		for _, unit := range application.Units() {
-			tools := unit.Tools()
-			usedVersions[tools.Version()] = true
+			addToolsVersion(unit.Tools(), usedVersions)
 		}
 	}
 
 	out := make([]params.SerializedModelTools, 0, len(usedVersions))
-	for v := range usedVersions {
+	for v, sha256 := range usedVersions {
 		out = append(out, params.SerializedModelTools{
 			Version: v.String(),
 			URI:     common.ToolsURL("", v),
+			SHA256:  sha256,
 		})
 	}
 	return out
 }
 
-func addToolsVersionForMachine(machine description.Machine, usedVersions map[version.Binary]bool) {
-	tools := machine.Tools()
-	usedVersions[tools.Version()] = true
+func addToolsVersion(tools description.AgentTools, usedVersions map[version.Binary]string) {
+	if sha256 := usedVersions[tools.Version()]; sha256 == "" {
+		usedVersions[tools.Version()] = tools.SHA256()
+	}
+}
+
+func addToolsVersionForMachine(machine description.Machine, usedVersions map[version.Binary]string) {
+	addToolsVersion(machine.Tools(), usedVersions)
 	for _, container := range machine.Containers() {
 		addToolsVersionForMachine(container, usedVersions)
 	}
 }
 
+func getCharmSHA256s(backend Backend, charms []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, curl := range charms {
+		sha256, err := backend.CharmSHA256(curl)
+		if err != nil {
+			return nil, errors.Annotatef(err, "getting hash of charm %s", curl)
+		}
+		out[curl] = sha256
+	}
+	return out, nil
+}
+
 func getUsedResources(model description.Model) []params.SerializedModelResource {
 	var out []params.SerializedModelResource
 	for _, app := range model.Applications() {
@@ -4,11 +4,13 @@
 package migrationmaster_test
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"time"
 
 	"github.com/juju/description"
 	"github.com/juju/errors"
+	"github.com/juju/loggo"
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
@@ -21,6 +23,7 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/apiserver/migrationmaster"
 	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
 	apiservertesting "github.com/juju/1.25-upgrade/juju2/apiserver/testing"
+	"github.com/juju/1.25-upgrade/juju2/controller"
 	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/migration"
 	"github.com/juju/1.25-upgrade/juju2/state"
@@ -92,6 +95,13 @@ func (s *Suite) TestMigrationStatus(c *gc.C) {
 	var expectedMacaroons = `
 [[{"caveats":[],"location":"location","identifier":"id","signature":"a9802bf274262733d6283a69c62805b5668dbf475bcd7edc25a962833f7c2cba"}]]`[1:]
 
+	s.backend.migration.importProgress = []string{"model"}
+	s.backend.migration.logTransfer = coremigration.LogTransferOptions{
+		MaxAge:            time.Hour,
+		Level:             loggo.INFO,
+		IncludeEntities:   []string{"machine-0"},
+		MaxBytesPerSecond: 4096,
+	}
 	api := s.mustMakeAPI(c)
 	status, err := api.MigrationStatus()
 	c.Assert(err, jc.ErrorIsNil)
@@ -107,10 +117,17 @@ func (s *Suite) TestMigrationStatus(c *gc.C) {
 				Password:      "secret",
 				Macaroons:     expectedMacaroons,
 			},
+			LogTransfer: params.MigrationLogTransferOptions{
+				MaxAge:            time.Hour,
+				Level:             "INFO",
+				IncludeEntities:   []string{"machine-0"},
+				MaxBytesPerSecond: 4096,
+			},
 		},
 		MigrationId:      "id",
 		Phase:            "IMPORT",
 		PhaseChangedTime: s.backend.migration.PhaseChangedTime(),
+		ImportProgress:   []string{"model"},
 	})
 }
 
@@ -122,6 +139,24 @@ func (s *Suite) TestModelInfo(c *gc.C) {
 	c.Assert(model.Name, gc.Equals, "model-name")
 	c.Assert(model.OwnerTag, gc.Equals, names.NewUserTag("owner").String())
 	c.Assert(model.AgentVersion, gc.Equals, version.MustParse("1.2.3"))
+	c.Assert(model.ControllerAgentVersion, gc.Equals, jujuversion.Current)
+	c.Assert(model.DescriptionVersion, gc.Equals, migration.CurrentDescriptionVersion)
+	c.Assert(model.Features, gc.HasLen, 0)
+}
+
+func (s *Suite) TestModelInfoFeatures(c *gc.C) {
+	s.backend.counts = state.MigrationEntityCounts{
+		RemoteApplications: 1,
+	}
+
+	api := s.mustMakeAPI(c)
+	model, err := api.ModelInfo()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(model.Features, jc.DeepEquals, []string{
+		migration.FeatureRemoteApplications,
+	})
+	// The model is not exported to find its features.
+	s.backend.stub.CheckCallNames(c, "MigrationEntityCounts")
 }
 
 func (s *Suite) TestSetPhase(c *gc.C) {
@@ -180,6 +215,34 @@ func (s *Suite) TestSetStatusMessageError(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, "failed to set status message: blam")
 }
 
+func (s *Suite) TestControllerConfig(c *gc.C) {
+	api := s.mustMakeAPI(c)
+
+	result, err := api.ControllerConfig()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result.Config, jc.DeepEquals, params.ControllerConfig{
+		"migration-webhook-url": "https://example.com/hook",
+	})
+}
+
+func (s *Suite) TestAddImportProgress(c *gc.C) {
+	api := s.mustMakeAPI(c)
+
+	err := api.AddImportProgress(params.AddMigrationImportProgressArgs{
+		Steps: []string{"model", "charm cs:foo-1"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.backend.migration.importProgress, jc.DeepEquals, []string{"model", "charm cs:foo-1"})
+}
+
+func (s *Suite) TestAddImportProgressError(c *gc.C) {
+	s.backend.migration.addProgressErr = errors.New("blam")
+	api := s.mustMakeAPI(c)
+
+	err := api.AddImportProgress(params.AddMigrationImportProgressArgs{Steps: []string{"model"}})
+	c.Assert(err, gc.ErrorMatches, "failed to add import progress: blam")
+}
+
 func (s *Suite) TestPrechecks(c *gc.C) {
 	api := s.mustMakeAPI(c)
 	err := api.Prechecks()
@@ -197,6 +260,7 @@ func (s *Suite) TestExport(c *gc.C) {
 	m := s.model.AddMachine(description.MachineArgs{Id: names.NewMachineTag("9")})
 	m.SetTools(description.AgentToolsArgs{
 		Version: version.MustParseBinary(tools1),
+		SHA256:  "tools1-sha",
 	})
 
 	res := app.AddResource(description.ResourceArgs{"bin"})
@@ -228,6 +292,7 @@ func (s *Suite) TestExport(c *gc.C) {
 	})
 	unit.SetTools(description.AgentToolsArgs{
 		Version: version.MustParseBinary(tools0),
+		SHA256:  "tools0-sha",
 	})
 	unitRes := unit.AddResource(description.UnitResourceArgs{
 		Name: "bin",
@@ -251,13 +316,20 @@ func (s *Suite) TestExport(c *gc.C) {
 
 	// We don't want to tie this test the serialisation output (that's
 	// tested elsewhere). Just check that at least one thing we expect
-	// is in the serialised output.
-	c.Check(string(serialized.Bytes), jc.Contains, jujuversion.Current.String())
+	// is in the staged serialised output, and that it is described
+	// rather than returned.
+	c.Check(string(s.backend.staged), jc.Contains, jujuversion.Current.String())
+	c.Check(serialized.Bytes, gc.HasLen, 0)
+	c.Check(serialized.Size, gc.Equals, int64(len(s.backend.staged)))
+	c.Check(serialized.SHA256, gc.Equals, fmt.Sprintf("%x", sha256.Sum256(s.backend.staged)))
 
 	c.Check(serialized.Charms, gc.DeepEquals, []string{"cs:foo-0"})
 	c.Check(serialized.Tools, jc.SameContents, []params.SerializedModelTools{
-		{tools0, "/tools/" + tools0},
-		{tools1, "/tools/" + tools1},
+		{tools0, "/tools/" + tools0, "tools0-sha"},
+		{tools1, "/tools/" + tools1, "tools1-sha"},
+	})
+	c.Check(serialized.CharmSHA256s, gc.DeepEquals, map[string]string{
+		"cs:foo-0": "sha256 of cs:foo-0",
 	})
 	c.Check(serialized.Resources, gc.DeepEquals, []params.SerializedModelResource{{
 		Application: "foo",
@@ -301,12 +373,33 @@ func (s *Suite) TestExport(c *gc.C) {
 
 }
 
+func (s *Suite) TestExportV1(c *gc.C) {
+	s.model.AddApplication(description.ApplicationArgs{
+		Tag:      names.NewApplicationTag("foo"),
+		CharmURL: "cs:foo-0",
+	})
+	api, err := migrationmaster.NewAPIV1(s.backend, new(failingPrecheckBackend),
+		s.resources, s.authorizer)
+	c.Assert(err, jc.ErrorIsNil)
+
+	serialized, err := api.Export()
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Version 1 returns the serialised model rather than staging it.
+	c.Check(string(serialized.Bytes), jc.Contains, jujuversion.Current.String())
+	c.Check(s.backend.staged, gc.IsNil)
+	c.Check(serialized.Size, gc.Equals, int64(0))
+	c.Check(serialized.SHA256, gc.Equals, "")
+	c.Check(serialized.Charms, gc.DeepEquals, []string{"cs:foo-0"})
+}
+
 func (s *Suite) TestReap(c *gc.C) {
 	api := s.mustMakeAPI(c)
 
 	err := api.Reap()
 	c.Check(err, jc.ErrorIsNil)
 	s.backend.stub.CheckCalls(c, []testing.StubCall{
+		{"RemoveSerializedModel", []interface{}{}},
 		{"RemoveExportingModelDocs", []interface{}{}},
 	})
 }
@@ -406,6 +499,8 @@ type stubBackend struct {
 	removeErr error
 	migration *stubMigration
 	model     description.Model
+	staged    []byte
+	counts    state.MigrationEntityCounts
 }
 
 func (b *stubBackend) WatchForMigration() state.NotifyWatcher {
@@ -442,11 +537,38 @@ func (b *stubBackend) RemoveExportingModelDocs() error {
 	return b.removeErr
 }
 
+func (b *stubBackend) ControllerConfig() (controller.Config, error) {
+	return controller.Config{
+		"migration-webhook-url": "https://example.com/hook",
+	}, nil
+}
+
+func (b *stubBackend) CharmSHA256(curl string) (string, error) {
+	b.stub.AddCall("CharmSHA256", curl)
+	return "sha256 of " + curl, nil
+}
+
 func (b *stubBackend) Export() (description.Model, error) {
 	b.stub.AddCall("Export")
 	return b.model, nil
 }
 
+func (b *stubBackend) MigrationEntityCounts() (state.MigrationEntityCounts, error) {
+	b.stub.AddCall("MigrationEntityCounts")
+	return b.counts, nil
+}
+
+func (b *stubBackend) StageSerializedModel(serialized []byte) error {
+	b.stub.AddCall("StageSerializedModel")
+	b.staged = serialized
+	return nil
+}
+
+func (b *stubBackend) RemoveSerializedModel() error {
+	b.stub.AddCall("RemoveSerializedModel")
+	return nil
+}
+
 type stubMigration struct {
 	state.ModelMigration
 
@@ -455,6 +577,9 @@ type stubMigration struct {
 	phaseSet        coremigration.Phase
 	setMessageErr   error
 	messageSet      string
+	importProgress  []string
+	addProgressErr  error
+	logTransfer     coremigration.LogTransferOptions
 	minionReports   *state.MinionReports
 	externalControl bool
 }
@@ -490,6 +615,10 @@ func (m *stubMigration) TargetInfo() (*coremigration.TargetInfo, error) {
 	}, nil
 }
 
+func (m *stubMigration) LogTransferOptions() (coremigration.LogTransferOptions, error) {
+	return m.logTransfer, nil
+}
+
 func (m *stubMigration) SetPhase(phase coremigration.Phase) error {
 	if m.setPhaseErr != nil {
 		return m.setPhaseErr
@@ -506,6 +635,18 @@ func (m *stubMigration) SetStatusMessage(message string) error {
 	return nil
 }
 
+func (m *stubMigration) ImportProgress() []string {
+	return m.importProgress
+}
+
+func (m *stubMigration) AddImportProgress(steps ...string) error {
+	if m.addProgressErr != nil {
+		return m.addProgressErr
+	}
+	m.importProgress = append(m.importProgress, steps...)
+	return nil
+}
+
 func (m *stubMigration) WatchMinionReports() (state.NotifyWatcher, error) {
 	m.stub.AddCall("ModelMigration.WatchMinionReports")
 	return apiservertesting.NewFakeNotifyWatcher(), nil
@@ -6,6 +6,7 @@ package migrationmaster
 import (
 	"github.com/juju/errors"
 	"github.com/juju/version"
+	"gopkg.in/juju/charm.v6-unstable"
 	"gopkg.in/juju/names.v2"
 
 	"github.com/juju/1.25-upgrade/juju2/apiserver/facade"
@@ -27,6 +28,20 @@ func NewFacade(
 	return NewAPI(&backendShim{st}, precheckBackend, resources, authorizer)
 }
 
+// NewFacadeV1 exists to provide the required signature for version 1
+// API registration, converting st to backend.
+func NewFacadeV1(
+	st *state.State,
+	resources facade.Resources,
+	authorizer facade.Authorizer,
+) (*APIV1, error) {
+	precheckBackend, err := migration.PrecheckShim(st)
+	if err != nil {
+		return nil, errors.Annotate(err, "creating precheck backend")
+	}
+	return NewAPIV1(&backendShim{st}, precheckBackend, resources, authorizer)
+}
+
 // backendShim wraps a *state.State to implement Backend. It is
 // untested, but is simple enough to be verified by inspection.
 type backendShim struct {
@@ -63,3 +78,26 @@ func (s *backendShim) AgentVersion() (version.Number, error) {
 	}
 	return vers, nil
 }
+
+// CharmSHA256 implements Backend.
+func (s *backendShim) CharmSHA256(curl string) (string, error) {
+	url, err := charm.ParseURL(curl)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	ch, err := s.Charm(url)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return ch.BundleSha256(), nil
+}
+
+// StageSerializedModel implements Backend.
+func (s *backendShim) StageSerializedModel(serialized []byte) error {
+	return migration.StageSerializedModel(s.State, serialized)
+}
+
+// RemoveSerializedModel implements Backend.
+func (s *backendShim) RemoveSerializedModel() error {
+	return migration.RemoveSerializedModel(s.State)
+}
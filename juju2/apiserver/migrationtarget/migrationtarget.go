@@ -95,6 +95,8 @@ func (api *API) Prechecks(model params.MigrationModelInfo) error {
 			Owner:                  ownerTag,
 			AgentVersion:           model.AgentVersion,
 			ControllerAgentVersion: model.ControllerAgentVersion,
+			DescriptionVersion:     model.DescriptionVersion,
+			Features:               model.Features,
 		},
 	)
 }
@@ -170,6 +172,70 @@ func (api *API) Activate(args params.ModelArgs) error {
 	return model.SetMigrationMode(state.MigrationModeNone)
 }
 
+// UploadedBinaries reports the charms, tools and resources that the
+// controller already has for a model being imported, along with their
+// hashes. A migrationmaster resuming an interrupted binary upload uses
+// this to skip the binaries that made it across the first time.
+func (api *API) UploadedBinaries(args params.ModelArgs) (params.UploadedMigrationBinaries, error) {
+	var result params.UploadedMigrationBinaries
+	model, err := api.getImportingModel(args)
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	st, release, err := api.pool.Get(model.UUID())
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	defer release()
+
+	result.Charms = make(map[string]string)
+	charms, err := st.AllCharms()
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	for _, ch := range charms {
+		if ch.IsUploaded() && !ch.IsPlaceholder() {
+			result.Charms[ch.URL().String()] = ch.BundleSha256()
+		}
+	}
+
+	result.Tools = make(map[string]string)
+	toolsStorage, err := st.ToolsStorage()
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	defer toolsStorage.Close()
+	allTools, err := toolsStorage.AllMetadata()
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	for _, tools := range allTools {
+		result.Tools[tools.Version] = tools.SHA256
+	}
+
+	result.Resources = make(map[string]string)
+	resources, err := st.Resources()
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	applications, err := st.AllApplications()
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+	for _, app := range applications {
+		appResources, err := resources.ListResources(app.Name())
+		if err != nil {
+			return result, errors.Trace(err)
+		}
+		for _, res := range appResources.Resources {
+			if !res.IsPlaceholder() {
+				result.Resources[app.Name()+"/"+res.Name] = res.Fingerprint.Hex()
+			}
+		}
+	}
+	return result, nil
+}
+
 // LatestLogTime returns the time of the most recent log record
 // received by the logtransfer endpoint. This can be used as the start
 // point for streaming logs from the source if the transfer was
@@ -4,6 +4,7 @@
 package migrationtarget_test
 
 import (
+	"strings"
 	"time"
 
 	"github.com/juju/description"
@@ -24,9 +25,11 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/environs"
 	"github.com/juju/1.25-upgrade/juju2/provider/dummy"
 	"github.com/juju/1.25-upgrade/juju2/state"
+	"github.com/juju/1.25-upgrade/juju2/state/binarystorage"
 	"github.com/juju/1.25-upgrade/juju2/state/stateenvirons"
 	statetesting "github.com/juju/1.25-upgrade/juju2/state/testing"
 	jujutesting "github.com/juju/1.25-upgrade/juju2/testing"
+	"github.com/juju/1.25-upgrade/juju2/testing/factory"
 )
 
 type Suite struct {
@@ -100,6 +103,21 @@ func (s *Suite) TestPrechecks(c *gc.C) {
 	c.Assert(err, jc.ErrorIsNil)
 }
 
+func (s *Suite) TestPrechecksUnsupportedFeature(c *gc.C) {
+	api := s.mustNewAPI(c)
+	args := params.MigrationModelInfo{
+		UUID:                   "uuid",
+		Name:                   "some-model",
+		OwnerTag:               names.NewUserTag("someone").String(),
+		AgentVersion:           s.controllerVersion(c),
+		ControllerAgentVersion: s.controllerVersion(c),
+		DescriptionVersion:     1,
+		Features:               []string{"storage", "cross-model-relations"},
+	}
+	err := api.Prechecks(args)
+	c.Assert(err, gc.ErrorMatches, "model uses cross-model-relations, which cannot be migrated: .*")
+}
+
 func (s *Suite) TestCACert(c *gc.C) {
 	api := s.mustNewAPI(c)
 	r := api.CACert()
@@ -204,6 +222,44 @@ func (s *Suite) TestActivateNotImportingEnv(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, `migration mode for the model is not importing`)
 }
 
+func (s *Suite) TestUploadedBinaries(c *gc.C) {
+	api, ctx, err := s.newAPI(nil)
+	c.Assert(err, jc.ErrorIsNil)
+	defer ctx.StatePool().Close()
+	tag := s.importModel(c, api)
+
+	st, err := s.State.ForModel(tag)
+	c.Assert(err, jc.ErrorIsNil)
+	defer st.Close()
+	ch := factory.NewFactory(st).MakeCharm(c, nil)
+	toolsStorage, err := st.ToolsStorage()
+	c.Assert(err, jc.ErrorIsNil)
+	defer toolsStorage.Close()
+	err = toolsStorage.Add(strings.NewReader("tools"), binarystorage.Metadata{
+		Version: "2.2.2-xenial-amd64",
+		Size:    5,
+		SHA256:  "tools-sha256",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	uploaded, err := api.UploadedBinaries(params.ModelArgs{ModelTag: tag.String()})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(uploaded, jc.DeepEquals, params.UploadedMigrationBinaries{
+		Charms:    map[string]string{ch.URL().String(): ch.BundleSha256()},
+		Tools:     map[string]string{"2.2.2-xenial-amd64": "tools-sha256"},
+		Resources: map[string]string{},
+	})
+}
+
+func (s *Suite) TestUploadedBinariesNotImportingEnv(c *gc.C) {
+	st := s.Factory.MakeModel(c, nil)
+	defer st.Close()
+
+	api := s.mustNewAPI(c)
+	_, err := api.UploadedBinaries(params.ModelArgs{ModelTag: st.ModelTag().String()})
+	c.Assert(err, gc.ErrorMatches, `migration mode for the model is not importing`)
+}
+
 func (s *Suite) TestLatestLogTime(c *gc.C) {
 	st := s.Factory.MakeModel(c, nil)
 	defer st.Close()
@@ -0,0 +1,224 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package apiserver
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/apiserver/common"
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/migration"
+	"github.com/juju/1.25-upgrade/juju2/state"
+)
+
+// modelMigrationStreamHandler receives the serialized model of a
+// migration in chunks, rather than in a single API call, which would
+// be limited in size. The chunks are staged on disk until the whole
+// model has been received and verified, and it is then imported.
+//
+// GET reports what has been staged, so that an interrupted stream can
+// be resumed; PUT appends the chunk at the offset given; POST verifies
+// the size and SHA256 hash of the whole stream and imports the model;
+// and DELETE discards what has been staged. Requests for the same model
+// are handled one at a time, so that chunks sent concurrently, say by a
+// restarted migrationmaster while the old one's request is still in
+// progress, cannot be interleaved in the stage.
+type modelMigrationStreamHandler struct {
+	ctxt       httpContext
+	stagingDir string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lockModel serialises the requests for the model with the given UUID,
+// returning the function that releases the lock.
+func (h *modelMigrationStreamHandler) lockModel(modelUUID string) func() {
+	h.mu.Lock()
+	if h.locks == nil {
+		h.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := h.locks[modelUUID]
+	if !ok {
+		lock = new(sync.Mutex)
+		h.locks[modelUUID] = lock
+	}
+	h.mu.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+func (h *modelMigrationStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.ctxt.checkControllerAdmin(r); err != nil {
+		if err := sendError(w, err); err != nil {
+			logger.Errorf("%v", err)
+		}
+		return
+	}
+	modelUUID := r.Header.Get(params.MigrationModelHTTPHeader)
+	stage, err := migration.NewModelStage(h.stagingDir, modelUUID)
+	if err != nil {
+		if err := sendError(w, errors.NewBadRequest(err, "")); err != nil {
+			logger.Errorf("%v", err)
+		}
+		return
+	}
+	defer h.lockModel(modelUUID)()
+
+	var result params.StagedModel
+	switch r.Method {
+	case "GET":
+		result, err = h.processGet(stage)
+	case "PUT":
+		result, err = h.processPut(r, stage)
+	case "POST":
+		err = h.processPost(r, stage)
+	case "DELETE":
+		err = stage.Remove()
+	default:
+		err = errors.MethodNotAllowedf("unsupported method: %q", r.Method)
+	}
+	if err != nil {
+		if err := sendError(w, err); err != nil {
+			logger.Errorf("%v", err)
+		}
+		return
+	}
+	if err := sendStatusAndJSON(w, http.StatusOK, &result); err != nil {
+		logger.Errorf("%v", err)
+	}
+}
+
+// processGet reports the size and hash of what has been staged.
+func (h *modelMigrationStreamHandler) processGet(stage *migration.ModelStage) (params.StagedModel, error) {
+	size, err := stage.Size()
+	if err != nil {
+		return params.StagedModel{}, errors.Trace(err)
+	}
+	hash, err := stage.SHA256()
+	if err != nil {
+		return params.StagedModel{}, errors.Trace(err)
+	}
+	return params.StagedModel{Size: size, SHA256: hash}, nil
+}
+
+// processPut stages the chunk in the request body.
+func (h *modelMigrationStreamHandler) processPut(r *http.Request, stage *migration.ModelStage) (params.StagedModel, error) {
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		return params.StagedModel{}, errors.BadRequestf("invalid offset")
+	}
+	size, err := stage.Append(offset, r.Body)
+	if errors.IsNotValid(err) {
+		return params.StagedModel{}, errors.NewBadRequest(err, "")
+	} else if err != nil {
+		return params.StagedModel{}, errors.Trace(err)
+	}
+	return params.StagedModel{Size: size}, nil
+}
+
+// processPost imports the staged model, once it has been verified. The
+// stage is mapped rather than read into memory. It is discarded once the
+// model has been imported, or if it does not match the stream or cannot
+// be deserialized, as it would never be imported then. If the import
+// itself fails the stage is kept, so that the import can be retried
+// without streaming the model again.
+func (h *modelMigrationStreamHandler) processPost(r *http.Request, stage *migration.ModelStage) error {
+	query := r.URL.Query()
+	size, err := strconv.ParseInt(query.Get("size"), 10, 64)
+	if err != nil {
+		return errors.BadRequestf("invalid size")
+	}
+	if err := stage.Verify(size, query.Get("sha256")); errors.IsNotValid(err) {
+		removeStagedModel(stage)
+		return errors.NewBadRequest(err, "")
+	} else if err != nil {
+		return errors.Trace(err)
+	}
+	bytes, unmap, err := stage.Map()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	discard := false
+	defer func() {
+		if err := unmap(); err != nil {
+			logger.Errorf("cannot unmap staged model: %v", err)
+		}
+		if discard {
+			removeStagedModel(stage)
+		}
+	}()
+
+	model, err := description.Deserialize(bytes)
+	if err != nil {
+		discard = true
+		return errors.NewBadRequest(err, "deserializing model")
+	}
+	_, st, err := h.ctxt.srv.statePool.SystemState().Import(model)
+	if err != nil {
+		return errors.Annotate(err, "importing model")
+	}
+	discard = true
+	return st.Close()
+}
+
+func removeStagedModel(stage *migration.ModelStage) {
+	if err := stage.Remove(); err != nil {
+		logger.Errorf("cannot remove staged model: %v", err)
+	}
+}
+
+// modelMigrationExportHandler serves the serialized model staged by the
+// MigrationMaster facade's Export, so that the migrationmaster worker
+// can stream it to the target controller instead of receiving it in a
+// single API response. Only controller machine agents may download it.
+type modelMigrationExportHandler struct {
+	ctxt httpContext
+}
+
+func (h *modelMigrationExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.serveExport(w, r); err != nil {
+		if err := sendError(w, err); err != nil {
+			logger.Errorf("%v", err)
+		}
+	}
+}
+
+// serveExport sends the staged serialized model. Once the response has
+// been started, a failure to send the rest of it can only be logged;
+// the client detects the truncated model from its size and hash.
+func (h *modelMigrationExportHandler) serveExport(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return errors.MethodNotAllowedf("unsupported method: %q", r.Method)
+	}
+	st, releaser, entity, err := h.ctxt.stateForRequestAuthenticatedTag(r, names.MachineTagKind)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer releaser()
+	if machine, ok := entity.(*state.Machine); !ok || !machine.IsManager() {
+		return errors.Trace(common.ErrPerm)
+	}
+
+	content, size, err := migration.OpenSerializedModel(st)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", params.ContentTypeRaw)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		logger.Errorf("cannot send serialized model: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package apiserver_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/migration"
+	"github.com/juju/1.25-upgrade/juju2/permission"
+	"github.com/juju/1.25-upgrade/juju2/state"
+	"github.com/juju/1.25-upgrade/juju2/testing/factory"
+)
+
+type modelStreamSuite struct {
+	authHTTPSuite
+	importUUID string
+}
+
+var _ = gc.Suite(&modelStreamSuite{})
+
+func (s *modelStreamSuite) SetUpTest(c *gc.C) {
+	s.authHTTPSuite.SetUpTest(c)
+
+	// Make the user a controller admin (required for migrations).
+	controllerTag := names.NewControllerTag(s.ControllerConfig.ControllerUUID())
+	_, err := s.State.SetUserAccess(s.userTag, controllerTag, permission.SuperuserAccess)
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.importUUID = utils.MustNewUUID().String()
+	s.extraHeaders = map[string]string{
+		params.MigrationModelHTTPHeader: s.importUUID,
+	}
+}
+
+func (s *modelStreamSuite) modelURI(c *gc.C, query url.Values) string {
+	uri := s.baseURL(c)
+	uri.Path = "/migrate/model"
+	uri.RawQuery = query.Encode()
+	return uri.String()
+}
+
+func (s *modelStreamSuite) request(c *gc.C, method string, query url.Values, body string) *http.Response {
+	return s.authRequest(c, httpRequestParams{
+		method:      method,
+		url:         s.modelURI(c, query),
+		contentType: "application/octet-stream",
+		body:        strings.NewReader(body),
+	})
+}
+
+func (s *modelStreamSuite) assertStaged(c *gc.C, resp *http.Response) params.StagedModel {
+	body := assertResponse(c, resp, http.StatusOK, params.ContentTypeJSON)
+	var staged params.StagedModel
+	err := json.Unmarshal(body, &staged)
+	c.Assert(err, jc.ErrorIsNil, gc.Commentf("body: %s", body))
+	return staged
+}
+
+func (s *modelStreamSuite) assertErrorResponse(c *gc.C, resp *http.Response, expStatus int, expError string) {
+	body := assertResponse(c, resp, expStatus, params.ContentTypeJSON)
+	var result params.ErrorResult
+	err := json.Unmarshal(body, &result)
+	c.Assert(err, jc.ErrorIsNil, gc.Commentf("body: %s", body))
+	c.Assert(result.Error, gc.NotNil)
+	c.Check(result.Error.Message, gc.Matches, expError)
+}
+
+func (s *modelStreamSuite) putChunk(c *gc.C, offset int, chunk string) params.StagedModel {
+	query := url.Values{"offset": {fmt.Sprint(offset)}}
+	return s.assertStaged(c, s.request(c, "PUT", query, chunk))
+}
+
+func sha256Hex(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+func (s *modelStreamSuite) TestRequiresAuth(c *gc.C) {
+	resp := s.sendRequest(c, httpRequestParams{method: "GET", url: s.modelURI(c, nil)})
+	s.assertErrorResponse(c, resp, http.StatusUnauthorized, ".*no credentials provided$")
+}
+
+func (s *modelStreamSuite) TestRequiresControllerAdmin(c *gc.C) {
+	user := s.Factory.MakeUser(c, &factory.UserParams{Password: "hunter2"})
+	resp := s.sendRequest(c, httpRequestParams{
+		tag:          user.Tag().String(),
+		password:     "hunter2",
+		method:       "GET",
+		url:          s.modelURI(c, nil),
+		extraHeaders: s.extraHeaders,
+	})
+	s.assertErrorResponse(c, resp, http.StatusUnauthorized, "not a controller admin")
+}
+
+func (s *modelStreamSuite) TestRequiresModelUUID(c *gc.C) {
+	s.extraHeaders[params.MigrationModelHTTPHeader] = "../../etc"
+	resp := s.request(c, "GET", nil, "")
+	s.assertErrorResponse(c, resp, http.StatusBadRequest, `model UUID "../../etc" not valid`)
+}
+
+func (s *modelStreamSuite) TestUnsupportedMethod(c *gc.C) {
+	resp := s.request(c, "OPTIONS", nil, "")
+	s.assertErrorResponse(c, resp, http.StatusMethodNotAllowed, `unsupported method: "OPTIONS"`)
+}
+
+func (s *modelStreamSuite) TestStatusEmpty(c *gc.C) {
+	staged := s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged, jc.DeepEquals, params.StagedModel{SHA256: sha256Hex("")})
+}
+
+func (s *modelStreamSuite) TestPutChunks(c *gc.C) {
+	c.Assert(s.putChunk(c, 0, "model:"), jc.DeepEquals, params.StagedModel{Size: 6})
+	c.Assert(s.putChunk(c, 6, " {}"), jc.DeepEquals, params.StagedModel{Size: 9})
+
+	staged := s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged, jc.DeepEquals, params.StagedModel{
+		Size:   9,
+		SHA256: sha256Hex("model: {}"),
+	})
+}
+
+func (s *modelStreamSuite) TestPutChunkWrongOffset(c *gc.C) {
+	s.putChunk(c, 0, "model:")
+	resp := s.request(c, "PUT", url.Values{"offset": {"3"}}, " {}")
+	s.assertErrorResponse(c, resp, http.StatusBadRequest, "chunk at offset 3 with 6 bytes staged not valid")
+
+	resp = s.request(c, "PUT", url.Values{"offset": {"many"}}, " {}")
+	s.assertErrorResponse(c, resp, http.StatusBadRequest, "invalid offset")
+}
+
+func (s *modelStreamSuite) TestConcurrentPutsSerialised(c *gc.C) {
+	// Chunks sent for the same offset at once are staged one at a
+	// time, so only one of them is accepted.
+	const count = 5
+	statuses := make(chan int, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := s.request(c, "PUT", url.Values{"offset": {"0"}}, "model:")
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	accepted := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			accepted++
+		} else {
+			c.Check(status, gc.Equals, http.StatusBadRequest)
+		}
+	}
+	c.Assert(accepted, gc.Equals, 1)
+
+	staged := s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged.Size, gc.Equals, int64(6))
+}
+
+func (s *modelStreamSuite) TestDelete(c *gc.C) {
+	s.putChunk(c, 0, "model:")
+	s.assertStaged(c, s.request(c, "DELETE", nil, ""))
+
+	staged := s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged.Size, gc.Equals, int64(0))
+}
+
+func (s *modelStreamSuite) TestImportChecksStream(c *gc.C) {
+	s.putChunk(c, 0, "model:")
+
+	resp := s.request(c, "POST", url.Values{
+		"size":   {"9"},
+		"sha256": {sha256Hex("model: {}")},
+	}, "")
+	s.assertErrorResponse(c, resp, http.StatusBadRequest, "staged model has 6 bytes, expected 9")
+
+	// A stage that does not match the stream is discarded, so that
+	// the model is streamed again from the start.
+	staged := s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged.Size, gc.Equals, int64(0))
+
+	s.putChunk(c, 0, "model:")
+	resp = s.request(c, "POST", url.Values{
+		"size":   {"6"},
+		"sha256": {sha256Hex("model:")[1:]},
+	}, "")
+	s.assertErrorResponse(c, resp, http.StatusBadRequest, "staged model has SHA256 .*, expected .*")
+	staged = s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged.Size, gc.Equals, int64(0))
+}
+
+func (s *modelStreamSuite) TestImportBadModel(c *gc.C) {
+	s.putChunk(c, 0, "model: [")
+	resp := s.request(c, "POST", url.Values{
+		"size":   {"8"},
+		"sha256": {sha256Hex("model: [")},
+	}, "")
+	s.assertErrorResponse(c, resp, http.StatusBadRequest, "deserializing model: .*")
+
+	// A model that cannot be deserialized is discarded.
+	staged := s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged.Size, gc.Equals, int64(0))
+}
+
+func (s *modelStreamSuite) TestImportFailureKeepsStage(c *gc.C) {
+	// Importing a model that is already on the controller fails.
+	model, err := s.State.Export()
+	c.Assert(err, jc.ErrorIsNil)
+	bytes, err := description.Serialize(model)
+	c.Assert(err, jc.ErrorIsNil)
+	serialized := string(bytes)
+
+	s.putChunk(c, 0, serialized)
+	resp := s.request(c, "POST", url.Values{
+		"size":   {fmt.Sprint(len(serialized))},
+		"sha256": {sha256Hex(serialized)},
+	}, "")
+	s.assertErrorResponse(c, resp, http.StatusInternalServerError, "importing model: .*")
+
+	// The stage is kept, so that the import can be retried without
+	// streaming the model again.
+	staged := s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged, jc.DeepEquals, params.StagedModel{
+		Size:   int64(len(serialized)),
+		SHA256: sha256Hex(serialized),
+	})
+}
+
+func (s *modelStreamSuite) TestImport(c *gc.C) {
+	model, err := s.State.Export()
+	c.Assert(err, jc.ErrorIsNil)
+	model.UpdateConfig(map[string]interface{}{
+		"name": "new-model",
+		"uuid": s.importUUID,
+	})
+	bytes, err := description.Serialize(model)
+	c.Assert(err, jc.ErrorIsNil)
+	serialized := string(bytes)
+
+	half := len(serialized) / 2
+	s.putChunk(c, 0, serialized[:half])
+	s.putChunk(c, half, serialized[half:])
+	resp := s.request(c, "POST", url.Values{
+		"size":   {fmt.Sprint(len(serialized))},
+		"sha256": {sha256Hex(serialized)},
+	}, "")
+	s.assertStaged(c, resp)
+
+	imported, err := s.State.GetModel(names.NewModelTag(s.importUUID))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imported.Name(), gc.Equals, "new-model")
+	c.Assert(imported.MigrationMode(), gc.Equals, state.MigrationModeImporting)
+
+	// The stage is removed once the model is imported.
+	staged := s.assertStaged(c, s.request(c, "GET", nil, ""))
+	c.Assert(staged.Size, gc.Equals, int64(0))
+}
+
+type modelExportSuite struct {
+	authHTTPSuite
+}
+
+var _ = gc.Suite(&modelExportSuite{})
+
+func (s *modelExportSuite) exportURI(c *gc.C, modelUUID string) string {
+	uri := s.baseURL(c)
+	uri.Path = fmt.Sprintf("/model/%s/migrate/export", modelUUID)
+	return uri.String()
+}
+
+func (s *modelExportSuite) machineRequest(c *gc.C, st *state.State, jobs ...state.MachineJob) *http.Response {
+	const nonce = "noncey"
+	m, password := s.Factory.MakeMachineReturningPassword(c, &factory.MachineParams{
+		Jobs:  jobs,
+		Nonce: nonce,
+	})
+	return s.sendRequest(c, httpRequestParams{
+		method:   "GET",
+		url:      s.exportURI(c, st.ModelUUID()),
+		tag:      m.Tag().String(),
+		password: password,
+		nonce:    nonce,
+	})
+}
+
+func (s *modelExportSuite) assertErrorResponse(c *gc.C, resp *http.Response, expStatus int, expError string) {
+	body := assertResponse(c, resp, expStatus, params.ContentTypeJSON)
+	var result params.ErrorResult
+	err := json.Unmarshal(body, &result)
+	c.Assert(err, jc.ErrorIsNil, gc.Commentf("body: %s", body))
+	c.Assert(result.Error, gc.NotNil)
+	c.Check(result.Error.Message, gc.Matches, expError)
+}
+
+func (s *modelExportSuite) TestControllerMachineDownloads(c *gc.C) {
+	// The migrationmaster runs on a controller machine on behalf of
+	// the hosted model being migrated.
+	st := s.setupOtherModel(c)
+	err := migration.StageSerializedModel(st, []byte("model: {}"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	resp := s.machineRequest(c, st, state.JobManageModel)
+	body := assertResponse(c, resp, http.StatusOK, params.ContentTypeRaw)
+	c.Assert(string(body), gc.Equals, "model: {}")
+	c.Assert(resp.ContentLength, gc.Equals, int64(9))
+}
+
+func (s *modelExportSuite) TestNotStaged(c *gc.C) {
+	resp := s.machineRequest(c, s.State, state.JobManageModel)
+	s.assertErrorResponse(c, resp, http.StatusNotFound, "serialized model not found")
+}
+
+func (s *modelExportSuite) TestRequiresControllerMachine(c *gc.C) {
+	err := migration.StageSerializedModel(s.State, []byte("model: {}"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	resp := s.machineRequest(c, s.State, state.JobHostUnits)
+	s.assertErrorResponse(c, resp, http.StatusUnauthorized, "permission denied")
+}
+
+func (s *modelExportSuite) TestRefusesUsers(c *gc.C) {
+	resp := s.authRequest(c, httpRequestParams{
+		method: "GET",
+		url:    s.exportURI(c, s.State.ModelUUID()),
+	})
+	s.assertErrorResponse(c, resp, http.StatusUnauthorized, "tag kind user not valid")
+}
+
+func (s *modelExportSuite) TestUnsupportedMethod(c *gc.C) {
+	resp := s.authRequest(c, httpRequestParams{
+		method: "PUT",
+		url:    s.exportURI(c, s.State.ModelUUID()),
+	})
+	s.assertErrorResponse(c, resp, http.StatusMethodNotAllowed, `unsupported method: "PUT"`)
+}
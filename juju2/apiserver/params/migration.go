@@ -6,7 +6,11 @@ package params
 import (
 	"time"
 
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
 	"github.com/juju/version"
+
+	"github.com/juju/1.25-upgrade/juju2/core/migration"
 )
 
 // MigrationModelHTTPHeader is the key for the HTTP header value
@@ -23,8 +27,9 @@ type InitiateMigrationArgs struct {
 // MigrationSpec holds the details required to start the migration of
 // a single model.
 type MigrationSpec struct {
-	ModelTag   string              `json:"model-tag"`
-	TargetInfo MigrationTargetInfo `json:"target-info"`
+	ModelTag    string                      `json:"model-tag"`
+	TargetInfo  MigrationTargetInfo         `json:"target-info"`
+	LogTransfer MigrationLogTransferOptions `json:"log-transfer"`
 }
 
 // MigrationTargetInfo holds the details required to connect to and
@@ -38,6 +43,55 @@ type MigrationTargetInfo struct {
 	Macaroons     string   `json:"macaroons,omitempty"`
 }
 
+// MigrationLogTransferOptions limits the logs sent to the target
+// controller once a model migration has succeeded. Zero values mean no
+// limit. Level is a loggo level name, such as "WARNING".
+type MigrationLogTransferOptions struct {
+	MaxAge              time.Duration `json:"max-age,omitempty"`
+	Level               string        `json:"level,omitempty"`
+	IncludeEntities     []string      `json:"include-entities,omitempty"`
+	ExcludeEntities     []string      `json:"exclude-entities,omitempty"`
+	MaxRecordsPerSecond int           `json:"max-records-per-second,omitempty"`
+	MaxBytesPerSecond   int           `json:"max-bytes-per-second,omitempty"`
+}
+
+// LogTransferToParams converts log transfer options to be sent over
+// the API.
+func LogTransferToParams(opts migration.LogTransferOptions) MigrationLogTransferOptions {
+	out := MigrationLogTransferOptions{
+		MaxAge:              opts.MaxAge,
+		IncludeEntities:     opts.IncludeEntities,
+		ExcludeEntities:     opts.ExcludeEntities,
+		MaxRecordsPerSecond: opts.MaxRecordsPerSecond,
+		MaxBytesPerSecond:   opts.MaxBytesPerSecond,
+	}
+	if opts.Level != loggo.UNSPECIFIED {
+		out.Level = opts.Level.String()
+	}
+	return out
+}
+
+// LogTransferFromParams converts log transfer options received over
+// the API, returning an error if the level is not a loggo level name.
+func LogTransferFromParams(in MigrationLogTransferOptions) (migration.LogTransferOptions, error) {
+	level := loggo.UNSPECIFIED
+	if in.Level != "" {
+		var ok bool
+		level, ok = loggo.ParseLevel(in.Level)
+		if !ok {
+			return migration.LogTransferOptions{}, errors.NotValidf("log level %q", in.Level)
+		}
+	}
+	return migration.LogTransferOptions{
+		MaxAge:              in.MaxAge,
+		Level:               level,
+		IncludeEntities:     in.IncludeEntities,
+		ExcludeEntities:     in.ExcludeEntities,
+		MaxRecordsPerSecond: in.MaxRecordsPerSecond,
+		MaxBytesPerSecond:   in.MaxBytesPerSecond,
+	}, nil
+}
+
 // InitiateMigrationResults is used to return the result of one or
 // more attempts to start model migrations.
 type InitiateMigrationResults struct {
@@ -71,6 +125,16 @@ type SerializedModel struct {
 	Charms    []string                  `json:"charms"`
 	Tools     []SerializedModelTools    `json:"tools"`
 	Resources []SerializedModelResource `json:"resources"`
+
+	// CharmSHA256s holds the SHA256 hash of each charm archive, keyed
+	// by charm URL.
+	CharmSHA256s map[string]string `json:"charm-sha256s,omitempty"`
+
+	// Size and SHA256 describe the serialized model staged by the
+	// MigrationMaster facade's Export, which is downloaded separately
+	// rather than returned in Bytes.
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 // SerializedModelTools holds the version and URI for a given tools
@@ -83,6 +147,9 @@ type SerializedModelTools struct {
 	// with the API server scheme, address and model prefix before it
 	// can be used.
 	URI string `json:"uri"`
+
+	// SHA256 holds the SHA256 hash of the tools tarball.
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 // SerializedModelResource holds the details for a single resource for
@@ -109,6 +176,15 @@ type SerializedModelResourceRevision struct {
 	Username       string    `json:"username,omitempty"`
 }
 
+// StagedModel reports how much of a serialized model has been streamed
+// to the target controller of a migration, and the SHA256 hash of what
+// has been received. The hash is only reported when asked for the
+// status of the stream, not after each chunk.
+type StagedModel struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
 // ModelArgs wraps a simple model tag.
 type ModelArgs struct {
 	ModelTag string `json:"model-tag"`
@@ -122,6 +198,24 @@ type MasterMigrationStatus struct {
 	MigrationId      string        `json:"migration-id"`
 	Phase            string        `json:"phase"`
 	PhaseChangedTime time.Time     `json:"phase-changed-time"`
+	ImportProgress   []string      `json:"import-progress,omitempty"`
+}
+
+// AddMigrationImportProgressArgs provides the completed steps of the
+// IMPORT phase to the migrationmaster.AddImportProgress API method.
+type AddMigrationImportProgressArgs struct {
+	Steps []string `json:"steps"`
+}
+
+// UploadedMigrationBinaries reports the binaries the target controller
+// of a migration already has for the model being imported. Charms and
+// tools are keyed by charm URL and tools version, and hold the SHA256
+// hash of each; resources are keyed by "application/resource" and hold
+// the fingerprint of the application revision.
+type UploadedMigrationBinaries struct {
+	Charms    map[string]string `json:"charms"`
+	Tools     map[string]string `json:"tools"`
+	Resources map[string]string `json:"resources"`
 }
 
 // MigrationModelInfo is used to report basic model information to the
@@ -132,6 +226,8 @@ type MigrationModelInfo struct {
 	OwnerTag               string         `json:"owner-tag"`
 	AgentVersion           version.Number `json:"agent-version"`
 	ControllerAgentVersion version.Number `json:"controller-agent-version"`
+	DescriptionVersion     int            `json:"description-version,omitempty"`
+	Features               []string       `json:"features,omitempty"`
 }
 
 // MigrationStatus reports the current status of a model migration.
@@ -0,0 +1,55 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package params_test
+
+import (
+	"time"
+
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/core/migration"
+)
+
+type logTransferSuite struct{}
+
+var _ = gc.Suite(&logTransferSuite{})
+
+func (*logTransferSuite) TestRoundTrip(c *gc.C) {
+	opts := migration.LogTransferOptions{
+		MaxAge:              time.Hour,
+		Level:               loggo.WARNING,
+		IncludeEntities:     []string{"unit-*"},
+		ExcludeEntities:     []string{"machine-0"},
+		MaxRecordsPerSecond: 100,
+		MaxBytesPerSecond:   4096,
+	}
+	in := params.LogTransferToParams(opts)
+	c.Check(in, jc.DeepEquals, params.MigrationLogTransferOptions{
+		MaxAge:              time.Hour,
+		Level:               "WARNING",
+		IncludeEntities:     []string{"unit-*"},
+		ExcludeEntities:     []string{"machine-0"},
+		MaxRecordsPerSecond: 100,
+		MaxBytesPerSecond:   4096,
+	})
+	out, err := params.LogTransferFromParams(in)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out, jc.DeepEquals, opts)
+}
+
+func (*logTransferSuite) TestUnspecifiedLevel(c *gc.C) {
+	in := params.LogTransferToParams(migration.LogTransferOptions{})
+	c.Check(in.Level, gc.Equals, "")
+	out, err := params.LogTransferFromParams(in)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(out.Level, gc.Equals, loggo.UNSPECIFIED)
+}
+
+func (*logTransferSuite) TestInvalidLevel(c *gc.C) {
+	_, err := params.LogTransferFromParams(params.MigrationLogTransferOptions{Level: "LOUD"})
+	c.Assert(err, gc.ErrorMatches, `log level "LOUD" not valid`)
+}
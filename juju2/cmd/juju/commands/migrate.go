@@ -4,14 +4,19 @@
 package commands
 
 import (
+	"time"
+
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
+	"github.com/juju/gnuflag"
+	"github.com/juju/loggo"
 	"gopkg.in/macaroon-bakery.v1/httpbakery"
 	"gopkg.in/macaroon.v1"
 
 	"github.com/juju/1.25-upgrade/juju2/api"
 	"github.com/juju/1.25-upgrade/juju2/api/controller"
 	"github.com/juju/1.25-upgrade/juju2/cmd/modelcmd"
+	"github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/jujuclient"
 )
 
@@ -27,6 +32,14 @@ type migrateCommand struct {
 	newAPIRoot       func(jujuclient.ClientStore, string, string) (api.Connection, error)
 	api              migrateAPI
 	targetController string
+
+	logMaxAge        time.Duration
+	logLevel         string
+	logInclude       []string
+	logExclude       []string
+	logRecordsPerSec int
+	logKiBPerSec     int
+	logTransferLevel loggo.Level
 }
 
 type migrateAPI interface {
@@ -52,10 +65,23 @@ In order to start a migration, the target controller must be in the
 juju client's local configuration cache. See the juju "login" command
 for details of how to do this.
 
+Once the model is running on the target controller, its logs are
+copied there too. For a model with a lot of logs this can take a long
+time, so the logs copied can be limited by age, level and the entity
+that logged them, and the rate at which they are sent can be limited
+too. Entities are given as tags, such as "machine-0" or "unit-mysql-1";
+a tag ending with '*' matches any entity with that prefix.
+
 This command only starts a model migration - it does not wait for its
 completion. The progress of a migration can be tracked using the
 "status" command and by consulting the logs.
 
+Examples:
+
+    juju migrate mymodel target
+    juju migrate mymodel target --log-max-age 72h --log-level WARNING
+    juju migrate mymodel target --log-exclude unit-noisy-* --log-kib-per-second 512
+
 See also:
     login
     controllers
@@ -72,6 +98,17 @@ func (c *migrateCommand) Info() *cmd.Info {
 	}
 }
 
+// SetFlags implements cmd.Command.
+func (c *migrateCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.ModelCommandBase.SetFlags(f)
+	f.DurationVar(&c.logMaxAge, "log-max-age", 0, "Only copy logs written within this long of the migration (default all)")
+	f.StringVar(&c.logLevel, "log-level", "", "Only copy logs of this level or above (default all)")
+	f.Var(cmd.NewStringsValue(nil, &c.logInclude), "log-include", "Only copy logs from these comma-separated entities")
+	f.Var(cmd.NewStringsValue(nil, &c.logExclude), "log-exclude", "Do not copy logs from these comma-separated entities")
+	f.IntVar(&c.logRecordsPerSec, "log-records-per-second", 0, "Copy at most this many log records per second (default unlimited)")
+	f.IntVar(&c.logKiBPerSec, "log-kib-per-second", 0, "Copy at most this many KiB of logs per second (default unlimited)")
+}
+
 // Init implements cmd.Command.
 func (c *migrateCommand) Init(args []string) error {
 	if len(args) < 1 {
@@ -84,6 +121,23 @@ func (c *migrateCommand) Init(args []string) error {
 		return errors.New("too many arguments specified")
 	}
 
+	if c.logLevel != "" {
+		level, ok := loggo.ParseLevel(c.logLevel)
+		if !ok || level == loggo.UNSPECIFIED {
+			return errors.Errorf("invalid log level %q", c.logLevel)
+		}
+		c.logTransferLevel = level
+	}
+	if c.logMaxAge < 0 {
+		return errors.New("--log-max-age must not be negative")
+	}
+	if c.logRecordsPerSec < 0 {
+		return errors.New("--log-records-per-second must not be negative")
+	}
+	if c.logKiBPerSec < 0 {
+		return errors.New("--log-kib-per-second must not be negative")
+	}
+
 	c.SetModelName(args[0], false)
 	c.targetController = args[1]
 	return nil
@@ -118,6 +172,14 @@ func (c *migrateCommand) getMigrationSpec() (*controller.MigrationSpec, error) {
 		TargetUser:           accountInfo.User,
 		TargetPassword:       accountInfo.Password,
 		TargetMacaroons:      macs,
+		LogTransfer: migration.LogTransferOptions{
+			MaxAge:              c.logMaxAge,
+			Level:               c.logTransferLevel,
+			IncludeEntities:     c.logInclude,
+			ExcludeEntities:     c.logExclude,
+			MaxRecordsPerSecond: c.logRecordsPerSec,
+			MaxBytesPerSecond:   c.logKiBPerSec * 1024,
+		},
 	}, nil
 }
 
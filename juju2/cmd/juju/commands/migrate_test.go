@@ -10,6 +10,7 @@ import (
 
 	"github.com/juju/cmd"
 	"github.com/juju/cmd/cmdtesting"
+	"github.com/juju/loggo"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 	"gopkg.in/macaroon-bakery.v1/httpbakery"
@@ -19,6 +20,7 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/api/base"
 	"github.com/juju/1.25-upgrade/juju2/api/controller"
 	"github.com/juju/1.25-upgrade/juju2/cmd/modelcmd"
+	"github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/jujuclient"
 	"github.com/juju/1.25-upgrade/juju2/testing"
 )
@@ -151,6 +153,50 @@ func (s *MigrateSuite) TestSuccess(c *gc.C) {
 	})
 }
 
+func (s *MigrateSuite) TestLogTransferOptions(c *gc.C) {
+	_, err := s.makeAndRun(c, "model", "target",
+		"--log-max-age", "72h",
+		"--log-level", "warning",
+		"--log-include", "machine-0,unit-mysql-*",
+		"--log-exclude", "unit-mysql-1",
+		"--log-records-per-second", "200",
+		"--log-kib-per-second", "512",
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.api.specSeen.LogTransfer, jc.DeepEquals, migration.LogTransferOptions{
+		MaxAge:              72 * time.Hour,
+		Level:               loggo.WARNING,
+		IncludeEntities:     []string{"machine-0", "unit-mysql-*"},
+		ExcludeEntities:     []string{"unit-mysql-1"},
+		MaxRecordsPerSecond: 200,
+		MaxBytesPerSecond:   512 * 1024,
+	})
+}
+
+func (s *MigrateSuite) TestInvalidLogTransferOptions(c *gc.C) {
+	for i, test := range []struct {
+		args   []string
+		expect string
+	}{{
+		[]string{"--log-level", "loud"},
+		`invalid log level "loud"`,
+	}, {
+		[]string{"--log-max-age", "-1h"},
+		"--log-max-age must not be negative",
+	}, {
+		[]string{"--log-records-per-second", "-1"},
+		"--log-records-per-second must not be negative",
+	}, {
+		[]string{"--log-kib-per-second", "-1"},
+		"--log-kib-per-second must not be negative",
+	}} {
+		c.Logf("test %d", i)
+		_, err := s.makeAndRun(c, append([]string{"model", "target"}, test.args...)...)
+		c.Check(err, gc.ErrorMatches, test.expect)
+	}
+	c.Check(s.api.specSeen, gc.IsNil)
+}
+
 func (s *MigrateSuite) TestSuccessMacaroons(c *gc.C) {
 	err := s.store.UpdateAccount("target", jujuclient.AccountDetails{
 		User:     "targetuser",
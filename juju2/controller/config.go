@@ -82,6 +82,15 @@ const (
 	// MaxTxnLogSize is the maximum size the of capped txn log collection, eg "10M"
 	MaxTxnLogSize = "max-txn-log-size"
 
+	// MigrationWebhookURL is the URL that the controller posts an
+	// event to each time a model migration moves to a new phase.
+	MigrationWebhookURL = "migration-webhook-url"
+
+	// MigrationWebhookSecret is the key used to sign the events posted
+	// to the MigrationWebhookURL, so that the receiver can check that
+	// they came from the controller.
+	MigrationWebhookSecret = "migration-webhook-secret"
+
 	// Attribute Defaults
 
 	// DefaultAuditingEnabled contains the default value for the
@@ -129,6 +138,8 @@ var ControllerOnlyConfigAttributes = []string{
 	MaxLogsSize,
 	MaxLogsAge,
 	MaxTxnLogSize,
+	MigrationWebhookURL,
+	MigrationWebhookSecret,
 }
 
 // ControllerOnlyAttribute returns true if the specified attribute name
@@ -313,6 +324,18 @@ func (c Config) MaxTxnLogSizeMB() int {
 	return int(val)
 }
 
+// MigrationWebhookURL returns the URL that model migration phase events
+// are posted to, or "" if they are not posted.
+func (c Config) MigrationWebhookURL() string {
+	return c.asString(MigrationWebhookURL)
+}
+
+// MigrationWebhookSecret returns the key used to sign model migration
+// phase events, or "" if they are not signed.
+func (c Config) MigrationWebhookSecret() string {
+	return c.asString(MigrationWebhookSecret)
+}
+
 // Validate ensures that config is a valid configuration.
 func Validate(c Config) error {
 	if v, ok := c[IdentityPublicKey].(string); ok {
@@ -372,6 +395,16 @@ func Validate(c Config) error {
 		}
 	}
 
+	if v, ok := c[MigrationWebhookURL].(string); ok {
+		u, err := url.Parse(v)
+		if err != nil {
+			return errors.Annotate(err, "invalid migration webhook URL")
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.Errorf("migration webhook URL %q needs to be http or https", v)
+		}
+	}
+
 	return nil
 }
 
@@ -395,6 +428,8 @@ var configChecker = schema.FieldMap(schema.Fields{
 	MaxLogsAge:              schema.String(),
 	MaxLogsSize:             schema.String(),
 	MaxTxnLogSize:           schema.String(),
+	MigrationWebhookURL:     schema.String(),
+	MigrationWebhookSecret:  schema.String(),
 }, schema.Defaults{
 	APIPort:                 DefaultAPIPort,
 	AuditingEnabled:         DefaultAuditingEnabled,
@@ -409,4 +444,6 @@ var configChecker = schema.FieldMap(schema.Fields{
 	MaxLogsAge:              fmt.Sprintf("%vh", DefaultMaxLogsAgeDays*24),
 	MaxLogsSize:             fmt.Sprintf("%vM", DefaultMaxLogCollectionMB),
 	MaxTxnLogSize:           fmt.Sprintf("%vM", DefaultMaxTxnLogCollectionMB),
+	MigrationWebhookURL:     schema.Omit,
+	MigrationWebhookSecret:  schema.Omit,
 })
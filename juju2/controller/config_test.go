@@ -173,3 +173,33 @@ func (s *ConfigSuite) TestTxnLogConfigValue(c *gc.C) {
 	c.Assert(err, jc.ErrorIsNil)
 	c.Assert(cfg.MaxTxnLogSizeMB(), gc.Equals, 8192)
 }
+
+func (s *ConfigSuite) TestMigrationWebhookConfig(c *gc.C) {
+	cfg, err := controller.NewConfig(testing.ControllerTag.Id(), testing.CACert, nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cfg.MigrationWebhookURL(), gc.Equals, "")
+	c.Assert(cfg.MigrationWebhookSecret(), gc.Equals, "")
+
+	cfg, err = controller.NewConfig(
+		testing.ControllerTag.Id(),
+		testing.CACert,
+		map[string]interface{}{
+			"migration-webhook-url":    "https://orchestrator.example.com/migrations",
+			"migration-webhook-secret": "sekrit",
+		},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cfg.MigrationWebhookURL(), gc.Equals, "https://orchestrator.example.com/migrations")
+	c.Assert(cfg.MigrationWebhookSecret(), gc.Equals, "sekrit")
+}
+
+func (s *ConfigSuite) TestMigrationWebhookURLNotHTTP(c *gc.C) {
+	_, err := controller.NewConfig(
+		testing.ControllerTag.Id(),
+		testing.CACert,
+		map[string]interface{}{
+			"migration-webhook-url": "ftp://orchestrator.example.com",
+		},
+	)
+	c.Assert(err, gc.ErrorMatches, `migration webhook URL "ftp://orchestrator.example.com" needs to be http or https`)
+}
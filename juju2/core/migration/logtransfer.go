@@ -0,0 +1,143 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+)
+
+// LogTransferOptions limits which of a model's log records are sent
+// to the target controller once a migration has succeeded, and how
+// quickly they are sent. The zero value sends every record as fast as
+// the target will accept them.
+type LogTransferOptions struct {
+	// MaxAge, if not zero, excludes records logged longer than this
+	// before the transfer starts.
+	MaxAge time.Duration
+
+	// Level, if not loggo.UNSPECIFIED, excludes records less severe
+	// than it.
+	Level loggo.Level
+
+	// IncludeEntities, if not empty, limits the records to those
+	// logged by the given entity tags. As with debug-log, a tag may
+	// end with a '*' to match any entity with that prefix.
+	IncludeEntities []string
+
+	// ExcludeEntities excludes records logged by the given entity
+	// tags, which may also end with a '*'.
+	ExcludeEntities []string
+
+	// MaxRecordsPerSecond, if not zero, limits the rate at which
+	// records are sent.
+	MaxRecordsPerSecond int
+
+	// MaxBytesPerSecond, if not zero, limits the bandwidth used to
+	// send records, measured by their encoded size.
+	MaxBytesPerSecond int
+}
+
+// Validate returns an error if the LogTransferOptions contains bad
+// data. Nil is returned otherwise.
+func (opts *LogTransferOptions) Validate() error {
+	if opts.MaxAge < 0 {
+		return errors.NotValidf("negative MaxAge")
+	}
+	if opts.Level > loggo.CRITICAL {
+		return errors.NotValidf("Level %d", opts.Level)
+	}
+	for _, entity := range opts.IncludeEntities {
+		if entity == "" {
+			return errors.NotValidf("empty entity in IncludeEntities")
+		}
+	}
+	for _, entity := range opts.ExcludeEntities {
+		if entity == "" {
+			return errors.NotValidf("empty entity in ExcludeEntities")
+		}
+	}
+	if opts.MaxRecordsPerSecond < 0 {
+		return errors.NotValidf("negative MaxRecordsPerSecond")
+	}
+	if opts.MaxBytesPerSecond < 0 {
+		return errors.NotValidf("negative MaxBytesPerSecond")
+	}
+	return nil
+}
+
+// StartTime returns the time from which records should be sent, given
+// the time of the latest record the target already has (the zero time
+// if it has none) and the current time.
+func (opts *LogTransferOptions) StartTime(latest, now time.Time) time.Time {
+	if opts.MaxAge == 0 {
+		return latest
+	}
+	if earliest := now.Add(-opts.MaxAge); earliest.After(latest) {
+		return earliest
+	}
+	return latest
+}
+
+// NewLogThrottle returns a LogThrottle that keeps to the rate limits
+// in opts.
+func NewLogThrottle(opts LogTransferOptions) *LogThrottle {
+	return &LogThrottle{
+		maxRecords: opts.MaxRecordsPerSecond,
+		maxBytes:   opts.MaxBytesPerSecond,
+	}
+}
+
+// LogThrottle paces the records sent during a log transfer, so that
+// on average they keep to a maximum rate and bandwidth.
+type LogThrottle struct {
+	maxRecords int
+	maxBytes   int
+	started    time.Time
+	records    int64
+	bytes      int64
+}
+
+// Delay records that a record of the given encoded size is about to be
+// sent at the given time, and returns how long to wait before sending
+// it.
+func (t *LogThrottle) Delay(size int, now time.Time) time.Duration {
+	if t.maxRecords == 0 && t.maxBytes == 0 {
+		return 0
+	}
+	if t.started.IsZero() {
+		t.started = now
+	}
+	// Each limit gives the earliest time, relative to the start of
+	// the transfer, that the records sent so far could be sent by.
+	// The first record is sent straight away.
+	var due time.Duration
+	if t.maxRecords > 0 {
+		due = maxDuration(due, perSecond(t.records, t.maxRecords))
+	}
+	if t.maxBytes > 0 {
+		due = maxDuration(due, perSecond(t.bytes, t.maxBytes))
+	}
+	t.records++
+	t.bytes += int64(size)
+	if delay := t.started.Add(due).Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// perSecond returns how long it takes to send count items at limit
+// items per second.
+func perSecond(count int64, limit int) time.Duration {
+	return time.Duration(float64(count) / float64(limit) * float64(time.Second))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration_test
+
+import (
+	"time"
+
+	"github.com/juju/loggo"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/core/migration"
+	coretesting "github.com/juju/1.25-upgrade/juju2/testing"
+)
+
+type LogTransferSuite struct {
+	coretesting.BaseSuite
+}
+
+var _ = gc.Suite(new(LogTransferSuite))
+
+func (s *LogTransferSuite) TestValidation(c *gc.C) {
+	tests := []struct {
+		tweak        func(*migration.LogTransferOptions)
+		errorPattern string
+	}{{
+		func(opts *migration.LogTransferOptions) { opts.MaxAge = -time.Second },
+		"negative MaxAge not valid",
+	}, {
+		func(opts *migration.LogTransferOptions) { opts.Level = loggo.CRITICAL + 1 },
+		"Level 6 not valid",
+	}, {
+		func(opts *migration.LogTransferOptions) { opts.IncludeEntities = []string{"unit-*", ""} },
+		"empty entity in IncludeEntities not valid",
+	}, {
+		func(opts *migration.LogTransferOptions) { opts.ExcludeEntities = []string{""} },
+		"empty entity in ExcludeEntities not valid",
+	}, {
+		func(opts *migration.LogTransferOptions) { opts.MaxRecordsPerSecond = -1 },
+		"negative MaxRecordsPerSecond not valid",
+	}, {
+		func(opts *migration.LogTransferOptions) { opts.MaxBytesPerSecond = -1 },
+		"negative MaxBytesPerSecond not valid",
+	}, {
+		func(*migration.LogTransferOptions) {},
+		"",
+	}}
+	for i, test := range tests {
+		c.Logf("test %d", i)
+		opts := migration.LogTransferOptions{
+			MaxAge:              time.Hour,
+			Level:               loggo.WARNING,
+			IncludeEntities:     []string{"machine-0"},
+			ExcludeEntities:     []string{"unit-noisy-*"},
+			MaxRecordsPerSecond: 100,
+			MaxBytesPerSecond:   1024,
+		}
+		test.tweak(&opts)
+		err := opts.Validate()
+		if test.errorPattern == "" {
+			c.Check(err, jc.ErrorIsNil)
+		} else {
+			c.Check(err, gc.ErrorMatches, test.errorPattern)
+		}
+	}
+}
+
+func (s *LogTransferSuite) TestStartTime(c *gc.C) {
+	now := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-time.Minute)
+	var zero time.Time
+
+	opts := migration.LogTransferOptions{}
+	c.Check(opts.StartTime(zero, now), gc.Equals, zero)
+	c.Check(opts.StartTime(recent, now), gc.Equals, recent)
+
+	opts.MaxAge = time.Hour
+	c.Check(opts.StartTime(zero, now), gc.Equals, now.Add(-time.Hour))
+	c.Check(opts.StartTime(recent, now), gc.Equals, recent)
+}
+
+func (s *LogTransferSuite) TestThrottleUnlimited(c *gc.C) {
+	throttle := migration.NewLogThrottle(migration.LogTransferOptions{})
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		c.Assert(throttle.Delay(1000, now), gc.Equals, time.Duration(0))
+	}
+}
+
+func (s *LogTransferSuite) TestThrottleRecords(c *gc.C) {
+	throttle := migration.NewLogThrottle(migration.LogTransferOptions{
+		MaxRecordsPerSecond: 4,
+	})
+	now := time.Now()
+	c.Check(throttle.Delay(10, now), gc.Equals, time.Duration(0))
+	c.Check(throttle.Delay(10, now), gc.Equals, 250*time.Millisecond)
+	c.Check(throttle.Delay(10, now), gc.Equals, 500*time.Millisecond)
+
+	// Time spent elsewhere counts towards the delay.
+	now = now.Add(time.Second)
+	c.Check(throttle.Delay(10, now), gc.Equals, time.Duration(0))
+	c.Check(throttle.Delay(10, now), gc.Equals, time.Duration(0))
+	c.Check(throttle.Delay(10, now), gc.Equals, 250*time.Millisecond)
+}
+
+func (s *LogTransferSuite) TestThrottleBytes(c *gc.C) {
+	throttle := migration.NewLogThrottle(migration.LogTransferOptions{
+		MaxRecordsPerSecond: 1000,
+		MaxBytesPerSecond:   100,
+	})
+	now := time.Now()
+	c.Check(throttle.Delay(50, now), gc.Equals, time.Duration(0))
+	c.Check(throttle.Delay(150, now), gc.Equals, 500*time.Millisecond)
+	c.Check(throttle.Delay(10, now), gc.Equals, 2*time.Second)
+}
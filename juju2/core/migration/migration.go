@@ -32,15 +32,45 @@ type MigrationStatus struct {
 	// TargetInfo contains the details of how to connect to the target
 	// controller.
 	TargetInfo TargetInfo
+
+	// ImportProgress holds the steps of the IMPORT phase that have
+	// been completed, so that a restarted migrationmaster need not
+	// repeat them. See ImportModelStep and BinaryImportStep.
+	ImportProgress []string
+
+	// LogTransfer limits the logs sent to the target controller once
+	// the migration has succeeded.
+	LogTransfer LogTransferOptions
+}
+
+// ImportModelStep is the step of the IMPORT phase recorded in
+// MigrationStatus.ImportProgress once the model has been imported into
+// the target controller.
+const ImportModelStep = "model"
+
+// BinaryImportStep returns the step of the IMPORT phase recorded in
+// MigrationStatus.ImportProgress once the binary of the given kind
+// ("charm", "tools" or "resource") and name is on the target
+// controller.
+func BinaryImportStep(kind, name string) string {
+	return kind + " " + name
 }
 
 // SerializedModel wraps a buffer contain a serialised Juju model as
 // well as containing metadata about the charms and tools used by the
 // model.
 type SerializedModel struct {
-	// Bytes contains the serialized data for the model.
+	// Bytes contains the serialized data for the model. It is empty
+	// when the model was exported by version 2 or later of the
+	// MigrationMaster facade, which stages the serialized model to be
+	// downloaded instead.
 	Bytes []byte
 
+	// Size and SHA256 describe the staged serialized model, so that it
+	// can be checked once downloaded.
+	Size   int64
+	SHA256 string
+
 	// Charms lists the charm URLs in use in the model.
 	Charms []string
 
@@ -51,6 +81,29 @@ type SerializedModel struct {
 
 	// Resources represents all the resources in use in the model.
 	Resources []SerializedModelResource
+
+	// CharmSHA256s holds the SHA256 hash of each charm archive, keyed
+	// by charm URL.
+	CharmSHA256s map[string]string
+
+	// ToolsSHA256s holds the SHA256 hash of each tools tarball.
+	ToolsSHA256s map[version.Binary]string
+}
+
+// UploadedBinaries describes the binaries the target controller of a
+// migration already has for the model being imported, so that they need
+// not be uploaded again.
+type UploadedBinaries struct {
+	// Charms holds the SHA256 hash of each charm archive, keyed by
+	// charm URL.
+	Charms map[string]string
+
+	// Tools holds the SHA256 hash of each tools tarball.
+	Tools map[version.Binary]string
+
+	// Resources holds the fingerprint of the application revision of
+	// each resource, keyed by "application/resource".
+	Resources map[string]string
 }
 
 // SerializedModelResource defines the resource revisions for a
@@ -68,6 +121,15 @@ type ModelInfo struct {
 	Name                   string
 	AgentVersion           version.Number
 	ControllerAgentVersion version.Number
+
+	// DescriptionVersion holds the version of the model description
+	// the source controller will export, or 0 if it's not known.
+	DescriptionVersion int
+
+	// Features lists the features used by the model that may
+	// prevent it from being migrated, such as "storage" or
+	// "cross-model-relations".
+	Features []string
 }
 
 func (i *ModelInfo) Validate() error {
@@ -119,7 +119,7 @@ func (s *cmdSubnetSuite) TestSubnetAddWithoutZonesWhenProviderHasZones(c *gc.C)
 	c.Assert(subnet.CIDR(), gc.Equals, "0.10.0.0/24")
 	c.Assert(subnet.SpaceName(), gc.Equals, "myspace")
 	c.Assert(subnet.ProviderId(), gc.Equals, network.Id("dummy-private"))
-	c.Assert(subnet.AvailabilityZone(), gc.Equals, "zone1")
+	c.Assert(subnet.AvailabilityZones(), jc.DeepEquals, []string{"zone1", "zone2"})
 }
 
 func (s *cmdSubnetSuite) TestSubnetAddWithUnavailableZones(c *gc.C) {
@@ -143,7 +143,7 @@ func (s *cmdSubnetSuite) TestSubnetAddWithZonesWithNoProviderZones(c *gc.C) {
 	c.Assert(subnet.CIDR(), gc.Equals, "0.20.0.0/24")
 	c.Assert(subnet.SpaceName(), gc.Equals, "myspace")
 	c.Assert(subnet.ProviderId(), gc.Equals, network.Id("dummy-public"))
-	c.Assert(subnet.AvailabilityZone(), gc.Equals, "zone1")
+	c.Assert(subnet.AvailabilityZones(), jc.DeepEquals, []string{"zone1"})
 }
 
 func (s *cmdSubnetSuite) TestSubnetListNoResults(c *gc.C) {
@@ -160,8 +160,8 @@ func (s *cmdSubnetSuite) TestSubnetListResultsWithFilters(c *gc.C) {
 		CIDR: "10.0.0.0/8",
 	})
 	s.AddSubnet(c, state.SubnetInfo{
-		CIDR:             "10.10.0.0/16",
-		AvailabilityZone: "zone1",
+		CIDR:              "10.10.0.0/16",
+		AvailabilityZones: []string{"zone1"},
 	})
 	s.AddSpace(c, "myspace", []string{"10.10.0.0/16"}, true)
 
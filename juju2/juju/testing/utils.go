@@ -37,9 +37,10 @@ func AddControllerMachine(c *gc.C, st *state.State) *state.Machine {
 }
 
 // AddSubnetsWithTemplate adds numSubnets subnets, using the given
-// infoTemplate. Any string field in the infoTemplate can be specified
-// as a text/template string containing {{.}}, which is the current
-// index of the subnet-to-add (between 0 and numSubnets-1).
+// infoTemplate. Any string field in the infoTemplate, or availability
+// zone, can be specified as a text/template string containing {{.}},
+// which is the current index of the subnet-to-add (between 0 and
+// numSubnets-1).
 //
 // Example:
 //
@@ -47,7 +48,7 @@ func AddControllerMachine(c *gc.C, st *state.State) *state.Machine {
 //     CIDR: "10.10.{{.}}.0/24",
 //     ProviderId: "subnet-{{.}}",
 //     SpaceName: "space1",
-//     AvailabilityZone: "zone-{{.}}",
+//     AvailabilityZones: []string{"zone-{{.}}"},
 //     VLANTag: 42,
 // })
 //
@@ -57,7 +58,7 @@ func AddControllerMachine(c *gc.C, st *state.State) *state.Machine {
 //     CIDR: "10.10.0.0/24",
 //     ProviderId: "subnet-0",
 //     SpaceName: "space1",
-//     AvailabilityZone: "zone-0",
+//     AvailabilityZones: []string{"zone-0"},
 //     VLANTag: 42,
 // })
 // c.Assert(err, jc.ErrorIsNil)
@@ -65,7 +66,7 @@ func AddControllerMachine(c *gc.C, st *state.State) *state.Machine {
 //     CIDR: "10.10.1.0/24",
 //     ProviderId: "subnet-1",
 //     SpaceName: "space1",
-//     AvailabilityZone: "zone-1",
+//     AvailabilityZones: []string{"zone-1"},
 //     VLANTag: 42,
 // })
 func AddSubnetsWithTemplate(c *gc.C, st *state.State, numSubnets uint, infoTemplate state.SubnetInfo) {
@@ -86,7 +87,10 @@ func AddSubnetsWithTemplate(c *gc.C, st *state.State, numSubnets uint, infoTempl
 
 		info.ProviderId = network.Id(permute(string(info.ProviderId)))
 		info.CIDR = permute(info.CIDR)
-		info.AvailabilityZone = permute(info.AvailabilityZone)
+		info.AvailabilityZones = make([]string, len(infoTemplate.AvailabilityZones))
+		for i, zone := range infoTemplate.AvailabilityZones {
+			info.AvailabilityZones[i] = permute(zone)
+		}
 		info.SpaceName = permute(info.SpaceName)
 
 		_, err := st.AddSubnet(info)
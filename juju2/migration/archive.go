@@ -0,0 +1,539 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/version"
+	"gopkg.in/juju/charm.v6-unstable"
+	charmresource "gopkg.in/juju/charm.v6-unstable/resource"
+	"gopkg.in/yaml.v2"
+
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
+	"github.com/juju/1.25-upgrade/juju2/resource"
+)
+
+// ArchiveFormatVersion is the version of the archive format written by
+// ArchiveWriter. ReadArchive refuses archives of any later version.
+const ArchiveFormatVersion = 1
+
+// The kinds of file held in a model archive.
+const (
+	ArchiveModel    = "model"
+	ArchiveCharm    = "charm"
+	ArchiveTools    = "tools"
+	ArchiveResource = "resource"
+	ArchiveLogs     = "logs"
+)
+
+const (
+	archiveManifestPath = "manifest.yaml"
+	archiveModelPath    = "model.yaml"
+	archiveLogsPath     = "logs.json"
+
+	// maxManifestSize limits how much of an archive is read into
+	// memory as the manifest.
+	maxManifestSize = 64 << 20
+)
+
+// ArchiveManifest describes the content of a model archive. It is the
+// last file in the archive, written once the hashes of the others are
+// known.
+type ArchiveManifest struct {
+	FormatVersion int    `yaml:"format-version"`
+	Created       string `yaml:"created"`
+	ModelUUID     string `yaml:"model-uuid"`
+	ModelName     string `yaml:"model-name"`
+
+	// SourceVersion is the version of the controller the model was
+	// exported from.
+	SourceVersion string `yaml:"source-version"`
+
+	// DescriptionVersion is the version of the model description in
+	// the archive.
+	DescriptionVersion int `yaml:"description-version"`
+
+	Files []ArchiveFile `yaml:"files"`
+}
+
+// ArchiveFile describes one of the files in a model archive.
+type ArchiveFile struct {
+	Path string `yaml:"path"`
+	Kind string `yaml:"kind"`
+
+	// Name identifies the binary held in the file: a charm URL,
+	// tools version, or application and resource name.
+	Name string `yaml:"name,omitempty"`
+
+	Size   int64  `yaml:"size"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// ArchiveWriter writes a model archive: a gzipped tarball holding the
+// serialized model, the charms, tools and resources it uses, its logs,
+// and a manifest with the size and SHA256 hash of each file.
+type ArchiveWriter struct {
+	gzip     *gzip.Writer
+	tar      *tar.Writer
+	manifest ArchiveManifest
+	paths    map[string]bool
+}
+
+// NewArchiveWriter returns an ArchiveWriter that writes to w. The
+// manifest provides the details of the model; its format version,
+// description version and files are filled in by the writer. Close
+// must be called to complete the archive.
+func NewArchiveWriter(w io.Writer, manifest ArchiveManifest) *ArchiveWriter {
+	manifest.FormatVersion = ArchiveFormatVersion
+	manifest.DescriptionVersion = 0
+	manifest.Files = nil
+	gz := gzip.NewWriter(w)
+	return &ArchiveWriter{
+		gzip:     gz,
+		tar:      tar.NewWriter(gz),
+		manifest: manifest,
+		paths:    make(map[string]bool),
+	}
+}
+
+// AddModel adds the serialized model description.
+func (w *ArchiveWriter) AddModel(serialized []byte) error {
+	descriptionVersion, err := DescriptionVersion(serialized)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	w.manifest.DescriptionVersion = descriptionVersion
+	_, err = w.add(ArchiveModel, "", archiveModelPath, bytes.NewReader(serialized), int64(len(serialized)))
+	return errors.Trace(err)
+}
+
+// AddCharm adds the archive of the charm with the URL, returning its
+// details as recorded in the manifest.
+func (w *ArchiveWriter) AddCharm(curl string, r io.Reader, size int64) (ArchiveFile, error) {
+	return w.add(ArchiveCharm, curl, charmArchivePath(curl), r, size)
+}
+
+// AddTools adds the tools tarball of the version, returning its details
+// as recorded in the manifest.
+func (w *ArchiveWriter) AddTools(v version.Binary, r io.Reader, size int64) (ArchiveFile, error) {
+	return w.add(ArchiveTools, v.String(), toolsArchivePath(v), r, size)
+}
+
+// AddResource adds the application's current revision of the resource,
+// returning its details as recorded in the manifest.
+func (w *ArchiveWriter) AddResource(application, name string, r io.Reader, size int64) (ArchiveFile, error) {
+	return w.add(ArchiveResource, application+"/"+name, resourceArchivePath(application, name), r, size)
+}
+
+// AddLogs adds the model's log records, which are JSON-encoded
+// params.LogRecord values, one per line.
+func (w *ArchiveWriter) AddLogs(r io.Reader, size int64) (ArchiveFile, error) {
+	return w.add(ArchiveLogs, "", archiveLogsPath, r, size)
+}
+
+func (w *ArchiveWriter) add(kind, name, filePath string, r io.Reader, size int64) (ArchiveFile, error) {
+	var empty ArchiveFile
+	if w.paths[filePath] {
+		return empty, errors.AlreadyExistsf("%s %q in archive", kind, filePath)
+	}
+	err := w.tar.WriteHeader(&tar.Header{
+		Name:     filePath,
+		Mode:     0600,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return empty, errors.Annotatef(err, "writing %s header", kind)
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(w.tar, hash), io.LimitReader(r, size))
+	if err != nil {
+		return empty, errors.Annotatef(err, "writing %s", kind)
+	}
+	if written != size {
+		return empty, errors.Errorf("%s %q has %d bytes, expected %d", kind, filePath, written, size)
+	}
+	file := ArchiveFile{
+		Path:   filePath,
+		Kind:   kind,
+		Name:   name,
+		Size:   size,
+		SHA256: fmt.Sprintf("%x", hash.Sum(nil)),
+	}
+	w.paths[filePath] = true
+	w.manifest.Files = append(w.manifest.Files, file)
+	return file, nil
+}
+
+// Close writes the manifest and finishes the archive. It does not
+// close the underlying writer.
+func (w *ArchiveWriter) Close() error {
+	if w.manifest.DescriptionVersion == 0 {
+		return errors.New("no model added to archive")
+	}
+	data, err := yaml.Marshal(w.manifest)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = w.tar.WriteHeader(&tar.Header{
+		Name:     archiveManifestPath,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return errors.Annotate(err, "writing manifest header")
+	}
+	if _, err := w.tar.Write(data); err != nil {
+		return errors.Annotate(err, "writing manifest")
+	}
+	if err := w.tar.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(w.gzip.Close())
+}
+
+func charmArchivePath(curl string) string {
+	return path.Join("charms", url.PathEscape(curl)+".zip")
+}
+
+func toolsArchivePath(v version.Binary) string {
+	return path.Join("tools", v.String()+".tgz")
+}
+
+func resourceArchivePath(application, name string) string {
+	return path.Join("resources", url.PathEscape(application), url.PathEscape(name))
+}
+
+// Archive is a model archive that has been unpacked into a directory.
+// It provides the archived binaries as a CharmDownloader,
+// ToolsDownloader and ResourceDownloader, so they can be uploaded to a
+// controller with UploadBinaries.
+type Archive struct {
+	dir      string
+	Manifest ArchiveManifest
+}
+
+// ReadArchive unpacks the model archive read from r into dir, which
+// should be empty. Every file is checked against the size and SHA256
+// hash given in the manifest, and an error is returned if any of them
+// differ, or are missing from the archive or the manifest.
+func ReadArchive(r io.Reader, dir string) (*Archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Annotate(err, "reading archive")
+	}
+	defer gz.Close()
+
+	var manifestData []byte
+	unpacked := make(map[string]ArchiveFile)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Annotate(err, "reading archive")
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			return nil, errors.Errorf("archive entry %q is not a regular file", header.Name)
+		}
+		if header.Name == archiveManifestPath {
+			manifestData, err = ioutil.ReadAll(io.LimitReader(tr, maxManifestSize+1))
+			if err != nil {
+				return nil, errors.Annotate(err, "reading manifest")
+			}
+			if len(manifestData) > maxManifestSize {
+				return nil, errors.New("manifest too large")
+			}
+			continue
+		}
+		file, err := unpackArchiveFile(dir, header.Name, tr)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		unpacked[file.Path] = file
+	}
+	if manifestData == nil {
+		return nil, errors.New("archive has no manifest")
+	}
+
+	archive := &Archive{dir: dir}
+	if err := yaml.Unmarshal(manifestData, &archive.Manifest); err != nil {
+		return nil, errors.Annotate(err, "reading manifest")
+	}
+	if err := archive.checkManifest(unpacked); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return archive, nil
+}
+
+// unpackArchiveFile writes the content of an archive entry below dir,
+// returning its size and hash.
+func unpackArchiveFile(dir, name string, r io.Reader) (ArchiveFile, error) {
+	var empty ArchiveFile
+	// Entries may only be written below dir.
+	clean := path.Clean(name)
+	if clean != name || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return empty, errors.Errorf("archive entry %q not valid", name)
+	}
+	target := filepath.Join(dir, filepath.FromSlash(clean))
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return empty, errors.Trace(err)
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return empty, errors.Annotatef(err, "unpacking %q", name)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), r)
+	if err != nil {
+		return empty, errors.Annotatef(err, "unpacking %q", name)
+	}
+	return ArchiveFile{
+		Path:   clean,
+		Size:   size,
+		SHA256: fmt.Sprintf("%x", hash.Sum(nil)),
+	}, nil
+}
+
+// checkManifest returns an error if the manifest is of an unsupported
+// format, or does not match the unpacked files.
+func (a *Archive) checkManifest(unpacked map[string]ArchiveFile) error {
+	m := a.Manifest
+	if m.FormatVersion == 0 {
+		return errors.New("manifest has no format version")
+	}
+	if m.FormatVersion > ArchiveFormatVersion {
+		return errors.Errorf("archive format version %d not supported (latest supported is %d)",
+			m.FormatVersion, ArchiveFormatVersion)
+	}
+	if m.DescriptionVersion == 0 {
+		return errors.New("manifest has no model description version")
+	}
+	models := 0
+	listed := make(map[string]bool)
+	for _, file := range m.Files {
+		got, ok := unpacked[file.Path]
+		if !ok {
+			return errors.Errorf("%s %q missing from archive", file.Kind, file.Path)
+		}
+		if got.Size != file.Size {
+			return errors.Errorf("%s %q has %d bytes, manifest has %d", file.Kind, file.Path, got.Size, file.Size)
+		}
+		if got.SHA256 != file.SHA256 {
+			return errors.Errorf("%s %q has sha256 %s, manifest has %s", file.Kind, file.Path, got.SHA256, file.SHA256)
+		}
+		if file.Kind == ArchiveModel {
+			models++
+		}
+		listed[file.Path] = true
+	}
+	for filePath := range unpacked {
+		if !listed[filePath] {
+			return errors.Errorf("archive entry %q not in manifest", filePath)
+		}
+	}
+	if models != 1 {
+		return errors.Errorf("archive has %d models, expected 1", models)
+	}
+	return nil
+}
+
+// Model returns the serialized model description.
+func (a *Archive) Model() ([]byte, error) {
+	file, err := a.find(ArchiveModel, "")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data, err := ioutil.ReadFile(a.path(file))
+	return data, errors.Trace(err)
+}
+
+// OpenCharm is part of the CharmDownloader interface.
+func (a *Archive) OpenCharm(curl *charm.URL) (io.ReadCloser, error) {
+	return a.open(ArchiveCharm, curl.String())
+}
+
+// OpenURI is part of the ToolsDownloader interface. The URIs of the
+// tools are those given in the Tools of the archive's SerializedModel.
+func (a *Archive) OpenURI(uri string, query url.Values) (io.ReadCloser, error) {
+	for _, file := range a.Manifest.Files {
+		if file.Kind == ArchiveTools && file.Path == uri {
+			return a.openFile(file)
+		}
+	}
+	return nil, errors.NotFoundf("tools %q in archive", uri)
+}
+
+// OpenResource is part of the ResourceDownloader interface.
+func (a *Archive) OpenResource(application, name string) (io.ReadCloser, error) {
+	return a.open(ArchiveResource, application+"/"+name)
+}
+
+// OpenLogs returns the model's log records, as written by
+// ArchiveWriter.AddLogs. An error satisfying errors.IsNotFound is
+// returned if the archive has none.
+func (a *Archive) OpenLogs() (io.ReadCloser, error) {
+	return a.open(ArchiveLogs, "")
+}
+
+func (a *Archive) open(kind, name string) (io.ReadCloser, error) {
+	file, err := a.find(kind, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return a.openFile(file)
+}
+
+func (a *Archive) openFile(file ArchiveFile) (io.ReadCloser, error) {
+	f, err := os.Open(a.path(file))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return f, nil
+}
+
+func (a *Archive) find(kind, name string) (ArchiveFile, error) {
+	for _, file := range a.Manifest.Files {
+		if file.Kind == kind && file.Name == name {
+			return file, nil
+		}
+	}
+	if name == "" {
+		return ArchiveFile{}, errors.NotFoundf("%s in archive", kind)
+	}
+	return ArchiveFile{}, errors.NotFoundf("%s %s in archive", kind, name)
+}
+
+func (a *Archive) path(file ArchiveFile) string {
+	return filepath.Join(a.dir, filepath.FromSlash(file.Path))
+}
+
+// SerializedModel returns the serialized model, with the archived
+// charms and tools and the resources used by the model, ready to be
+// uploaded with UploadBinaries using the archive as the downloader.
+// The model is the deserialized form of bytes, which may have been
+// upgraded from the description version in the archive.
+func (a *Archive) SerializedModel(model description.Model, bytes []byte) (coremigration.SerializedModel, error) {
+	serialized := coremigration.SerializedModel{
+		Bytes:        bytes,
+		Tools:        make(map[version.Binary]string),
+		CharmSHA256s: make(map[string]string),
+		ToolsSHA256s: make(map[version.Binary]string),
+	}
+	for _, file := range a.Manifest.Files {
+		switch file.Kind {
+		case ArchiveCharm:
+			serialized.Charms = append(serialized.Charms, file.Name)
+			serialized.CharmSHA256s[file.Name] = file.SHA256
+		case ArchiveTools:
+			v, err := version.ParseBinary(file.Name)
+			if err != nil {
+				return serialized, errors.Annotatef(err, "archived tools %q", file.Path)
+			}
+			serialized.Tools[v] = file.Path
+			serialized.ToolsSHA256s[v] = file.SHA256
+		}
+	}
+	resources, err := modelResources(model)
+	if err != nil {
+		return serialized, errors.Trace(err)
+	}
+	serialized.Resources = resources
+	return serialized, nil
+}
+
+// modelResources returns the resources used by the model's
+// applications, with the revisions of them used by each unit.
+func modelResources(model description.Model) ([]coremigration.SerializedModelResource, error) {
+	var out []coremigration.SerializedModelResource
+	for _, app := range model.Applications() {
+		for _, res := range app.Resources() {
+			appRev, err := resourceRevision(app.Name(), res.Name(), res.ApplicationRevision())
+			if err != nil {
+				return nil, errors.Annotatef(err, "resource %s/%s", app.Name(), res.Name())
+			}
+			csRev, err := resourceRevision(app.Name(), res.Name(), res.CharmStoreRevision())
+			if err != nil {
+				return nil, errors.Annotatef(err, "resource %s/%s", app.Name(), res.Name())
+			}
+			unitRevs := make(map[string]resource.Resource)
+			for _, unit := range app.Units() {
+				for _, unitRes := range unit.Resources() {
+					if unitRes.Name() != res.Name() {
+						continue
+					}
+					unitRev, err := resourceRevision(app.Name(), res.Name(), unitRes.Revision())
+					if err != nil {
+						return nil, errors.Annotatef(err, "resource %s/%s of unit %s", app.Name(), res.Name(), unit.Name())
+					}
+					unitRevs[unit.Name()] = unitRev
+				}
+			}
+			out = append(out, coremigration.SerializedModelResource{
+				ApplicationRevision: appRev,
+				CharmStoreRevision:  csRev,
+				UnitRevisions:       unitRevs,
+			})
+		}
+	}
+	return out, nil
+}
+
+func resourceRevision(app, name string, rev description.ResourceRevision) (resource.Resource, error) {
+	var empty resource.Resource
+	if rev == nil {
+		return resource.Resource{
+			Resource:      charmresource.Resource{Meta: charmresource.Meta{Name: name}},
+			ApplicationID: app,
+		}, nil
+	}
+	type_, err := charmresource.ParseType(rev.Type())
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	origin, err := charmresource.ParseOrigin(rev.Origin())
+	if err != nil {
+		return empty, errors.Trace(err)
+	}
+	var fp charmresource.Fingerprint
+	if hex := rev.FingerprintHex(); hex != "" {
+		if fp, err = charmresource.ParseFingerprint(hex); err != nil {
+			return empty, errors.Annotate(err, "invalid fingerprint")
+		}
+	}
+	return resource.Resource{
+		Resource: charmresource.Resource{
+			Meta: charmresource.Meta{
+				Name:        name,
+				Type:        type_,
+				Path:        rev.Path(),
+				Description: rev.Description(),
+			},
+			Origin:      origin,
+			Revision:    rev.Revision(),
+			Size:        rev.Size(),
+			Fingerprint: fp,
+		},
+		ApplicationID: app,
+		Username:      rev.Username(),
+		Timestamp:     rev.Timestamp(),
+	}, nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v6-unstable"
+	"gopkg.in/juju/names.v2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/migration"
+)
+
+type ArchiveSuite struct {
+	serialized []byte
+}
+
+var _ = gc.Suite(&ArchiveSuite{})
+
+const (
+	testCharmURL = "cs:trusty/mysql-38"
+	testLogs     = `{"t":"2017-08-01T12:00:00Z","m":"juju.worker","l":"foo.go:1","v":"INFO","x":"hello","e":"machine-0"}` + "\n"
+)
+
+var testToolsVersion = version.MustParseBinary("2.2.2-trusty-amd64")
+
+func (s *ArchiveSuite) SetUpTest(c *gc.C) {
+	model := description.NewModel(description.ModelArgs{
+		Owner:  names.NewUserTag("owner"),
+		Config: map[string]interface{}{"name": "foo", "uuid": "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6"},
+	})
+	var err error
+	s.serialized, err = description.Serialize(model)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *ArchiveSuite) writeArchive(c *gc.C) []byte {
+	var buf bytes.Buffer
+	w := migration.NewArchiveWriter(&buf, migration.ArchiveManifest{
+		Created:       "2017-08-01T12:00:00Z",
+		ModelUUID:     "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6",
+		ModelName:     "foo",
+		SourceVersion: "1.25.10",
+	})
+	c.Assert(w.AddModel(s.serialized), jc.ErrorIsNil)
+	file, err := w.AddCharm(testCharmURL, strings.NewReader("charm"), 5)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(file, jc.DeepEquals, migration.ArchiveFile{
+		Path:   "charms/cs:trusty%2Fmysql-38.zip",
+		Kind:   migration.ArchiveCharm,
+		Name:   testCharmURL,
+		Size:   5,
+		SHA256: sha256Hex("charm"),
+	})
+	_, err = w.AddTools(testToolsVersion, strings.NewReader("tools"), 5)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = w.AddResource("mysql", "data", strings.NewReader("resource"), 8)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = w.AddLogs(strings.NewReader(testLogs), int64(len(testLogs)))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	return buf.Bytes()
+}
+
+func sha256Hex(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+func (s *ArchiveSuite) TestRoundTrip(c *gc.C) {
+	archive, err := migration.ReadArchive(bytes.NewReader(s.writeArchive(c)), c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+
+	m := archive.Manifest
+	c.Check(m.FormatVersion, gc.Equals, migration.ArchiveFormatVersion)
+	c.Check(m.ModelUUID, gc.Equals, "bd3fae18-5ea1-4bc5-8837-45400cf1f8f6")
+	c.Check(m.ModelName, gc.Equals, "foo")
+	c.Check(m.SourceVersion, gc.Equals, "1.25.10")
+	c.Check(m.DescriptionVersion, gc.Equals, migration.CurrentDescriptionVersion)
+	c.Check(m.Files, gc.HasLen, 5)
+
+	model, err := archive.Model()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(model), gc.Equals, string(s.serialized))
+
+	curl := charm.MustParseURL(testCharmURL)
+	charmReader, err := archive.OpenCharm(curl)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(readCloserContent(c, charmReader), gc.Equals, "charm")
+
+	_, err = archive.OpenCharm(charm.MustParseURL("cs:trusty/mysql-39"))
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+
+	resourceReader, err := archive.OpenResource("mysql", "data")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(readCloserContent(c, resourceReader), gc.Equals, "resource")
+
+	logsReader, err := archive.OpenLogs()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(readCloserContent(c, logsReader), gc.Equals, testLogs)
+
+	desc, err := description.Deserialize(model)
+	c.Assert(err, jc.ErrorIsNil)
+	serialized, err := archive.SerializedModel(desc, model)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(serialized.Charms, jc.DeepEquals, []string{testCharmURL})
+	c.Check(serialized.CharmSHA256s, jc.DeepEquals, map[string]string{testCharmURL: sha256Hex("charm")})
+	c.Check(serialized.ToolsSHA256s, jc.DeepEquals, map[version.Binary]string{testToolsVersion: sha256Hex("tools")})
+	c.Assert(serialized.Tools, gc.HasLen, 1)
+	toolsReader, err := archive.OpenURI(serialized.Tools[testToolsVersion], nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(readCloserContent(c, toolsReader), gc.Equals, "tools")
+	c.Check(serialized.Resources, gc.HasLen, 0)
+}
+
+func readCloserContent(c *gc.C, r io.ReadCloser) string {
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, jc.ErrorIsNil)
+	return string(data)
+}
+
+func (s *ArchiveSuite) TestNoLogs(c *gc.C) {
+	var buf bytes.Buffer
+	w := migration.NewArchiveWriter(&buf, migration.ArchiveManifest{ModelName: "foo"})
+	c.Assert(w.AddModel(s.serialized), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	archive, err := migration.ReadArchive(&buf, c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = archive.OpenLogs()
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *ArchiveSuite) TestWriterErrors(c *gc.C) {
+	w := migration.NewArchiveWriter(ioutil.Discard, migration.ArchiveManifest{})
+	c.Check(w.Close(), gc.ErrorMatches, "no model added to archive")
+
+	w = migration.NewArchiveWriter(ioutil.Discard, migration.ArchiveManifest{})
+	_, err := w.AddCharm(testCharmURL, strings.NewReader("char"), 5)
+	c.Check(err, gc.ErrorMatches, `charm "charms/cs:trusty%2Fmysql-38.zip" has 4 bytes, expected 5`)
+
+	w = migration.NewArchiveWriter(ioutil.Discard, migration.ArchiveManifest{})
+	_, err = w.AddTools(testToolsVersion, strings.NewReader("tools"), 5)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = w.AddTools(testToolsVersion, strings.NewReader("tools"), 5)
+	c.Check(err, jc.Satisfies, errors.IsAlreadyExists)
+}
+
+// archiveEntry is an entry of a hand-made archive.
+type archiveEntry struct {
+	name    string
+	content string
+}
+
+func makeArchive(c *gc.C, entries ...archiveEntry) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     entry.name,
+			Mode:     0600,
+			Size:     int64(len(entry.content)),
+			Typeflag: tar.TypeReg,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		_, err = tw.Write([]byte(entry.content))
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	c.Assert(tw.Close(), jc.ErrorIsNil)
+	c.Assert(gz.Close(), jc.ErrorIsNil)
+	return buf.Bytes()
+}
+
+func (s *ArchiveSuite) manifest(c *gc.C, tweak func(*migration.ArchiveManifest)) archiveEntry {
+	manifest := migration.ArchiveManifest{
+		FormatVersion:      1,
+		DescriptionVersion: 1,
+		Files: []migration.ArchiveFile{{
+			Path:   "model.yaml",
+			Kind:   migration.ArchiveModel,
+			Size:   int64(len(s.serialized)),
+			SHA256: sha256Hex(string(s.serialized)),
+		}},
+	}
+	tweak(&manifest)
+	data, err := yaml.Marshal(manifest)
+	c.Assert(err, jc.ErrorIsNil)
+	return archiveEntry{"manifest.yaml", string(data)}
+}
+
+func (s *ArchiveSuite) TestReadErrors(c *gc.C) {
+	model := archiveEntry{"model.yaml", string(s.serialized)}
+	noChange := func(*migration.ArchiveManifest) {}
+	for i, test := range []struct {
+		entries []archiveEntry
+		err     string
+	}{{
+		entries: []archiveEntry{model},
+		err:     "archive has no manifest",
+	}, {
+		entries: []archiveEntry{model, {"../escape", "x"}, s.manifest(c, noChange)},
+		err:     `archive entry "../escape" not valid`,
+	}, {
+		entries: []archiveEntry{model, {"/etc/passwd", "x"}, s.manifest(c, noChange)},
+		err:     `archive entry "/etc/passwd" not valid`,
+	}, {
+		entries: []archiveEntry{model, {"extra", "x"}, s.manifest(c, noChange)},
+		err:     `archive entry "extra" not in manifest`,
+	}, {
+		entries: []archiveEntry{{"model.yaml", "version: 1\n"}, s.manifest(c, noChange)},
+		err:     `model "model.yaml" has 11 bytes, manifest has .*`,
+	}, {
+		entries: []archiveEntry{model, s.manifest(c, func(m *migration.ArchiveManifest) {
+			m.Files[0].SHA256 = sha256Hex("other")
+		})},
+		err: `model "model.yaml" has sha256 .*, manifest has .*`,
+	}, {
+		entries: []archiveEntry{model, s.manifest(c, func(m *migration.ArchiveManifest) {
+			m.Files = append(m.Files, migration.ArchiveFile{Path: "logs.json", Kind: migration.ArchiveLogs})
+		})},
+		err: `logs "logs.json" missing from archive`,
+	}, {
+		entries: []archiveEntry{s.manifest(c, func(m *migration.ArchiveManifest) {
+			m.Files = nil
+		})},
+		err: "archive has 0 models, expected 1",
+	}, {
+		entries: []archiveEntry{model, s.manifest(c, func(m *migration.ArchiveManifest) {
+			m.FormatVersion = 2
+		})},
+		err: `archive format version 2 not supported \(latest supported is 1\)`,
+	}, {
+		entries: []archiveEntry{model, s.manifest(c, func(m *migration.ArchiveManifest) {
+			m.FormatVersion = 0
+		})},
+		err: "manifest has no format version",
+	}, {
+		entries: []archiveEntry{model, s.manifest(c, func(m *migration.ArchiveManifest) {
+			m.DescriptionVersion = 0
+		})},
+		err: "manifest has no model description version",
+	}} {
+		c.Logf("test %d", i)
+		_, err := migration.ReadArchive(bytes.NewReader(makeArchive(c, test.entries...)), c.MkDir())
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *ArchiveSuite) TestReadNotArchive(c *gc.C) {
+	_, err := migration.ReadArchive(strings.NewReader("not an archive"), c.MkDir())
+	c.Check(err, gc.ErrorMatches, "reading archive: .*")
+}
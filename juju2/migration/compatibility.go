@@ -0,0 +1,193 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/description"
+	"github.com/juju/errors"
+	"github.com/juju/version"
+	"gopkg.in/yaml.v2"
+
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
+	"github.com/juju/1.25-upgrade/juju2/state"
+)
+
+// The features a model may use that not every migration can carry.
+// They are reported in coremigration.ModelInfo.Features, and a feature
+// should only be added here along with a Compatibility that cannot
+// carry it.
+const (
+	FeatureRemoteApplications = "cross-model-relations"
+)
+
+// CurrentDescriptionVersion is the version of the model description
+// written by this controller's exporter.
+const CurrentDescriptionVersion = 1
+
+// VersionRange holds an inclusive range of controller versions. Only
+// the major and minor version numbers are considered.
+type VersionRange struct {
+	Min version.Number
+	Max version.Number
+}
+
+// Contains returns whether the version is in the range.
+func (r VersionRange) Contains(ver version.Number) bool {
+	ver = versionToMajMin(ver)
+	return ver.Compare(versionToMajMin(r.Min)) >= 0 && ver.Compare(versionToMajMin(r.Max)) <= 0
+}
+
+// String returns the range as "2.1" or "2.1-2.2".
+func (r VersionRange) String() string {
+	min := fmt.Sprintf("%d.%d", r.Min.Major, r.Min.Minor)
+	max := fmt.Sprintf("%d.%d", r.Max.Major, r.Max.Minor)
+	if min == max {
+		return min
+	}
+	return min + "-" + max
+}
+
+// Compatibility describes the models that target controllers in a
+// range of versions accept from source controllers in a range of
+// versions.
+type Compatibility struct {
+	Source VersionRange
+	Target VersionRange
+
+	// DescriptionVersions holds the versions of the model
+	// description that can be imported.
+	DescriptionVersions []int
+
+	// UnsupportedFeatures maps each feature that cannot be migrated
+	// to what should be done about it before migrating.
+	UnsupportedFeatures map[string]string
+}
+
+// CompatibilityTable lists the migrations between controllers of
+// different major versions that are supported. A migration between
+// controllers of the same major version is supported as long as the
+// source controller is not newer than the target, and is checked
+// with DefaultCompatibility.
+var CompatibilityTable = []Compatibility{{
+	// Juju 1.25 environments are exported by the 1.25-upgrade tool.
+	// Only the 2.1 and 2.2 controllers it has been tested against are
+	// listed; the target range must not be widened without checking
+	// the description versions the new controllers accept.
+	Source: VersionRange{
+		Min: version.MustParse("1.25.0"),
+		Max: version.MustParse("1.25.0"),
+	},
+	Target: VersionRange{
+		Min: version.MustParse("2.1.0"),
+		Max: version.MustParse("2.2.0"),
+	},
+	DescriptionVersions: []int{1},
+	UnsupportedFeatures: map[string]string{
+		FeatureRemoteApplications: "remove the relations to remote applications",
+	},
+}}
+
+// DefaultCompatibility is used for migrations between controllers of
+// the same major version.
+var DefaultCompatibility = Compatibility{
+	DescriptionVersions: []int{CurrentDescriptionVersion},
+	UnsupportedFeatures: map[string]string{
+		// Cross-model relations are limited to models on the same
+		// controller, and the model is moving to a new one.
+		FeatureRemoteApplications: "remove the relations to remote applications",
+	},
+}
+
+// FindCompatibility returns the entry of the CompatibilityTable that
+// covers migrations from the source controller version to the target
+// controller version, or an error if there is none.
+func FindCompatibility(source, target version.Number) (Compatibility, error) {
+	if !controllerVersionCompatible(source, target) {
+		return Compatibility{}, errors.Errorf("source controller has higher version than target controller (%s > %s)",
+			source, target)
+	}
+	for _, compat := range CompatibilityTable {
+		if compat.Source.Contains(source) && compat.Target.Contains(target) {
+			return compat, nil
+		}
+	}
+	if source.Major == target.Major {
+		return DefaultCompatibility, nil
+	}
+	return Compatibility{}, errors.Errorf("migrating models from %d.%d controllers to %d.%d controllers is not supported",
+		source.Major, source.Minor, target.Major, target.Minor)
+}
+
+// CheckModel returns an error if the model cannot be migrated as
+// described by compat. The model's description version and features
+// are only checked if they were reported.
+func (compat Compatibility) CheckModel(modelInfo coremigration.ModelInfo) error {
+	if modelInfo.DescriptionVersion != 0 && !compat.supportsDescription(modelInfo.DescriptionVersion) {
+		return errors.Errorf("model description version %d not supported (target accepts %s)",
+			modelInfo.DescriptionVersion, formatInts(compat.DescriptionVersions))
+	}
+	for _, feature := range modelInfo.Features {
+		if advice, ok := compat.UnsupportedFeatures[feature]; ok {
+			return errors.Errorf("model uses %s, which cannot be migrated: %s first", feature, advice)
+		}
+	}
+	return nil
+}
+
+func (compat Compatibility) supportsDescription(descriptionVersion int) bool {
+	for _, v := range compat.DescriptionVersions {
+		if v == descriptionVersion {
+			return true
+		}
+	}
+	return false
+}
+
+func formatInts(values []int) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = strconv.Itoa(v)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// ModelFeatures returns the features used by the model that may
+// prevent it from being migrated. See FeatureRemoteApplications.
+func ModelFeatures(model description.Model) []string {
+	return EntityFeatures(state.MigrationEntityCounts{
+		RemoteApplications: len(model.RemoteApplications()),
+	})
+}
+
+// EntityFeatures returns the features used by a model with the given
+// entity counts, as ModelFeatures does for an exported model. It lets
+// the features of a model in state be found without exporting it.
+func EntityFeatures(counts state.MigrationEntityCounts) []string {
+	var features []string
+	if counts.RemoteApplications > 0 {
+		features = append(features, FeatureRemoteApplications)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// DescriptionVersion returns the version of a serialized model
+// description.
+func DescriptionVersion(serialized []byte) (int, error) {
+	var doc struct {
+		Version int `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(serialized, &doc); err != nil {
+		return 0, errors.Annotate(err, "reading model description version")
+	}
+	if doc.Version == 0 {
+		return 0, errors.New("model description has no version")
+	}
+	return doc.Version, nil
+}
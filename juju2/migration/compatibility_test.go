@@ -0,0 +1,145 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration_test
+
+import (
+	"github.com/juju/description"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/names.v2"
+
+	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
+	"github.com/juju/1.25-upgrade/juju2/migration"
+	"github.com/juju/1.25-upgrade/juju2/state"
+)
+
+type CompatibilitySuite struct{}
+
+var _ = gc.Suite(&CompatibilitySuite{})
+
+func (*CompatibilitySuite) TestVersionRange(c *gc.C) {
+	r := migration.VersionRange{
+		Min: version.MustParse("2.1.0"),
+		Max: version.MustParse("2.2.0"),
+	}
+	for _, in := range []string{"2.1.0", "2.1-beta1", "2.2.9", "2.2.2.1"} {
+		c.Check(r.Contains(version.MustParse(in)), jc.IsTrue, gc.Commentf(in))
+	}
+	for _, out := range []string{"2.0.4", "2.3.0", "1.25.10", "3.1.0"} {
+		c.Check(r.Contains(version.MustParse(out)), jc.IsFalse, gc.Commentf(out))
+	}
+	c.Check(r.String(), gc.Equals, "2.1-2.2")
+	r.Max = r.Min
+	c.Check(r.String(), gc.Equals, "2.1")
+}
+
+func (*CompatibilitySuite) TestFindCompatibility(c *gc.C) {
+	for i, test := range []struct {
+		source, target string
+		expectDefault  bool
+		expectErr      string
+	}{{
+		source: "1.25.10",
+		target: "2.2.2",
+	}, {
+		source: "1.25.6",
+		target: "2.1.3",
+	}, {
+		source:    "1.25.10",
+		target:    "2.0.4",
+		expectErr: `migrating models from 1.25 controllers to 2.0 controllers is not supported`,
+	}, {
+		source:    "1.25.10",
+		target:    "2.3.0",
+		expectErr: `migrating models from 1.25 controllers to 2.3 controllers is not supported`,
+	}, {
+		source:        "2.1.3",
+		target:        "2.2.2",
+		expectDefault: true,
+	}, {
+		source:        "2.2.3",
+		target:        "2.2.2",
+		expectDefault: true,
+	}, {
+		source:    "2.3.0",
+		target:    "2.2.2",
+		expectErr: `source controller has higher version than target controller \(2.3.0 > 2.2.2\)`,
+	}} {
+		c.Logf("test %d: %s -> %s", i, test.source, test.target)
+		compat, err := migration.FindCompatibility(version.MustParse(test.source), version.MustParse(test.target))
+		if test.expectErr != "" {
+			c.Check(err, gc.ErrorMatches, test.expectErr)
+			continue
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		if test.expectDefault {
+			c.Check(compat, jc.DeepEquals, migration.DefaultCompatibility)
+		} else {
+			c.Check(compat, jc.DeepEquals, migration.CompatibilityTable[0])
+		}
+	}
+}
+
+func (*CompatibilitySuite) TestCheckModel(c *gc.C) {
+	compat := migration.Compatibility{
+		DescriptionVersions: []int{1, 2},
+		UnsupportedFeatures: map[string]string{
+			migration.FeatureRemoteApplications: "remove the remote applications",
+		},
+	}
+	info := coremigration.ModelInfo{
+		DescriptionVersion: 2,
+	}
+	c.Check(compat.CheckModel(info), jc.ErrorIsNil)
+
+	// Models from sources that don't report these aren't checked.
+	c.Check(compat.CheckModel(coremigration.ModelInfo{}), jc.ErrorIsNil)
+
+	info.DescriptionVersion = 3
+	c.Check(compat.CheckModel(info), gc.ErrorMatches,
+		`model description version 3 not supported \(target accepts 1, 2\)`)
+
+	info.DescriptionVersion = 1
+	info.Features = append(info.Features, migration.FeatureRemoteApplications)
+	c.Check(compat.CheckModel(info), gc.ErrorMatches,
+		`model uses cross-model-relations, which cannot be migrated: remove the remote applications first`)
+}
+
+func (*CompatibilitySuite) TestModelFeatures(c *gc.C) {
+	model := description.NewModel(description.ModelArgs{
+		Owner: names.NewUserTag("owner"),
+	})
+	c.Check(migration.ModelFeatures(model), gc.HasLen, 0)
+
+	model.AddRemoteApplication(description.RemoteApplicationArgs{
+		Tag: names.NewApplicationTag("remote"),
+	})
+	c.Check(migration.ModelFeatures(model), jc.DeepEquals, []string{
+		migration.FeatureRemoteApplications,
+	})
+}
+
+func (*CompatibilitySuite) TestEntityFeatures(c *gc.C) {
+	c.Check(migration.EntityFeatures(state.MigrationEntityCounts{}), gc.HasLen, 0)
+	c.Check(migration.EntityFeatures(state.MigrationEntityCounts{
+		RemoteApplications: 2,
+	}), jc.DeepEquals, []string{
+		migration.FeatureRemoteApplications,
+	})
+}
+
+func (*CompatibilitySuite) TestDescriptionVersion(c *gc.C) {
+	model := description.NewModel(description.ModelArgs{
+		Owner: names.NewUserTag("owner"),
+	})
+	serialized, err := description.Serialize(model)
+	c.Assert(err, jc.ErrorIsNil)
+	descriptionVersion, err := migration.DescriptionVersion(serialized)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(descriptionVersion, gc.Equals, migration.CurrentDescriptionVersion)
+
+	_, err = migration.DescriptionVersion([]byte("applications: []\n"))
+	c.Check(err, gc.ErrorMatches, "model description has no version")
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration
+
+import (
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// descriptionUpgrades holds the functions that convert a model
+// description from each version to the next: descriptionUpgrades[v]
+// converts the document of a version v description, in place, to
+// version v+1. They allow models exported by older controllers, and
+// kept in archives, to be imported by controllers that no longer
+// accept the version they were exported with.
+//
+// There are none yet, as this controller's exporter writes the only
+// version there is. When the description changes, an upgrade to the
+// new version must be added here along with CurrentDescriptionVersion.
+var descriptionUpgrades = map[int]func(doc map[string]interface{}) error{}
+
+// UpgradeDescription converts a serialized model description to the
+// given version, by applying the upgrade from each version to the next
+// in turn. Descriptions cannot be downgraded.
+func UpgradeDescription(serialized []byte, to int) ([]byte, error) {
+	from, err := DescriptionVersion(serialized)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if from == to {
+		return serialized, nil
+	}
+	if from > to {
+		return nil, errors.Errorf("cannot downgrade model description from version %d to %d", from, to)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(serialized, &doc); err != nil {
+		return nil, errors.Annotate(err, "reading model description")
+	}
+	for v := from; v < to; v++ {
+		upgrade, ok := descriptionUpgrades[v]
+		if !ok {
+			return nil, errors.Errorf("no upgrade for model description version %d", v)
+		}
+		if err := upgrade(doc); err != nil {
+			return nil, errors.Annotatef(err, "upgrading model description from version %d", v)
+		}
+		doc["version"] = v + 1
+	}
+	upgraded, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return upgraded, nil
+}
+
+// DescriptionUpgradeTarget returns the version a model description of
+// the given version must be upgraded to before it is imported: the
+// version itself if the target accepts it, or otherwise the earliest
+// later version the target accepts.
+func (compat Compatibility) DescriptionUpgradeTarget(descriptionVersion int) (int, error) {
+	target := 0
+	for _, v := range compat.DescriptionVersions {
+		if v >= descriptionVersion && (target == 0 || v < target) {
+			target = v
+		}
+	}
+	if target == 0 {
+		return 0, errors.Errorf("model description version %d not supported (target accepts %s)",
+			descriptionVersion, formatInts(compat.DescriptionVersions))
+	}
+	return target, nil
+}
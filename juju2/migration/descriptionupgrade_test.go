@@ -0,0 +1,83 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/1.25-upgrade/juju2/migration"
+)
+
+type DescriptionUpgradeSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&DescriptionUpgradeSuite{})
+
+func (s *DescriptionUpgradeSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.PatchValue(migration.DescriptionUpgrades, map[int]func(map[string]interface{}) error{
+		1: func(doc map[string]interface{}) error {
+			doc["applications"] = doc["services"]
+			delete(doc, "services")
+			return nil
+		},
+		2: func(doc map[string]interface{}) error {
+			doc["upgraded"] = true
+			return nil
+		},
+		3: func(map[string]interface{}) error {
+			return errors.New("boom")
+		},
+	})
+}
+
+func (s *DescriptionUpgradeSuite) TestUpgrade(c *gc.C) {
+	upgraded, err := migration.UpgradeDescription([]byte("version: 1\nservices: [foo]\n"), 3)
+	c.Assert(err, jc.ErrorIsNil)
+	var doc map[string]interface{}
+	c.Assert(yaml.Unmarshal(upgraded, &doc), jc.ErrorIsNil)
+	c.Check(doc, jc.DeepEquals, map[string]interface{}{
+		"version":      3,
+		"applications": []interface{}{"foo"},
+		"upgraded":     true,
+	})
+}
+
+func (s *DescriptionUpgradeSuite) TestUpgradeSameVersion(c *gc.C) {
+	serialized := []byte("version: 2\nservices: [foo]\n")
+	upgraded, err := migration.UpgradeDescription(serialized, 2)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(upgraded), gc.Equals, string(serialized))
+}
+
+func (s *DescriptionUpgradeSuite) TestUpgradeErrors(c *gc.C) {
+	_, err := migration.UpgradeDescription([]byte("version: 3\n"), 2)
+	c.Check(err, gc.ErrorMatches, "cannot downgrade model description from version 3 to 2")
+	_, err = migration.UpgradeDescription([]byte("version: 3\n"), 4)
+	c.Check(err, gc.ErrorMatches, "upgrading model description from version 3: boom")
+	_, err = migration.UpgradeDescription([]byte("version: 3\n"), 5)
+	c.Check(err, gc.ErrorMatches, "upgrading model description from version 3: boom")
+	_, err = migration.UpgradeDescription([]byte("version: 4\n"), 5)
+	c.Check(err, gc.ErrorMatches, "no upgrade for model description version 4")
+	_, err = migration.UpgradeDescription([]byte("services: []\n"), 2)
+	c.Check(err, gc.ErrorMatches, "model description has no version")
+}
+
+func (s *DescriptionUpgradeSuite) TestDescriptionUpgradeTarget(c *gc.C) {
+	compat := migration.Compatibility{DescriptionVersions: []int{4, 2, 3}}
+	for _, test := range []struct {
+		from, to int
+	}{{1, 2}, {2, 2}, {3, 3}, {4, 4}} {
+		to, err := compat.DescriptionUpgradeTarget(test.from)
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(to, gc.Equals, test.to, gc.Commentf("from %d", test.from))
+	}
+	_, err := compat.DescriptionUpgradeTarget(5)
+	c.Check(err, gc.ErrorMatches, `model description version 5 not supported \(target accepts 4, 2, 3\)`)
+}
@@ -3,4 +3,4 @@
 
 package migration
 
-var ()
+var DescriptionUpgrades = &descriptionUpgrades
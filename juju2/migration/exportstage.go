@@ -0,0 +1,54 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/1.25-upgrade/juju2/state"
+	"github.com/juju/1.25-upgrade/juju2/state/storage"
+)
+
+// serializedModelPath is where the serialized model is kept in the
+// exporting model's blob storage.
+const serializedModelPath = "migration/model.yaml"
+
+// StageSerializedModel keeps the serialized model in the blob storage
+// of the model being exported, so that the migrationmaster can
+// download it as a stream instead of receiving it whole in an API
+// response. Any model staged by an earlier export is replaced.
+func StageSerializedModel(st *state.State, serialized []byte) error {
+	if err := RemoveSerializedModel(st); err != nil {
+		return errors.Trace(err)
+	}
+	store := storage.NewStorage(st.ModelUUID(), st.MongoSession())
+	err := store.Put(serializedModelPath, bytes.NewReader(serialized), int64(len(serialized)))
+	return errors.Annotate(err, "staging serialized model")
+}
+
+// OpenSerializedModel returns a reader for the serialized model staged
+// by StageSerializedModel, along with its size.
+func OpenSerializedModel(st *state.State) (io.ReadCloser, int64, error) {
+	store := storage.NewStorage(st.ModelUUID(), st.MongoSession())
+	r, size, err := store.Get(serializedModelPath)
+	if errors.IsNotFound(err) {
+		return nil, 0, errors.NotFoundf("serialized model")
+	} else if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	return r, size, nil
+}
+
+// RemoveSerializedModel discards the serialized model staged by
+// StageSerializedModel, if there is one.
+func RemoveSerializedModel(st *state.State) error {
+	store := storage.NewStorage(st.ModelUUID(), st.MongoSession())
+	if err := store.Remove(serializedModelPath); err != nil && !errors.IsNotFound(err) {
+		return errors.Trace(err)
+	}
+	return nil
+}
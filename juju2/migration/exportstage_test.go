@@ -0,0 +1,64 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration_test
+
+import (
+	"io/ioutil"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/migration"
+	statetesting "github.com/juju/1.25-upgrade/juju2/state/testing"
+)
+
+type ExportStageSuite struct {
+	statetesting.StateSuite
+}
+
+var _ = gc.Suite(&ExportStageSuite{})
+
+func (s *ExportStageSuite) assertStaged(c *gc.C, content string) {
+	r, size, err := migration.OpenSerializedModel(s.State)
+	c.Assert(err, jc.ErrorIsNil)
+	defer r.Close()
+	c.Assert(size, gc.Equals, int64(len(content)))
+	bytes, err := ioutil.ReadAll(r)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(bytes), gc.Equals, content)
+}
+
+func (s *ExportStageSuite) TestNotStaged(c *gc.C) {
+	_, _, err := migration.OpenSerializedModel(s.State)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, "serialized model not found")
+}
+
+func (s *ExportStageSuite) TestStage(c *gc.C) {
+	err := migration.StageSerializedModel(s.State, []byte("model: {}"))
+	c.Assert(err, jc.ErrorIsNil)
+	s.assertStaged(c, "model: {}")
+}
+
+func (s *ExportStageSuite) TestStageReplaces(c *gc.C) {
+	err := migration.StageSerializedModel(s.State, []byte("model: {}"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = migration.StageSerializedModel(s.State, []byte("model: {version: 1}"))
+	c.Assert(err, jc.ErrorIsNil)
+	s.assertStaged(c, "model: {version: 1}")
+}
+
+func (s *ExportStageSuite) TestRemove(c *gc.C) {
+	err := migration.StageSerializedModel(s.State, []byte("model: {}"))
+	c.Assert(err, jc.ErrorIsNil)
+	err = migration.RemoveSerializedModel(s.State)
+	c.Assert(err, jc.ErrorIsNil)
+	_, _, err = migration.OpenSerializedModel(s.State)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	// Removing again is not an error.
+	err = migration.RemoveSerializedModel(s.State)
+	c.Assert(err, jc.ErrorIsNil)
+}
@@ -4,10 +4,15 @@
 package migration
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/juju/description"
 	"github.com/juju/errors"
@@ -109,13 +114,39 @@ type UploadBinariesConfig struct {
 	CharmDownloader CharmDownloader
 	CharmUploader   CharmUploader
 
+	// CharmSHA256s holds the expected SHA256 hash of each charm
+	// archive, keyed by charm URL. Charms without an expected hash
+	// are uploaded without being checked.
+	CharmSHA256s map[string]string
+
 	Tools           map[version.Binary]string
 	ToolsDownloader ToolsDownloader
 	ToolsUploader   ToolsUploader
 
+	// ToolsSHA256s holds the expected SHA256 hash of each tools
+	// tarball. Tools without an expected hash are uploaded without
+	// being checked.
+	ToolsSHA256s map[version.Binary]string
+
 	Resources          []migration.SerializedModelResource
 	ResourceDownloader ResourceDownloader
 	ResourceUploader   ResourceUploader
+
+	// Uploaded holds the binaries the target controller already has,
+	// with their hashes. Those whose hashes match are not uploaded
+	// again, so that an interrupted upload can be resumed.
+	Uploaded migration.UploadedBinaries
+
+	// Parallelism is the maximum number of binaries uploaded at once.
+	// Revisions of the same charm are always uploaded one at a time,
+	// in order. Zero means one binary at a time.
+	Parallelism int
+
+	// Progress, if not nil, is called with the kind ("charm", "tools"
+	// or "resource") and name of each binary once it has been
+	// uploaded, or skipped because the target already had it. It is
+	// never called concurrently.
+	Progress func(kind, name string)
 }
 
 // Validate makes sure that all the config values are non-nil.
@@ -141,38 +172,169 @@ func (c *UploadBinariesConfig) Validate() error {
 	return nil
 }
 
+// BinaryMismatch describes a binary whose content does not match the
+// metadata it was exported with.
+type BinaryMismatch struct {
+	// Kind is "charm", "tools" or "resource".
+	Kind string
+
+	// Name identifies the binary: a charm URL, tools version, or
+	// application and resource name.
+	Name string
+
+	// Problem describes how the binary differs from its metadata.
+	Problem string
+}
+
+// BinaryMismatchError is returned by UploadBinaries when binaries do not
+// match the metadata they were exported with. None of those binaries are
+// uploaded, but all the others are.
+type BinaryMismatchError struct {
+	Mismatches []BinaryMismatch
+}
+
+// Error is part of the error interface.
+func (e *BinaryMismatchError) Error() string {
+	lines := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		lines[i] = fmt.Sprintf("%s %s: %s", m.Kind, m.Name, m.Problem)
+	}
+	return "binaries failed verification:\n    " + strings.Join(lines, "\n    ")
+}
+
+// IsBinaryMismatchError returns whether err is a *BinaryMismatchError.
+func IsBinaryMismatchError(err error) bool {
+	_, ok := errors.Cause(err).(*BinaryMismatchError)
+	return ok
+}
+
+// binaryReport collects the binaries that fail verification, and
+// passes on the progress of those that do not. It is safe to use from
+// concurrent uploads.
+type binaryReport struct {
+	mu         sync.Mutex
+	progress   func(kind, name string)
+	mismatches []BinaryMismatch
+}
+
+func (r *binaryReport) add(kind, name, format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mismatches = append(r.mismatches, BinaryMismatch{
+		Kind:    kind,
+		Name:    name,
+		Problem: fmt.Sprintf(format, args...),
+	})
+}
+
+// done records that the binary is on the target controller.
+func (r *binaryReport) done(kind, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.progress != nil {
+		r.progress(kind, name)
+	}
+}
+
+func (r *binaryReport) err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.mismatches) == 0 {
+		return nil
+	}
+	return &BinaryMismatchError{Mismatches: r.mismatches}
+}
+
 // UploadBinaries will send binaries stored in the source blobstore to
-// the target controller.
+// the target controller. Each binary is checked against the metadata it
+// was exported with before it is uploaded, and where the target reports
+// what it stored, after. Any that do not match are reported together in
+// a *BinaryMismatchError, once the rest have been uploaded. Binaries
+// the target already has are skipped.
 func UploadBinaries(config UploadBinariesConfig) error {
 	if err := config.Validate(); err != nil {
 		return errors.Trace(err)
 	}
-	if err := uploadCharms(config); err != nil {
+	report := binaryReport{progress: config.Progress}
+	if err := uploadCharms(config, &report); err != nil {
 		return errors.Trace(err)
 	}
-	if err := uploadTools(config); err != nil {
+	if err := uploadTools(config, &report); err != nil {
 		return errors.Trace(err)
 	}
-	if err := uploadResources(config); err != nil {
+	if err := uploadResources(config, &report); err != nil {
 		return errors.Trace(err)
 	}
-	return nil
+	return report.err()
+}
+
+// runUploads runs the uploads, at most parallelism of them at a time,
+// and returns the first error any of them returns. Once one has failed,
+// those not yet started are abandoned.
+func runUploads(parallelism int, uploads []func() error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	slots := make(chan struct{}, parallelism)
+	for _, upload := range uploads {
+		slots <- struct{}{}
+		if failed() {
+			break
+		}
+		wg.Add(1)
+		go func(upload func() error) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := upload(); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(upload)
+	}
+	wg.Wait()
+	return firstErr
 }
 
-func streamThroughTempFile(r io.Reader) (_ io.ReadSeeker, cleanup func(), err error) {
+// binaryDigest holds the size and hashes of a binary streamed through a
+// temporary file.
+type binaryDigest struct {
+	size   int64
+	sha256 string
+	sha384 string
+}
+
+func streamThroughTempFile(r io.Reader) (_ io.ReadSeeker, _ binaryDigest, cleanup func(), err error) {
+	var digest binaryDigest
 	tempFile, err := ioutil.TempFile("", "juju-migrate-binary")
 	if err != nil {
-		return nil, nil, errors.Trace(err)
+		return nil, digest, nil, errors.Trace(err)
 	}
 	defer func() {
 		if err != nil {
 			os.Remove(tempFile.Name())
 		}
 	}()
-	_, err = io.Copy(tempFile, r)
+	sha256Hash := sha256.New()
+	sha384Hash := sha512.New384()
+	digest.size, err = io.Copy(io.MultiWriter(tempFile, sha256Hash, sha384Hash), r)
 	if err != nil {
-		return nil, nil, errors.Trace(err)
+		return nil, digest, nil, errors.Trace(err)
 	}
+	digest.sha256 = fmt.Sprintf("%x", sha256Hash.Sum(nil))
+	digest.sha384 = fmt.Sprintf("%x", sha384Hash.Sum(nil))
 	tempFile.Seek(0, 0)
 	rmTempFile := func() {
 		filename := tempFile.Name()
@@ -180,110 +342,255 @@ func streamThroughTempFile(r io.Reader) (_ io.ReadSeeker, cleanup func(), err er
 		os.Remove(filename)
 	}
 
-	return tempFile, rmTempFile, nil
+	return tempFile, digest, rmTempFile, nil
 }
 
-func uploadCharms(config UploadBinariesConfig) error {
-	// It is critical that charms are uploaded in ascending charm URL
-	// order so that charm revisions end up the same in the target as
-	// they were in the source.
+func uploadCharms(config UploadBinariesConfig, report *binaryReport) error {
+	// It is critical that revisions of a charm are uploaded in
+	// ascending order so that they end up the same in the target as
+	// they were in the source. Different charms are independent, so
+	// each charm's revisions are uploaded in their own sequence.
 	utils.SortStringsNaturally(config.Charms)
 
+	var sequences [][]*charm.URL
+	sequenceIndex := make(map[string]int)
 	for _, charmURL := range config.Charms {
-		logger.Debugf("sending charm %s to target", charmURL)
-
 		curl, err := charm.ParseURL(charmURL)
 		if err != nil {
 			return errors.Annotate(err, "bad charm URL")
 		}
-
-		reader, err := config.CharmDownloader.OpenCharm(curl)
-		if err != nil {
-			return errors.Annotate(err, "cannot open charm")
+		base := curl.WithRevision(-1).String()
+		i, ok := sequenceIndex[base]
+		if !ok {
+			i = len(sequences)
+			sequenceIndex[base] = i
+			sequences = append(sequences, nil)
 		}
-		defer reader.Close()
+		sequences[i] = append(sequences[i], curl)
+	}
 
-		content, cleanup, err := streamThroughTempFile(reader)
-		if err != nil {
-			return errors.Trace(err)
+	uploads := make([]func() error, len(sequences))
+	for i, sequence := range sequences {
+		sequence := sequence
+		uploads[i] = func() error {
+			for _, curl := range sequence {
+				if err := uploadCharm(config, report, curl); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			return nil
 		}
-		defer cleanup()
+	}
+	return runUploads(config.Parallelism, uploads)
+}
 
-		if usedCurl, err := config.CharmUploader.UploadCharm(curl, content); err != nil {
-			return errors.Annotate(err, "cannot upload charm")
-		} else if usedCurl.String() != curl.String() {
-			// The target controller shouldn't assign a different charm URL.
-			return errors.Errorf("charm %s unexpectedly assigned %s", curl, usedCurl)
+func uploadCharm(config UploadBinariesConfig, report *binaryReport, curl *charm.URL) error {
+	charmURL := curl.String()
+	expected := config.CharmSHA256s[charmURL]
+	if uploaded, ok := config.Uploaded.Charms[charmURL]; ok {
+		if expected != "" && uploaded != expected {
+			report.add("charm", charmURL, "target has sha256 %s, expected %s", uploaded, expected)
+			return nil
 		}
+		logger.Debugf("target already has charm %s", charmURL)
+		report.done("charm", charmURL)
+		return nil
 	}
+	logger.Debugf("sending charm %s to target", charmURL)
+
+	reader, err := config.CharmDownloader.OpenCharm(curl)
+	if err != nil {
+		return errors.Annotate(err, "cannot open charm")
+	}
+	defer reader.Close()
+
+	content, digest, cleanup, err := streamThroughTempFile(reader)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer cleanup()
+
+	if expected != "" && digest.sha256 != expected {
+		report.add("charm", charmURL, "sha256 %s, expected %s", digest.sha256, expected)
+		return nil
+	}
+	if usedCurl, err := config.CharmUploader.UploadCharm(curl, content); err != nil {
+		return errors.Annotate(err, "cannot upload charm")
+	} else if usedCurl.String() != charmURL {
+		// The target controller shouldn't assign a different charm URL.
+		return errors.Errorf("charm %s unexpectedly assigned %s", curl, usedCurl)
+	}
+	report.done("charm", charmURL)
 	return nil
 }
 
-func uploadTools(config UploadBinariesConfig) error {
+func uploadTools(config UploadBinariesConfig, report *binaryReport) error {
+	var uploads []func() error
 	for v, uri := range config.Tools {
-		logger.Debugf("sending tools to target: %s", v)
+		v, uri := v, uri
+		uploads = append(uploads, func() error {
+			return uploadToolsVersion(config, report, v, uri)
+		})
+	}
+	return runUploads(config.Parallelism, uploads)
+}
 
-		reader, err := config.ToolsDownloader.OpenURI(uri, nil)
-		if err != nil {
-			return errors.Annotate(err, "cannot open charm")
+func uploadToolsVersion(config UploadBinariesConfig, report *binaryReport, v version.Binary, uri string) error {
+	expected := config.ToolsSHA256s[v]
+	if uploaded, ok := config.Uploaded.Tools[v]; ok {
+		if expected != "" && uploaded != expected {
+			report.add("tools", v.String(), "target has sha256 %s, expected %s", uploaded, expected)
+			return nil
 		}
-		defer reader.Close()
+		logger.Debugf("target already has tools %s", v)
+		report.done("tools", v.String())
+		return nil
+	}
+	logger.Debugf("sending tools to target: %s", v)
 
-		content, cleanup, err := streamThroughTempFile(reader)
-		if err != nil {
-			return errors.Trace(err)
+	reader, err := config.ToolsDownloader.OpenURI(uri, nil)
+	if err != nil {
+		return errors.Annotate(err, "cannot open charm")
+	}
+	defer reader.Close()
+
+	content, digest, cleanup, err := streamThroughTempFile(reader)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer cleanup()
+
+	if expected != "" && digest.sha256 != expected {
+		report.add("tools", v.String(), "sha256 %s, expected %s", digest.sha256, expected)
+		return nil
+	}
+	uploaded, err := config.ToolsUploader.UploadTools(content, v)
+	if err != nil {
+		return errors.Annotate(err, "cannot upload tools")
+	}
+	if checkUploadedTools(report, v, digest, uploaded) {
+		report.done("tools", v.String())
+	}
+	return nil
+}
+
+// checkUploadedTools reports any difference between the tools the target
+// says it stored and those sent to it, and returns whether there was
+// none.
+func checkUploadedTools(report *binaryReport, v version.Binary, digest binaryDigest, uploaded tools.List) bool {
+	ok := true
+	for _, t := range uploaded {
+		if t.Version != v {
+			continue
+		}
+		if t.SHA256 != "" && t.SHA256 != digest.sha256 {
+			report.add("tools", v.String(), "target stored sha256 %s, sent %s", t.SHA256, digest.sha256)
+			ok = false
+		} else if t.Size != 0 && t.Size != digest.size {
+			report.add("tools", v.String(), "target stored %d bytes, sent %d", t.Size, digest.size)
+			ok = false
 		}
-		defer cleanup()
+	}
+	return ok
+}
 
-		if _, err := config.ToolsUploader.UploadTools(content, v); err != nil {
-			return errors.Annotate(err, "cannot upload tools")
+func uploadResources(config UploadBinariesConfig, report *binaryReport) error {
+	uploads := make([]func() error, len(config.Resources))
+	for i, res := range config.Resources {
+		res := res
+		uploads[i] = func() error {
+			return uploadResource(config, report, res)
 		}
 	}
-	return nil
+	return runUploads(config.Parallelism, uploads)
 }
 
-func uploadResources(config UploadBinariesConfig) error {
-	for _, res := range config.Resources {
-		if res.ApplicationRevision.IsPlaceholder() {
-			// Resource placeholders created in the migration import rather
-			// than attempting to post empty resources.
-		} else {
-			err := uploadAppResource(config, res.ApplicationRevision)
-			if err != nil {
-				return errors.Trace(err)
-			}
+func uploadResource(config UploadBinariesConfig, report *binaryReport, res migration.SerializedModelResource) error {
+	appRev := res.ApplicationRevision
+	if !checkUnitResourceRevisions(report, res) {
+		return nil
+	}
+	if appRev.IsPlaceholder() {
+		// Resource placeholders created in the migration import rather
+		// than attempting to post empty resources.
+	} else if config.Uploaded.Resources[resourceName(appRev)] == appRev.Fingerprint.Hex() {
+		logger.Debugf("target already has resource %s", resourceName(appRev))
+	} else {
+		uploaded, err := uploadAppResource(config, report, appRev)
+		if err != nil {
+			return errors.Trace(err)
 		}
-		for unitName, unitRev := range res.UnitRevisions {
-			if err := config.ResourceUploader.SetUnitResource(unitName, unitRev); err != nil {
-				return errors.Annotate(err, "cannot set unit resource")
-			}
+		if !uploaded {
+			return nil
 		}
-		// Each config.Resources element also contains a
-		// CharmStoreRevision field. This isn't especially important
-		// to migrate so is skipped for now.
 	}
+	for unitName, unitRev := range res.UnitRevisions {
+		if err := config.ResourceUploader.SetUnitResource(unitName, unitRev); err != nil {
+			return errors.Annotate(err, "cannot set unit resource")
+		}
+	}
+	// Each config.Resources element also contains a
+	// CharmStoreRevision field. This isn't especially important
+	// to migrate so is skipped for now.
+	report.done("resource", resourceName(appRev))
 	return nil
 }
 
-func uploadAppResource(config UploadBinariesConfig, rev resource.Resource) error {
+// checkUnitResourceRevisions reports the resource if any unit has the
+// same revision of it as the application, but with different content.
+// It returns whether the revisions are consistent.
+func checkUnitResourceRevisions(report *binaryReport, res migration.SerializedModelResource) bool {
+	appRev := res.ApplicationRevision
+	if appRev.IsPlaceholder() {
+		return true
+	}
+	consistent := true
+	for unitName, unitRev := range res.UnitRevisions {
+		if unitRev.Revision == appRev.Revision && unitRev.Fingerprint.Hex() != appRev.Fingerprint.Hex() {
+			report.add("resource", resourceName(appRev),
+				"unit %s has revision %d with fingerprint %s, application has %s",
+				unitName, unitRev.Revision, unitRev.Fingerprint.Hex(), appRev.Fingerprint.Hex())
+			consistent = false
+		}
+	}
+	return consistent
+}
+
+// uploadAppResource uploads the application's revision of the resource,
+// returning whether it was uploaded. The target checks the content
+// against the size and fingerprint it is sent with the resource.
+func uploadAppResource(config UploadBinariesConfig, report *binaryReport, rev resource.Resource) (bool, error) {
 	logger.Debugf("opening application resource for %s: %s", rev.ApplicationID, rev.Name)
 	reader, err := config.ResourceDownloader.OpenResource(rev.ApplicationID, rev.Name)
 	if err != nil {
-		return errors.Annotate(err, "cannot open resource")
+		return false, errors.Annotate(err, "cannot open resource")
 	}
 	defer reader.Close()
 
-	// TODO(menn0) - validate that the downloaded revision matches
-	// the expected metadata. Check revision and fingerprint.
-
-	content, cleanup, err := streamThroughTempFile(reader)
+	content, digest, cleanup, err := streamThroughTempFile(reader)
 	if err != nil {
-		return errors.Trace(err)
+		return false, errors.Trace(err)
 	}
 	defer cleanup()
 
+	// The source serves the application's current revision of the
+	// resource, so this also checks that it is still the one that was
+	// exported.
+	if digest.size != rev.Size {
+		report.add("resource", resourceName(rev), "revision %d has %d bytes, expected %d", rev.Revision, digest.size, rev.Size)
+		return false, nil
+	}
+	if expected := rev.Fingerprint.Hex(); digest.sha384 != expected {
+		report.add("resource", resourceName(rev), "revision %d has fingerprint %s, expected %s", rev.Revision, digest.sha384, expected)
+		return false, nil
+	}
+
 	if err := config.ResourceUploader.UploadResource(rev, content); err != nil {
-		return errors.Annotate(err, "cannot upload resource")
+		return false, errors.Annotate(err, "cannot upload resource")
 	}
-	return nil
+	return true, nil
+}
+
+func resourceName(rev resource.Resource) string {
+	return rev.ApplicationID + "/" + rev.Name
 }
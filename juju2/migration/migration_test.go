@@ -5,10 +5,12 @@ package migration_test
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
+	"sync"
 
 	"github.com/juju/description"
 	"github.com/juju/errors"
@@ -204,13 +206,218 @@ func (s *ImportSuite) TestWrongCharmURLAssigned(c *gc.C) {
 		"charm local:foo/bar-2 unexpectedly assigned local:foo/bar-1")
 }
 
+func (s *ImportSuite) TestBinariesVerified(c *gc.C) {
+	downloader := &fakeDownloader{}
+	uploader := &fakeUploader{
+		tools:     make(map[version.Binary]string),
+		resources: make(map[string]string),
+	}
+	toolsVersion := version.MustParseBinary("2.1.0-trusty-amd64")
+
+	goodRes := resourcetesting.NewResource(c, nil, "blob0", "app0", "blob0").Resource
+	// The downloader returns the resource name as its content, so
+	// these differ in size and fingerprint respectively.
+	shortRes := resourcetesting.NewResource(c, nil, "blob1", "app1", "longer content").Resource
+	changedRes := resourcetesting.NewResource(c, nil, "blob2", "app2", "blobX").Resource
+
+	config := migration.UploadBinariesConfig{
+		Charms: []string{"cs:trusty/good-1", "cs:trusty/bad-1"},
+		CharmSHA256s: map[string]string{
+			"cs:trusty/good-1": sha256Hex("cs:trusty/good-1 content"),
+			"cs:trusty/bad-1":  sha256Hex("something else"),
+		},
+		CharmDownloader: downloader,
+		CharmUploader:   uploader,
+		Tools:           map[version.Binary]string{toolsVersion: "/tools/0"},
+		ToolsSHA256s: map[version.Binary]string{
+			toolsVersion: sha256Hex("something else"),
+		},
+		ToolsDownloader: downloader,
+		ToolsUploader:   uploader,
+		Resources: []coremigration.SerializedModelResource{
+			{ApplicationRevision: goodRes},
+			{ApplicationRevision: shortRes},
+			{ApplicationRevision: changedRes},
+		},
+		ResourceDownloader: downloader,
+		ResourceUploader:   uploader,
+	}
+	err := migration.UploadBinaries(config)
+	c.Assert(migration.IsBinaryMismatchError(err), jc.IsTrue)
+	c.Assert(err, gc.ErrorMatches, `binaries failed verification:
+    charm cs:trusty/bad-1: sha256 [0-9a-f]+, expected [0-9a-f]+
+    tools 2.1.0-trusty-amd64: sha256 [0-9a-f]+, expected [0-9a-f]+
+    resource app1/blob1: revision 0 has 5 bytes, expected 14
+    resource app2/blob2: revision 0 has fingerprint [0-9a-f]+, expected [0-9a-f]+`)
+
+	// Everything that matched is still uploaded.
+	c.Assert(uploader.charms, jc.DeepEquals, []string{"cs:trusty/good-1"})
+	c.Assert(uploader.tools, gc.HasLen, 0)
+	c.Assert(uploader.resources, jc.DeepEquals, map[string]string{
+		"app0/blob0": "blob0",
+	})
+}
+
+func (s *ImportSuite) TestUploadedToolsVerified(c *gc.C) {
+	downloader := &fakeDownloader{}
+	uploader := &fakeUploader{
+		tools:       make(map[version.Binary]string),
+		toolsSHA256: "stored-sha",
+	}
+	toolsVersion := version.MustParseBinary("2.1.0-trusty-amd64")
+
+	config := migration.UploadBinariesConfig{
+		CharmDownloader:    downloader,
+		CharmUploader:      uploader,
+		Tools:              map[version.Binary]string{toolsVersion: "/tools/0"},
+		ToolsDownloader:    downloader,
+		ToolsUploader:      uploader,
+		ResourceDownloader: downloader,
+		ResourceUploader:   uploader,
+	}
+	err := migration.UploadBinaries(config)
+	c.Assert(err, gc.ErrorMatches, `binaries failed verification:
+    tools 2.1.0-trusty-amd64: target stored sha256 stored-sha, sent [0-9a-f]+`)
+}
+
+func (s *ImportSuite) TestUploadedBinariesSkipped(c *gc.C) {
+	downloader := &fakeDownloader{}
+	uploader := &fakeUploader{
+		tools:     make(map[version.Binary]string),
+		resources: make(map[string]string),
+	}
+	toolsVersion := version.MustParseBinary("2.1.0-trusty-amd64")
+	otherToolsVersion := version.MustParseBinary("2.1.0-xenial-amd64")
+	appRes := resourcetesting.NewResource(c, nil, "blob0", "app0", "blob0").Resource
+	otherRes := resourcetesting.NewResource(c, nil, "blob1", "app1", "blob1").Resource
+
+	var progress []string
+	config := migration.UploadBinariesConfig{
+		Charms:       []string{"cs:trusty/uploaded-1", "cs:trusty/new-1"},
+		CharmSHA256s: map[string]string{"cs:trusty/uploaded-1": "charm-sha"},
+		Tools: map[version.Binary]string{
+			toolsVersion:      "/tools/0",
+			otherToolsVersion: "/tools/1",
+		},
+		ToolsSHA256s: map[version.Binary]string{toolsVersion: "tools-sha"},
+		Resources: []coremigration.SerializedModelResource{{
+			ApplicationRevision: appRes,
+			UnitRevisions:       map[string]resource.Resource{"app0/0": appRes},
+		}, {
+			ApplicationRevision: otherRes,
+		}},
+		Uploaded: coremigration.UploadedBinaries{
+			Charms:    map[string]string{"cs:trusty/uploaded-1": "charm-sha"},
+			Tools:     map[version.Binary]string{toolsVersion: "tools-sha"},
+			Resources: map[string]string{"app0/blob0": appRes.Fingerprint.Hex()},
+		},
+		Progress: func(kind, name string) {
+			progress = append(progress, kind+" "+name)
+		},
+		CharmDownloader:    downloader,
+		CharmUploader:      uploader,
+		ToolsDownloader:    downloader,
+		ToolsUploader:      uploader,
+		ResourceDownloader: downloader,
+		ResourceUploader:   uploader,
+	}
+	err := migration.UploadBinaries(config)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(downloader.charms, jc.DeepEquals, []string{"cs:trusty/new-1"})
+	c.Assert(uploader.charms, jc.DeepEquals, []string{"cs:trusty/new-1"})
+	c.Assert(downloader.uris, jc.DeepEquals, []string{"/tools/1"})
+	c.Assert(uploader.tools, gc.HasLen, 1)
+	c.Assert(downloader.resources, jc.DeepEquals, []string{"app1/blob1"})
+	// Unit resources are set even if the target has the application's.
+	c.Assert(uploader.unitResources, jc.DeepEquals, []string{"app0/0-blob0"})
+
+	c.Assert(progress, jc.SameContents, []string{
+		"charm cs:trusty/new-1",
+		"charm cs:trusty/uploaded-1",
+		"tools 2.1.0-trusty-amd64",
+		"tools 2.1.0-xenial-amd64",
+		"resource app0/blob0",
+		"resource app1/blob1",
+	})
+}
+
+func (s *ImportSuite) TestUploadedBinariesVerified(c *gc.C) {
+	downloader := &fakeDownloader{}
+	uploader := &fakeUploader{}
+
+	var progress []string
+	config := migration.UploadBinariesConfig{
+		Charms:       []string{"cs:trusty/uploaded-1"},
+		CharmSHA256s: map[string]string{"cs:trusty/uploaded-1": "charm-sha"},
+		Uploaded: coremigration.UploadedBinaries{
+			Charms: map[string]string{"cs:trusty/uploaded-1": "other-sha"},
+		},
+		Progress: func(kind, name string) {
+			progress = append(progress, kind+" "+name)
+		},
+		CharmDownloader:    downloader,
+		CharmUploader:      uploader,
+		ToolsDownloader:    downloader,
+		ToolsUploader:      uploader,
+		ResourceDownloader: downloader,
+		ResourceUploader:   uploader,
+	}
+	err := migration.UploadBinaries(config)
+	c.Assert(err, gc.ErrorMatches, `binaries failed verification:
+    charm cs:trusty/uploaded-1: target has sha256 other-sha, expected charm-sha`)
+	c.Assert(uploader.charms, gc.HasLen, 0)
+	c.Assert(progress, gc.HasLen, 0)
+}
+
+func (s *ImportSuite) TestBinariesUploadedInParallel(c *gc.C) {
+	downloader := &fakeDownloader{}
+	uploader := &fakeUploader{}
+
+	config := migration.UploadBinariesConfig{
+		Charms: []string{
+			"local:trusty/magic-10",
+			"local:trusty/magic-2",
+			"local:trusty/magic-1",
+			"cs:trusty/postgresql-42",
+			"cs:trusty/mysql-1",
+			"cs:xenial/mysql-3",
+		},
+		Parallelism:        3,
+		CharmDownloader:    downloader,
+		CharmUploader:      uploader,
+		ToolsDownloader:    downloader,
+		ToolsUploader:      uploader,
+		ResourceDownloader: downloader,
+		ResourceUploader:   uploader,
+	}
+	err := migration.UploadBinaries(config)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(uploader.charms, jc.SameContents, config.Charms)
+	// Revisions of the same charm are still uploaded in order.
+	index := make(map[string]int)
+	for i, curl := range uploader.charms {
+		index[curl] = i
+	}
+	c.Assert(index["local:trusty/magic-1"] < index["local:trusty/magic-2"], jc.IsTrue)
+	c.Assert(index["local:trusty/magic-2"] < index["local:trusty/magic-10"], jc.IsTrue)
+}
+
+func sha256Hex(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
 type fakeDownloader struct {
+	mu        sync.Mutex
 	charms    []string
 	uris      []string
 	resources []string
 }
 
 func (d *fakeDownloader) OpenCharm(curl *charm.URL) (io.ReadCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	urlStr := curl.String()
 	d.charms = append(d.charms, urlStr)
 	// Return the charm URL string as the fake charm content
@@ -221,23 +428,29 @@ func (d *fakeDownloader) OpenURI(uri string, query url.Values) (io.ReadCloser, e
 	if query != nil {
 		panic("query should be empty")
 	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	d.uris = append(d.uris, uri)
 	// Return the URI string as fake content
 	return ioutil.NopCloser(bytes.NewReader([]byte(uri))), nil
 }
 
 func (d *fakeDownloader) OpenResource(app, name string) (io.ReadCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	d.resources = append(d.resources, app+"/"+name)
 	// Use the resource name as the content.
 	return ioutil.NopCloser(bytes.NewReader([]byte(name))), nil
 }
 
 type fakeUploader struct {
+	mu               sync.Mutex
 	tools            map[version.Binary]string
 	charms           []string
 	resources        map[string]string
 	unitResources    []string
 	reassignCharmURL bool
+	toolsSHA256      string
 }
 
 func (f *fakeUploader) UploadTools(r io.ReadSeeker, v version.Binary, _ ...string) (tools.List, error) {
@@ -245,8 +458,10 @@ func (f *fakeUploader) UploadTools(r io.ReadSeeker, v version.Binary, _ ...strin
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.tools[v] = string(data)
-	return tools.List{&tools.Tools{Version: v}}, nil
+	return tools.List{&tools.Tools{Version: v, SHA256: f.toolsSHA256}}, nil
 }
 
 func (f *fakeUploader) UploadCharm(u *charm.URL, r io.ReadSeeker) (*charm.URL, error) {
@@ -257,6 +472,8 @@ func (f *fakeUploader) UploadCharm(u *charm.URL, r io.ReadSeeker) (*charm.URL, e
 	if string(data) != u.String()+" content" {
 		panic(fmt.Sprintf("unexpected charm body for %s: %s", u.String(), data))
 	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.charms = append(f.charms, u.String())
 
 	outU := *u
@@ -271,16 +488,22 @@ func (f *fakeUploader) UploadResource(res resource.Resource, r io.ReadSeeker) er
 	if err != nil {
 		return errors.Trace(err)
 	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.resources[res.ApplicationID+"/"+res.Name] = string(body)
 	return nil
 }
 
 func (f *fakeUploader) SetPlaceholderResource(res resource.Resource) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.resources[res.ApplicationID+"/"+res.Name] = "<placeholder>"
 	return nil
 }
 
 func (f *fakeUploader) SetUnitResource(unit string, res resource.Resource) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.unitResources = append(f.unitResources, unit+"-"+res.Name)
 	return nil
 }
@@ -0,0 +1,144 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils"
+)
+
+// ModelStage holds a serialized model on the target controller while
+// it is streamed there in chunks, in a file named for the model in the
+// staging directory. As the file outlives the connection it was
+// streamed over, an interrupted stream can be resumed from the end of
+// what has been staged, even by a restarted migrationmaster.
+type ModelStage struct {
+	path string
+}
+
+// NewModelStage returns the stage for the model with the given UUID,
+// creating the staging directory if necessary.
+func NewModelStage(dir, modelUUID string) (*ModelStage, error) {
+	if !utils.IsValidUUIDString(modelUUID) {
+		return nil, errors.NotValidf("model UUID %q", modelUUID)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &ModelStage{path: filepath.Join(dir, modelUUID+".yaml")}, nil
+}
+
+// Size returns the number of bytes staged.
+func (s *ModelStage) Size() (int64, error) {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return info.Size(), nil
+}
+
+// SHA256 returns the hex-encoded SHA256 hash of the bytes staged.
+func (s *ModelStage) SHA256() (string, error) {
+	hash := sha256.New()
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	} else if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", errors.Trace(err)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Append adds the chunk read from r to the stage, and returns the new
+// number of bytes staged. The stage must hold exactly offset bytes
+// already: a chunk at any other offset is refused, so that a resumed
+// stream can leave neither a gap nor an overlap. If the chunk cannot be
+// read in full, none of it is kept.
+func (s *ModelStage) Append(offset int64, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if offset != size {
+		return size, errors.NotValidf("chunk at offset %d with %d bytes staged", offset, size)
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		if err := f.Truncate(size); err != nil {
+			logger.Errorf("cannot discard partial chunk: %v", err)
+		}
+		return size, errors.Annotate(err, "staging chunk")
+	}
+	return size + n, nil
+}
+
+// Verify checks that the whole stream has been staged, by comparing
+// the size and SHA256 hash of the stage with those of the stream. An
+// error satisfying errors.IsNotValid is returned if they differ.
+func (s *ModelStage) Verify(size int64, hash string) error {
+	stagedSize, err := s.Size()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if stagedSize != size {
+		return errors.NewNotValid(nil, fmt.Sprintf("staged model has %d bytes, expected %d", stagedSize, size))
+	}
+	stagedSHA256, err := s.SHA256()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if stagedSHA256 != hash {
+		return errors.NewNotValid(nil, fmt.Sprintf("staged model has SHA256 %s, expected %s", stagedSHA256, hash))
+	}
+	return nil
+}
+
+// Map makes the serialized model staged available to be deserialized
+// without reading it into memory, where a large model would otherwise be
+// held alongside its deserialized form. The returned function must be
+// called once the bytes are no longer needed, and they must not be
+// used after that.
+func (s *ModelStage) Map() ([]byte, func() error, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil, errors.NotFoundf("staged model")
+	} else if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	if info.Size() == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	bytes, unmap, err := mapFile(f, info.Size())
+	return bytes, unmap, errors.Trace(err)
+}
+
+// Remove discards whatever has been staged.
+func (s *ModelStage) Remove() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return errors.Trace(err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/migration"
+)
+
+type ModelStageSuite struct {
+	stage *migration.ModelStage
+}
+
+var _ = gc.Suite(&ModelStageSuite{})
+
+func (s *ModelStageSuite) SetUpTest(c *gc.C) {
+	var err error
+	s.stage, err = migration.NewModelStage(c.MkDir(), utils.MustNewUUID().String())
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *ModelStageSuite) assertStaged(c *gc.C, content string) {
+	size, err := s.stage.Size()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(size, gc.Equals, int64(len(content)))
+	hash, err := s.stage.SHA256()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(hash, gc.Equals, fmt.Sprintf("%x", sha256.Sum256([]byte(content))))
+}
+
+func (s *ModelStageSuite) TestInvalidModelUUID(c *gc.C) {
+	_, err := migration.NewModelStage(c.MkDir(), "../model")
+	c.Assert(err, gc.ErrorMatches, `model UUID "../model" not valid`)
+}
+
+func (s *ModelStageSuite) TestEmpty(c *gc.C) {
+	s.assertStaged(c, "")
+	_, _, err := s.stage.Map()
+	c.Assert(err, gc.ErrorMatches, "staged model not found")
+}
+
+func (s *ModelStageSuite) TestAppend(c *gc.C) {
+	size, err := s.stage.Append(0, strings.NewReader("model:"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(size, gc.Equals, int64(6))
+	size, err = s.stage.Append(6, strings.NewReader(" {}"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(size, gc.Equals, int64(9))
+
+	s.assertStaged(c, "model: {}")
+	bytes, unmap, err := s.stage.Map()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(bytes), gc.Equals, "model: {}")
+	c.Assert(unmap(), jc.ErrorIsNil)
+}
+
+func (s *ModelStageSuite) TestAppendWrongOffset(c *gc.C) {
+	_, err := s.stage.Append(0, strings.NewReader("model:"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	size, err := s.stage.Append(3, strings.NewReader(" {}"))
+	c.Assert(err, gc.ErrorMatches, "chunk at offset 3 with 6 bytes staged not valid")
+	c.Assert(size, gc.Equals, int64(6))
+	size, err = s.stage.Append(9, strings.NewReader(" {}"))
+	c.Assert(err, gc.ErrorMatches, "chunk at offset 9 with 6 bytes staged not valid")
+	c.Assert(size, gc.Equals, int64(6))
+	s.assertStaged(c, "model:")
+}
+
+func (s *ModelStageSuite) TestAppendDiscardsPartialChunk(c *gc.C) {
+	_, err := s.stage.Append(0, strings.NewReader("model:"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	size, err := s.stage.Append(6, &failingReader{" {"})
+	c.Assert(err, gc.ErrorMatches, "staging chunk: connection reset")
+	c.Assert(size, gc.Equals, int64(6))
+	s.assertStaged(c, "model:")
+}
+
+func (s *ModelStageSuite) TestVerify(c *gc.C) {
+	_, err := s.stage.Append(0, strings.NewReader("model: {}"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte("model: {}")))
+	c.Assert(s.stage.Verify(9, hash), jc.ErrorIsNil)
+	err := s.stage.Verify(10, hash)
+	c.Assert(err, gc.ErrorMatches, "staged model has 9 bytes, expected 10")
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	err = s.stage.Verify(9, "bad")
+	c.Assert(err, gc.ErrorMatches, "staged model has SHA256 [0-9a-f]+, expected bad")
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *ModelStageSuite) TestRemove(c *gc.C) {
+	_, err := s.stage.Append(0, strings.NewReader("model: {}"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(s.stage.Remove(), jc.ErrorIsNil)
+	s.assertStaged(c, "")
+	c.Assert(s.stage.Remove(), jc.ErrorIsNil)
+}
+
+// failingReader returns its content, and then fails as if the
+// connection it was reading from had been lost.
+type failingReader struct {
+	content string
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.content == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.content)
+	r.content = r.content[n:]
+	return n, nil
+}
@@ -0,0 +1,22 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package migration
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// mapFile maps the first size bytes of the file read-only into memory.
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	bytes, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, errors.Annotate(err, "mapping staged model")
+	}
+	return bytes, func() error { return syscall.Munmap(bytes) }, nil
+}
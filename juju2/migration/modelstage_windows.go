@@ -0,0 +1,21 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migration
+
+import (
+	"io"
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// mapFile reads the first size bytes of the file, as controllers, which
+// are the only ones to stage models, do not run on Windows.
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	bytes := make([]byte, size)
+	if _, err := io.ReadFull(f, bytes); err != nil {
+		return nil, nil, errors.Annotate(err, "reading staged model")
+	}
+	return bytes, func() error { return nil }, nil
+}
@@ -176,9 +176,17 @@ func TargetPrecheck(backend PrecheckBackend, modelInfo coremigration.ModelInfo)
 			modelInfo.AgentVersion, controllerVersion)
 	}
 
-	if !controllerVersionCompatible(modelInfo.ControllerAgentVersion, controllerVersion) {
-		return errors.Errorf("source controller has higher version than target controller (%s > %s)",
-			modelInfo.ControllerAgentVersion, controllerVersion)
+	// Sources that don't report their version are assumed to be
+	// of the same major version as the target.
+	compat := DefaultCompatibility
+	if modelInfo.ControllerAgentVersion != version.Zero {
+		compat, err = FindCompatibility(modelInfo.ControllerAgentVersion, controllerVersion)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := compat.CheckModel(modelInfo); err != nil {
+		return errors.Trace(err)
 	}
 
 	if err := checkController(backend); err != nil {
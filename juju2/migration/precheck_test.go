@@ -410,6 +410,38 @@ func (s *TargetPrecheckSuite) TestSourceControllerTagMismatch(c *gc.C) {
 	c.Assert(migration.TargetPrecheck(backend, s.modelInfo), jc.ErrorIsNil)
 }
 
+func (s *TargetPrecheckSuite) TestSourceControllerMajorBehind(c *gc.C) {
+	backend := newFakeBackend()
+
+	s.modelInfo.ControllerAgentVersion = version.MustParse("0.9.0")
+
+	err := migration.TargetPrecheck(backend, s.modelInfo)
+	c.Assert(err.Error(), gc.Equals,
+		`migrating models from 0.9 controllers to 1.2 controllers is not supported`)
+}
+
+func (s *TargetPrecheckSuite) TestDescriptionVersionNotSupported(c *gc.C) {
+	backend := newFakeBackend()
+
+	s.modelInfo.ControllerAgentVersion = backendVersion
+	s.modelInfo.DescriptionVersion = migration.CurrentDescriptionVersion + 1
+
+	err := migration.TargetPrecheck(backend, s.modelInfo)
+	c.Assert(err, gc.ErrorMatches, `model description version \d+ not supported \(target accepts 1\)`)
+}
+
+func (s *TargetPrecheckSuite) TestUnsupportedFeature(c *gc.C) {
+	backend := newFakeBackend()
+
+	s.modelInfo.Features = []string{
+		migration.FeatureRemoteApplications,
+	}
+
+	err := migration.TargetPrecheck(backend, s.modelInfo)
+	c.Assert(err.Error(), gc.Equals,
+		"model uses cross-model-relations, which cannot be migrated: remove the relations to remote applications first")
+}
+
 func (s *TargetPrecheckSuite) TestDying(c *gc.C) {
 	backend := newFakeBackend()
 	backend.model.life = state.Dying
@@ -36,6 +36,17 @@ func DiscoverService(name string, conf common.Conf) (Service, error) {
 	return service, nil
 }
 
+// DiscoverInitSystem returns the name of the init system running on the
+// local host. If it cannot be detected from the host, the init system is
+// derived from the provided series.
+func DiscoverInitSystem(hostSeries string) (string, error) {
+	initName, err := discoverInitSystem(hostSeries)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return initName, nil
+}
+
 func discoverInitSystem(hostSeries string) (string, error) {
 	initName, err := discoverLocalInitSystem()
 	if errors.IsNotFound(err) {
@@ -137,6 +137,11 @@ func (s Service) Conf() common.Conf {
 	return s.Service.Conf
 }
 
+// UnitFile returns the content of the unit file that defines the service.
+func (s *Service) UnitFile() ([]byte, error) {
+	return s.serialize()
+}
+
 func (s *Service) serialize() ([]byte, error) {
 	data, err := serialize(s.UnitName, s.Service.Conf, renderer)
 	if err != nil {
@@ -24,12 +24,14 @@ func (s *ControllerConfigSuite) TestControllerAndModelConfigInitialisation(c *gc
 	c.Assert(err, jc.ErrorIsNil)
 
 	optional := map[string]bool{
-		controller.IdentityURL:         true,
-		controller.IdentityPublicKey:   true,
-		controller.AutocertURLKey:      true,
-		controller.AutocertDNSNameKey:  true,
-		controller.AllowModelAccessKey: true,
-		controller.MongoMemoryProfile:  true,
+		controller.IdentityURL:            true,
+		controller.IdentityPublicKey:      true,
+		controller.AutocertURLKey:         true,
+		controller.AutocertDNSNameKey:     true,
+		controller.AllowModelAccessKey:    true,
+		controller.MongoMemoryProfile:     true,
+		controller.MigrationWebhookURL:    true,
+		controller.MigrationWebhookSecret: true,
 	}
 	for _, controllerAttr := range controller.ControllerOnlyConfigAttributes {
 		v, ok := controllerSettings.Get(controllerAttr)
@@ -48,6 +48,33 @@ func (st *State) Export() (description.Model, error) {
 	return st.exportImpl(ExportConfig{})
 }
 
+// MigrationEntityCounts holds the number of entities of each kind in a
+// model that affects where the model can be migrated to.
+type MigrationEntityCounts struct {
+	RemoteApplications int
+}
+
+// MigrationEntityCounts counts the entities in the model that affect
+// where it can be migrated to, without exporting it.
+func (st *State) MigrationEntityCounts() (MigrationEntityCounts, error) {
+	var counts MigrationEntityCounts
+	for _, item := range []struct {
+		collection string
+		count      *int
+	}{
+		{remoteApplicationsC, &counts.RemoteApplications},
+	} {
+		coll, closer := st.db().GetCollection(item.collection)
+		n, err := coll.Count()
+		closer()
+		if err != nil {
+			return MigrationEntityCounts{}, errors.Annotatef(err, "counting %s", item.collection)
+		}
+		*item.count = n
+	}
+	return counts, nil
+}
+
 func (st *State) exportImpl(cfg ExportConfig) (description.Model, error) {
 	dbModel, err := st.Model()
 	if err != nil {
@@ -985,14 +1012,9 @@ func (e *exporter) subnets() error {
 			ProviderId:        string(subnet.ProviderId()),
 			ProviderNetworkId: string(subnet.ProviderNetworkId()),
 			VLANTag:           subnet.VLANTag(),
+			AvailabilityZones: subnet.AvailabilityZones(),
 			SpaceName:         subnet.SpaceName(),
 		}
-		// TODO(babbageclunk): at the moment state.Subnet only stores
-		// one AZ.
-		az := subnet.AvailabilityZone()
-		if az != "" {
-			args.AvailabilityZones = []string{az}
-		}
 		e.model.AddSubnet(args)
 	}
 	return nil
@@ -684,7 +684,7 @@ func (s *MigrationExportSuite) TestSubnets(c *gc.C) {
 		ProviderId:        network.Id("foo"),
 		ProviderNetworkId: network.Id("rust"),
 		VLANTag:           64,
-		AvailabilityZone:  "bar",
+		AvailabilityZones: []string{"bar", "baz"},
 		SpaceName:         "bam",
 	})
 	c.Assert(err, jc.ErrorIsNil)
@@ -701,7 +701,7 @@ func (s *MigrationExportSuite) TestSubnets(c *gc.C) {
 	c.Assert(subnet.ProviderId(), gc.Equals, "foo")
 	c.Assert(subnet.ProviderNetworkId(), gc.Equals, "rust")
 	c.Assert(subnet.VLANTag(), gc.Equals, 64)
-	c.Assert(subnet.AvailabilityZones(), gc.DeepEquals, []string{"bar"})
+	c.Assert(subnet.AvailabilityZones(), gc.DeepEquals, []string{"bar", "baz"})
 	c.Assert(subnet.SpaceName(), gc.Equals, "bam")
 }
 
@@ -1123,6 +1123,25 @@ func (s *MigrationExportSuite) TestStoragePools(c *gc.C) {
 	})
 }
 
+func (s *MigrationExportSuite) TestMigrationEntityCounts(c *gc.C) {
+	counts, err := s.State.MigrationEntityCounts()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(counts, gc.Equals, state.MigrationEntityCounts{})
+
+	_, err = s.State.AddRemoteApplication(state.AddRemoteApplicationParams{
+		Name:        "remote-app",
+		SourceModel: s.State.ModelTag(),
+		Token:       "token",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	counts, err = s.State.MigrationEntityCounts()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(counts, gc.Equals, state.MigrationEntityCounts{
+		RemoteApplications: 1,
+	})
+}
+
 func (s *MigrationExportSuite) TestPayloads(c *gc.C) {
 	unit := s.Factory.MakeUnit(c, nil)
 	up, err := s.State.UnitPayloads(unit)
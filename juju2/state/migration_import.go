@@ -94,7 +94,18 @@ func (st *State) Import(model description.Model) (_ *Model, _ *State, err error)
 
 		existingCreds, err := st.CloudCredential(credTag)
 
-		if errors.IsNotFound(err) {
+		if len(creds.Attributes()) == 0 {
+			// A credential without attributes refers to one
+			// that must already exist on the controller.
+			if errors.IsNotFound(err) {
+				return nil, nil, errors.NotFoundf("credential %q", credID)
+			} else if err != nil {
+				return nil, nil, errors.Trace(err)
+			}
+			if existingCreds.Revoked {
+				return nil, nil, errors.Errorf("credential %q is revoked", credID)
+			}
+		} else if errors.IsNotFound(err) {
 			credential := cloud.NewCredential(
 				cloud.AuthType(creds.AuthType()),
 				creds.Attributes())
@@ -1242,14 +1253,9 @@ func (i *importer) subnets() error {
 			ProviderId:        network.Id(subnet.ProviderId()),
 			ProviderNetworkId: network.Id(subnet.ProviderNetworkId()),
 			VLANTag:           subnet.VLANTag(),
+			AvailabilityZones: subnet.AvailabilityZones(),
 			SpaceName:         subnet.SpaceName(),
 		}
-		// TODO(babbageclunk): at the moment state.Subnet only stores
-		// one AZ.
-		zones := subnet.AvailabilityZones()
-		if len(zones) > 0 {
-			info.AvailabilityZone = zones[0]
-		}
 		err := i.addSubnet(info)
 		if err != nil {
 			return errors.Trace(err)
@@ -17,6 +17,7 @@ import (
 	"gopkg.in/juju/names.v2"
 	"gopkg.in/yaml.v2"
 
+	"github.com/juju/1.25-upgrade/juju2/cloud"
 	"github.com/juju/1.25-upgrade/juju2/constraints"
 	"github.com/juju/1.25-upgrade/juju2/network"
 	"github.com/juju/1.25-upgrade/juju2/payload"
@@ -217,6 +218,38 @@ func (s *MigrationImportSuite) AssertUserEqual(c *gc.C, newUser, oldUser permiss
 	}
 }
 
+// importWithCredential imports the model with its cloud credential
+// replaced by one that only names a credential of the owner.
+func (s *MigrationImportSuite) importWithCredential(c *gc.C, name string) (*state.Model, *state.State, error) {
+	out, err := s.State.Export()
+	c.Assert(err, jc.ErrorIsNil)
+	out.SetCloudCredential(description.CloudCredentialArgs{
+		Owner: s.Owner,
+		Cloud: names.NewCloudTag("dummy"),
+		Name:  name,
+	})
+	return s.State.Import(newModel(out, utils.MustNewUUID().String(), "new"))
+}
+
+func (s *MigrationImportSuite) TestCredentialReferencedByName(c *gc.C) {
+	credTag := names.NewCloudCredentialTag(fmt.Sprintf("dummy/%s/existing", s.Owner.Id()))
+	err := s.State.UpdateCloudCredential(credTag, cloud.NewCredential(cloud.EmptyAuthType, nil))
+	c.Assert(err, jc.ErrorIsNil)
+
+	newModel, newSt, err := s.importWithCredential(c, "existing")
+	c.Assert(err, jc.ErrorIsNil)
+	defer newSt.Close()
+
+	tag, ok := newModel.CloudCredential()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(tag, gc.Equals, credTag)
+}
+
+func (s *MigrationImportSuite) TestCredentialReferencedByNameMissing(c *gc.C) {
+	_, _, err := s.importWithCredential(c, "missing")
+	c.Assert(err, gc.ErrorMatches, `credential "dummy/.*/missing" not found`)
+}
+
 func (s *MigrationImportSuite) TestModelUsers(c *gc.C) {
 	// To be sure with this test, we create three env users, and remove
 	// the owner.
@@ -858,7 +891,7 @@ func (s *MigrationImportSuite) TestSubnets(c *gc.C) {
 		ProviderId:        network.Id("foo"),
 		ProviderNetworkId: network.Id("elm"),
 		VLANTag:           64,
-		AvailabilityZone:  "bar",
+		AvailabilityZones: []string{"bar", "baz"},
 		SpaceName:         "bam",
 	})
 	c.Assert(err, jc.ErrorIsNil)
@@ -874,7 +907,7 @@ func (s *MigrationImportSuite) TestSubnets(c *gc.C) {
 	c.Assert(subnet.ProviderId(), gc.Equals, network.Id("foo"))
 	c.Assert(subnet.ProviderNetworkId(), gc.Equals, network.Id("elm"))
 	c.Assert(subnet.VLANTag(), gc.Equals, 64)
-	c.Assert(subnet.AvailabilityZone(), gc.Equals, "bar")
+	c.Assert(subnet.AvailabilityZones(), jc.DeepEquals, []string{"bar", "baz"})
 	c.Assert(subnet.SpaceName(), gc.Equals, "bam")
 }
 
@@ -598,13 +598,17 @@ func (s *MigrationSuite) TestSubnetDocFields(c *gc.C) {
 
 		// Currently unused (never set or exposed).
 		"IsPublic",
+
+		// Only set on subnets added before AvailabilityZones, and
+		// exported through it.
+		"AvailabilityZone",
 	)
 	migrated := set.NewStrings(
 		"CIDR",
 		"VLANTag",
 		"SpaceName",
 		"ProviderId",
-		"AvailabilityZone",
+		"AvailabilityZones",
 		"ProviderNetworkId",
 	)
 	s.AssertExportedFields(c, subnetDoc{}, migrated.Union(ignored))
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/juju/errors"
+	"github.com/juju/loggo"
 	"github.com/juju/utils/set"
 	"gopkg.in/juju/names.v2"
 	"gopkg.in/macaroon.v1"
@@ -67,6 +68,10 @@ type ModelMigration interface {
 	// migration's target controller.
 	TargetInfo() (*migration.TargetInfo, error)
 
+	// LogTransferOptions returns the limits on the logs sent to the
+	// target controller once the migration has succeeded.
+	LogTransferOptions() (migration.LogTransferOptions, error)
+
 	// SetPhase sets the phase of the migration. An error will be
 	// returned if the new phase does not follow the current phase or
 	// if the migration is no longer active.
@@ -76,6 +81,15 @@ type ModelMigration interface {
 	// current progress of the migration.
 	SetStatusMessage(text string) error
 
+	// ImportProgress returns the steps of the IMPORT phase that have
+	// been completed.
+	ImportProgress() []string
+
+	// AddImportProgress records steps of the IMPORT phase as
+	// completed, so that they need not be repeated if the phase is
+	// interrupted.
+	AddImportProgress(steps ...string) error
+
 	// SubmitMinionReport records a report from a migration minion
 	// worker about the success or failure to complete its actions for
 	// a given migration phase.
@@ -152,6 +166,21 @@ type modelMigDoc struct {
 	// TargetMacaroons holds the macaroons to use with TargetAuthTag
 	// when authenticating.
 	TargetMacaroons string `bson:"target-macaroons,omitempty"`
+
+	// LogTransfer holds the limits on the logs sent to the target
+	// controller. It is nil if all logs are to be sent unthrottled.
+	LogTransfer *logTransferDoc `bson:"log-transfer,omitempty"`
+}
+
+// logTransferDoc holds the log transfer options of a migration
+// attempt. See migration.LogTransferOptions.
+type logTransferDoc struct {
+	MaxAge              int64    `bson:"max-age,omitempty"`
+	Level               string   `bson:"level,omitempty"`
+	IncludeEntities     []string `bson:"include-entities,omitempty"`
+	ExcludeEntities     []string `bson:"exclude-entities,omitempty"`
+	MaxRecordsPerSecond int      `bson:"max-records-per-second,omitempty"`
+	MaxBytesPerSecond   int      `bson:"max-bytes-per-second,omitempty"`
 }
 
 // modelMigStatusDoc tracks the progress of a migration attempt for a
@@ -190,6 +219,10 @@ type modelMigStatusDoc struct {
 	// StatusMessage holds a human readable message about the
 	// migration's progress.
 	StatusMessage string `bson:"status-message"`
+
+	// ImportProgress holds the steps of the IMPORT phase that have
+	// been completed.
+	ImportProgress []string `bson:"import-progress,omitempty"`
 }
 
 type modelMigMinionSyncDoc struct {
@@ -275,6 +308,30 @@ func (mig *modelMigration) TargetInfo() (*migration.TargetInfo, error) {
 	}, nil
 }
 
+// LogTransferOptions implements ModelMigration.
+func (mig *modelMigration) LogTransferOptions() (migration.LogTransferOptions, error) {
+	doc := mig.doc.LogTransfer
+	if doc == nil {
+		return migration.LogTransferOptions{}, nil
+	}
+	level := loggo.UNSPECIFIED
+	if doc.Level != "" {
+		var ok bool
+		level, ok = loggo.ParseLevel(doc.Level)
+		if !ok {
+			return migration.LogTransferOptions{}, errors.NotValidf("log level %q", doc.Level)
+		}
+	}
+	return migration.LogTransferOptions{
+		MaxAge:              time.Duration(doc.MaxAge),
+		Level:               level,
+		IncludeEntities:     doc.IncludeEntities,
+		ExcludeEntities:     doc.ExcludeEntities,
+		MaxRecordsPerSecond: doc.MaxRecordsPerSecond,
+		MaxBytesPerSecond:   doc.MaxBytesPerSecond,
+	}, nil
+}
+
 // SetPhase implements ModelMigration.
 func (mig *modelMigration) SetPhase(nextPhase migration.Phase) error {
 	now := mig.st.clock.Now().UnixNano()
@@ -411,6 +468,37 @@ func (mig *modelMigration) SetStatusMessage(text string) error {
 	return nil
 }
 
+// ImportProgress implements ModelMigration.
+func (mig *modelMigration) ImportProgress() []string {
+	return mig.statusDoc.ImportProgress
+}
+
+// AddImportProgress implements ModelMigration.
+func (mig *modelMigration) AddImportProgress(steps ...string) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	ops := []txn.Op{{
+		C:  migrationsStatusC,
+		Id: mig.statusDoc.Id,
+		Update: bson.M{"$addToSet": bson.M{
+			"import-progress": bson.M{"$each": steps},
+		}},
+		Assert: txn.DocExists,
+	}}
+	if err := mig.st.runTransaction(ops); err != nil {
+		return errors.Annotate(err, "failed to add import progress")
+	}
+	progress := set.NewStrings(mig.statusDoc.ImportProgress...)
+	for _, step := range steps {
+		if !progress.Contains(step) {
+			progress.Add(step)
+			mig.statusDoc.ImportProgress = append(mig.statusDoc.ImportProgress, step)
+		}
+	}
+	return nil
+}
+
 // SubmitMinionReport implements ModelMigration.
 func (mig *modelMigration) SubmitMinionReport(tag names.Tag, phase migration.Phase, success bool) error {
 	globalKey, err := agentTagToGlobalKey(tag)
@@ -596,6 +684,7 @@ func (mig *modelMigration) Refresh() error {
 type MigrationSpec struct {
 	InitiatedBy names.UserTag
 	TargetInfo  migration.TargetInfo
+	LogTransfer migration.LogTransferOptions
 }
 
 // Validate returns an error if the MigrationSpec contains bad
@@ -604,7 +693,10 @@ func (spec *MigrationSpec) Validate() error {
 	if !names.IsValidUser(spec.InitiatedBy.Id()) {
 		return errors.NotValidf("InitiatedBy")
 	}
-	return spec.TargetInfo.Validate()
+	if err := spec.TargetInfo.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	return spec.LogTransfer.Validate()
 }
 
 // CreateMigration initialises state that tracks a model migration. It
@@ -669,6 +761,7 @@ func (st *State) CreateMigration(spec MigrationSpec) (ModelMigration, error) {
 			TargetAuthTag:    spec.TargetInfo.AuthTag.String(),
 			TargetPassword:   spec.TargetInfo.Password,
 			TargetMacaroons:  macsJSON,
+			LogTransfer:      logTransferToDoc(spec.LogTransfer),
 		}
 
 		statusDoc = modelMigStatusDoc{
@@ -738,6 +831,27 @@ func jsonToMacaroons(raw string) ([]macaroon.Slice, error) {
 	return macs, nil
 }
 
+// logTransferToDoc returns the document holding the given options, or
+// nil if they do not limit the transfer at all.
+func logTransferToDoc(opts migration.LogTransferOptions) *logTransferDoc {
+	doc := logTransferDoc{
+		MaxAge:              int64(opts.MaxAge),
+		IncludeEntities:     opts.IncludeEntities,
+		ExcludeEntities:     opts.ExcludeEntities,
+		MaxRecordsPerSecond: opts.MaxRecordsPerSecond,
+		MaxBytesPerSecond:   opts.MaxBytesPerSecond,
+	}
+	if opts.Level != loggo.UNSPECIFIED {
+		doc.Level = opts.Level.String()
+	}
+	if doc.MaxAge == 0 && doc.Level == "" &&
+		len(doc.IncludeEntities) == 0 && len(doc.ExcludeEntities) == 0 &&
+		doc.MaxRecordsPerSecond == 0 && doc.MaxBytesPerSecond == 0 {
+		return nil
+	}
+	return &doc
+}
+
 func checkTargetController(st *State, targetControllerTag names.ControllerTag) error {
 	currentController, err := st.ControllerModel()
 	if err != nil {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/juju/errors"
+	"github.com/juju/loggo"
 	jujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
@@ -80,6 +81,10 @@ func (s *MigrationSuite) TestCreate(c *gc.C) {
 	c.Assert(err, jc.ErrorIsNil)
 	c.Check(*info, jc.DeepEquals, s.stdSpec.TargetInfo)
 
+	logTransfer, err := mig.LogTransferOptions()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(logTransfer, jc.DeepEquals, migration.LogTransferOptions{})
+
 	assertPhase(c, mig, migration.QUIESCE)
 	c.Check(mig.PhaseChangedTime(), gc.Equals, mig.StartTime())
 
@@ -89,6 +94,27 @@ func (s *MigrationSuite) TestCreate(c *gc.C) {
 	c.Check(model.MigrationMode(), gc.Equals, state.MigrationModeExporting)
 }
 
+func (s *MigrationSuite) TestCreateWithLogTransferOptions(c *gc.C) {
+	spec := s.stdSpec
+	spec.LogTransfer = migration.LogTransferOptions{
+		MaxAge:              24 * time.Hour,
+		Level:               loggo.WARNING,
+		IncludeEntities:     []string{"machine-0", "unit-mysql-*"},
+		ExcludeEntities:     []string{"unit-mysql-1"},
+		MaxRecordsPerSecond: 500,
+		MaxBytesPerSecond:   65536,
+	}
+	_, err := s.State2.CreateMigration(spec)
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Read the migration back to check the options were stored.
+	mig, err := s.State2.LatestMigration()
+	c.Assert(err, jc.ErrorIsNil)
+	logTransfer, err := mig.LogTransferOptions()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(logTransfer, jc.DeepEquals, spec.LogTransfer)
+}
+
 func (s *MigrationSuite) TestIsMigrationActive(c *gc.C) {
 	check := func(expected bool) {
 		isActive, err := s.State2.IsMigrationActive()
@@ -172,6 +198,12 @@ func (s *MigrationSuite) TestSpecValidation(c *gc.C) {
 			spec.TargetInfo.Addrs = nil
 		},
 		"empty Addrs not valid",
+	}, {
+		"LogTransfer is validated",
+		func(spec *state.MigrationSpec) {
+			spec.LogTransfer.MaxBytesPerSecond = -1
+		},
+		"negative MaxBytesPerSecond not valid",
 	}}
 	for _, test := range tests {
 		c.Logf("---- %s -----------", test.label)
@@ -496,6 +528,23 @@ func (s *MigrationSuite) TestStatusMessage(c *gc.C) {
 	c.Check(mig2.StatusMessage(), gc.Equals, "foo bar")
 }
 
+func (s *MigrationSuite) TestImportProgress(c *gc.C) {
+	mig, err := s.State2.CreateMigration(s.stdSpec)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(mig.ImportProgress(), gc.HasLen, 0)
+
+	err = mig.AddImportProgress("model", "charm cs:foo-1")
+	c.Assert(err, jc.ErrorIsNil)
+	err = mig.AddImportProgress("charm cs:foo-1", "tools 2.2.2-xenial-amd64")
+	c.Assert(err, jc.ErrorIsNil)
+	expected := []string{"model", "charm cs:foo-1", "tools 2.2.2-xenial-amd64"}
+	c.Check(mig.ImportProgress(), jc.DeepEquals, expected)
+
+	mig2, err := s.State2.LatestMigration()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(mig2.ImportProgress(), jc.DeepEquals, expected)
+}
+
 func (s *MigrationSuite) TestWatchForMigration(c *gc.C) {
 	// Start watching for migration.
 	w, wc := s.createMigrationWatcher(c, s.State2)
@@ -42,9 +42,9 @@ func (s *SpacesSuite) makeSubnetInfosForCIDRs(c *gc.C, CIDRs []string) []state.S
 		c.Assert(err, jc.ErrorIsNil)
 
 		infos[i] = state.SubnetInfo{
-			CIDR:             cidr,
-			VLANTag:          79,
-			AvailabilityZone: "AvailabilityZone",
+			CIDR:              cidr,
+			VLANTag:           79,
+			AvailabilityZones: []string{"AvailabilityZone"},
 		}
 
 	}
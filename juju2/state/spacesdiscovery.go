@@ -63,16 +63,12 @@ func (st *State) SaveSubnetsFromProvider(subnets []network.SubnetInfo) error {
 		if modelSubnetIds.Contains(string(subnet.ProviderId)) {
 			continue
 		}
-		var firstZone string
-		if len(subnet.AvailabilityZones) > 0 {
-			firstZone = subnet.AvailabilityZones[0]
-		}
 		_, err := st.AddSubnet(SubnetInfo{
 			ProviderId:        subnet.ProviderId,
 			ProviderNetworkId: subnet.ProviderNetworkId,
 			CIDR:              subnet.CIDR,
 			VLANTag:           subnet.VLANTag,
-			AvailabilityZone:  firstZone,
+			AvailabilityZones: subnet.AvailabilityZones,
 		})
 		if err != nil {
 			return errors.Trace(err)
@@ -140,17 +136,13 @@ func (st *State) SaveSpacesFromProvider(providerSpaces []network.SpaceInfo) erro
 			if modelSubnetIds.Contains(string(subnet.ProviderId)) {
 				continue
 			}
-			var firstZone string
-			if len(subnet.AvailabilityZones) > 0 {
-				firstZone = subnet.AvailabilityZones[0]
-			}
 			_, err = st.AddSubnet(SubnetInfo{
 				ProviderId:        subnet.ProviderId,
 				ProviderNetworkId: subnet.ProviderNetworkId,
 				CIDR:              subnet.CIDR,
 				SpaceName:         spaceTag.Id(),
 				VLANTag:           subnet.VLANTag,
-				AvailabilityZone:  firstZone,
+				AvailabilityZones: subnet.AvailabilityZones,
 			})
 			if err != nil {
 				return errors.Trace(err)
@@ -31,9 +31,10 @@ type SubnetInfo struct {
 	// networks. It's defined by IEEE 802.1Q standard.
 	VLANTag int
 
-	// AvailabilityZone describes which availability zone this subnet is in. It can
-	// be empty if the provider does not support availability zones.
-	AvailabilityZone string
+	// AvailabilityZones describes which availability zones this subnet is
+	// in. It can be empty if the provider does not support availability
+	// zones.
+	AvailabilityZones []string
 
 	// SpaceName is the name of the space the subnet is associated with. It
 	// can be empty if the subnet is not associated with a space yet.
@@ -53,7 +54,10 @@ type subnetDoc struct {
 	ProviderNetworkId string `bson:"provider-network-id,omitempty"`
 	CIDR              string `bson:"cidr"`
 	VLANTag           int    `bson:"vlantag,omitempty"`
-	AvailabilityZone  string `bson:"availabilityzone,omitempty"`
+	// AvailabilityZone holds the single zone recorded for subnets
+	// added before AvailabilityZones; it is never written now.
+	AvailabilityZone  string   `bson:"availabilityzone,omitempty"`
+	AvailabilityZones []string `bson:"availability-zones,omitempty"`
 	// TODO: add IsPublic to SubnetArgs, add an IsPublic method and add
 	// IsPublic to migration import/export.
 	IsPublic  bool   `bson:"is-public,omitempty"`
@@ -149,10 +153,13 @@ func (s *Subnet) VLANTag() int {
 	return s.doc.VLANTag
 }
 
-// AvailabilityZone returns the availability zone of the subnet. If the subnet
-// is not associated with an availability zone it will be the empty string.
-func (s *Subnet) AvailabilityZone() string {
-	return s.doc.AvailabilityZone
+// AvailabilityZones returns the availability zones of the subnet. If the
+// subnet is not associated with any availability zones it will be empty.
+func (s *Subnet) AvailabilityZones() []string {
+	if len(s.doc.AvailabilityZones) == 0 && s.doc.AvailabilityZone != "" {
+		return []string{s.doc.AvailabilityZone}
+	}
+	return s.doc.AvailabilityZones
 }
 
 // SpaceName returns the space the subnet is associated with. If the subnet is
@@ -247,7 +254,7 @@ func (st *State) newSubnetFromArgs(args SubnetInfo) (*Subnet, error) {
 		VLANTag:           args.VLANTag,
 		ProviderId:        string(args.ProviderId),
 		ProviderNetworkId: string(args.ProviderNetworkId),
-		AvailabilityZone:  args.AvailabilityZone,
+		AvailabilityZones: args.AvailabilityZones,
 		SpaceName:         args.SpaceName,
 	}
 	subnet := &Subnet{doc: subDoc, st: st}
@@ -268,7 +275,7 @@ func (st *State) addSubnetOps(args SubnetInfo) []txn.Op {
 		VLANTag:           args.VLANTag,
 		ProviderId:        string(args.ProviderId),
 		ProviderNetworkId: string(args.ProviderNetworkId),
-		AvailabilityZone:  args.AvailabilityZone,
+		AvailabilityZones: args.AvailabilityZones,
 		SpaceName:         args.SpaceName,
 	}
 	ops := []txn.Op{
@@ -9,6 +9,7 @@ import (
 	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
 
 	"github.com/juju/1.25-upgrade/juju2/state"
 )
@@ -24,7 +25,7 @@ func (s *SubnetSuite) TestAddSubnetSucceedsWithFullyPopulatedInfo(c *gc.C) {
 		ProviderId:        "foo",
 		CIDR:              "192.168.1.0/24",
 		VLANTag:           79,
-		AvailabilityZone:  "Timbuktu",
+		AvailabilityZones: []string{"Timbuktu", "Ouagadougou"},
 		SpaceName:         "foo",
 		ProviderNetworkId: "wildbirds",
 	}
@@ -43,13 +44,31 @@ func (s *SubnetSuite) assertSubnetMatchesInfo(c *gc.C, subnet *state.Subnet, inf
 	c.Assert(subnet.ProviderId(), gc.Equals, info.ProviderId)
 	c.Assert(subnet.CIDR(), gc.Equals, info.CIDR)
 	c.Assert(subnet.VLANTag(), gc.Equals, info.VLANTag)
-	c.Assert(subnet.AvailabilityZone(), gc.Equals, info.AvailabilityZone)
+	c.Assert(subnet.AvailabilityZones(), jc.DeepEquals, info.AvailabilityZones)
 	c.Assert(subnet.String(), gc.Equals, info.CIDR)
 	c.Assert(subnet.GoString(), gc.Equals, info.CIDR)
 	c.Assert(subnet.SpaceName(), gc.Equals, info.SpaceName)
 	c.Assert(subnet.ProviderNetworkId(), gc.Equals, info.ProviderNetworkId)
 }
 
+func (s *SubnetSuite) TestAvailabilityZonesFallsBackToLegacyZone(c *gc.C) {
+	_, err := s.State.AddSubnet(state.SubnetInfo{CIDR: "192.168.1.0/24"})
+	c.Assert(err, jc.ErrorIsNil)
+
+	// Subnets added before multiple zones were supported only have the
+	// single "availabilityzone" field.
+	coll, closer := state.GetRawCollection(s.State, "subnets")
+	defer closer()
+	err = coll.UpdateId(s.State.ModelUUID()+":192.168.1.0/24", bson.D{{
+		"$set", bson.D{{"availabilityzone", "Timbuktu"}},
+	}})
+	c.Assert(err, jc.ErrorIsNil)
+
+	subnet, err := s.State.Subnet("192.168.1.0/24")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(subnet.AvailabilityZones(), jc.DeepEquals, []string{"Timbuktu"})
+}
+
 func (s *SubnetSuite) TestAddSubnetFailsWithEmptyCIDR(c *gc.C) {
 	subnetInfo := state.SubnetInfo{}
 	s.assertAddSubnetForInfoFailsWithSuffix(c, subnetInfo, "missing CIDR")
@@ -255,7 +274,7 @@ func (s *SubnetSuite) TestAllSubnets(c *gc.C) {
 		{CIDR: "192.168.1.0/24"},
 		{CIDR: "8.8.8.0/24", SpaceName: "bar"},
 		{CIDR: "10.0.2.0/24", ProviderId: "foo"},
-		{CIDR: "2001:db8::/64", AvailabilityZone: "zone1"},
+		{CIDR: "2001:db8::/64", AvailabilityZones: []string{"zone1"}},
 	}
 
 	for _, info := range subnetInfos {
@@ -271,6 +290,6 @@ func (s *SubnetSuite) TestAllSubnets(c *gc.C) {
 		c.Assert(subnet.CIDR(), gc.Equals, subnetInfos[i].CIDR)
 		c.Assert(subnet.ProviderId(), gc.Equals, subnetInfos[i].ProviderId)
 		c.Assert(subnet.SpaceName(), gc.Equals, subnetInfos[i].SpaceName)
-		c.Assert(subnet.AvailabilityZone(), gc.Equals, subnetInfos[i].AvailabilityZone)
+		c.Assert(subnet.AvailabilityZones(), jc.DeepEquals, subnetInfos[i].AvailabilityZones)
 	}
 }
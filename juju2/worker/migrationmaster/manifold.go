@@ -4,6 +4,9 @@
 package migrationmaster
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/juju/errors"
 	"github.com/juju/utils/clock"
 	worker "gopkg.in/juju/worker.v1"
@@ -16,6 +19,26 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/worker/fortress"
 )
 
+const (
+	// webhookTimeout is how long the migration webhook is given to
+	// respond to each request.
+	webhookTimeout = 2 * time.Second
+
+	// webhookAttempts is how many times an event is posted to the
+	// migration webhook before giving up on it.
+	webhookAttempts = 3
+
+	// webhookRetryDelay is how long is waited before posting an event
+	// to the migration webhook again for the first time.
+	webhookRetryDelay = 500 * time.Millisecond
+
+	// webhookMaxEventTime is the longest time spent posting each event
+	// to the migration webhook. Events are posted as the migration
+	// moves between phases, so this bounds how long an unresponsive
+	// webhook can hold up each phase change.
+	webhookMaxEventTime = 5 * time.Second
+)
+
 // ManifoldConfig defines the names of the manifolds on which a
 // Worker manifold will depend.
 type ManifoldConfig struct {
@@ -73,6 +96,10 @@ func (config ManifoldConfig) start(context dependency.Context) (worker.Worker, e
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	webhook, err := newPhaseWebhook(facade, config.Clock)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 	apiClient := apiConn.Client()
 	worker, err := config.NewWorker(Config{
 		ModelUUID:       agent.CurrentConfig().Model().Id(),
@@ -83,6 +110,7 @@ func (config ManifoldConfig) start(context dependency.Context) (worker.Worker, e
 		CharmDownloader: apiClient,
 		ToolsDownloader: apiClient,
 		Clock:           config.Clock,
+		Webhook:         webhook,
 	})
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -90,6 +118,32 @@ func (config ManifoldConfig) start(context dependency.Context) (worker.Worker, e
 	return worker, nil
 }
 
+// newPhaseWebhook returns a Webhook for the URL in the controller
+// config, or nil if there is none.
+func newPhaseWebhook(facade Facade, clock clock.Clock) (PhaseNotifier, error) {
+	controllerConfig, err := facade.ControllerConfig()
+	if err != nil {
+		return nil, errors.Annotate(err, "getting controller config")
+	}
+	url := controllerConfig.MigrationWebhookURL()
+	if url == "" {
+		return nil, nil
+	}
+	webhook, err := NewWebhook(WebhookConfig{
+		URL:          url,
+		Secret:       controllerConfig.MigrationWebhookSecret(),
+		Client:       &http.Client{Timeout: webhookTimeout},
+		Clock:        clock,
+		Attempts:     webhookAttempts,
+		RetryDelay:   webhookRetryDelay,
+		MaxEventTime: webhookMaxEventTime,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return webhook, nil
+}
+
 func errorFilter(err error) error {
 	switch errors.Cause(err) {
 	case ErrMigrated:
@@ -0,0 +1,210 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migrationmaster
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils/clock"
+)
+
+const (
+	// WebhookSignatureHeader holds the HMAC-SHA256 signature of the
+	// body of a webhook request, made with the configured secret and
+	// hex-encoded as "sha256=<signature>".
+	WebhookSignatureHeader = "X-Juju-Migration-Signature"
+
+	// WebhookEventHeader holds the kind of event a webhook request
+	// reports.
+	WebhookEventHeader = "X-Juju-Migration-Event"
+
+	// phaseEventKind is the kind of event posted when a migration
+	// moves to a new phase.
+	phaseEventKind = "phase"
+)
+
+// PhaseEvent describes a model migration moving to a new phase. It is
+// posted as JSON to the migration webhook.
+type PhaseEvent struct {
+	MigrationId      string    `json:"migration-id"`
+	ModelUUID        string    `json:"model-uuid"`
+	Phase            string    `json:"phase"`
+	PreviousPhase    string    `json:"previous-phase"`
+	TargetController string    `json:"target-controller"`
+	TargetAddrs      []string  `json:"target-addrs"`
+	Time             time.Time `json:"time"`
+
+	// PreviousPhaseStarted is when the migration moved to the
+	// previous phase, and PreviousPhaseSeconds is how long it then
+	// spent in it.
+	PreviousPhaseStarted time.Time `json:"previous-phase-started"`
+	PreviousPhaseSeconds float64   `json:"previous-phase-seconds"`
+
+	// Error holds the problem that caused the migration to be
+	// aborted, or its model not to be removed from the source.
+	Error string `json:"error,omitempty"`
+}
+
+// PhaseNotifier is notified of each phase a migration moves to.
+type PhaseNotifier interface {
+	// NotifyPhase reports the event, giving up if abort is closed.
+	NotifyPhase(event PhaseEvent, abort <-chan struct{}) error
+}
+
+// WebhookConfig holds the configuration of a Webhook.
+type WebhookConfig struct {
+	// URL is where events are posted.
+	URL string
+
+	// Secret, if not empty, is used to sign the events.
+	Secret string
+
+	// Client is used to post the events.
+	Client *http.Client
+
+	// Clock is used to wait between attempts.
+	Clock clock.Clock
+
+	// Attempts is the number of times an event is posted before
+	// giving up on it.
+	Attempts int
+
+	// RetryDelay is the time waited after the first failed attempt.
+	// It doubles after each attempt after that.
+	RetryDelay time.Duration
+
+	// MaxEventTime is the longest time spent posting an event, across
+	// all its attempts, so that an unresponsive endpoint holds up the
+	// migration for no longer than that.
+	MaxEventTime time.Duration
+}
+
+// Validate returns an error if the config cannot drive a Webhook.
+func (config WebhookConfig) Validate() error {
+	if config.URL == "" {
+		return errors.NotValidf("empty URL")
+	}
+	if config.Client == nil {
+		return errors.NotValidf("nil Client")
+	}
+	if config.Clock == nil {
+		return errors.NotValidf("nil Clock")
+	}
+	if config.Attempts < 1 {
+		return errors.NotValidf("%d Attempts", config.Attempts)
+	}
+	if config.RetryDelay <= 0 {
+		return errors.NotValidf("non-positive RetryDelay")
+	}
+	if config.MaxEventTime <= 0 {
+		return errors.NotValidf("non-positive MaxEventTime")
+	}
+	return nil
+}
+
+// NewWebhook returns a Webhook that posts to the configured URL.
+func NewWebhook(config WebhookConfig) (*Webhook, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Webhook{config}, nil
+}
+
+// Webhook is a PhaseNotifier that posts each event to an HTTP
+// endpoint. Events that cannot be delivered, because the endpoint
+// cannot be reached or responds with a server error, are retried until
+// the configured MaxEventTime has passed.
+type Webhook struct {
+	config WebhookConfig
+}
+
+// NotifyPhase is part of the PhaseNotifier interface.
+func (h *Webhook) NotifyPhase(event PhaseEvent, abort <-chan struct{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// The event is given up on once MaxEventTime has passed, even if
+	// a request is in progress.
+	timedOut := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-h.config.Clock.After(h.config.MaxEventTime):
+			close(timedOut)
+		case <-done:
+		}
+	}()
+
+	delay := h.config.RetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := h.post(phaseEventKind, body, timedOut)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == h.config.Attempts {
+			return errors.Annotatef(err, "posting %s event (attempt %d)", event.Phase, attempt)
+		}
+		select {
+		case <-abort:
+			return errors.Annotatef(err, "posting %s event (aborted)", event.Phase)
+		case <-timedOut:
+			return errors.Annotatef(err, "posting %s event (timed out)", event.Phase)
+		case <-h.config.Clock.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends the event body, and returns any error along with whether
+// the request should be retried. The request is abandoned if cancel is
+// closed.
+func (h *Webhook) post(kind string, body []byte, cancel <-chan struct{}) (bool, error) {
+	req, err := http.NewRequest("POST", h.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	req.Cancel = cancel
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, kind)
+	if h.config.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookBody(h.config.Secret, body))
+	}
+	resp, err := h.config.Client.Do(req)
+	if err != nil {
+		return true, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so that the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests:
+		return true, errors.Errorf("webhook responded %s", resp.Status)
+	default:
+		return false, errors.Errorf("webhook responded %s", resp.Status)
+	}
+}
+
+// SignWebhookBody returns the hex-encoded HMAC-SHA256 signature of a
+// webhook request body, made with the given secret. A receiver can
+// compare it with the WebhookSignatureHeader of the request.
+func SignWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return fmt.Sprintf("%x", mac.Sum(nil))
+}
@@ -0,0 +1,222 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package migrationmaster_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/clock"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/1.25-upgrade/juju2/worker/migrationmaster"
+)
+
+type WebhookSuite struct {
+	testing.IsolationSuite
+
+	mu        sync.Mutex
+	requests  []webhookRequest
+	responses []int
+	server    *httptest.Server
+}
+
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+var _ = gc.Suite(&WebhookSuite{})
+
+func (s *WebhookSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.requests = nil
+	s.responses = nil
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.AddCleanup(func(*gc.C) { s.server.Close() })
+}
+
+// handle records each request, and responds with the next queued
+// status code, or 200 once there are none left.
+func (s *WebhookSuite) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, webhookRequest{r.Header, body})
+	status := http.StatusOK
+	if len(s.responses) > 0 {
+		status, s.responses = s.responses[0], s.responses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (s *WebhookSuite) config() migrationmaster.WebhookConfig {
+	return migrationmaster.WebhookConfig{
+		URL:          s.server.URL,
+		Secret:       "sekrit",
+		Client:       http.DefaultClient,
+		Clock:        clock.WallClock,
+		Attempts:     3,
+		RetryDelay:   time.Millisecond,
+		MaxEventTime: time.Minute,
+	}
+}
+
+func (s *WebhookSuite) newWebhook(c *gc.C, config migrationmaster.WebhookConfig) *migrationmaster.Webhook {
+	webhook, err := migrationmaster.NewWebhook(config)
+	c.Assert(err, jc.ErrorIsNil)
+	return webhook
+}
+
+var testPhaseEvent = migrationmaster.PhaseEvent{
+	MigrationId:          "model-uuid:2",
+	ModelUUID:            "model-uuid",
+	Phase:                "ABORT",
+	PreviousPhase:        "IMPORT",
+	TargetController:     "controller-uuid",
+	TargetAddrs:          []string{"1.2.3.4:5"},
+	Time:                 time.Date(2017, 8, 1, 10, 0, 30, 0, time.UTC),
+	PreviousPhaseStarted: time.Date(2017, 8, 1, 10, 0, 0, 0, time.UTC),
+	PreviousPhaseSeconds: 30,
+	Error:                "model data transfer failed, boom",
+}
+
+func (s *WebhookSuite) TestValidate(c *gc.C) {
+	for i, test := range []struct {
+		tweak  func(*migrationmaster.WebhookConfig)
+		expect string
+	}{{
+		func(config *migrationmaster.WebhookConfig) { config.URL = "" },
+		"empty URL not valid",
+	}, {
+		func(config *migrationmaster.WebhookConfig) { config.Client = nil },
+		"nil Client not valid",
+	}, {
+		func(config *migrationmaster.WebhookConfig) { config.Clock = nil },
+		"nil Clock not valid",
+	}, {
+		func(config *migrationmaster.WebhookConfig) { config.Attempts = 0 },
+		"0 Attempts not valid",
+	}, {
+		func(config *migrationmaster.WebhookConfig) { config.RetryDelay = 0 },
+		"non-positive RetryDelay not valid",
+	}, {
+		func(config *migrationmaster.WebhookConfig) { config.MaxEventTime = 0 },
+		"non-positive MaxEventTime not valid",
+	}} {
+		c.Logf("test %d", i)
+		config := s.config()
+		test.tweak(&config)
+		_, err := migrationmaster.NewWebhook(config)
+		c.Check(err, gc.ErrorMatches, test.expect)
+	}
+}
+
+func (s *WebhookSuite) TestNotifyPhase(c *gc.C) {
+	webhook := s.newWebhook(c, s.config())
+	err := webhook.NotifyPhase(testPhaseEvent, nil)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(s.requests, gc.HasLen, 1)
+	req := s.requests[0]
+	c.Check(req.header.Get("Content-Type"), gc.Equals, "application/json")
+	c.Check(req.header.Get(migrationmaster.WebhookEventHeader), gc.Equals, "phase")
+	c.Check(req.header.Get(migrationmaster.WebhookSignatureHeader), gc.Equals,
+		"sha256="+migrationmaster.SignWebhookBody("sekrit", req.body))
+
+	var event migrationmaster.PhaseEvent
+	err = json.Unmarshal(req.body, &event)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(event, jc.DeepEquals, testPhaseEvent)
+}
+
+func (s *WebhookSuite) TestNotifyPhaseUnsigned(c *gc.C) {
+	config := s.config()
+	config.Secret = ""
+	webhook := s.newWebhook(c, config)
+	err := webhook.NotifyPhase(testPhaseEvent, nil)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(s.requests, gc.HasLen, 1)
+	c.Check(s.requests[0].header.Get(migrationmaster.WebhookSignatureHeader), gc.Equals, "")
+}
+
+func (s *WebhookSuite) TestSignWebhookBody(c *gc.C) {
+	// Test vector from RFC 4231, test case 2.
+	signature := migrationmaster.SignWebhookBody("Jefe", []byte("what do ya want for nothing?"))
+	c.Assert(signature, gc.Equals, "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843")
+}
+
+func (s *WebhookSuite) TestNotifyPhaseRetries(c *gc.C) {
+	s.responses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	webhook := s.newWebhook(c, s.config())
+	err := webhook.NotifyPhase(testPhaseEvent, nil)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(s.requests, gc.HasLen, 3)
+	c.Check(s.requests[2].body, jc.DeepEquals, s.requests[0].body)
+}
+
+func (s *WebhookSuite) TestNotifyPhaseGivesUp(c *gc.C) {
+	s.responses = []int{500, 500, 500, 500}
+	webhook := s.newWebhook(c, s.config())
+	err := webhook.NotifyPhase(testPhaseEvent, nil)
+	c.Assert(err, gc.ErrorMatches, `posting ABORT event \(attempt 3\): webhook responded 500 Internal Server Error`)
+	c.Assert(s.requests, gc.HasLen, 3)
+}
+
+func (s *WebhookSuite) TestNotifyPhaseClientErrorNotRetried(c *gc.C) {
+	s.responses = []int{http.StatusBadRequest}
+	webhook := s.newWebhook(c, s.config())
+	err := webhook.NotifyPhase(testPhaseEvent, nil)
+	c.Assert(err, gc.ErrorMatches, `posting ABORT event \(attempt 1\): webhook responded 400 Bad Request`)
+	c.Assert(s.requests, gc.HasLen, 1)
+}
+
+func (s *WebhookSuite) TestNotifyPhaseUnreachableRetried(c *gc.C) {
+	// Nothing is listening at the URL of a closed server.
+	closed := httptest.NewServer(http.HandlerFunc(s.handle))
+	closed.Close()
+	config := s.config()
+	config.URL = closed.URL
+	webhook := s.newWebhook(c, config)
+	err := webhook.NotifyPhase(testPhaseEvent, nil)
+	c.Assert(err, gc.ErrorMatches, `posting ABORT event \(attempt 3\): .*`)
+}
+
+func (s *WebhookSuite) TestNotifyPhaseAborted(c *gc.C) {
+	s.responses = []int{500}
+	config := s.config()
+	config.RetryDelay = time.Hour
+	webhook := s.newWebhook(c, config)
+
+	abort := make(chan struct{})
+	close(abort)
+	err := webhook.NotifyPhase(testPhaseEvent, abort)
+	c.Assert(err, gc.ErrorMatches, `posting ABORT event \(aborted\): webhook responded 500 Internal Server Error`)
+	c.Assert(s.requests, gc.HasLen, 1)
+}
+
+func (s *WebhookSuite) TestNotifyPhaseTimesOut(c *gc.C) {
+	// The endpoint never responds, so the request in progress is
+	// abandoned once the event has taken too long.
+	unresponsive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer unresponsive.Close()
+	config := s.config()
+	config.URL = unresponsive.URL
+	config.RetryDelay = time.Hour
+	config.MaxEventTime = 10 * time.Millisecond
+	webhook := s.newWebhook(c, config)
+
+	err := webhook.NotifyPhase(testPhaseEvent, nil)
+	c.Assert(err, gc.ErrorMatches, `posting ABORT event \(timed out\): .*`)
+}
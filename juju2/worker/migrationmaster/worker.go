@@ -4,14 +4,19 @@
 package migrationmaster
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
 	"github.com/juju/utils/clock"
+	"github.com/juju/utils/set"
 	"github.com/juju/version"
 	"gopkg.in/juju/charm.v6-unstable"
 	"gopkg.in/juju/names.v2"
@@ -20,6 +25,7 @@ import (
 	"github.com/juju/1.25-upgrade/juju2/api/common"
 	"github.com/juju/1.25-upgrade/juju2/api/migrationtarget"
 	"github.com/juju/1.25-upgrade/juju2/apiserver/params"
+	"github.com/juju/1.25-upgrade/juju2/controller"
 	coremigration "github.com/juju/1.25-upgrade/juju2/core/migration"
 	"github.com/juju/1.25-upgrade/juju2/migration"
 	"github.com/juju/1.25-upgrade/juju2/resource"
@@ -58,6 +64,10 @@ const (
 	// reports from minions and while it's transferring log messages
 	// to the newly-migrated model.
 	progressUpdateInterval = 30 * time.Second
+
+	// binaryUploadParallelism is the number of model binaries that
+	// are uploaded to the target controller at once.
+	binaryUploadParallelism = 4
 )
 
 // Facade exposes controller functionality to a Worker.
@@ -78,6 +88,11 @@ type Facade interface {
 	// progress of a migration.
 	SetStatusMessage(string) error
 
+	// AddImportProgress records steps of the IMPORT phase as
+	// completed, so that they are not repeated if the phase is
+	// resumed.
+	AddImportProgress(...string) error
+
 	// Prechecks performs pre-migration checks on the model and
 	// (source) controller.
 	Prechecks() error
@@ -92,6 +107,10 @@ type Facade interface {
 	// OpenResource downloads a single resource for an application.
 	OpenResource(string, string) (io.ReadCloser, error)
 
+	// OpenSerializedModel downloads the serialized model staged by
+	// Export.
+	OpenSerializedModel() (io.ReadCloser, error)
+
 	// Reap removes all documents of the model associated with the API
 	// connection.
 	Reap() error
@@ -107,8 +126,13 @@ type Facade interface {
 	// StreamModelLog takes a starting time and returns a channel that
 	// will yield the logs on or after that time - these are the logs
 	// that need to be transferred to the target after the migration
-	// is successful.
-	StreamModelLog(time.Time) (<-chan common.LogMessage, error)
+	// is successful. Only logs matching the level and entity limits
+	// of the log transfer options are yielded.
+	StreamModelLog(time.Time, coremigration.LogTransferOptions) (<-chan common.LogMessage, error)
+
+	// ControllerConfig returns the configuration of the (source)
+	// controller.
+	ControllerConfig() (controller.Config, error)
 }
 
 // Config defines the operation of a Worker.
@@ -121,6 +145,10 @@ type Config struct {
 	CharmDownloader migration.CharmDownloader
 	ToolsDownloader migration.ToolsDownloader
 	Clock           clock.Clock
+
+	// Webhook, if not nil, is notified each time the migration moves
+	// to a new phase.
+	Webhook PhaseNotifier
 }
 
 // Validate returns an error if config cannot drive a Worker.
@@ -185,6 +213,10 @@ type Worker struct {
 	catacomb catacomb.Catacomb
 	config   Config
 	logger   loggo.Logger
+
+	// lastError holds the last error status message set, to be
+	// reported to the webhook if the migration fails.
+	lastError string
 }
 
 // Kill implements worker.Worker.
@@ -211,6 +243,7 @@ func (w *Worker) run() error {
 	}
 
 	phase := status.Phase
+	phaseStarted := status.PhaseChangedTime
 
 	for {
 		var err error
@@ -218,13 +251,13 @@ func (w *Worker) run() error {
 		case coremigration.QUIESCE:
 			phase, err = w.doQUIESCE(status)
 		case coremigration.IMPORT:
-			phase, err = w.doIMPORT(status.TargetInfo, status.ModelUUID)
+			phase, err = w.doIMPORT(status)
 		case coremigration.VALIDATION:
 			phase, err = w.doVALIDATION(status)
 		case coremigration.SUCCESS:
 			phase, err = w.doSUCCESS(status)
 		case coremigration.LOGTRANSFER:
-			phase, err = w.doLOGTRANSFER(status.TargetInfo, status.ModelUUID)
+			phase, err = w.doLOGTRANSFER(status.TargetInfo, status.ModelUUID, status.LogTransfer)
 		case coremigration.REAP:
 			phase, err = w.doREAP()
 		case coremigration.ABORT:
@@ -250,6 +283,7 @@ func (w *Worker) run() error {
 		if err := w.config.Facade.SetPhase(phase); err != nil {
 			return errors.Annotate(err, "failed to set phase")
 		}
+		phaseStarted = w.notifyPhase(status, phase, phaseStarted)
 		status.Phase = phase
 
 		if modelHasMigrated(phase) {
@@ -276,6 +310,7 @@ func (w *Worker) setInfoStatus(s string, a ...interface{}) {
 }
 
 func (w *Worker) setErrorStatus(s string, a ...interface{}) {
+	w.lastError = fmt.Sprintf(s, a...)
 	w.setStatusAndLog(w.logger.Errorf, s, a...)
 }
 
@@ -295,6 +330,35 @@ func (w *Worker) setStatus(message string) error {
 	return errors.Annotate(err, "failed to set status message")
 }
 
+// notifyPhase reports the migration moving from status.Phase, which it
+// moved to at previousStarted, to the given phase, and returns when
+// that happened. A failure to notify the webhook is logged, but does
+// not affect the migration.
+func (w *Worker) notifyPhase(status coremigration.MigrationStatus, phase coremigration.Phase, previousStarted time.Time) time.Time {
+	now := w.config.Clock.Now()
+	if w.config.Webhook == nil {
+		return now
+	}
+	event := PhaseEvent{
+		MigrationId:          status.MigrationId,
+		ModelUUID:            status.ModelUUID,
+		Phase:                phase.String(),
+		PreviousPhase:        status.Phase.String(),
+		TargetController:     status.TargetInfo.ControllerTag.Id(),
+		TargetAddrs:          status.TargetInfo.Addrs,
+		Time:                 now.UTC(),
+		PreviousPhaseStarted: previousStarted.UTC(),
+		PreviousPhaseSeconds: now.Sub(previousStarted).Seconds(),
+	}
+	if phase == coremigration.ABORT || phase == coremigration.REAPFAILED {
+		event.Error = w.lastError
+	}
+	if err := w.config.Webhook.NotifyPhase(event, w.catacomb.Dying()); err != nil {
+		w.logger.Warningf("failed to notify migration webhook: %v", err)
+	}
+	return now
+}
+
 func (w *Worker) doQUIESCE(status coremigration.MigrationStatus) (coremigration.Phase, error) {
 	// Run prechecks before waiting for minions to report back. This
 	// short-circuits the long timeout in the case of an agent being
@@ -349,8 +413,8 @@ func (w *Worker) prechecks(status coremigration.MigrationStatus) error {
 	return errors.Annotate(err, "target prechecks failed")
 }
 
-func (w *Worker) doIMPORT(targetInfo coremigration.TargetInfo, modelUUID string) (coremigration.Phase, error) {
-	err := w.transferModel(targetInfo, modelUUID)
+func (w *Worker) doIMPORT(status coremigration.MigrationStatus) (coremigration.Phase, error) {
+	err := w.transferModel(status)
 	if err != nil {
 		w.setErrorStatus("model data transfer failed, %v", err)
 		return coremigration.ABORT, nil
@@ -388,39 +452,121 @@ func (w *uploadWrapper) SetUnitResource(unitName string, res resource.Resource)
 	return w.client.SetUnitResource(w.modelUUID, unitName, res)
 }
 
-func (w *Worker) transferModel(targetInfo coremigration.TargetInfo, modelUUID string) error {
+// streamModel downloads the serialized model staged by Export to a
+// temporary file, so that it is never held in memory, and streams it to
+// the target controller once it has been checked against the size and
+// hash reported by Export.
+func (w *Worker) streamModel(
+	targetClient *migrationtarget.Client,
+	modelUUID string,
+	serialized coremigration.SerializedModel,
+) error {
+	content, err := w.config.Facade.OpenSerializedModel()
+	if err != nil {
+		return errors.Annotate(err, "downloading model")
+	}
+	defer content.Close()
+
+	f, err := ioutil.TempFile("", "juju-migration-model")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		f.Close()
+		if err := os.Remove(f.Name()); err != nil {
+			w.logger.Errorf("cannot remove downloaded model: %v", err)
+		}
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), content)
+	if err != nil {
+		return errors.Annotate(err, "downloading model")
+	}
+	if size != serialized.Size {
+		return errors.Errorf("downloaded model has %d bytes, expected %d", size, serialized.Size)
+	}
+	if sum := fmt.Sprintf("%x", hash.Sum(nil)); sum != serialized.SHA256 {
+		return errors.Errorf("downloaded model has SHA256 %s, expected %s", sum, serialized.SHA256)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(targetClient.StreamModel(modelUUID, f))
+}
+
+// transferModel imports the model into the target controller and
+// uploads its binaries. Each step completed is recorded, so that if
+// the phase is resumed by a restarted worker, the model is not
+// imported again and binaries the target already has are skipped.
+func (w *Worker) transferModel(status coremigration.MigrationStatus) error {
+	modelUUID := status.ModelUUID
 	w.setInfoStatus("exporting model")
 	serialized, err := w.config.Facade.Export()
 	if err != nil {
 		return errors.Annotate(err, "model export failed")
 	}
 
-	w.setInfoStatus("importing model into target controller")
-	conn, err := w.openAPIConn(targetInfo)
+	conn, err := w.openAPIConn(status.TargetInfo)
 	if err != nil {
 		return errors.Annotate(err, "failed to connect to target controller")
 	}
 	defer conn.Close()
 	targetClient := migrationtarget.NewClient(conn)
-	err = targetClient.Import(serialized.Bytes)
-	if err != nil {
-		return errors.Annotate(err, "failed to import model into target controller")
+
+	completed := set.NewStrings(status.ImportProgress...)
+	if completed.Contains(coremigration.ImportModelStep) {
+		w.logger.Infof("model already imported into target controller")
+	} else {
+		w.setInfoStatus("importing model into target controller")
+		err = w.streamModel(targetClient, modelUUID, serialized)
+		if err != nil {
+			return errors.Annotate(err, "failed to import model into target controller")
+		}
+		if err := w.config.Facade.AddImportProgress(coremigration.ImportModelStep); err != nil {
+			return errors.Annotate(err, "failed to record import progress")
+		}
 	}
 
+	uploaded, err := targetClient.UploadedBinaries(modelUUID)
+	if params.IsCodeNotImplemented(err) {
+		// The target cannot say what it has, so upload everything.
+		uploaded = coremigration.UploadedBinaries{}
+	} else if err != nil {
+		return errors.Annotate(err, "failed to get binaries uploaded to target controller")
+	}
+
+	total := len(serialized.Charms) + len(serialized.Tools) + len(serialized.Resources)
+	done := 0
 	w.setInfoStatus("uploading model binaries into target controller")
 	wrapper := &uploadWrapper{targetClient, modelUUID}
 	err = w.config.UploadBinaries(migration.UploadBinariesConfig{
 		Charms:          serialized.Charms,
 		CharmDownloader: w.config.CharmDownloader,
 		CharmUploader:   wrapper,
+		CharmSHA256s:    serialized.CharmSHA256s,
 
 		Tools:           serialized.Tools,
 		ToolsDownloader: w.config.ToolsDownloader,
 		ToolsUploader:   wrapper,
+		ToolsSHA256s:    serialized.ToolsSHA256s,
 
 		Resources:          serialized.Resources,
 		ResourceDownloader: w.config.Facade,
 		ResourceUploader:   wrapper,
+
+		Uploaded:    uploaded,
+		Parallelism: binaryUploadParallelism,
+		Progress: func(kind, name string) {
+			done++
+			step := coremigration.BinaryImportStep(kind, name)
+			if err := w.config.Facade.AddImportProgress(step); err != nil {
+				// The target is asked what it has when the phase is
+				// resumed, so losing this only affects reporting.
+				w.logger.Errorf("failed to record import progress: %v", err)
+			}
+			w.setInfoStatus("uploading model binaries into target controller (%d of %d)", done, total)
+		},
 	})
 	return errors.Annotate(err, "failed to migrate binaries")
 }
@@ -486,22 +632,38 @@ func (w *Worker) transferResources(targetInfo coremigration.TargetInfo, modelUUI
 	return errors.Trace(err)
 }
 
-func (w *Worker) doLOGTRANSFER(targetInfo coremigration.TargetInfo, modelUUID string) (coremigration.Phase, error) {
-	err := w.transferLogs(targetInfo, modelUUID)
+func (w *Worker) doLOGTRANSFER(
+	targetInfo coremigration.TargetInfo,
+	modelUUID string,
+	opts coremigration.LogTransferOptions,
+) (coremigration.Phase, error) {
+	err := w.transferLogs(targetInfo, modelUUID, opts)
 	if err != nil {
 		return coremigration.UNKNOWN, errors.Trace(err)
 	}
 	return coremigration.REAP, nil
 }
 
-func (w *Worker) transferLogs(targetInfo coremigration.TargetInfo, modelUUID string) error {
+func (w *Worker) transferLogs(
+	targetInfo coremigration.TargetInfo,
+	modelUUID string,
+	opts coremigration.LogTransferOptions,
+) error {
 	sent := 0
+	var reached time.Time
 	reportProgress := func(finished bool, sent int) {
 		verb := "transferring"
 		if finished {
 			verb = "transferred"
 		}
-		w.setInfoStatus("successful, %s logs to target controller (%d sent)", verb, sent)
+		if reached.IsZero() {
+			w.setInfoStatus("successful, %s logs to target controller (%d sent)", verb, sent)
+		} else {
+			// Give the time of the latest record sent, so that the
+			// progress of a long transfer can be judged.
+			w.setInfoStatus("successful, %s logs to target controller (%d sent, reached %s)",
+				verb, sent, reached.UTC().Format(time.RFC3339))
+		}
 	}
 	reportProgress(false, sent)
 
@@ -521,10 +683,17 @@ func (w *Worker) transferLogs(targetInfo coremigration.TargetInfo, modelUUID str
 
 	throwWrench := latestLogTime == utcZero && wrench.IsActive("migrationmaster", "die-after-500-log-messages")
 
-	logSource, err := w.config.Facade.StreamModelLog(latestLogTime)
+	clk := w.config.Clock
+	startTime := opts.StartTime(latestLogTime, clk.Now())
+	if startTime != latestLogTime {
+		w.logger.Debugf("skipping logs older than %s", opts.MaxAge)
+	}
+	logSource, err := w.config.Facade.StreamModelLog(startTime, opts)
 	if err != nil {
 		return errors.Annotate(err, "opening source log stream")
 	}
+	throttle := coremigration.NewLogThrottle(opts)
+	throttled := opts.MaxRecordsPerSecond > 0 || opts.MaxBytesPerSecond > 0
 
 	logTarget, err := targetClient.OpenLogTransferStream(modelUUID)
 	if err != nil {
@@ -532,7 +701,6 @@ func (w *Worker) transferLogs(targetInfo coremigration.TargetInfo, modelUUID str
 	}
 	defer logTarget.Close()
 
-	clk := w.config.Clock
 	logProgress := clk.After(progressUpdateInterval)
 
 	for {
@@ -545,18 +713,24 @@ func (w *Worker) transferLogs(targetInfo coremigration.TargetInfo, modelUUID str
 				reportProgress(true, sent)
 				return nil
 			}
-			err := logTarget.WriteJSON(params.LogRecord{
+			record := params.LogRecord{
 				Entity:   msg.Entity,
 				Time:     msg.Timestamp,
 				Module:   msg.Module,
 				Location: msg.Location,
 				Level:    msg.Severity,
 				Message:  msg.Message,
-			})
-			if err != nil {
+			}
+			if throttled {
+				if err := w.throttleLogRecord(throttle, record); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			if err := logTarget.WriteJSON(record); err != nil {
 				return errors.Trace(err)
 			}
 			sent++
+			reached = msg.Timestamp
 
 			if throwWrench && sent == 500 {
 				// Simulate a connection drop to test restartability.
@@ -569,6 +743,26 @@ func (w *Worker) transferLogs(targetInfo coremigration.TargetInfo, modelUUID str
 	}
 }
 
+// throttleLogRecord waits until the record can be sent without
+// exceeding the log transfer rate limits.
+func (w *Worker) throttleLogRecord(throttle *coremigration.LogThrottle, record params.LogRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	clk := w.config.Clock
+	delay := throttle.Delay(len(data), clk.Now())
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-w.catacomb.Dying():
+		return w.catacomb.ErrDying()
+	case <-clk.After(delay):
+		return nil
+	}
+}
+
 func (w *Worker) doREAP() (coremigration.Phase, error) {
 	w.setInfoStatus("successful, removing model from source controller")
 	err := w.config.Facade.Reap()
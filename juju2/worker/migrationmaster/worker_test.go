@@ -4,6 +4,12 @@
 package migrationmaster_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/textproto"
 	"net/url"
@@ -11,6 +17,7 @@ import (
 	"time"
 
 	"github.com/juju/errors"
+	"github.com/juju/httprequest"
 	"github.com/juju/loggo"
 	jujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
@@ -83,10 +90,23 @@ var (
 			migration.ControllerDialOpts(),
 		},
 	}
-	importCall = jujutesting.StubCall{
-		"MigrationTarget.Import",
+	importCalls = []jujutesting.StubCall{
+		{"facade.OpenSerializedModel", nil},
+		{"GET /migrate/model", []interface{}{"", ""}},
+		{"PUT /migrate/model", []interface{}{"offset=0", string(fakeModelBytes)}},
+		{"POST /migrate/model", []interface{}{
+			fmt.Sprintf("sha256=%x&size=%d", sha256.Sum256(fakeModelBytes), len(fakeModelBytes)),
+			"",
+		}},
+	}
+	addModelProgressCall = jujutesting.StubCall{
+		"facade.AddImportProgress",
+		[]interface{}{[]string{coremigration.ImportModelStep}},
+	}
+	uploadedBinariesCall = jujutesting.StubCall{
+		"MigrationTarget.UploadedBinaries",
 		[]interface{}{
-			params.SerializedModel{Bytes: fakeModelBytes},
+			params.ModelArgs{ModelTag: modelTag.String()},
 		},
 	}
 	activateCall = jujutesting.StubCall{
@@ -235,16 +255,29 @@ func (s *Suite) TestSuccessfulMigration(c *gc.C) {
 			//IMPORT
 			{"facade.Export", nil},
 			apiOpenControllerCall,
-			importCall,
+		},
+		importCalls,
+		[]jujutesting.StubCall{
+			addModelProgressCall,
+			uploadedBinariesCall,
 			{"UploadBinaries", []interface{}{
 				[]string{"charm0", "charm1"},
 				fakeCharmDownloader,
+				map[string]string{"charm0": "sha0", "charm1": "sha1"},
 				map[version.Binary]string{
 					version.MustParseBinary("2.1.0-trusty-amd64"): "/tools/0",
 				},
 				fakeToolsDownloader,
+				map[version.Binary]string{
+					version.MustParseBinary("2.1.0-trusty-amd64"): "tools-sha",
+				},
 				s.facade.exportedResources,
 				s.facade,
+				coremigration.UploadedBinaries{
+					Charms:    map[string]string{"charm0": "sha0"},
+					Tools:     map[version.Binary]string{},
+					Resources: map[string]string{},
+				},
 			}},
 			apiCloseCall, // for target controller
 			{"facade.SetPhase", []interface{}{coremigration.VALIDATION}},
@@ -268,7 +301,7 @@ func (s *Suite) TestSuccessfulMigration(c *gc.C) {
 			// LOGTRANSFER
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 			{"facade.SetPhase", []interface{}{coremigration.REAP}},
 
@@ -296,7 +329,7 @@ func (s *Suite) TestMigrationResume(c *gc.C) {
 			{"facade.SetPhase", []interface{}{coremigration.LOGTRANSFER}},
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 			{"facade.SetPhase", []interface{}{coremigration.REAP}},
 			{"facade.Reap", nil},
@@ -482,6 +515,47 @@ func (s *Suite) TestExportFailure(c *gc.C) {
 	))
 }
 
+func (s *Suite) TestPhasesNotified(c *gc.C) {
+	s.facade.queueStatus(s.makeStatus(coremigration.IMPORT))
+	s.facade.exportErr = errors.New("boom")
+	webhook := &stubPhaseNotifier{stub: s.stub, err: errors.New("unreachable")}
+	s.config.Webhook = webhook
+
+	s.checkWorkerReturns(c, migrationmaster.ErrInactive)
+	s.stub.CheckCallNames(c,
+		"facade.Watch",
+		"facade.MigrationStatus",
+		"guard.Lockdown",
+		"facade.Export",
+		"facade.SetPhase",
+		"NotifyPhase",
+		"apiOpen",
+		"MigrationTarget.Abort",
+		"Connection.Close",
+		"facade.SetPhase",
+		"NotifyPhase",
+	)
+
+	now := s.clock.Now().UTC()
+	expected := migrationmaster.PhaseEvent{
+		MigrationId:          "model-uuid:2",
+		ModelUUID:            "model-uuid",
+		Phase:                "ABORT",
+		PreviousPhase:        "IMPORT",
+		TargetController:     targetControllerTag.Id(),
+		TargetAddrs:          []string{"1.2.3.4:5"},
+		Time:                 now,
+		PreviousPhaseStarted: now,
+		Error:                "model data transfer failed, model export failed: boom",
+	}
+	c.Check(webhook.events, gc.HasLen, 2)
+	c.Check(webhook.events[0], jc.DeepEquals, expected)
+	expected.Phase = "ABORTDONE"
+	expected.PreviousPhase = "ABORT"
+	expected.Error = ""
+	c.Check(webhook.events[1], jc.DeepEquals, expected)
+}
+
 func (s *Suite) TestAPIOpenFailure(c *gc.C) {
 	s.facade.queueStatus(s.makeStatus(coremigration.IMPORT))
 	s.connectionErr = errors.New("boom")
@@ -509,7 +583,84 @@ func (s *Suite) TestImportFailure(c *gc.C) {
 		[]jujutesting.StubCall{
 			{"facade.Export", nil},
 			apiOpenControllerCall,
-			importCall,
+		},
+		importCalls,
+		[]jujutesting.StubCall{
+			apiCloseCall,
+		},
+		abortCalls,
+	))
+}
+
+func (s *Suite) TestIMPORTDownloadedModelMismatch(c *gc.C) {
+	s.facade.queueStatus(s.makeStatus(coremigration.IMPORT))
+	s.facade.serializedModel = []byte("mode")
+
+	s.checkWorkerReturns(c, migrationmaster.ErrInactive)
+	s.stub.CheckCalls(c, joinCalls(
+		watchStatusLockdownCalls,
+		[]jujutesting.StubCall{
+			{"facade.Export", nil},
+			apiOpenControllerCall,
+			// The truncated model is not sent to the target.
+			{"facade.OpenSerializedModel", nil},
+			apiCloseCall,
+		},
+		abortCalls,
+	))
+}
+
+func (s *Suite) TestIMPORTResumedAfterModelImport(c *gc.C) {
+	status := s.makeStatus(coremigration.IMPORT)
+	status.ImportProgress = []string{coremigration.ImportModelStep}
+	s.facade.queueStatus(status)
+	s.config.UploadBinaries = func(config migration.UploadBinariesConfig) error {
+		s.stub.AddCall("UploadBinaries", config.Uploaded)
+		return errors.New("boom")
+	}
+
+	s.checkWorkerReturns(c, migrationmaster.ErrInactive)
+	s.stub.CheckCalls(c, joinCalls(
+		watchStatusLockdownCalls,
+		[]jujutesting.StubCall{
+			// The model is not streamed to the target again.
+			{"facade.Export", nil},
+			apiOpenControllerCall,
+			uploadedBinariesCall,
+			{"UploadBinaries", []interface{}{coremigration.UploadedBinaries{
+				Charms:    map[string]string{"charm0": "sha0"},
+				Tools:     map[version.Binary]string{},
+				Resources: map[string]string{},
+			}}},
+			apiCloseCall,
+		},
+		abortCalls,
+	))
+}
+
+func (s *Suite) TestIMPORTRecordsBinaryProgress(c *gc.C) {
+	s.facade.queueStatus(s.makeStatus(coremigration.IMPORT))
+	s.connection.uploadedErr = &params.Error{Code: params.CodeNotImplemented}
+	s.config.UploadBinaries = func(config migration.UploadBinariesConfig) error {
+		s.stub.AddCall("UploadBinaries", config.Uploaded)
+		config.Progress("charm", "charm0")
+		return errors.New("boom")
+	}
+
+	s.checkWorkerReturns(c, migrationmaster.ErrInactive)
+	s.stub.CheckCalls(c, joinCalls(
+		watchStatusLockdownCalls,
+		[]jujutesting.StubCall{
+			{"facade.Export", nil},
+			apiOpenControllerCall,
+		},
+		importCalls,
+		[]jujutesting.StubCall{
+			addModelProgressCall,
+			uploadedBinariesCall,
+			// The target can't say what it has, so nothing is skipped.
+			{"UploadBinaries", []interface{}{coremigration.UploadedBinaries{}}},
+			{"facade.AddImportProgress", []interface{}{[]string{"charm charm0"}}},
 			apiCloseCall,
 		},
 		abortCalls,
@@ -573,7 +724,7 @@ func (s *Suite) TestSUCCESSMinionWaitFailedMachine(c *gc.C) {
 			{"facade.SetPhase", []interface{}{coremigration.LOGTRANSFER}},
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 			{"facade.SetPhase", []interface{}{coremigration.REAP}},
 			{"facade.Reap", nil},
@@ -603,7 +754,7 @@ func (s *Suite) TestSUCCESSMinionWaitFailedUnit(c *gc.C) {
 			{"facade.SetPhase", []interface{}{coremigration.LOGTRANSFER}},
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 			{"facade.SetPhase", []interface{}{coremigration.REAP}},
 			{"facade.Reap", nil},
@@ -644,7 +795,7 @@ func (s *Suite) TestSUCCESSMinionWaitTimeout(c *gc.C) {
 			{"facade.SetPhase", []interface{}{coremigration.LOGTRANSFER}},
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 			{"facade.SetPhase", []interface{}{coremigration.REAP}},
 			{"facade.Reap", nil},
@@ -754,7 +905,7 @@ func (s *Suite) TestLogTransferErrorOpeningLogSource(c *gc.C) {
 		[]jujutesting.StubCall{
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 		},
 	))
 }
@@ -769,7 +920,7 @@ func (s *Suite) TestLogTransferErrorOpeningLogDest(c *gc.C) {
 		[]jujutesting.StubCall{
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 		},
 	))
@@ -787,7 +938,7 @@ func (s *Suite) TestLogTransferErrorWriting(c *gc.C) {
 		[]jujutesting.StubCall{
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 		},
 	))
@@ -822,7 +973,7 @@ func (s *Suite) TestLogTransferSendsRecords(c *gc.C) {
 		[]jujutesting.StubCall{
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{time.Time{}}},
+			{"StreamModelLog", []interface{}{time.Time{}, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 			{"facade.SetPhase", []interface{}{coremigration.REAP}},
 			{"facade.Reap", nil},
@@ -888,7 +1039,7 @@ func (s *Suite) TestLogTransfer_ChecksLatestTime(c *gc.C) {
 		[]jujutesting.StubCall{
 			apiOpenControllerCall,
 			latestLogTimeCall,
-			{"StreamModelLog", []interface{}{t}},
+			{"StreamModelLog", []interface{}{t, coremigration.LogTransferOptions{}}},
 			openDestLogStreamCall,
 			{"facade.SetPhase", []interface{}{coremigration.REAP}},
 			{"facade.Reap", nil},
@@ -897,6 +1048,69 @@ func (s *Suite) TestLogTransfer_ChecksLatestTime(c *gc.C) {
 	))
 }
 
+func (s *Suite) TestLogTransferOptions(c *gc.C) {
+	status := s.makeStatus(coremigration.LOGTRANSFER)
+	status.LogTransfer = coremigration.LogTransferOptions{
+		MaxAge:          time.Hour,
+		Level:           loggo.WARNING,
+		ExcludeEntities: []string{"unit-noisy-*"},
+	}
+	s.facade.queueStatus(status)
+
+	s.checkWorkerReturns(c, migrationmaster.ErrMigrated)
+	s.stub.CheckCalls(c, joinCalls(
+		watchStatusLockdownCalls,
+		[]jujutesting.StubCall{
+			apiOpenControllerCall,
+			latestLogTimeCall,
+			{"StreamModelLog", []interface{}{s.clock.Now().Add(-time.Hour), status.LogTransfer}},
+			openDestLogStreamCall,
+			{"facade.SetPhase", []interface{}{coremigration.REAP}},
+			{"facade.Reap", nil},
+			{"facade.SetPhase", []interface{}{coremigration.DONE}},
+		},
+	))
+}
+
+func (s *Suite) TestLogTransferThrottled(c *gc.C) {
+	status := s.makeStatus(coremigration.LOGTRANSFER)
+	status.LogTransfer = coremigration.LogTransferOptions{
+		MaxRecordsPerSecond: 1,
+	}
+	s.facade.queueStatus(status)
+	t0 := time.Date(2016, 12, 2, 10, 39, 10, 0, time.UTC)
+	messages := []common.LogMessage{
+		{Message: "lightning bolt", Timestamp: t0},
+		{Message: "hella", Timestamp: t0.Add(time.Minute)},
+		{Message: "battles", Timestamp: t0.Add(2 * time.Minute)},
+	}
+	s.facade.logMessages = func(d chan<- common.LogMessage) {
+		safeSend(c, d, messages[0])
+		for _, message := range messages[1:] {
+			safeSend(c, d, message)
+			// The worker waits a second before sending each record
+			// after the first, as well as for the next progress
+			// update.
+			err := s.clock.WaitAdvance(time.Second, coretesting.LongWait, 2)
+			c.Assert(err, jc.ErrorIsNil)
+		}
+	}
+
+	var logWriter loggo.TestWriter
+	c.Assert(loggo.RegisterWriter("migrationmaster-tests", &logWriter), jc.ErrorIsNil)
+	defer func() {
+		loggo.RemoveWriter("migrationmaster-tests")
+		logWriter.Clear()
+	}()
+
+	s.checkWorkerReturns(c, migrationmaster.ErrMigrated)
+	c.Assert(s.connection.logStream.written, gc.HasLen, 3)
+	c.Assert(logWriter.Log()[:2], jc.LogMatches, []string{
+		"successful, transferring logs to target controller \\(0 sent\\)",
+		"successful, transferred logs to target controller \\(3 sent, reached 2016-12-02T10:41:10Z\\)",
+	})
+}
+
 func safeSend(c *gc.C, d chan<- common.LogMessage, message common.LogMessage) {
 	select {
 	case d <- message:
@@ -1012,6 +1226,7 @@ type stubMasterFacade struct {
 	minionReportsErr      error
 
 	exportedResources []coremigration.SerializedModelResource
+	serializedModel   []byte
 }
 
 func (f *stubMasterFacade) triggerWatcher() {
@@ -1107,15 +1322,29 @@ func (f *stubMasterFacade) Export() (coremigration.SerializedModel, error) {
 		return coremigration.SerializedModel{}, f.exportErr
 	}
 	return coremigration.SerializedModel{
-		Bytes:  fakeModelBytes,
+		Size:   int64(len(fakeModelBytes)),
+		SHA256: fmt.Sprintf("%x", sha256.Sum256(fakeModelBytes)),
 		Charms: []string{"charm0", "charm1"},
 		Tools: map[version.Binary]string{
 			version.MustParseBinary("2.1.0-trusty-amd64"): "/tools/0",
 		},
-		Resources: f.exportedResources,
+		Resources:    f.exportedResources,
+		CharmSHA256s: map[string]string{"charm0": "sha0", "charm1": "sha1"},
+		ToolsSHA256s: map[version.Binary]string{
+			version.MustParseBinary("2.1.0-trusty-amd64"): "tools-sha",
+		},
 	}, nil
 }
 
+func (f *stubMasterFacade) OpenSerializedModel() (io.ReadCloser, error) {
+	f.stub.AddCall("facade.OpenSerializedModel")
+	serialized := f.serializedModel
+	if serialized == nil {
+		serialized = fakeModelBytes
+	}
+	return ioutil.NopCloser(bytes.NewReader(serialized)), nil
+}
+
 func (f *stubMasterFacade) SetPhase(phase coremigration.Phase) error {
 	f.stub.AddCall("facade.SetPhase", phase)
 	return nil
@@ -1125,13 +1354,18 @@ func (f *stubMasterFacade) SetStatusMessage(message string) error {
 	return nil
 }
 
+func (f *stubMasterFacade) AddImportProgress(steps ...string) error {
+	f.stub.AddCall("facade.AddImportProgress", steps)
+	return nil
+}
+
 func (f *stubMasterFacade) Reap() error {
 	f.stub.AddCall("facade.Reap")
 	return nil
 }
 
-func (f *stubMasterFacade) StreamModelLog(start time.Time) (<-chan common.LogMessage, error) {
-	f.stub.AddCall("StreamModelLog", start)
+func (f *stubMasterFacade) StreamModelLog(start time.Time, opts coremigration.LogTransferOptions) (<-chan common.LogMessage, error) {
+	f.stub.AddCall("StreamModelLog", start, opts)
 	if f.streamErr != nil {
 		return nil, f.streamErr
 	}
@@ -1175,23 +1409,32 @@ type stubConnection struct {
 
 	latestLogErr  error
 	latestLogTime time.Time
+
+	uploadedErr error
 }
 
 func (c *stubConnection) BestFacadeVersion(string) int {
-	return 1
+	return 2
 }
 
-func (c *stubConnection) APICall(objType string, version int, id, request string, params, response interface{}) error {
-	c.stub.AddCall(objType+"."+request, params)
+func (c *stubConnection) APICall(objType string, version int, id, request string, args, response interface{}) error {
+	c.stub.AddCall(objType+"."+request, args)
 
 	if objType == "MigrationTarget" {
 		switch request {
 		case "Prechecks":
 			return c.prechecksErr
-		case "Import":
-			return c.importErr
 		case "Activate", "AdoptResources":
 			return nil
+		case "UploadedBinaries":
+			if c.uploadedErr != nil {
+				return c.uploadedErr
+			}
+			*(response.(*params.UploadedMigrationBinaries)) = params.UploadedMigrationBinaries{
+				Charms:    map[string]string{"charm0": "sha0"},
+				Resources: map[string]string{},
+			}
+			return nil
 		case "LatestLogTime":
 			responseTime := response.(*time.Time)
 			// This is needed because even if a zero time comes back
@@ -1203,6 +1446,45 @@ func (c *stubConnection) APICall(objType string, version int, id, request string
 	return errors.New("unexpected API call")
 }
 
+func (c *stubConnection) HTTPClient() (*httprequest.Client, error) {
+	return &httprequest.Client{Doer: c}, nil
+}
+
+// Do handles the requests made to stream the model to the target
+// controller, which stages each chunk sent.
+func (c *stubConnection) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.stub.AddCall(req.Method+" "+req.URL.Path, req.URL.RawQuery, string(body))
+
+	var staged params.StagedModel
+	switch req.Method {
+	case "PUT":
+		staged.Size = int64(len(body))
+	case "POST":
+		if c.importErr != nil {
+			return nil, c.importErr
+		}
+	}
+	respBody, err := json.Marshal(staged)
+	if err != nil {
+		return nil, err
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(respBody)),
+		Header:     make(http.Header),
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	return resp, nil
+}
+
 func (c *stubConnection) Client() *api.Client {
 	// This is kinda crappy but the *Client doesn't have to be
 	// functional...
@@ -1226,16 +1508,33 @@ func (c *stubConnection) ConnectControllerStream(path string, attrs url.Values,
 	return c.logStream, nil
 }
 
+// stubPhaseNotifier records the events it is notified of. Failing to
+// notify does not affect the migration.
+type stubPhaseNotifier struct {
+	stub   *jujutesting.Stub
+	err    error
+	events []migrationmaster.PhaseEvent
+}
+
+func (n *stubPhaseNotifier) NotifyPhase(event migrationmaster.PhaseEvent, abort <-chan struct{}) error {
+	n.stub.AddCall("NotifyPhase")
+	n.events = append(n.events, event)
+	return n.err
+}
+
 func makeStubUploadBinaries(stub *jujutesting.Stub) func(migration.UploadBinariesConfig) error {
 	return func(config migration.UploadBinariesConfig) error {
 		stub.AddCall(
 			"UploadBinaries",
 			config.Charms,
 			config.CharmDownloader,
+			config.CharmSHA256s,
 			config.Tools,
 			config.ToolsDownloader,
+			config.ToolsSHA256s,
 			config.Resources,
 			config.ResourceDownloader,
+			config.Uploaded,
 		)
 		return nil
 	}